@@ -0,0 +1,281 @@
+// Package account exports users' data and deletes their accounts.
+//
+// Deleting an account takes two steps. Asking for it only marks the user,
+// which hides their profile and content from everyone else, and they can
+// change their mind until the grace period ends. After that a purge job
+// deletes them for good, along with their calls and responses through the
+// database's cascades, and clears what Redis holds about them.
+package account
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"github.com/pageza/vet-app/rbac"
+	"github.com/pageza/vet-app/repository"
+	"github.com/pageza/vet-app/session"
+	"github.com/pageza/vet-app/token"
+)
+
+// purgeBatch is how many users Purge loads at a time.
+const purgeBatch = 100
+
+// Archive is everything stored about a user.
+type Archive struct {
+	ExportedAt time.Time         `json:"exported_at"`
+	User       *models.User      `json:"user"`
+	Roles      []string          `json:"roles"`
+	Sessions   []session.Session `json:"sessions"`
+	Calls      []CallExport      `json:"calls"`
+	Responses  []models.Response `json:"responses"`
+	// VolunteerProfile is nil if the user has none.
+	VolunteerProfile *VolunteerProfileExport `json:"volunteer_profile"`
+}
+
+// CallExport is one of the user's calls in an archive, with what the API
+// serves apart from the call itself. Location is nil if the call does not
+// say where it is.
+type CallExport struct {
+	models.Call
+	Category *models.Category          `json:"category"`
+	Tags     []string                  `json:"tags"`
+	Location *LocationExport           `json:"location"`
+	History  []models.CallStatusChange `json:"history"`
+}
+
+// LocationExport is where a call is, along with where it is shown to the
+// public.
+type LocationExport struct {
+	Lat       *float64 `json:"lat"`
+	Lng       *float64 `json:"lng"`
+	PublicLat *float64 `json:"public_lat"`
+	PublicLng *float64 `json:"public_lng"`
+	ZIP       string   `json:"zip,omitempty"`
+}
+
+// VolunteerProfileExport is the user's volunteer profile in an archive.
+// ServiceArea is nil if they take calls from anywhere.
+type VolunteerProfileExport struct {
+	models.VolunteerProfile
+	ServiceArea *ServiceAreaExport `json:"service_area"`
+}
+
+// ServiceAreaExport is the area a volunteer takes calls from.
+type ServiceAreaExport struct {
+	Lat    float64 `json:"lat"`
+	Lng    float64 `json:"lng"`
+	Radius float64 `json:"radius"`
+}
+
+// Service exports and deletes accounts.
+type Service struct {
+	users      repository.UserRepository
+	calls      repository.CallRepository
+	responses  repository.ResponseRepository
+	volunteers repository.VolunteerRepository
+	sessions   *session.Store
+	tokens     *token.Service
+	authz      *rbac.Authorizer
+	grace      time.Duration
+	now        func() time.Time
+}
+
+// NewService returns a Service that purges accounts grace after their
+// deletion was requested, revoking their sessions and tokens and dropping
+// their cached roles from authz.
+func NewService(repos repository.Repositories, sessions *session.Store, tokens *token.Service, authz *rbac.Authorizer, grace time.Duration) *Service {
+	return &Service{
+		users:      repos.Users,
+		calls:      repos.Calls,
+		responses:  repos.Responses,
+		volunteers: repos.Volunteers,
+		sessions:   sessions,
+		tokens:     tokens,
+		authz:      authz,
+		grace:      grace,
+		now:        time.Now,
+	}
+}
+
+// Export collects everything stored about user, including their hidden
+// responses. Responses by others to user's calls belong to those users and
+// are left out.
+func (s *Service) Export(ctx context.Context, user *models.User) (*Archive, error) {
+	roles, err := s.authz.Roles(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.sessions.List(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	calls, err := all(func(page pagination.Params) ([]models.Call, error) {
+		return s.calls.List(ctx, repository.CallFilter{UserID: user.ID}, page)
+	}, func(c models.Call) uint { return c.ID })
+	if err != nil {
+		return nil, err
+	}
+	exports := make([]CallExport, len(calls))
+	for i, call := range calls {
+		history, err := s.calls.History(ctx, call.ID)
+		if err != nil {
+			return nil, err
+		}
+		if history == nil {
+			history = []models.CallStatusChange{}
+		}
+		exports[i] = CallExport{Call: call, Category: call.Category, Tags: []string{}, History: history}
+		for _, tag := range call.Tags {
+			exports[i].Tags = append(exports[i].Tags, tag.Name)
+		}
+		if call.Latitude != nil || call.ZIP != "" {
+			exports[i].Location = &LocationExport{
+				Lat:       call.Latitude,
+				Lng:       call.Longitude,
+				PublicLat: call.PublicLatitude,
+				PublicLng: call.PublicLongitude,
+				ZIP:       call.ZIP,
+			}
+		}
+	}
+	responses, err := all(func(page pagination.Params) ([]models.Response, error) {
+		return s.responses.List(ctx, repository.ResponseFilter{UserID: user.ID}, page)
+	}, func(r models.Response) uint { return r.ID })
+	if err != nil {
+		return nil, err
+	}
+	var volunteer *VolunteerProfileExport
+	profile, err := s.volunteers.Get(ctx, user.ID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+	case err != nil:
+		return nil, err
+	default:
+		volunteer = &VolunteerProfileExport{VolunteerProfile: *profile}
+		if area := profile.ServiceArea(); area != nil {
+			volunteer.ServiceArea = &ServiceAreaExport{Lat: area.Center.Lat, Lng: area.Center.Lng, Radius: area.Radius}
+		}
+	}
+	if sessions == nil {
+		sessions = []session.Session{}
+	}
+	return &Archive{
+		ExportedAt:       s.now(),
+		User:             user,
+		Roles:            roles,
+		Sessions:         sessions,
+		Calls:            exports,
+		Responses:        responses,
+		VolunteerProfile: volunteer,
+	}, nil
+}
+
+// PurgeAt returns when user will be purged if they do not cancel, or nil if
+// they have not asked for their account to be deleted.
+func (s *Service) PurgeAt(user *models.User) *time.Time {
+	if !user.DeletionRequested() {
+		return nil
+	}
+	at := user.DeletionRequestedAt.Add(s.grace)
+	return &at
+}
+
+// RequestDeletion schedules user's account for deletion. Asking again keeps
+// the original schedule.
+func (s *Service) RequestDeletion(ctx context.Context, user *models.User) error {
+	if user.DeletionRequested() {
+		return nil
+	}
+	now := s.now()
+	user.DeletionRequestedAt = &now
+	return s.users.Update(ctx, user)
+}
+
+// CancelDeletion keeps user's account after all.
+func (s *Service) CancelDeletion(ctx context.Context, user *models.User) error {
+	if !user.DeletionRequested() {
+		return nil
+	}
+	user.DeletionRequestedAt = nil
+	return s.users.Update(ctx, user)
+}
+
+// Delete deletes a user for good, logging them out everywhere first.
+func (s *Service) Delete(ctx context.Context, userID uint) error {
+	if _, err := s.sessions.DeleteUser(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.tokens.RevokeUser(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.authz.ForgetUser(ctx, userID); err != nil {
+		return err
+	}
+	return s.users.Delete(ctx, userID)
+}
+
+// Purge deletes every user whose grace period has ended and returns how
+// many there were.
+func (s *Service) Purge(ctx context.Context) (int, error) {
+	before := s.now().Add(-s.grace)
+	filter := repository.UserFilter{DeletionRequestedBefore: &before}
+	page := pagination.Params{Limit: purgeBatch, Sort: pagination.SortID}
+	purged := 0
+	for {
+		users, err := s.users.List(ctx, filter, page)
+		if err != nil {
+			return purged, err
+		}
+		for _, user := range users {
+			// Another instance may have purged the user already.
+			if err := s.Delete(ctx, user.ID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+				return purged, err
+			}
+			purged++
+		}
+		if len(users) <= purgeBatch {
+			return purged, nil
+		}
+	}
+}
+
+// RunPurge purges accounts now and then every interval until ctx is done.
+func (s *Service) RunPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		switch purged, err := s.Purge(ctx); {
+		case err != nil:
+			log.Printf("account: purging deleted accounts: %v", err)
+		case purged > 0:
+			log.Printf("account: purged %d deleted accounts", purged)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// all collects every item list returns, a page at a time in ID order.
+func all[T any](list func(pagination.Params) ([]T, error), id func(T) uint) ([]T, error) {
+	page := pagination.Params{Limit: pagination.MaxLimit, Sort: pagination.SortID}
+	items := []T{}
+	for {
+		batch, err := list(page)
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) <= page.Limit {
+			return append(items, batch...), nil
+		}
+		batch = batch[:page.Limit]
+		items = append(items, batch...)
+		page.After = &pagination.Cursor{Sort: pagination.SortID, ID: id(batch[len(batch)-1])}
+	}
+}
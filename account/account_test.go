@@ -0,0 +1,143 @@
+package account
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/pageza/vet-app/config"
+	"github.com/pageza/vet-app/geo"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"github.com/pageza/vet-app/rbac"
+	"github.com/pageza/vet-app/repository"
+	"github.com/pageza/vet-app/session"
+	"github.com/pageza/vet-app/token"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+const grace = 30 * 24 * time.Hour
+
+func setup(t *testing.T) (*Service, repository.Repositories, *session.Store, *token.Service) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	repos := repository.NewMemory()
+	sessions := session.NewStore(client, config.SessionConfig{CookieName: "session", IdleTimeout: time.Hour, MaxLifetime: 24 * time.Hour})
+	keys, err := token.GenerateKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := token.NewService(keys, client, config.TokenConfig{Issuer: "vet-app", AccessTTL: time.Minute, RefreshTTL: time.Hour})
+	authz := rbac.NewAuthorizer(repos.Roles, client, time.Minute)
+	return NewService(repos, sessions, tokens, authz, grace), repos, sessions, tokens
+}
+
+func createUser(t *testing.T, repos repository.Repositories, name, email string) *models.User {
+	user := &models.User{Name: name, Email: email}
+	assert.NoError(t, repos.Users.Create(ctx, user))
+	return user
+}
+
+func TestExport(t *testing.T) {
+	s, repos, sessions, _ := setup(t)
+	user := createUser(t, repos, "John Doe", "john@example.com")
+	other := createUser(t, repos, "Jane Doe", "jane@example.com")
+	transportation, err := repos.Categories.Get(ctx, "transportation")
+	assert.NoError(t, err)
+	call := models.Call{UserID: user.ID, Desc: "Need a ride", CategoryID: &transportation.ID, Tags: []models.Tag{{Name: "va-hospital"}}, ZIP: "20500"}
+	call.SetLocation(&geo.Point{Lat: 38.8977, Lng: -77.0365}, &geo.Point{Lat: 38.9, Lng: -77.04})
+	assert.NoError(t, repos.Calls.Create(ctx, &call))
+	call.Status = models.CallStatusClosed
+	assert.NoError(t, repos.Calls.Transition(ctx, &call, &models.CallStatusChange{CallID: call.ID, UserID: &user.ID, FromStatus: models.CallStatusOpen, ToStatus: models.CallStatusClosed, Note: "Found one"}))
+	assert.NoError(t, repos.Responses.Create(ctx, &models.Response{CallID: call.ID, UserID: user.ID, Msg: "Still need it"}))
+	assert.NoError(t, repos.Responses.Create(ctx, &models.Response{CallID: call.ID, UserID: other.ID, Msg: "On my way"}))
+	_, err = sessions.Create(ctx, user.ID, "Firefox", "192.0.2.1")
+	assert.NoError(t, err)
+
+	archive, err := s.Export(ctx, user)
+	assert.NoError(t, err)
+	assert.Nil(t, archive.VolunteerProfile)
+	profile := models.VolunteerProfile{UserID: user.ID, Skills: models.Words{"rides"}}
+	profile.SetServiceArea(&geo.Circle{Center: geo.Point{Lat: 38.8977, Lng: -77.0365}, Radius: 10})
+	assert.NoError(t, repos.Volunteers.Save(ctx, &profile))
+
+	archive, err = s.Export(ctx, user)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, archive.User.ID)
+	assert.Equal(t, models.Words{"rides"}, archive.VolunteerProfile.Skills)
+	assert.Equal(t, &ServiceAreaExport{Lat: 38.8977, Lng: -77.0365, Radius: 10}, archive.VolunteerProfile.ServiceArea)
+	assert.Equal(t, []string{models.RoleVolunteer}, archive.Roles)
+	assert.Len(t, archive.Sessions, 1)
+	if assert.Len(t, archive.Calls, 1) && assert.Len(t, archive.Calls[0].History, 1) {
+		assert.Equal(t, models.CallStatusClosed, archive.Calls[0].Status)
+		assert.Equal(t, "Found one", archive.Calls[0].History[0].Note)
+		assert.Equal(t, "transportation", archive.Calls[0].Category.Slug)
+		assert.Equal(t, []string{"va-hospital"}, archive.Calls[0].Tags)
+		lat, publicLat := 38.8977, 38.9
+		assert.Equal(t, &lat, archive.Calls[0].Location.Lat)
+		assert.Equal(t, &publicLat, archive.Calls[0].Location.PublicLat)
+		assert.Equal(t, "20500", archive.Calls[0].Location.ZIP)
+	}
+	if assert.Len(t, archive.Responses, 1) {
+		assert.Equal(t, "Still need it", archive.Responses[0].Msg)
+	}
+}
+
+func TestExportPages(t *testing.T) {
+	s, repos, _, _ := setup(t)
+	user := createUser(t, repos, "John Doe", "john@example.com")
+	for i := 0; i < 250; i++ {
+		assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: user.ID, Desc: "Need a ride"}))
+	}
+	archive, err := s.Export(ctx, user)
+	assert.NoError(t, err)
+	assert.Len(t, archive.Calls, 250)
+}
+
+func TestDeletion(t *testing.T) {
+	s, repos, sessions, tokens := setup(t)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	user := createUser(t, repos, "John Doe", "john@example.com")
+	other := createUser(t, repos, "Jane Doe", "jane@example.com")
+	assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: user.ID, Desc: "Need a ride"}))
+	sess, _ := sessions.Create(ctx, user.ID, "Firefox", "192.0.2.1")
+	pair, _ := tokens.Issue(ctx, user.ID, time.Time{})
+
+	assert.Nil(t, s.PurgeAt(user))
+	assert.NoError(t, s.RequestDeletion(ctx, user))
+	assert.Equal(t, now.Add(grace), *s.PurgeAt(user))
+	now = now.Add(time.Hour)
+	assert.NoError(t, s.RequestDeletion(ctx, user))
+	assert.Equal(t, now.Add(grace-time.Hour), *s.PurgeAt(user))
+
+	assert.NoError(t, s.CancelDeletion(ctx, user))
+	stored, _ := repos.Users.Get(ctx, user.ID)
+	assert.False(t, stored.DeletionRequested())
+	assert.NoError(t, s.RequestDeletion(ctx, user))
+
+	// Nothing is purged before the grace period ends.
+	purged, err := s.Purge(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, purged)
+
+	now = now.Add(grace + time.Second)
+	purged, err = s.Purge(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = repos.Users.Get(ctx, user.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = repos.Users.Get(ctx, other.ID)
+	assert.NoError(t, err)
+	calls, _ := repos.Calls.List(ctx, repository.CallFilter{UserID: user.ID}, pagination.Params{Limit: 10})
+	assert.Empty(t, calls)
+	_, err = sessions.Get(ctx, sess.ID)
+	assert.ErrorIs(t, err, session.ErrNotFound)
+	_, err = tokens.Refresh(ctx, pair.RefreshToken)
+	assert.Error(t, err)
+}
@@ -0,0 +1,203 @@
+// Package apierr defines the error model shared by every HTTP endpoint.
+//
+// All errors are written as JSON with the following shape:
+//
+//	{
+//	  "error": {
+//	    "status": 409,
+//	    "code": "conflict",
+//	    "message": "email is already in use",
+//	    "fields": {"email": "is required"},
+//	    "correlation_id": "5f0c6a1e9b2d4c7a8e3f1b6d2a9c4e70"
+//	  }
+//	}
+//
+// "fields" is only present on validation errors. "correlation_id" is present
+// on every error and is logged alongside the underlying cause of 500
+// responses so that client reports can be matched to server logs.
+package apierr
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// Error codes returned in the "code" field.
+const (
+	CodeBadRequest    = "bad_request"
+	CodeValidation    = "validation_failed"
+	CodeUnauthorized  = "unauthorized"
+	CodeForbidden     = "forbidden"
+	CodeNotFound      = "not_found"
+	CodeConflict      = "conflict"
+	CodeUnprocessable = "unprocessable_entity"
+	CodeTooMany       = "too_many_requests"
+	CodeInternal      = "internal_error"
+
+	// CodeStepUpRequired is a 403 asking the user to prove their second
+	// factor again before retrying.
+	CodeStepUpRequired = "step_up_required"
+)
+
+// Postgres SQLSTATE codes for constraint violations.
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+// CorrelationHeader is the request header whose value, when present, is used
+// as the correlation ID of an error response.
+const CorrelationHeader = "X-Request-ID"
+
+// Error is an error that can be rendered to API clients.
+type Error struct {
+	Status  int               `json:"status"`
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+
+	// CorrelationID is filled in when the error is written.
+	CorrelationID string `json:"correlation_id"`
+
+	// Err is the underlying cause. It is logged but never sent to clients.
+	Err error `json:"-"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New returns an Error with the given status, code and message.
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// BadRequest returns a 400 error for malformed requests.
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+// Validation returns a 400 error describing the invalid fields.
+func Validation(fields map[string]string) *Error {
+	e := New(http.StatusBadRequest, CodeValidation, "validation failed")
+	e.Fields = fields
+	return e
+}
+
+// Unauthorized returns a 401 error.
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+// Forbidden returns a 403 error.
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+// NotFound returns a 404 error.
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+// Conflict returns a 409 error.
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+// Unprocessable returns a 422 error.
+func Unprocessable(message string) *Error {
+	return New(http.StatusUnprocessableEntity, CodeUnprocessable, message)
+}
+
+// TooManyRequests returns a 429 error.
+func TooManyRequests(message string) *Error {
+	return New(http.StatusTooManyRequests, CodeTooMany, message)
+}
+
+// StepUpRequired returns a 403 asking the user to enter their second factor.
+func StepUpRequired(message string) *Error {
+	return New(http.StatusForbidden, CodeStepUpRequired, message)
+}
+
+// Internal returns a 500 error wrapping err.
+func Internal(err error) *Error {
+	e := New(http.StatusInternalServerError, CodeInternal, "internal server error")
+	e.Err = err
+	return e
+}
+
+// From converts any error into an Error. Errors that already are (or wrap)
+// an *Error are returned as is; database errors are mapped as follows:
+//
+//   - gorm.ErrRecordNotFound: 404
+//   - unique violations: 409
+//   - foreign key violations: 422
+//
+// Everything else becomes a 500.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var pgErr *pgconn.PgError
+	isPg := errors.As(err, &pgErr)
+
+	var e *Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		e = NotFound("resource not found")
+	case errors.Is(err, gorm.ErrDuplicatedKey), isPg && pgErr.Code == pgUniqueViolation:
+		e = Conflict("resource conflicts with an existing one")
+	case errors.Is(err, gorm.ErrForeignKeyViolated), isPg && pgErr.Code == pgForeignKeyViolation:
+		e = Unprocessable("referenced resource does not exist")
+	default:
+		return Internal(err)
+	}
+	e.Err = err
+	return e
+}
+
+// Write renders err as a JSON error response. 500 errors are logged with
+// their correlation ID and underlying cause.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	// Copy so that shared errors are never mutated.
+	e := *From(err)
+	e.CorrelationID = correlationID(r)
+
+	if e.Status >= http.StatusInternalServerError {
+		log.Printf("[%s] %s %s: %v", e.CorrelationID, r.Method, r.URL.Path, e.Err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	if err := json.NewEncoder(w).Encode(map[string]*Error{"error": &e}); err != nil {
+		log.Printf("Failed to encode error response: %v", err)
+	}
+}
+
+// correlationID returns the request's ID if it has one, or a new random ID.
+func correlationID(r *http.Request) string {
+	if id := r.Header.Get(CorrelationHeader); id != "" {
+		return id
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
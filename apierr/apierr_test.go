@@ -0,0 +1,72 @@
+package apierr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestFromMapsDatabaseErrors(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{gorm.ErrRecordNotFound, http.StatusNotFound, CodeNotFound},
+		{fmt.Errorf("create user: %w", gorm.ErrDuplicatedKey), http.StatusConflict, CodeConflict},
+		{&pgconn.PgError{Code: "23505"}, http.StatusConflict, CodeConflict},
+		{gorm.ErrForeignKeyViolated, http.StatusUnprocessableEntity, CodeUnprocessable},
+		{&pgconn.PgError{Code: "23503"}, http.StatusUnprocessableEntity, CodeUnprocessable},
+		{&pgconn.PgError{Code: "57014"}, http.StatusInternalServerError, CodeInternal},
+		{errors.New("boom"), http.StatusInternalServerError, CodeInternal},
+		{Forbidden("nope"), http.StatusForbidden, CodeForbidden},
+	}
+
+	for _, tt := range tests {
+		e := From(tt.err)
+		assert.Equal(t, tt.status, e.Status, tt.err.Error())
+		assert.Equal(t, tt.code, e.Code, tt.err.Error())
+	}
+}
+
+func TestWriteEnvelope(t *testing.T) {
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	rec := httptest.NewRecorder()
+	Write(rec, req, Validation(map[string]string{"email": "is required"}))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var body struct {
+		Error Error `json:"error"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, http.StatusBadRequest, body.Error.Status)
+	assert.Equal(t, CodeValidation, body.Error.Code)
+	assert.Equal(t, "is required", body.Error.Fields["email"])
+	assert.NotEmpty(t, body.Error.CorrelationID)
+}
+
+func TestWriteHidesInternalCause(t *testing.T) {
+	req := httptest.NewRequest("GET", "/calls", nil)
+	req.Header.Set(CorrelationHeader, "req-123")
+	rec := httptest.NewRecorder()
+	Write(rec, req, errors.New("pq: password authentication failed"))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "password")
+
+	var body struct {
+		Error Error `json:"error"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, "req-123", body.Error.CorrelationID)
+	assert.Equal(t, "internal server error", body.Error.Message)
+}
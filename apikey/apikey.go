@@ -0,0 +1,117 @@
+// Package apikey authenticates partner organizations by API key.
+//
+// Keys look like vak_<prefix>_<secret>. The prefix is stored in the clear to
+// find the key and the whole key is stored as a SHA-256 hash, which is
+// enough for a random 256-bit secret. Requests made with a key act as the
+// organization's service account, but only on routes that accept one of the
+// key's scopes, and are rate limited per key.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/ratelimit"
+	"github.com/pageza/vet-app/repository"
+)
+
+// ErrInvalidKey is returned for unknown, expired and revoked keys.
+var ErrInvalidKey = errors.New("invalid API key")
+
+const keyPrefix = "vak_"
+
+// touchInterval limits how often a key's last use is written to the
+// database.
+const touchInterval = time.Minute
+
+// rateWindow is the period a key's rate limit applies to.
+const rateWindow = time.Minute
+
+// Service issues and checks API keys.
+type Service struct {
+	keys             repository.APIKeyRepository
+	users            repository.UserRepository
+	limiter          *ratelimit.Limiter
+	defaultRateLimit int
+	now              func() time.Time
+}
+
+// NewService returns a Service that counts requests with limiter. Keys
+// created without a rate limit get defaultRateLimit requests per minute.
+func NewService(repos repository.Repositories, limiter *ratelimit.Limiter, defaultRateLimit int) *Service {
+	return &Service{
+		keys:             repos.APIKeys,
+		users:            repos.Users,
+		limiter:          limiter,
+		defaultRateLimit: defaultRateLimit,
+		now:              time.Now,
+	}
+}
+
+// Issue stores key with a new secret and returns the secret, which cannot
+// be recovered later.
+func (s *Service) Issue(ctx context.Context, key *models.APIKey) (string, error) {
+	prefix := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(prefix); err != nil {
+		return "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	key.Prefix = hex.EncodeToString(prefix)
+	raw := keyPrefix + key.Prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	key.KeyHash = hashKey(raw)
+	if key.RateLimit == 0 {
+		key.RateLimit = s.defaultRateLimit
+	}
+	if err := s.keys.Create(ctx, key); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// Authenticate returns the active key raw stands for and records that it
+// was used.
+func (s *Service) Authenticate(ctx context.Context, raw string) (*models.APIKey, error) {
+	rest, ok := strings.CutPrefix(raw, keyPrefix)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	key, err := s.keys.GetByPrefix(ctx, prefix)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if subtle.ConstantTimeCompare([]byte(hashKey(raw)), []byte(key.KeyHash)) != 1 || !key.Active(now) {
+		return nil, ErrInvalidKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= touchInterval {
+		if err := s.keys.Touch(ctx, key.ID, now); err != nil {
+			log.Printf("apikey: recording use of key %d: %v", key.ID, err)
+		}
+	}
+	return key, nil
+}
+
+func hashKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,149 @@
+package apikey
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/pageza/vet-app/auth"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/ratelimit"
+	"github.com/pageza/vet-app/rbac"
+	"github.com/pageza/vet-app/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+func setup(t *testing.T) (*Service, repository.Repositories, *models.Organization) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	repos := repository.NewMemory()
+	org := &models.Organization{Name: "Helping Vets", User: models.User{Name: "Helping Vets", Email: "api@helpingvets.org"}}
+	assert.NoError(t, repos.Organizations.Create(ctx, org))
+	return NewService(repos, ratelimit.NewLimiter(client), 60), repos, org
+}
+
+// issue creates a key for org with the given scopes.
+func issue(t *testing.T, s *Service, org *models.Organization, scopes ...string) (*models.APIKey, string) {
+	key := &models.APIKey{OrganizationID: org.ID, Name: "Case system", Scopes: scopes}
+	raw, err := s.Issue(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, raw
+}
+
+func TestAuthenticate(t *testing.T) {
+	s, repos, org := setup(t)
+	key, raw := issue(t, s, org, models.ScopeCallsRead)
+	assert.Regexp(t, `^vak_[0-9a-f]{16}_[A-Za-z0-9_-]{43}$`, raw)
+	assert.Equal(t, 60, key.RateLimit)
+	assert.NotContains(t, key.KeyHash, raw)
+
+	found, err := s.Authenticate(ctx, raw)
+	assert.NoError(t, err)
+	assert.Equal(t, key.ID, found.ID)
+	stored, _ := repos.APIKeys.Get(ctx, key.ID)
+	assert.NotNil(t, stored.LastUsedAt)
+
+	for _, bad := range []string{"", "vak_", raw[:len(raw)-1] + "x", "vak_0000000000000000_secret"} {
+		_, err := s.Authenticate(ctx, bad)
+		assert.ErrorIs(t, err, ErrInvalidKey, bad)
+	}
+
+	s.now = func() time.Time { return time.Now().Add(time.Hour) }
+	expires := time.Now().Add(time.Minute)
+	expiring := &models.APIKey{OrganizationID: org.ID, Scopes: models.Words{models.ScopeCallsRead}, ExpiresAt: &expires}
+	expiringRaw, _ := s.Issue(ctx, expiring)
+	_, err = s.Authenticate(ctx, expiringRaw)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+
+	assert.NoError(t, repos.APIKeys.Revoke(ctx, key.ID, time.Now()))
+	_, err = s.Authenticate(ctx, raw)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestMiddleware(t *testing.T) {
+	s, _, org := setup(t)
+	key := &models.APIKey{OrganizationID: org.ID, Scopes: models.Words{models.ScopeCallsRead}, RateLimit: 2}
+	raw, err := s.Issue(ctx, key)
+	assert.NoError(t, err)
+
+	var got *models.APIKey
+	h := s.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context())
+	}))
+	serve := func(authorization string) *httptest.ResponseRecorder {
+		got = nil
+		req := httptest.NewRequest("GET", "/calls", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, serve("").Code)
+	assert.Nil(t, got)
+	assert.Equal(t, http.StatusOK, serve("Bearer token").Code)
+	assert.Nil(t, got)
+
+	rec := serve("ApiKey vak_0000000000000000_secret")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "ApiKey", rec.Header().Get("WWW-Authenticate"))
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, serve("ApiKey "+raw).Code)
+		assert.Equal(t, key.ID, got.ID)
+	}
+	rec = serve("ApiKey " + raw)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("X-RateLimit-Limit"))
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+	assert.Nil(t, got)
+}
+
+func TestRequireScope(t *testing.T) {
+	s, _, org := setup(t)
+	_, reader := issue(t, s, org, models.ScopeCallsRead)
+	_, writer := issue(t, s, org, models.ScopeResponsesWrite)
+
+	var user *models.User
+	var canCreate bool
+	h := s.Middleware(s.RequireScope(models.ScopeResponsesWrite, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user = auth.UserFromContext(r.Context())
+		canCreate = rbac.Can(r.Context(), models.PermissionCreateResponses)
+	})))
+	serve := func(raw string) *httptest.ResponseRecorder {
+		user, canCreate = nil, false
+		req := httptest.NewRequest("POST", "/calls/1/responses", nil)
+		if raw != "" {
+			req.Header.Set("Authorization", "ApiKey "+raw)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(reader)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), models.ScopeResponsesWrite)
+
+	assert.Equal(t, http.StatusOK, serve(writer).Code)
+	if assert.NotNil(t, user) {
+		assert.Equal(t, org.UserID, user.ID)
+	}
+	assert.True(t, canCreate)
+
+	// Requests without a key are left to the route's own checks.
+	assert.Equal(t, http.StatusOK, serve("").Code)
+	assert.Nil(t, user)
+	assert.False(t, canCreate)
+}
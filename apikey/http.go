@@ -0,0 +1,114 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/auth"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/ratelimit"
+	"github.com/pageza/vet-app/rbac"
+)
+
+var errInvalidKey = apierr.Unauthorized("invalid, expired or revoked API key")
+
+// scopePermissions lists the permissions each scope grants on the routes
+// that accept it.
+var scopePermissions = map[string][]string{
+	models.ScopeCallsReadVeteranOnly: {models.PermissionViewVeteranOnly},
+	models.ScopeResponsesWrite:       {models.PermissionCreateResponses},
+}
+
+type keyKey struct{}
+
+// FromContext returns the API key loaded by Middleware, or nil.
+func FromContext(ctx context.Context) *models.APIKey {
+	key, _ := ctx.Value(keyKey{}).(*models.APIKey)
+	return key
+}
+
+// FromRequest returns the key of an "Authorization: ApiKey" header, or ""
+// if there is none.
+func FromRequest(r *http.Request) string {
+	scheme, key, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "ApiKey") {
+		return ""
+	}
+	return strings.TrimSpace(key)
+}
+
+// Middleware authenticates requests carrying an API key and stores the key
+// in the request context, where rate limits count the key rather than the
+// caller's IP address. It does not authenticate a user; RequireScope does
+// that for the routes keys may use. Requests without a key pass through
+// untouched, requests with an invalid key are rejected with 401 and
+// requests over the key's rate limit with 429.
+func (s *Service) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := FromRequest(r)
+		if raw == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, err := s.Authenticate(r.Context(), raw)
+		if err != nil {
+			if errors.Is(err, ErrInvalidKey) {
+				w.Header().Set("WWW-Authenticate", "ApiKey")
+				err = errInvalidKey
+			}
+			apierr.Write(w, r, err)
+			return
+		}
+		client := fmt.Sprintf("apikey:%d", key.ID)
+		res, err := s.limiter.Allow(r.Context(), client, ratelimit.Limit{Requests: key.RateLimit, Window: rateWindow})
+		if err != nil {
+			// Keep serving partners while Redis is down.
+			log.Printf("apikey: counting request of key %d: %v", key.ID, err)
+		} else {
+			ratelimit.SetHeaders(w.Header(), res)
+			if !res.Allowed {
+				apierr.Write(w, r, apierr.TooManyRequests("API key rate limit exceeded"))
+				return
+			}
+		}
+		ctx := ratelimit.WithClient(context.WithValue(r.Context(), keyKey{}, key), client)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireScope lets requests made with an API key through to next only if
+// the key has scope, in which case they act as the key's organization with
+// the permissions of the key's scopes. Other requests pass through
+// untouched.
+func (s *Service) RequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := FromContext(r.Context())
+		if key == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !key.Scopes.Has(scope) {
+			apierr.Write(w, r, apierr.Forbidden("this API key needs the "+scope+" scope"))
+			return
+		}
+		user, err := s.users.Get(r.Context(), key.Organization.UserID)
+		if err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+		permissions := rbac.Set{}
+		for _, scope := range key.Scopes {
+			for _, p := range scopePermissions[scope] {
+				permissions[p] = true
+			}
+		}
+		ctx := rbac.WithPermissions(auth.WithUser(r.Context(), user), permissions)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
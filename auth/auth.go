@@ -0,0 +1,40 @@
+// Package auth carries the authenticated user of a request. Authentication
+// middleware stores the user with WithUser and handlers read it back with
+// UserFromContext.
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/pageza/vet-app/models"
+)
+
+type userKey struct{}
+
+type secondFactorKey struct{}
+
+// WithUser returns a copy of ctx carrying user.
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns the authenticated user, or nil if the request is
+// anonymous.
+func UserFromContext(ctx context.Context) *models.User {
+	user, _ := ctx.Value(userKey{}).(*models.User)
+	return user
+}
+
+// WithSecondFactor returns a copy of ctx recording that the user proved
+// their second factor at the given time.
+func WithSecondFactor(ctx context.Context, at time.Time) context.Context {
+	return context.WithValue(ctx, secondFactorKey{}, at)
+}
+
+// SecondFactorAt returns when the user last proved their second factor, or
+// the zero time if they have not in this session.
+func SecondFactorAt(ctx context.Context) time.Time {
+	at, _ := ctx.Value(secondFactorKey{}).(time.Time)
+	return at
+}
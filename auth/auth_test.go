@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pageza/vet-app/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserFromContext(t *testing.T) {
+	assert.Nil(t, UserFromContext(context.Background()))
+
+	user := &models.User{ID: 1}
+	assert.Same(t, user, UserFromContext(WithUser(context.Background(), user)))
+}
+
+func TestSecondFactorAt(t *testing.T) {
+	assert.True(t, SecondFactorAt(context.Background()).IsZero())
+
+	at := time.Now()
+	assert.Equal(t, at, SecondFactorAt(WithSecondFactor(context.Background(), at)))
+}
@@ -0,0 +1,121 @@
+// Package callstatus moves calls through their lifecycle, recording every
+// change in the call's status history, and expires calls that nobody took
+// up.
+package callstatus
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"github.com/pageza/vet-app/repository"
+)
+
+// ErrInvalidTransition is returned for a status a call cannot move to from
+// its current one.
+var ErrInvalidTransition = errors.New("call cannot move to that status")
+
+// expireBatch is how many calls Expire loads at a time.
+const expireBatch = 100
+
+// Service changes the status of calls.
+type Service struct {
+	calls repository.CallRepository
+	now   func() time.Time
+}
+
+// NewService returns a Service storing calls in repos.
+func NewService(repos repository.Repositories) *Service {
+	return &Service{calls: repos.Calls, now: time.Now}
+}
+
+// Transition moves call to status on behalf of actor, who is nil when the
+// app makes the change, and updates call to match. Claiming a call makes
+// actor its claimer and reopening it releases the claim. It returns
+// ErrInvalidTransition if the lifecycle does not allow the change and
+// repository.ErrStale if the call's status changed since it was read.
+// Whether actor may make the change is up to the caller.
+func (s *Service) Transition(ctx context.Context, call *models.Call, actor *models.User, status, note string) error {
+	if !models.CanTransition(call.Status, status) {
+		return ErrInvalidTransition
+	}
+	next := *call
+	next.Status = status
+	switch status {
+	case models.CallStatusClaimed:
+		next.ClaimedByID = &actor.ID
+	case models.CallStatusOpen:
+		next.ClaimedByID = nil
+	}
+	change := &models.CallStatusChange{
+		FromStatus: call.Status,
+		ToStatus:   status,
+		Note:       note,
+		CreatedAt:  s.now(),
+	}
+	if actor != nil {
+		change.UserID = &actor.ID
+	}
+	if err := s.calls.Transition(ctx, &next, change); err != nil {
+		return err
+	}
+	*call = next
+	return nil
+}
+
+// Expire moves every call that has been open for longer than after to
+// expired and returns how many there were.
+func (s *Service) Expire(ctx context.Context, after time.Duration) (int, error) {
+	before := s.now().Add(-after)
+	filter := repository.CallFilter{Statuses: []string{models.CallStatusOpen}, CreatedBefore: &before}
+	page := pagination.Params{Limit: expireBatch, Sort: pagination.SortID}
+	expired := 0
+	for {
+		calls, err := s.calls.List(ctx, filter, page)
+		if err != nil {
+			return expired, err
+		}
+		more := len(calls) > expireBatch
+		if more {
+			calls = calls[:expireBatch]
+		}
+		for i := range calls {
+			// The call may have been claimed, or expired by another
+			// instance, since it was listed.
+			err := s.Transition(ctx, &calls[i], nil, models.CallStatusExpired, "")
+			switch {
+			case err == nil:
+				expired++
+			case !errors.Is(err, repository.ErrStale) && !errors.Is(err, repository.ErrNotFound):
+				return expired, err
+			}
+		}
+		if !more {
+			return expired, nil
+		}
+		page.After = &pagination.Cursor{Sort: pagination.SortID, ID: calls[len(calls)-1].ID}
+	}
+}
+
+// RunExpiry expires calls open for longer than after, now and then every
+// interval until ctx is done.
+func (s *Service) RunExpiry(ctx context.Context, after, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		switch expired, err := s.Expire(ctx, after); {
+		case err != nil:
+			log.Printf("callstatus: expiring calls: %v", err)
+		case expired > 0:
+			log.Printf("callstatus: expired %d calls", expired)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
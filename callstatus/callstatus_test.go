@@ -0,0 +1,110 @@
+package callstatus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+func createUser(t *testing.T, repos repository.Repositories, name, email string) *models.User {
+	user := &models.User{Name: name, Email: email}
+	assert.NoError(t, repos.Users.Create(ctx, user))
+	return user
+}
+
+func TestTransition(t *testing.T) {
+	repos := repository.NewMemory()
+	s := NewService(repos)
+	owner := createUser(t, repos, "John Doe", "john@example.com")
+	volunteer := createUser(t, repos, "Jane Doe", "jane@example.com")
+	call := &models.Call{UserID: owner.ID, Desc: "Need a ride"}
+	assert.NoError(t, repos.Calls.Create(ctx, call))
+
+	assert.ErrorIs(t, s.Transition(ctx, call, volunteer, models.CallStatusInProgress, ""), ErrInvalidTransition)
+
+	assert.NoError(t, s.Transition(ctx, call, volunteer, models.CallStatusClaimed, "I can drive"))
+	assert.Equal(t, models.CallStatusClaimed, call.Status)
+	assert.Equal(t, volunteer.ID, *call.ClaimedByID)
+
+	// A stale copy of the call cannot be claimed again.
+	stale := &models.Call{ID: call.ID, UserID: owner.ID, Status: models.CallStatusOpen}
+	assert.ErrorIs(t, s.Transition(ctx, stale, owner, models.CallStatusClosed, ""), repository.ErrStale)
+
+	assert.NoError(t, s.Transition(ctx, call, volunteer, models.CallStatusOpen, ""))
+	assert.Nil(t, call.ClaimedByID)
+	assert.NoError(t, s.Transition(ctx, call, volunteer, models.CallStatusClaimed, ""))
+	assert.NoError(t, s.Transition(ctx, call, volunteer, models.CallStatusInProgress, ""))
+	assert.NoError(t, s.Transition(ctx, call, owner, models.CallStatusResolved, "Got there"))
+	assert.Equal(t, volunteer.ID, *call.ClaimedByID)
+
+	stored, err := repos.Calls.Get(ctx, call.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.CallStatusResolved, stored.Status)
+
+	history, err := repos.Calls.History(ctx, call.ID)
+	assert.NoError(t, err)
+	var path []string
+	for _, change := range history {
+		path = append(path, change.FromStatus+">"+change.ToStatus)
+	}
+	assert.Equal(t, []string{"open>claimed", "claimed>open", "open>claimed", "claimed>in_progress", "in_progress>resolved"}, path)
+	assert.Equal(t, owner.ID, *history[4].UserID)
+	assert.Equal(t, "Got there", history[4].Note)
+}
+
+func TestExpire(t *testing.T) {
+	repos := repository.NewMemory()
+	s := NewService(repos)
+	owner := createUser(t, repos, "John Doe", "john@example.com")
+	volunteer := createUser(t, repos, "Jane Doe", "jane@example.com")
+	old := time.Now().Add(-48 * time.Hour)
+
+	stale := &models.Call{UserID: owner.ID, Desc: "Nobody came", CreatedAt: old}
+	claimed := &models.Call{UserID: owner.ID, Desc: "Someone came", CreatedAt: old}
+	recent := &models.Call{UserID: owner.ID, Desc: "Just asked"}
+	for _, call := range []*models.Call{stale, claimed, recent} {
+		assert.NoError(t, repos.Calls.Create(ctx, call))
+	}
+	assert.NoError(t, s.Transition(ctx, claimed, volunteer, models.CallStatusClaimed, ""))
+
+	expired, err := s.Expire(ctx, 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, expired)
+
+	for call, status := range map[*models.Call]string{
+		stale:   models.CallStatusExpired,
+		claimed: models.CallStatusClaimed,
+		recent:  models.CallStatusOpen,
+	} {
+		stored, err := repos.Calls.Get(ctx, call.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, status, stored.Status, call.Desc)
+	}
+	history, err := repos.Calls.History(ctx, stale.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Nil(t, history[0].UserID)
+	}
+
+	expired, err = s.Expire(ctx, 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Zero(t, expired)
+}
+
+func TestExpireBatches(t *testing.T) {
+	repos := repository.NewMemory()
+	s := NewService(repos)
+	owner := createUser(t, repos, "John Doe", "john@example.com")
+	for i := 0; i < expireBatch*2+5; i++ {
+		assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: owner.ID, Desc: "Nobody came", CreatedAt: time.Now().Add(-48 * time.Hour)}))
+	}
+	expired, err := s.Expire(ctx, 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, expireBatch*2+5, expired)
+}
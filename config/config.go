@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -12,13 +14,269 @@ type DBConfig struct {
 	Name     string `mapstructure:"DB_NAME"`
 }
 
+// ServerConfig controls the HTTP server. Durations are written like "15s".
+type ServerConfig struct {
+	Port              int           `mapstructure:"PORT"`
+	ReadTimeout       time.Duration `mapstructure:"SERVER_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `mapstructure:"SERVER_READ_HEADER_TIMEOUT"`
+	WriteTimeout      time.Duration `mapstructure:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `mapstructure:"SERVER_IDLE_TIMEOUT"`
+	// DrainDelay is how long the server keeps accepting requests after a
+	// shutdown signal, giving load balancers time to stop routing to it.
+	DrainDelay time.Duration `mapstructure:"SERVER_DRAIN_DELAY"`
+	// ShutdownTimeout bounds how long in-flight requests may take to finish.
+	ShutdownTimeout time.Duration `mapstructure:"SERVER_SHUTDOWN_TIMEOUT"`
+}
+
+// CORSConfig controls which browser origins may call the API. List values
+// are comma separated, e.g. CORS_ALLOWED_ORIGINS=https://app.example.org.
+type CORSConfig struct {
+	AllowedOrigins   []string      `mapstructure:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods   []string      `mapstructure:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders   []string      `mapstructure:"CORS_ALLOWED_HEADERS"`
+	AllowCredentials bool          `mapstructure:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `mapstructure:"CORS_MAX_AGE"`
+}
+
+// IDmeConfig configures login through ID.me's OpenID Connect provider.
+// Login is disabled when ClientID is empty.
+type IDmeConfig struct {
+	Issuer       string   `mapstructure:"IDME_ISSUER"`
+	ClientID     string   `mapstructure:"IDME_CLIENT_ID"`
+	ClientSecret string   `mapstructure:"IDME_CLIENT_SECRET"`
+	RedirectURL  string   `mapstructure:"IDME_REDIRECT_URL"`
+	Scopes       []string `mapstructure:"IDME_SCOPES"`
+	// VeteranClaim names the ID token claim listing the user's verified
+	// groups, and VeteranGroup is the entry in it that marks a veteran.
+	VeteranClaim string `mapstructure:"IDME_VETERAN_CLAIM"`
+	VeteranGroup string `mapstructure:"IDME_VETERAN_GROUP"`
+	// BranchClaim names the claim holding a veteran's branch of service.
+	BranchClaim string `mapstructure:"IDME_BRANCH_CLAIM"`
+	// VerificationTTL is how long a veteran verification from ID.me lasts
+	// before the user has to log in through ID.me again.
+	VerificationTTL time.Duration `mapstructure:"IDME_VERIFICATION_TTL"`
+}
+
+// SessionConfig controls the cookie sessions used by the web client.
+// Sessions expire after IdleTimeout without use and never outlive
+// MaxLifetime.
+type SessionConfig struct {
+	CookieName   string        `mapstructure:"SESSION_COOKIE_NAME"`
+	CookieDomain string        `mapstructure:"SESSION_COOKIE_DOMAIN"`
+	CookieSecure bool          `mapstructure:"SESSION_COOKIE_SECURE"`
+	IdleTimeout  time.Duration `mapstructure:"SESSION_IDLE_TIMEOUT"`
+	MaxLifetime  time.Duration `mapstructure:"SESSION_MAX_LIFETIME"`
+}
+
+// TokenConfig controls the bearer tokens used by the mobile clients.
+// KeysDir holds the PEM signing keys; if it is empty a key is generated at
+// startup, which only suits development.
+type TokenConfig struct {
+	Issuer      string        `mapstructure:"TOKEN_ISSUER"`
+	KeysDir     string        `mapstructure:"TOKEN_KEYS_DIR"`
+	ActiveKeyID string        `mapstructure:"TOKEN_ACTIVE_KEY_ID"`
+	AccessTTL   time.Duration `mapstructure:"TOKEN_ACCESS_TTL"`
+	RefreshTTL  time.Duration `mapstructure:"TOKEN_REFRESH_TTL"`
+}
+
+// RBACConfig controls how long role lookups are cached in Redis. Changes
+// made through the API take effect immediately; changes made directly in the
+// database wait for CacheTTL.
+type RBACConfig struct {
+	CacheTTL time.Duration `mapstructure:"RBAC_CACHE_TTL"`
+}
+
+// TwoFactorConfig controls TOTP two-factor authentication. EncryptionKey is
+// the base64 encoding of the 32-byte key that encrypts TOTP secrets at rest;
+// if it is empty a key is generated at startup, which only suits development
+// since enrollments do not survive a restart. Users holding any of
+// RequiredRoles lose those roles' permissions until they have entered a
+// second factor, and destructive admin actions ask for one within
+// StepUpWindow.
+type TwoFactorConfig struct {
+	Issuer        string        `mapstructure:"TWO_FACTOR_ISSUER"`
+	EncryptionKey string        `mapstructure:"TWO_FACTOR_ENCRYPTION_KEY"`
+	RequiredRoles []string      `mapstructure:"TWO_FACTOR_REQUIRED_ROLES"`
+	StepUpWindow  time.Duration `mapstructure:"TWO_FACTOR_STEP_UP_WINDOW"`
+}
+
+// APIKeyConfig controls the API keys used by partner organizations.
+// DefaultRateLimit is how many requests per minute a key may make unless it
+// was created with its own limit.
+type APIKeyConfig struct {
+	DefaultRateLimit int `mapstructure:"API_KEY_DEFAULT_RATE_LIMIT"`
+}
+
+// RateLimitConfig limits how many requests each user, API key or, for
+// anonymous requests, IP address may make to the routes most open to spam.
+// Windows slide, so CreateCalls=10 with a 1h window allows at most ten calls
+// in any hour. A limit of 0 turns it off.
+type RateLimitConfig struct {
+	CreateCalls           int           `mapstructure:"RATE_LIMIT_CREATE_CALLS"`
+	CreateCallsWindow     time.Duration `mapstructure:"RATE_LIMIT_CREATE_CALLS_WINDOW"`
+	CreateResponses       int           `mapstructure:"RATE_LIMIT_CREATE_RESPONSES"`
+	CreateResponsesWindow time.Duration `mapstructure:"RATE_LIMIT_CREATE_RESPONSES_WINDOW"`
+}
+
+// AccountConfig controls account deletion. Accounts are purged
+// DeletionGracePeriod after their owner asked for it, by a job that runs
+// every PurgeInterval.
+type AccountConfig struct {
+	DeletionGracePeriod time.Duration `mapstructure:"ACCOUNT_DELETION_GRACE_PERIOD"`
+	PurgeInterval       time.Duration `mapstructure:"ACCOUNT_PURGE_INTERVAL"`
+}
+
+// MailConfig configures the SMTP server that sends email. Messages are
+// logged instead of sent when SMTPHost is empty, which only suits
+// development.
+type MailConfig struct {
+	SMTPHost     string `mapstructure:"SMTP_HOST"`
+	SMTPPort     int    `mapstructure:"SMTP_PORT"`
+	SMTPUsername string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword string `mapstructure:"SMTP_PASSWORD"`
+	From         string `mapstructure:"MAIL_FROM"`
+}
+
+// MagicLinkConfig controls passwordless login through links sent by email.
+// Login is disabled when URL, the page of the web client that redeems the
+// link's token, is empty. Secret is the base64 encoding of the key that
+// signs links; if it is empty a key is generated at startup, which only
+// suits development. Each email address may be sent RateLimit links per
+// RateLimitWindow.
+type MagicLinkConfig struct {
+	URL             string        `mapstructure:"MAGIC_LINK_URL"`
+	Secret          string        `mapstructure:"MAGIC_LINK_SECRET"`
+	TTL             time.Duration `mapstructure:"MAGIC_LINK_TTL"`
+	RateLimit       int           `mapstructure:"MAGIC_LINK_RATE_LIMIT"`
+	RateLimitWindow time.Duration `mapstructure:"MAGIC_LINK_RATE_LIMIT_WINDOW"`
+}
+
+// CallConfig controls when calls expire. Calls still open ExpireAfter after
+// they were created are expired by a job that runs every ExpiryInterval. An
+// ExpireAfter of 0 turns expiry off.
+type CallConfig struct {
+	ExpireAfter    time.Duration `mapstructure:"CALL_EXPIRE_AFTER"`
+	ExpiryInterval time.Duration `mapstructure:"CALL_EXPIRY_INTERVAL"`
+}
+
+// CrisisConfig controls how calls and responses are screened for crisis
+// language. PhrasesFile lists weighted phrases, one per line as a weight
+// followed by the phrase; if it is empty a built-in list is used. Text
+// scoring at least Threshold marks its call urgent.
+type CrisisConfig struct {
+	PhrasesFile string `mapstructure:"CRISIS_PHRASES_FILE"`
+	Threshold   int    `mapstructure:"CRISIS_THRESHOLD"`
+}
+
+// GeoConfig controls where calls are placed. ZIPFile is a Census Bureau
+// ZCTA gazetteer file used to place calls given only a ZIP code; without it
+// such calls are left out of radius searches. Locations shown to the public
+// are moved a random distance of up to FuzzRadius miles.
+type GeoConfig struct {
+	ZIPFile    string  `mapstructure:"GEO_ZIP_FILE"`
+	FuzzRadius float64 `mapstructure:"GEO_FUZZ_RADIUS"`
+}
+
 type Config struct {
-	DB        DBConfig `mapstructure:",squash"`
-	TestDB    DBConfig `mapstructure:"TEST_DB"`
-	RedisHost string   `mapstructure:"REDIS_HOST"`
-	RedisPort int      `mapstructure:"REDIS_PORT"`
-	RedisPassword string `mapstructure:"REDIS_PASSWORD"`
-	RedisDB   int      `mapstructure:"REDIS_DB"`
+	DB            DBConfig        `mapstructure:",squash"`
+	TestDB        DBConfig        `mapstructure:"TEST_DB"`
+	RedisHost     string          `mapstructure:"REDIS_HOST"`
+	RedisPort     int             `mapstructure:"REDIS_PORT"`
+	RedisPassword string          `mapstructure:"REDIS_PASSWORD"`
+	RedisDB       int             `mapstructure:"REDIS_DB"`
+	Server        ServerConfig    `mapstructure:",squash"`
+	CORS          CORSConfig      `mapstructure:",squash"`
+	IDme          IDmeConfig      `mapstructure:",squash"`
+	Session       SessionConfig   `mapstructure:",squash"`
+	Token         TokenConfig     `mapstructure:",squash"`
+	RBAC          RBACConfig      `mapstructure:",squash"`
+	TwoFactor     TwoFactorConfig `mapstructure:",squash"`
+	APIKey        APIKeyConfig    `mapstructure:",squash"`
+	RateLimit     RateLimitConfig `mapstructure:",squash"`
+	Account       AccountConfig   `mapstructure:",squash"`
+	Mail          MailConfig      `mapstructure:",squash"`
+	MagicLink     MagicLinkConfig `mapstructure:",squash"`
+	Call          CallConfig      `mapstructure:",squash"`
+	Crisis        CrisisConfig    `mapstructure:",squash"`
+	Geo           GeoConfig       `mapstructure:",squash"`
+}
+
+// setDefaults registers defaults for optional settings. Registering a key
+// also lets it be set from the environment alone.
+func setDefaults() {
+	viper.SetDefault("PORT", 8080)
+	viper.SetDefault("SERVER_READ_TIMEOUT", "15s")
+	viper.SetDefault("SERVER_READ_HEADER_TIMEOUT", "5s")
+	viper.SetDefault("SERVER_WRITE_TIMEOUT", "30s")
+	viper.SetDefault("SERVER_IDLE_TIMEOUT", "120s")
+	viper.SetDefault("SERVER_DRAIN_DELAY", "0s")
+	viper.SetDefault("SERVER_SHUTDOWN_TIMEOUT", "30s")
+
+	viper.SetDefault("CORS_ALLOWED_ORIGINS", "")
+	viper.SetDefault("CORS_ALLOWED_METHODS", "GET,POST,PUT,DELETE,OPTIONS")
+	viper.SetDefault("CORS_ALLOWED_HEADERS", "Content-Type,Authorization,X-Request-ID")
+	viper.SetDefault("CORS_ALLOW_CREDENTIALS", false)
+	viper.SetDefault("CORS_MAX_AGE", "10m")
+
+	viper.SetDefault("IDME_ISSUER", "https://api.id.me/oidc")
+	viper.SetDefault("IDME_CLIENT_ID", "")
+	viper.SetDefault("IDME_CLIENT_SECRET", "")
+	viper.SetDefault("IDME_REDIRECT_URL", "")
+	viper.SetDefault("IDME_SCOPES", "openid,email,military")
+	viper.SetDefault("IDME_VETERAN_CLAIM", "groups")
+	viper.SetDefault("IDME_VETERAN_GROUP", "veteran")
+	viper.SetDefault("IDME_BRANCH_CLAIM", "branch")
+	viper.SetDefault("IDME_VERIFICATION_TTL", "8760h")
+
+	viper.SetDefault("SESSION_COOKIE_NAME", "session")
+	viper.SetDefault("SESSION_COOKIE_DOMAIN", "")
+	viper.SetDefault("SESSION_COOKIE_SECURE", true)
+	viper.SetDefault("SESSION_IDLE_TIMEOUT", "24h")
+	viper.SetDefault("SESSION_MAX_LIFETIME", "720h")
+
+	viper.SetDefault("TOKEN_ISSUER", "vet-app")
+	viper.SetDefault("TOKEN_KEYS_DIR", "")
+	viper.SetDefault("TOKEN_ACTIVE_KEY_ID", "")
+	viper.SetDefault("TOKEN_ACCESS_TTL", "15m")
+	viper.SetDefault("TOKEN_REFRESH_TTL", "720h")
+
+	viper.SetDefault("RBAC_CACHE_TTL", "5m")
+
+	viper.SetDefault("TWO_FACTOR_ISSUER", "Vet App")
+	viper.SetDefault("TWO_FACTOR_ENCRYPTION_KEY", "")
+	viper.SetDefault("TWO_FACTOR_REQUIRED_ROLES", "moderator,admin")
+	viper.SetDefault("TWO_FACTOR_STEP_UP_WINDOW", "10m")
+
+	viper.SetDefault("API_KEY_DEFAULT_RATE_LIMIT", 60)
+
+	viper.SetDefault("RATE_LIMIT_CREATE_CALLS", 10)
+	viper.SetDefault("RATE_LIMIT_CREATE_CALLS_WINDOW", "1h")
+	viper.SetDefault("RATE_LIMIT_CREATE_RESPONSES", 60)
+	viper.SetDefault("RATE_LIMIT_CREATE_RESPONSES_WINDOW", "1h")
+
+	viper.SetDefault("ACCOUNT_DELETION_GRACE_PERIOD", "720h")
+	viper.SetDefault("ACCOUNT_PURGE_INTERVAL", "1h")
+
+	viper.SetDefault("SMTP_HOST", "")
+	viper.SetDefault("SMTP_PORT", 587)
+	viper.SetDefault("SMTP_USERNAME", "")
+	viper.SetDefault("SMTP_PASSWORD", "")
+	viper.SetDefault("MAIL_FROM", "Vet App <no-reply@example.org>")
+
+	viper.SetDefault("MAGIC_LINK_URL", "")
+	viper.SetDefault("MAGIC_LINK_SECRET", "")
+	viper.SetDefault("MAGIC_LINK_TTL", "15m")
+	viper.SetDefault("MAGIC_LINK_RATE_LIMIT", 5)
+	viper.SetDefault("MAGIC_LINK_RATE_LIMIT_WINDOW", "1h")
+
+	viper.SetDefault("CALL_EXPIRE_AFTER", "720h")
+	viper.SetDefault("CALL_EXPIRY_INTERVAL", "1h")
+
+	viper.SetDefault("CRISIS_PHRASES_FILE", "")
+	viper.SetDefault("CRISIS_THRESHOLD", 10)
+
+	viper.SetDefault("GEO_ZIP_FILE", "")
+	viper.SetDefault("GEO_FUZZ_RADIUS", 1.0)
 }
 
 func LoadConfig(path string) (Config, error) {
@@ -29,6 +287,7 @@ func LoadConfig(path string) (Config, error) {
 	viper.SetConfigType("env")
 
 	viper.AutomaticEnv()
+	setDefaults()
 
 	if err := viper.ReadInConfig(); err != nil {
 		return config, err
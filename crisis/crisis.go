@@ -0,0 +1,117 @@
+// Package crisis screens what users write for signs that a veteran is in
+// crisis. Calls that look urgent are marked so and the moderators on duty
+// are paged about them, and the app points everyone involved to the
+// Veterans Crisis Line.
+package crisis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pageza/vet-app/mail"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"github.com/pageza/vet-app/repository"
+)
+
+// pageBatch is how many on-duty moderators Escalate loads at a time.
+const pageBatch = 100
+
+// ErrNoOneOnDuty is returned by Escalate when no moderator was on duty to
+// be paged.
+var ErrNoOneOnDuty = errors.New("no moderators are on duty")
+
+// Resource is somewhere to get help right away.
+type Resource struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Phone       string `json:"phone,omitempty"`
+	Text        string `json:"text,omitempty"`
+	URL         string `json:"url,omitempty"`
+}
+
+// Resources lists the Veterans Crisis Line's ways of reaching it, along
+// with emergency services.
+var Resources = []Resource{
+	{
+		Name:        "Veterans Crisis Line",
+		Description: "Free, confidential support for veterans in crisis and their families, 24 hours a day. Dial 988 and press 1.",
+		Phone:       "988",
+		Text:        "838255",
+		URL:         "https://www.veteranscrisisline.net/get-help-now/chat/",
+	},
+	{
+		Name:        "Emergency services",
+		Description: "If you or someone else is in immediate danger, call 911.",
+		Phone:       "911",
+	},
+}
+
+// Service assesses text and escalates the calls it finds urgent.
+type Service struct {
+	detector *Detector
+	calls    repository.CallRepository
+	users    repository.UserRepository
+	sender   mail.Sender
+}
+
+// NewService returns a Service that assesses text with detector and pages
+// moderators through sender.
+func NewService(repos repository.Repositories, detector *Detector, sender mail.Sender) *Service {
+	return &Service{detector: detector, calls: repos.Calls, users: repos.Users, sender: sender}
+}
+
+// Assess scores text written in a call or a response.
+func (s *Service) Assess(text string) Assessment {
+	return s.detector.Assess(text)
+}
+
+// Escalate marks a call urgent because of what a found, and emails every
+// user holding the on-duty role about it. A call that is already urgent is
+// left alone, so moderators are paged once per call. The email leaves out
+// what was written, which moderators read in the app.
+func (s *Service) Escalate(ctx context.Context, callID uint, a Assessment) error {
+	marked, err := s.calls.MarkUrgent(ctx, callID)
+	if err != nil || !marked {
+		return err
+	}
+
+	msg := mail.Message{
+		Subject: fmt.Sprintf("Urgent: call %d may be from someone in crisis", callID),
+		Body: fmt.Sprintf("Call %d was marked urgent because it mentions: %s (score %d).\n\n"+
+			"Please review it now. The Veterans Crisis Line is reached by dialing 988 and pressing 1.\n",
+			callID, strings.Join(a.Matches, ", "), a.Score),
+	}
+	filter := repository.UserFilter{Role: models.RoleOnDuty, ExcludeDeleting: true}
+	page := pagination.Params{Limit: pageBatch, Sort: pagination.SortID}
+	var errs []error
+	paged := 0
+	for {
+		users, err := s.users.List(ctx, filter, page)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		more := len(users) > pageBatch
+		if more {
+			users = users[:pageBatch]
+		}
+		for _, user := range users {
+			msg.To = user.Email
+			if err := s.sender.Send(ctx, msg); err != nil {
+				errs = append(errs, fmt.Errorf("paging %s: %w", user.Email, err))
+				continue
+			}
+			paged++
+		}
+		if !more {
+			break
+		}
+		page.After = &pagination.Cursor{Sort: pagination.SortID, ID: users[len(users)-1].ID}
+	}
+	if paged == 0 && len(errs) == 0 {
+		return ErrNoOneOnDuty
+	}
+	return errors.Join(errs...)
+}
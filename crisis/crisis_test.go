@@ -0,0 +1,90 @@
+package crisis
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pageza/vet-app/mail/mailtest"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+func TestAssess(t *testing.T) {
+	d := NewDetector(DefaultRules(), DefaultThreshold)
+
+	a := d.Assess("Need a ride to the VA on Tuesday")
+	assert.Zero(t, a.Score)
+	assert.False(t, a.Urgent)
+
+	a = d.Assess("I've been thinking about SUICIDE lately.")
+	assert.True(t, a.Urgent)
+	assert.Equal(t, []string{"suicide"}, a.Matches)
+
+	// Weaker phrases add up, and apostrophes and punctuation don't matter.
+	a = d.Assess("I cant go on... feeling hopeless")
+	assert.Equal(t, 9, a.Score)
+	assert.False(t, a.Urgent)
+	a = d.Assess("I can't go on, hopeless, and a burden to everyone")
+	assert.Equal(t, 12, a.Score)
+	assert.True(t, a.Urgent)
+
+	// Phrases only match whole words.
+	a = d.Assess("Looking for a gunsmith and a burdensome paperwork helper")
+	assert.Zero(t, a.Score)
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader("# weight phrase\n10 end it all\n\n3\thopeless\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Rule{{"end it all", 10}, {"hopeless", 3}}, rules)
+
+	_, err = ParseRules(strings.NewReader("hopeless 3\n"))
+	assert.EqualError(t, err, "line 1: weight must be a positive integer")
+	_, err = ParseRules(strings.NewReader("10 end it all\n5 ...\n"))
+	assert.EqualError(t, err, "line 2: phrase is missing")
+}
+
+func TestEscalate(t *testing.T) {
+	repos := repository.NewMemory()
+	owner := models.User{Name: "John Doe", Email: "john@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, &owner))
+	call := models.Call{UserID: owner.ID, Desc: "I want to end my life"}
+	assert.NoError(t, repos.Calls.Create(ctx, &call))
+
+	sender := &mailtest.Sender{}
+	s := NewService(repos, NewDetector(DefaultRules(), DefaultThreshold), sender)
+	a := s.Assess(call.Desc)
+
+	// The call is marked urgent even when there is nobody to page.
+	assert.ErrorIs(t, s.Escalate(ctx, call.ID, a), ErrNoOneOnDuty)
+	fetched, err := repos.Calls.Get(ctx, call.ID)
+	assert.NoError(t, err)
+	assert.True(t, fetched.Urgent)
+
+	call = models.Call{UserID: owner.ID, Desc: "I want to end my life"}
+	assert.NoError(t, repos.Calls.Create(ctx, &call))
+	for _, email := range []string{"mod1@example.com", "mod2@example.com", "off@example.com"} {
+		user := models.User{Name: "Moderator", Email: email}
+		assert.NoError(t, repos.Users.Create(ctx, &user))
+		assert.NoError(t, repos.Roles.Grant(ctx, user.ID, models.RoleModerator))
+		if email != "off@example.com" {
+			assert.NoError(t, repos.Roles.Grant(ctx, user.ID, models.RoleOnDuty))
+		}
+	}
+
+	assert.NoError(t, s.Escalate(ctx, call.ID, a))
+	messages := sender.Messages()
+	if assert.Len(t, messages, 2) {
+		assert.ElementsMatch(t, []string{"mod1@example.com", "mod2@example.com"}, []string{messages[0].To, messages[1].To})
+		assert.Contains(t, messages[0].Body, "end my life")
+		assert.NotContains(t, messages[0].Body, call.Desc)
+	}
+
+	// Moderators are only paged once per call.
+	assert.NoError(t, s.Escalate(ctx, call.ID, a))
+	assert.Len(t, sender.Messages(), 2)
+}
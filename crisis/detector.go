@@ -0,0 +1,155 @@
+package crisis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultThreshold is the score at which the default rules mark text urgent.
+// Any one of their strongest phrases reaches it.
+const DefaultThreshold = 10
+
+// Rule adds Weight to the score of text containing Phrase. Phrases match
+// whole words regardless of case and punctuation, so "can't go on" matches
+// "Cant go on..." too.
+type Rule struct {
+	Phrase string
+	Weight int
+}
+
+// DefaultRules returns the phrases used when no list is configured.
+func DefaultRules() []Rule {
+	return []Rule{
+		{"kill myself", 10},
+		{"killing myself", 10},
+		{"end my life", 10},
+		{"ending my life", 10},
+		{"take my own life", 10},
+		{"suicide", 10},
+		{"suicidal", 10},
+		{"want to die", 10},
+		{"better off dead", 10},
+		{"no reason to live", 6},
+		{"can't go on", 6},
+		{"better off without me", 6},
+		{"hurt myself", 6},
+		{"self harm", 6},
+		{"overdose", 6},
+		{"say goodbye", 4},
+		{"no way out", 4},
+		{"can't take it anymore", 4},
+		{"hopeless", 3},
+		{"worthless", 3},
+		{"burden", 3},
+		{"nobody cares", 3},
+		{"gun", 2},
+		{"pills", 2},
+	}
+}
+
+// ParseRules reads rules one per line, each a positive weight followed by
+// the phrase. Blank lines and lines starting with # are skipped.
+func ParseRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		weight, err := strconv.Atoi(fields[0])
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("line %d: weight must be a positive integer", n)
+		}
+		phrase := strings.Join(fields[1:], " ")
+		if normalize(phrase) == " " {
+			return nil, fmt.Errorf("line %d: phrase is missing", n)
+		}
+		rules = append(rules, Rule{Phrase: phrase, Weight: weight})
+	}
+	return rules, scanner.Err()
+}
+
+// LoadRules reads rules from the file at path as ParseRules does.
+func LoadRules(path string) ([]Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rules, err := ParseRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Assessment is how strongly a text suggests its author is in crisis.
+// Matches lists the phrases found, in the order of the rules.
+type Assessment struct {
+	Score   int
+	Matches []string
+	Urgent  bool
+}
+
+// Detector scores text against weighted phrases.
+type Detector struct {
+	rules     []Rule
+	phrases   []string
+	threshold int
+}
+
+// NewDetector returns a Detector that finds text urgent when the weights of
+// the phrases it contains add up to at least threshold. Each phrase counts
+// once however often it appears.
+func NewDetector(rules []Rule, threshold int) *Detector {
+	d := &Detector{rules: rules, threshold: threshold}
+	for _, rule := range rules {
+		d.phrases = append(d.phrases, normalize(rule.Phrase))
+	}
+	return d
+}
+
+// Assess scores text.
+func (d *Detector) Assess(text string) Assessment {
+	text = normalize(text)
+	var a Assessment
+	for i, rule := range d.rules {
+		if strings.Contains(text, d.phrases[i]) {
+			a.Score += rule.Weight
+			a.Matches = append(a.Matches, rule.Phrase)
+		}
+	}
+	a.Urgent = a.Score > 0 && a.Score >= d.threshold
+	return a
+}
+
+// normalize lower-cases text and reduces it to words separated by single
+// spaces, with a space at either end so that phrases only match whole
+// words. Apostrophes are dropped rather than splitting words.
+func normalize(text string) string {
+	var b strings.Builder
+	b.WriteByte(' ')
+	space := true
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case r == '\'' || r == '’':
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			space = false
+		case !space:
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	if !space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
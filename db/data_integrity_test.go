@@ -8,7 +8,7 @@ import (
 )
 
 func setupDataIntegrity(t *testing.T) {
-	SetupDB(t, &models.User{}, &models.Call{}, &models.Response{})
+	SetupDB(t)
 }
 
 func TestForeignKeyConstraints(t *testing.T) {
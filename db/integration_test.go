@@ -10,7 +10,7 @@ import (
 )
 
 func setupIntegration(t *testing.T) {
-	SetupDB(t, &models.User{}, &models.Call{}, &models.Response{})
+	SetupDB(t)
 	setupRedis(t)
 }
 
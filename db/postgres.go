@@ -9,19 +9,35 @@ import (
 	"gorm.io/gorm"
 )
 
+// DB is the connection opened by InitDB.
+//
+// Deprecated: use Open and pass the *gorm.DB to the code that needs it.
 var DB *gorm.DB
 
-func InitDB(dbConfig config.DBConfig) error {
+// Open connects to the PostgreSQL database described by dbConfig.
+func Open(dbConfig config.DBConfig) (*gorm.DB, error) {
 	dsn := fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%d sslmode=disable",
 		dbConfig.Host, dbConfig.User, dbConfig.Password, dbConfig.Name, dbConfig.Port,
 	)
 
-	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		// Surface constraint violations as gorm.ErrDuplicatedKey and friends
+		TranslateError: true,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to connect to the database: %v", err)
+		return nil, fmt.Errorf("failed to connect to the database: %w", err)
 	}
 	log.Println("Database connected successfully")
+	return conn, nil
+}
+
+// InitDB opens a connection with Open and stores it in DB.
+func InitDB(dbConfig config.DBConfig) error {
+	conn, err := Open(dbConfig)
+	if err != nil {
+		return err
+	}
+	DB = conn
 	return nil
 }
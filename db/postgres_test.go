@@ -11,7 +11,7 @@ import (
 )
 
 func setup(t *testing.T) {
-	SetupDB(t, &models.User{})
+	SetupDB(t)
 }
 
 func TestInitDB(t *testing.T) {
@@ -34,7 +34,7 @@ func TestInitDBConnectionFailure(t *testing.T) {
 
 func TestDatabaseMigrations(t *testing.T) {
 	setup(t)
-	// No specific assertions needed here as setup runs AutoMigrate
+	// No specific assertions needed here as setup applies the migrations
 }
 
 func TestDataInsertionAndRetrieval(t *testing.T) {
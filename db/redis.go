@@ -5,31 +5,49 @@ import (
 	"fmt"
 	"log"
 	"time"
-	
+
 	"github.com/go-redis/redis/v8"
 
 	"github.com/pageza/vet-app/config"
 )
 
+// RedisClient is the client created by InitRedis.
+//
+// Deprecated: use NewRedisClient and pass the client to the code that
+// needs it.
 var RedisClient *redis.Client
+
+// RedisCtx is the context used with RedisClient.
+//
+// Deprecated: use the context of the request or operation instead.
 var RedisCtx = context.Background()
 
-func InitRedis(config config.Config) error {
-	RedisClient = redis.NewClient(&redis.Options{
+// NewRedisClient creates a Redis client from config and checks that the
+// server is reachable. The client is returned even if the ping fails.
+func NewRedisClient(config config.Config) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
 		Addr:     fmt.Sprintf("%s:%d", config.RedisHost, config.RedisPort),
 		Password: config.RedisPassword,
 		DB:       config.RedisDB,
 	})
 
-	ctx, cancel := context.WithTimeout(RedisCtx, 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := RedisClient.Ping(ctx).Result()
+	_, err := client.Ping(ctx).Result()
 	if err != nil {
 		log.Printf("Failed to connect to Redis: %v", err)
-		return err
+		return client, err
 	}
 
 	log.Println("Redis connected successfully")
-	return nil
+	return client, nil
+}
+
+// InitRedis creates a client with NewRedisClient and stores it in
+// RedisClient.
+func InitRedis(config config.Config) error {
+	client, err := NewRedisClient(config)
+	RedisClient = client
+	return err
 }
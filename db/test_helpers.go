@@ -1,10 +1,12 @@
 package db
 
 import (
+	"context"
 	"log"
 	"testing"
 
 	"github.com/pageza/vet-app/config"
+	"github.com/pageza/vet-app/migrations"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
 )
@@ -19,8 +21,8 @@ func ClearDB(db *gorm.DB) {
 	}
 }
 
-// SetupDB is a helper function to initialize the database, run migrations, and clear the tables.
-func SetupDB(t *testing.T, models ...interface{}) {
+// SetupDB is a helper function to initialize the database, apply migrations, and clear the tables.
+func SetupDB(t *testing.T) {
 	config, err := config.LoadConfig("../")
 	if err != nil {
 		t.Fatalf("Failed to load config: %v", err)
@@ -30,7 +32,11 @@ func SetupDB(t *testing.T, models ...interface{}) {
 	assert.NoError(t, err)
 
 	// Run migrations
-	err = DB.AutoMigrate(models...)
+	sqlDB, err := DB.DB()
+	assert.NoError(t, err)
+	migrator, err := migrations.New(sqlDB)
+	assert.NoError(t, err)
+	_, err = migrator.Up(context.Background())
 	assert.NoError(t, err)
 
 	// Clear the database before each test
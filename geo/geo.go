@@ -0,0 +1,86 @@
+// Package geo provides the geographic primitives used to place calls and
+// volunteers: points, distances between them, circular areas such as a
+// search radius or a service area, fuzzing of coordinates shown to the
+// public, and ZIP code lookups. Distances are in miles.
+package geo
+
+import (
+	"math"
+	"math/rand/v2"
+)
+
+// EarthRadius is the mean radius of the Earth in miles.
+const EarthRadius = 3958.8
+
+// Point is a position in decimal degrees.
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// Valid reports whether p is a real position on the Earth.
+func (p Point) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+// Distance returns the great-circle distance between a and b.
+func Distance(a, b Point) float64 {
+	dLat := radians(b.Lat - a.Lat)
+	dLng := radians(b.Lng - a.Lng)
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(radians(a.Lat))*math.Cos(radians(b.Lat))*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * EarthRadius * math.Asin(math.Sqrt(math.Min(h, 1)))
+}
+
+// Offset returns the point distance miles from p in the direction of
+// bearing, in degrees clockwise from north.
+func Offset(p Point, distance, bearing float64) Point {
+	d := distance / EarthRadius
+	b := radians(bearing)
+	lat1, lng1 := radians(p.Lat), radians(p.Lng)
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(b))
+	lng2 := lng1 + math.Atan2(math.Sin(b)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+	return Point{Lat: degrees(lat2), Lng: math.Mod(degrees(lng2)+540, 360) - 180}
+}
+
+// Fuzz returns a random point within radius miles of p, spread evenly over
+// the circle. Coordinates shown to the public are fuzzed once, when they are
+// stored, so that averaging many reads does not reveal the real ones.
+func Fuzz(p Point, radius float64) Point {
+	if radius <= 0 {
+		return p
+	}
+	return Offset(p, radius*math.Sqrt(rand.Float64()), rand.Float64()*360)
+}
+
+// Circle is the area within Radius miles of Center.
+type Circle struct {
+	Center Point
+	Radius float64
+}
+
+// Contains reports whether p lies in c.
+func (c Circle) Contains(p Point) bool {
+	return Distance(c.Center, p) <= c.Radius
+}
+
+// Bounds returns the corners of a box holding c, for narrowing a search
+// with an index before measuring distances. Near the poles or the 180th
+// meridian the box spans every longitude.
+func (c Circle) Bounds() (min, max Point) {
+	dLat := degrees(c.Radius / EarthRadius)
+	min = Point{Lat: c.Center.Lat - dLat, Lng: -180}
+	max = Point{Lat: c.Center.Lat + dLat, Lng: 180}
+	if min.Lat <= -90 || max.Lat >= 90 {
+		min.Lat, max.Lat = math.Max(min.Lat, -90), math.Min(max.Lat, 90)
+		return min, max
+	}
+	dLng := degrees(math.Asin(math.Sin(c.Radius/EarthRadius) / math.Cos(radians(c.Center.Lat))))
+	if c.Center.Lng-dLng >= -180 && c.Center.Lng+dLng <= 180 {
+		min.Lng, max.Lng = c.Center.Lng-dLng, c.Center.Lng+dLng
+	}
+	return min, max
+}
+
+func radians(deg float64) float64 { return deg * math.Pi / 180 }
+
+func degrees(rad float64) float64 { return rad * 180 / math.Pi }
@@ -0,0 +1,100 @@
+package geo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	washington = Point{Lat: 38.8977, Lng: -77.0365}
+	baltimore  = Point{Lat: 39.2904, Lng: -76.6122}
+)
+
+func TestDistance(t *testing.T) {
+	assert.InDelta(t, 35.8, Distance(washington, baltimore), 0.5)
+	assert.InDelta(t, Distance(washington, baltimore), Distance(baltimore, washington), 1e-9)
+	assert.Zero(t, Distance(washington, washington))
+}
+
+func TestOffset(t *testing.T) {
+	north := Offset(washington, 10, 0)
+	assert.InDelta(t, 10, Distance(washington, north), 1e-6)
+	assert.Greater(t, north.Lat, washington.Lat)
+	assert.InDelta(t, washington.Lng, north.Lng, 1e-9)
+
+	wrapped := Offset(Point{Lat: 0, Lng: 179.9}, 20, 90)
+	assert.True(t, wrapped.Valid())
+	assert.Less(t, wrapped.Lng, 0.0)
+}
+
+func TestFuzz(t *testing.T) {
+	moved := 0
+	for i := 0; i < 100; i++ {
+		p := Fuzz(washington, 2)
+		assert.LessOrEqual(t, Distance(washington, p), 2+1e-9)
+		if p != washington {
+			moved++
+		}
+	}
+	assert.Equal(t, 100, moved)
+	assert.Equal(t, washington, Fuzz(washington, 0))
+}
+
+func TestCircle(t *testing.T) {
+	c := Circle{Center: washington, Radius: 40}
+	assert.True(t, c.Contains(baltimore))
+	assert.False(t, Circle{Center: washington, Radius: 30}.Contains(baltimore))
+
+	min, max := c.Bounds()
+	for bearing := 0.0; bearing < 360; bearing += 15 {
+		p := Offset(washington, 39.99, bearing)
+		assert.True(t, p.Lat >= min.Lat && p.Lat <= max.Lat && p.Lng >= min.Lng && p.Lng <= max.Lng, "bearing %v", bearing)
+	}
+	assert.Less(t, max.Lat-min.Lat, 2.0)
+
+	min, max = Circle{Center: Point{Lat: 10, Lng: 179.5}, Radius: 100}.Bounds()
+	assert.Equal(t, -180.0, min.Lng)
+	assert.Equal(t, 180.0, max.Lng)
+
+	min, max = Circle{Center: Point{Lat: 89.9, Lng: 0}, Radius: 100}.Bounds()
+	assert.Equal(t, 90.0, max.Lat)
+	assert.Equal(t, -180.0, min.Lng)
+}
+
+func TestNormalizeZIP(t *testing.T) {
+	for in, want := range map[string]string{"20500": "20500", " 20500-0003 ": "20500", "2050": "", "20500-03": "", "2050a": ""} {
+		zip, ok := NormalizeZIP(in)
+		assert.Equal(t, want, zip, in)
+		assert.Equal(t, want != "", ok, in)
+	}
+}
+
+func TestParseZIPCodes(t *testing.T) {
+	zips, err := ParseZIPCodes(strings.NewReader(
+		"GEOID\tALAND\tAWATER\tALAND_SQMI\tAWATER_SQMI\tINTPTLAT\tINTPTLONG                                                                                                               \n" +
+			"20500\t72587\t0\t0.028\t0.000\t38.897700\t-77.036500\n" +
+			"\n" +
+			"21202\t4423413\t24519\t1.708\t0.009\t39.290400\t-76.612200\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, ZIPCodes{"20500": washington, "21202": baltimore}, zips)
+
+	_, err = ParseZIPCodes(strings.NewReader("GEOID\tLAT\tLNG\n"))
+	assert.Error(t, err)
+	_, err = ParseZIPCodes(strings.NewReader("GEOID\tINTPTLAT\tINTPTLONG\n20500\t91\t0\n"))
+	assert.Error(t, err)
+}
+
+func TestLocator(t *testing.T) {
+	l := NewLocator(ZIPCodes{"20500": washington}, 1)
+	p, err := l.ZIP("20500")
+	assert.NoError(t, err)
+	assert.Equal(t, &washington, p)
+	_, err = l.ZIP("99999")
+	assert.ErrorIs(t, err, ErrUnknownZIP)
+	assert.LessOrEqual(t, Distance(washington, l.Public(washington)), 1+1e-9)
+
+	_, err = NewLocator(nil, 1).ZIP("20500")
+	assert.ErrorIs(t, err, ErrNoZIPCodes)
+}
@@ -0,0 +1,42 @@
+package geo
+
+import "errors"
+
+// Errors returned when a Locator cannot place a ZIP code.
+var (
+	ErrUnknownZIP = errors.New("geo: unknown ZIP code")
+	// ErrNoZIPCodes means the Locator was given no ZIP codes at all.
+	ErrNoZIPCodes = errors.New("geo: ZIP lookup is not configured")
+)
+
+// Locator turns the locations users give into points and decides where
+// they are shown to the public.
+type Locator struct {
+	zips       ZIPCodes
+	fuzzRadius float64
+}
+
+// NewLocator returns a Locator that places ZIP codes with zips, which may
+// be nil, and fuzzes public coordinates by up to fuzzRadius miles.
+func NewLocator(zips ZIPCodes, fuzzRadius float64) *Locator {
+	return &Locator{zips: zips, fuzzRadius: fuzzRadius}
+}
+
+// ZIP returns the center of a five-digit ZIP code, or ErrUnknownZIP if it
+// is not known. It returns ErrNoZIPCodes if the Locator knows no ZIP codes
+// at all.
+func (l *Locator) ZIP(zip string) (*Point, error) {
+	if len(l.zips) == 0 {
+		return nil, ErrNoZIPCodes
+	}
+	p, ok := l.zips[zip]
+	if !ok {
+		return nil, ErrUnknownZIP
+	}
+	return &p, nil
+}
+
+// Public returns where p is shown to the public: a random point near it.
+func (l *Locator) Public(p Point) Point {
+	return Fuzz(p, l.fuzzRadius)
+}
@@ -0,0 +1,96 @@
+package geo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ZIPCodes maps five-digit ZIP codes to the point at their center.
+type ZIPCodes map[string]Point
+
+// NormalizeZIP returns the five-digit form of a ZIP or ZIP+4 code, or false
+// if zip is neither.
+func NormalizeZIP(zip string) (string, bool) {
+	zip = strings.TrimSpace(zip)
+	if len(zip) == 10 && zip[5] == '-' && digits(zip[6:]) {
+		zip = zip[:5]
+	}
+	if len(zip) != 5 || !digits(zip) {
+		return "", false
+	}
+	return zip, true
+}
+
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseZIPCodes reads a Census Bureau ZCTA gazetteer file: tab-separated
+// columns with a header naming them, of which GEOID, INTPTLAT and INTPTLONG
+// are used.
+func ParseZIPCodes(r io.Reader) (ZIPCodes, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("missing header")
+	}
+	columns := map[string]int{}
+	for i, name := range strings.Fields(scanner.Text()) {
+		columns[name] = i
+	}
+	for _, name := range []string{"GEOID", "INTPTLAT", "INTPTLONG"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("header has no %s column", name)
+		}
+	}
+
+	zips := ZIPCodes{}
+	for n := 2; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != len(columns) {
+			return nil, fmt.Errorf("line %d: expected %d columns", n, len(columns))
+		}
+		zip, ok := NormalizeZIP(fields[columns["GEOID"]])
+		if !ok {
+			return nil, fmt.Errorf("line %d: invalid ZIP code %q", n, fields[columns["GEOID"]])
+		}
+		lat, err := strconv.ParseFloat(fields[columns["INTPTLAT"]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid latitude", n)
+		}
+		lng, err := strconv.ParseFloat(fields[columns["INTPTLONG"]], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid longitude", n)
+		}
+		p := Point{Lat: lat, Lng: lng}
+		if !p.Valid() {
+			return nil, fmt.Errorf("line %d: position out of range", n)
+		}
+		zips[zip] = p
+	}
+	return zips, scanner.Err()
+}
+
+// LoadZIPCodes reads a ZCTA gazetteer file from path.
+func LoadZIPCodes(path string) (ZIPCodes, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseZIPCodes(f)
+}
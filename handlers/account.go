@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pageza/vet-app/account"
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/rbac"
+	"github.com/pageza/vet-app/repository"
+)
+
+// Account serves the endpoints for exporting a user's data and deleting
+// their account.
+type Account struct {
+	users   repository.UserRepository
+	service *account.Service
+}
+
+// NewAccount returns the account handlers.
+func NewAccount(repos repository.Repositories, service *account.Service) *Account {
+	return &Account{users: repos.Users, service: service}
+}
+
+// deletionStatus describes a pending account deletion. Both fields are null
+// when there is none.
+type deletionStatus struct {
+	RequestedAt *time.Time `json:"requested_at"`
+	PurgeAt     *time.Time `json:"purge_at"`
+}
+
+// ExportUser handles GET /users/{id}/export, returning everything stored
+// about the acting user as a JSON file to download. Users may only export
+// their own data.
+func (h *Account) ExportUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.self(w, r)
+	if !ok {
+		return
+	}
+	archive, err := h.service.Export(r.Context(), user)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="vet-app-user-%d.json"`, user.ID))
+	writeJSON(w, http.StatusOK, archive)
+}
+
+// RequestDeletion handles POST /users/{id}/deletion, scheduling the acting
+// user's account for deletion once the grace period ends. Until then their
+// profile and content are hidden and they may cancel.
+func (h *Account) RequestDeletion(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.self(w, r)
+	if !ok {
+		return
+	}
+	if err := h.service.RequestDeletion(r.Context(), user); err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, deletionStatus{RequestedAt: user.DeletionRequestedAt, PurgeAt: h.service.PurgeAt(user)})
+}
+
+// CancelDeletion handles DELETE /users/{id}/deletion, keeping an account
+// whose deletion was requested. Users may cancel their own deletion and
+// users allowed to delete users may cancel anyone's.
+func (h *Account) CancelDeletion(w http.ResponseWriter, r *http.Request) {
+	acting, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("user not found"))
+		return
+	}
+	if acting.ID != id && !rbac.Can(r.Context(), models.PermissionDeleteUsers) {
+		writeError(w, r, apierr.Forbidden("you can only cancel the deletion of your own account"))
+		return
+	}
+	user, err := h.users.Get(r.Context(), id)
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	if err := h.service.CancelDeletion(r.Context(), user); err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, deletionStatus{})
+}
+
+// self returns the acting user if the id path variable names them, writing
+// an error otherwise.
+func (h *Account) self(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return nil, false
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("user not found"))
+		return nil, false
+	}
+	if id != user.ID {
+		writeError(w, r, apierr.Forbidden("you can only do this for your own account"))
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pageza/vet-app/account"
+	"github.com/pageza/vet-app/mail/mailtest"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupAccount(t *testing.T) (*mux.Router, repository.Repositories) {
+	repos := repository.NewMemory()
+	client := newRedis(t)
+	authz := newAuthorizer(repos, client)
+	accounts := account.NewService(repos, newSessionStore(client), newTokenService(t, client), authz, 30*24*time.Hour)
+	h := New(repos, newCrisis(repos, &mailtest.Sender{}), testLocator, 10*time.Minute)
+	a := NewAccount(repos, accounts)
+
+	r := mux.NewRouter()
+	r.Use(testAuth(repos.Users), authz.Middleware)
+	r.HandleFunc("/users", h.GetUsers).Methods("GET")
+	r.HandleFunc("/users/{id:[0-9]+}", h.GetUser).Methods("GET")
+	r.HandleFunc("/users/{id:[0-9]+}/export", a.ExportUser).Methods("GET")
+	r.HandleFunc("/users/{id:[0-9]+}/deletion", a.RequestDeletion).Methods("POST")
+	r.HandleFunc("/users/{id:[0-9]+}/deletion", a.CancelDeletion).Methods("DELETE")
+	r.HandleFunc("/calls", h.GetCalls).Methods("GET")
+	return r, repos
+}
+
+func TestExportUser(t *testing.T) {
+	r, repos := setupAccount(t)
+	user := createUser(t, repos, "John Doe", "john@example.com", false)
+	other := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+	assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: user.ID, Desc: "Need a ride"}))
+	path := fmt.Sprintf("/users/%d/export", user.ID)
+
+	rec := doRequest(r, "GET", path, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = doRequestAs(r, other.ID, "GET", path, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequestAs(r, user.ID, "GET", path, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), fmt.Sprintf("vet-app-user-%d.json", user.ID))
+	var archive account.Archive
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&archive))
+	assert.Equal(t, "john@example.com", archive.User.Email)
+	assert.Len(t, archive.Calls, 1)
+	assert.Empty(t, archive.Responses)
+}
+
+func TestAccountDeletion(t *testing.T) {
+	r, repos := setupAccount(t)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+	user := createUser(t, repos, "John Doe", "john@example.com", false)
+	other := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+	assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: user.ID, Desc: "Need a ride"}))
+	path := fmt.Sprintf("/users/%d/deletion", user.ID)
+	profile := fmt.Sprintf("/users/%d", user.ID)
+
+	rec := doRequestAs(r, other.ID, "POST", path, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequestAs(r, user.ID, "POST", path, nil)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	var status deletionStatus
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&status))
+	if assert.NotNil(t, status.RequestedAt) && assert.NotNil(t, status.PurgeAt) {
+		assert.WithinDuration(t, status.RequestedAt.Add(30*24*time.Hour), *status.PurgeAt, time.Second)
+	}
+
+	// Others no longer see the user or their calls.
+	rec = doRequestAs(r, other.ID, "GET", profile, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = doRequestAs(r, other.ID, "GET", "/users", nil)
+	assert.NotContains(t, rec.Body.String(), "john@example.com")
+	rec = doRequestAs(r, other.ID, "GET", "/calls", nil)
+	assert.NotContains(t, rec.Body.String(), "Need a ride")
+
+	// The user and admins still do.
+	rec = doRequestAs(r, user.ID, "GET", profile, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequestAs(r, admin.ID, "GET", profile, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequestAs(r, admin.ID, "GET", "/calls", nil)
+	assert.Contains(t, rec.Body.String(), "Need a ride")
+
+	rec = doRequestAs(r, other.ID, "DELETE", path, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = doRequestAs(r, user.ID, "DELETE", path, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequestAs(r, other.ID, "GET", profile, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Admins may cancel on the user's behalf.
+	doRequestAs(r, user.ID, "POST", path, nil)
+	rec = doRequestAs(r, admin.ID, "DELETE", path, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	stored, _ := repos.Users.Get(ctx, user.ID)
+	assert.False(t, stored.DeletionRequested())
+}
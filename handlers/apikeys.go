@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/apikey"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/repository"
+)
+
+// APIKeys serves the endpoints for managing partner organizations and
+// their API keys. Their routes are expected to require the api_keys:manage
+// permission.
+type APIKeys struct {
+	orgs    repository.OrganizationRepository
+	keys    repository.APIKeyRepository
+	service *apikey.Service
+}
+
+// NewAPIKeys returns the API key handlers. Keys are issued by service.
+func NewAPIKeys(repos repository.Repositories, service *apikey.Service) *APIKeys {
+	return &APIKeys{orgs: repos.Organizations, keys: repos.APIKeys, service: service}
+}
+
+// apiKeyInput is the request body accepted by CreateAPIKey. RateLimit
+// defaults to API_KEY_DEFAULT_RATE_LIMIT and keys without ExpiresAt never
+// expire.
+type apiKeyInput struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	RateLimit int        `json:"rate_limit"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// validate normalizes the input and returns any field errors.
+func (in *apiKeyInput) validate(now time.Time) map[string]string {
+	in.Name = strings.TrimSpace(in.Name)
+
+	fields := map[string]string{}
+	switch {
+	case in.Name == "":
+		fields["name"] = "is required"
+	case len(in.Name) > 255:
+		fields["name"] = "must be at most 255 characters"
+	}
+	if len(in.Scopes) == 0 {
+		fields["scopes"] = "is required"
+	}
+	for _, scope := range in.Scopes {
+		if !models.ValidScope(scope) {
+			fields["scopes"] = "contains an unknown scope"
+		}
+	}
+	if in.RateLimit < 0 {
+		fields["rate_limit"] = "must be positive"
+	}
+	if in.ExpiresAt != nil && !in.ExpiresAt.After(now) {
+		fields["expires_at"] = "must be in the future"
+	}
+	return fields
+}
+
+// createdAPIKey is the response of CreateAPIKey, the only one that
+// includes the key itself.
+type createdAPIKey struct {
+	*models.APIKey
+	Key string `json:"key"`
+}
+
+// GetOrganizations handles GET /organizations.
+func (h *APIKeys) GetOrganizations(w http.ResponseWriter, r *http.Request) {
+	orgs, err := h.orgs.List(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, listResponse[models.Organization]{Data: orgs})
+}
+
+// CreateOrganization handles POST /organizations, which takes the same
+// body as CreateUser and creates the organization along with its service
+// account. The email is the organization's contact address.
+func (h *APIKeys) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	var in userInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	if fields := in.validate(); len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+
+	org := models.Organization{Name: in.Name, User: models.User{Name: in.Name, Email: in.Email}}
+	if err := h.orgs.Create(r.Context(), &org); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			err = apierr.Conflict("name or email is already in use")
+		}
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, org)
+}
+
+// GetAPIKeys handles GET /organizations/{id}/api-keys, including revoked
+// and expired keys.
+func (h *APIKeys) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	org, ok := h.organization(w, r)
+	if !ok {
+		return
+	}
+	keys, err := h.keys.List(r.Context(), org.ID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, listResponse[models.APIKey]{Data: keys})
+}
+
+// CreateAPIKey handles POST /organizations/{id}/api-keys. The key is in the
+// response and cannot be shown again.
+func (h *APIKeys) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	org, ok := h.organization(w, r)
+	if !ok {
+		return
+	}
+	var in apiKeyInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	if fields := in.validate(time.Now()); len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+
+	key := models.APIKey{
+		OrganizationID: org.ID,
+		Name:           in.Name,
+		Scopes:         in.Scopes,
+		RateLimit:      in.RateLimit,
+		ExpiresAt:      in.ExpiresAt,
+	}
+	raw, err := h.service.Issue(r.Context(), &key)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, createdAPIKey{APIKey: &key, Key: raw})
+}
+
+// RevokeAPIKey handles DELETE /api-keys/{id}. Revoked keys stay listed.
+func (h *APIKeys) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("API key not found"))
+		return
+	}
+	if err := h.keys.Revoke(r.Context(), id, time.Now()); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = apierr.NotFound("API key not found")
+		}
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// organization loads the organization named by the id path variable,
+// writing a 404 if there is none.
+func (h *APIKeys) organization(w http.ResponseWriter, r *http.Request) (*models.Organization, bool) {
+	notFound := apierr.NotFound("organization not found")
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, notFound)
+		return nil, false
+	}
+	org, err := h.orgs.Get(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		err = notFound
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return nil, false
+	}
+	return org, true
+}
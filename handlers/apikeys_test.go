@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pageza/vet-app/apikey"
+	"github.com/pageza/vet-app/mail/mailtest"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"github.com/pageza/vet-app/ratelimit"
+	"github.com/pageza/vet-app/rbac"
+	"github.com/pageza/vet-app/repository"
+	"github.com/pageza/vet-app/twofactor"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupAPIKeys(t *testing.T) (*mux.Router, repository.Repositories) {
+	repos := repository.NewMemory()
+	client := newRedis(t)
+	authz := newAuthorizer(repos, client)
+	keys := apikey.NewService(repos, ratelimit.NewLimiter(client), 60)
+	stepUp := twofactor.RequireStepUp(10 * time.Minute)
+	h := New(repos, newCrisis(repos, &mailtest.Sender{}), testLocator, 10*time.Minute)
+	apiKeys := NewAPIKeys(repos, keys)
+
+	r := mux.NewRouter()
+	r.Use(testAuth(repos.Users), keys.Middleware, authz.Middleware)
+	r.Handle("/organizations", rbac.RequireFunc(models.PermissionManageAPIKeys, apiKeys.GetOrganizations)).Methods("GET")
+	r.Handle("/organizations", rbac.RequireFunc(models.PermissionManageAPIKeys, apiKeys.CreateOrganization)).Methods("POST")
+	r.Handle("/organizations/{id:[0-9]+}/api-keys", rbac.RequireFunc(models.PermissionManageAPIKeys, apiKeys.GetAPIKeys)).Methods("GET")
+	r.Handle("/organizations/{id:[0-9]+}/api-keys", rbac.RequireFunc(models.PermissionManageAPIKeys, stepUp(apiKeys.CreateAPIKey))).Methods("POST")
+	r.Handle("/api-keys/{id:[0-9]+}", rbac.RequireFunc(models.PermissionManageAPIKeys, apiKeys.RevokeAPIKey)).Methods("DELETE")
+	r.Handle("/calls", keys.RequireScope(models.ScopeCallsRead, http.HandlerFunc(h.GetCalls))).Methods("GET")
+	r.Handle("/calls/{call_id}/responses", keys.RequireScope(models.ScopeResponsesWrite, rbac.RequireFunc(models.PermissionCreateResponses, h.CreateResponse))).Methods("POST")
+	r.HandleFunc("/calls/{id}", h.DeleteCall).Methods("DELETE")
+	return r, repos
+}
+
+// doRequestWithKey sends a request authenticated by an API key.
+func doRequestWithKey(r http.Handler, key, method, path string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "ApiKey "+key)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestManageAPIKeys(t *testing.T) {
+	r, repos := setupAPIKeys(t)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+	volunteer := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+	org := map[string]string{"name": "Helping Vets", "email": "api@helpingvets.org"}
+
+	rec := doRequestAs(r, volunteer.ID, "POST", "/organizations", org)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequestAs(r, admin.ID, "POST", "/organizations", org)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var created models.Organization
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	assert.NotZero(t, created.UserID)
+	rec = doRequestAs(r, admin.ID, "POST", "/organizations", org)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	path := fmt.Sprintf("/organizations/%d/api-keys", created.ID)
+	rec = doRequestAs(r, admin.ID, "POST", path, map[string]interface{}{"name": "Case system", "scopes": []string{"calls:delete"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "scopes")
+	rec = doRequestAs(r, admin.ID, "POST", "/organizations/999999/api-keys", map[string]interface{}{"name": "Case system", "scopes": []string{"calls:read"}})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = doRequestAs(r, admin.ID, "POST", path, map[string]interface{}{"name": "Case system", "scopes": []string{"calls:read"}})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var key createdAPIKey
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&key))
+	assert.Contains(t, key.Key, "vak_"+key.Prefix+"_")
+	assert.Equal(t, 60, key.RateLimit)
+	assert.Equal(t, models.Words{models.ScopeCallsRead}, key.Scopes)
+
+	rec = doRequestAs(r, admin.ID, "GET", path, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), key.Key)
+	var list listResponse[models.APIKey]
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+	assert.Len(t, list.Data, 1)
+
+	revoke := fmt.Sprintf("/api-keys/%d", key.ID)
+	assert.Equal(t, http.StatusNoContent, doRequestAs(r, admin.ID, "DELETE", revoke, nil).Code)
+	assert.Equal(t, http.StatusNotFound, doRequestAs(r, admin.ID, "DELETE", "/api-keys/999999", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, doRequestWithKey(r, key.Key, "GET", "/calls", "").Code)
+}
+
+func TestAPIKeyRequests(t *testing.T) {
+	r, repos := setupAPIKeys(t)
+	veteran := createVeteran(t, repos, "John Doe", "john@example.com")
+	call := models.Call{UserID: veteran.ID, Desc: "Rough night", VeteranOnly: true}
+	assert.NoError(t, repos.Calls.Create(ctx, &call))
+
+	org := models.Organization{Name: "Helping Vets", User: models.User{Name: "Helping Vets", Email: "api@helpingvets.org"}}
+	assert.NoError(t, repos.Organizations.Create(ctx, &org))
+	keys := apikey.NewService(repos, ratelimit.NewLimiter(newRedis(t)), 60)
+	reader, err := keys.Issue(ctx, &models.APIKey{OrganizationID: org.ID, Scopes: models.Words{models.ScopeCallsRead}})
+	assert.NoError(t, err)
+	veteranReader, err := keys.Issue(ctx, &models.APIKey{OrganizationID: org.ID, Scopes: models.Words{models.ScopeCallsRead, models.ScopeCallsReadVeteranOnly}})
+	assert.NoError(t, err)
+	writer, err := keys.Issue(ctx, &models.APIKey{OrganizationID: org.ID, Scopes: models.Words{models.ScopeCallsRead, models.ScopeCallsReadVeteranOnly, models.ScopeResponsesWrite}})
+	assert.NoError(t, err)
+
+	// Only keys given the veteran-only scope see the calls verified
+	// veterans see.
+	rec := doRequestWithKey(r, reader, "GET", "/calls", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var page pagination.Page[callView]
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	assert.Empty(t, page.Data)
+	rec = doRequestWithKey(r, veteranReader, "GET", "/calls", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	assert.Len(t, page.Data, 1)
+
+	path := fmt.Sprintf("/calls/%d/responses", call.ID)
+	rec = doRequestWithKey(r, reader, "POST", path, `{"msg": "We can help"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = doRequestWithKey(r, writer, "POST", path, `{"msg": "We can help"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var response responseView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.Equal(t, org.UserID, response.Author.ID)
+
+	// Routes that take no scope treat key requests as anonymous.
+	rec = doRequestWithKey(r, reader, "DELETE", fmt.Sprintf("/calls/%d", call.ID), "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = doRequestWithKey(r, "vak_0000000000000000_secret", "GET", "/calls", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
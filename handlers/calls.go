@@ -0,0 +1,641 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/callstatus"
+	"github.com/pageza/vet-app/crisis"
+	"github.com/pageza/vet-app/geo"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"github.com/pageza/vet-app/rbac"
+	"github.com/pageza/vet-app/repository"
+)
+
+// authorSummary is the public view of a user attached to calls and responses.
+type authorSummary struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+func newAuthorSummary(user models.User) authorSummary {
+	return authorSummary{ID: user.ID, Name: user.Name}
+}
+
+// categorySummary is the view of a category attached to calls.
+type categorySummary struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// locationView says where a call is. Exact is false when the coordinates
+// are the fuzzed ones shown to the public, and both are null when the call
+// was only given a ZIP code that could not be placed.
+type locationView struct {
+	Lat   *float64 `json:"lat"`
+	Lng   *float64 `json:"lng"`
+	ZIP   string   `json:"zip,omitempty"`
+	Exact bool     `json:"exact"`
+}
+
+// callView is the JSON representation of a call. Urgent calls come with
+// crisis resources, and calls found by a radius search with their distance
+// in miles.
+type callView struct {
+	models.Call
+	Author          authorSummary     `json:"author"`
+	Category        *categorySummary  `json:"category"`
+	Tags            []string          `json:"tags"`
+	Location        *locationView     `json:"location"`
+	Miles           *float64          `json:"distance,omitempty"`
+	CrisisResources []crisis.Resource `json:"crisis_resources,omitempty"`
+}
+
+func newCallView(r *http.Request, call models.Call) callView {
+	v := callView{Call: call, Author: newAuthorSummary(call.User), Tags: []string{}}
+	if call.Urgent {
+		v.CrisisResources = crisis.Resources
+	}
+	if call.Category != nil {
+		v.Category = &categorySummary{Slug: call.Category.Slug, Name: call.Category.Name}
+	}
+	for _, tag := range call.Tags {
+		v.Tags = append(v.Tags, tag.Name)
+	}
+	if call.PublicLatitude != nil || call.ZIP != "" {
+		v.Location = &locationView{Lat: call.PublicLatitude, Lng: call.PublicLongitude, ZIP: call.ZIP}
+		if canSeeLocation(r, &call) {
+			v.Location.Lat, v.Location.Lng, v.Location.Exact = call.Latitude, call.Longitude, true
+		}
+	}
+	if call.Distance != nil {
+		miles := math.Round(*call.Distance*10) / 10
+		v.Miles = &miles
+	}
+	return v
+}
+
+func callViewKey(v callView) pagination.Key {
+	key := pagination.Key{ID: v.ID, CreatedAt: v.CreatedAt}
+	if v.Call.Distance != nil {
+		key.Distance = *v.Call.Distance
+	}
+	return key
+}
+
+// maxCallTags caps how many tags a call may have.
+const maxCallTags = 10
+
+// callInput is the request body accepted by CreateCall and UpdateCall. An
+// empty Category takes a call out of its category, and an empty Location
+// removes its location.
+type callInput struct {
+	Desc        string         `json:"desc"`
+	VeteranOnly *bool          `json:"veteran_only"`
+	Category    *string        `json:"category"`
+	Tags        *[]string      `json:"tags"`
+	Location    *locationInput `json:"location"`
+}
+
+// locationInput says where a call is, by coordinates, by ZIP code or both.
+// Calls given only a ZIP code are placed at its center.
+type locationInput struct {
+	Lat *float64 `json:"lat"`
+	Lng *float64 `json:"lng"`
+	ZIP string   `json:"zip"`
+}
+
+// validate normalizes the input and returns any field errors.
+func (in *callInput) validate() map[string]string {
+	in.Desc = strings.TrimSpace(in.Desc)
+
+	fields := map[string]string{}
+	switch {
+	case in.Desc == "":
+		fields["desc"] = "is required"
+	case len(in.Desc) > 255:
+		fields["desc"] = "must be at most 255 characters"
+	}
+	if in.Category != nil {
+		*in.Category = strings.ToLower(strings.TrimSpace(*in.Category))
+	}
+	if in.Tags != nil {
+		tags, msg := normalizeTags(*in.Tags)
+		switch {
+		case msg != "":
+			fields["tags"] = msg
+		case len(tags) > maxCallTags:
+			fields["tags"] = fmt.Sprintf("must have at most %d tags", maxCallTags)
+		}
+		*in.Tags = tags
+	}
+	if loc := in.Location; loc != nil {
+		switch {
+		case (loc.Lat == nil) != (loc.Lng == nil):
+			fields["location"] = "must have both lat and lng or neither"
+		case loc.Lat != nil && !(geo.Point{Lat: *loc.Lat, Lng: *loc.Lng}).Valid():
+			fields["location"] = "must have lat between -90 and 90 and lng between -180 and 180"
+		}
+		if loc.ZIP != "" {
+			zip, ok := geo.NormalizeZIP(loc.ZIP)
+			if !ok {
+				fields["location.zip"] = "must be a five-digit ZIP code"
+			}
+			loc.ZIP = zip
+		}
+	}
+	return fields
+}
+
+// apply copies the input onto call, looking up its category and placing
+// it. It returns field errors if the category or ZIP code is not known.
+func (in *callInput) apply(r *http.Request, categories repository.CategoryRepository, locator *geo.Locator, call *models.Call) (map[string]string, error) {
+	call.Desc = in.Desc
+	if in.VeteranOnly != nil {
+		call.VeteranOnly = *in.VeteranOnly
+	}
+	if in.Tags != nil {
+		call.Tags = make([]models.Tag, len(*in.Tags))
+		for i, name := range *in.Tags {
+			call.Tags[i] = models.Tag{Name: name}
+		}
+	}
+	switch {
+	case in.Category == nil:
+	case *in.Category == "":
+		call.CategoryID, call.Category = nil, nil
+	default:
+		category, err := categories.Get(r.Context(), *in.Category)
+		if errors.Is(err, repository.ErrNotFound) {
+			return map[string]string{"category": "is not a known category"}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		call.CategoryID, call.Category = &category.ID, category
+	}
+	if loc := in.Location; loc != nil {
+		var p *geo.Point
+		switch {
+		case loc.Lat != nil:
+			p = &geo.Point{Lat: *loc.Lat, Lng: *loc.Lng}
+		case loc.ZIP != "":
+			var err error
+			if p, err = locator.ZIP(loc.ZIP); err != nil {
+				return map[string]string{"location.zip": zipMessage(err)}, nil
+			}
+		}
+		placeCall(locator, call, p, loc.ZIP)
+	}
+	return nil, nil
+}
+
+// zipMessage describes why a ZIP code given in a field could not be
+// placed.
+func zipMessage(err error) string {
+	if errors.Is(err, geo.ErrNoZIPCodes) {
+		return "cannot be used because ZIP lookup is not configured"
+	}
+	return "is not a known ZIP code"
+}
+
+// placeCall sets where call is. Its public location is only fuzzed anew
+// when it moves, so that saving it again reveals nothing more.
+func placeCall(locator *geo.Locator, call *models.Call, p *geo.Point, zip string) {
+	call.ZIP = zip
+	if p == nil {
+		call.SetLocation(nil, nil)
+		return
+	}
+	if old := call.Location(); old != nil && *old == *p {
+		return
+	}
+	public := locator.Public(*p)
+	call.SetLocation(p, &public)
+}
+
+// normalizeTags lower-cases tag names and drops duplicates, returning a
+// message if any of them is malformed.
+func normalizeTags(names []string) ([]string, string) {
+	return normalizeSlugs(names, "tag")
+}
+
+// normalizeSlugs lower-cases names and drops duplicates, returning a message
+// naming each a noun if any of them is malformed.
+func normalizeSlugs(names []string, noun string) ([]string, string) {
+	slugs := []string{}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if msg := slugError(name); msg != "" {
+			return nil, "each " + noun + " " + msg
+		}
+		if !contains(slugs, name) {
+			slugs = append(slugs, name)
+		}
+	}
+	return slugs, ""
+}
+
+// Radius searches cover defaultRadius miles unless asked for up to
+// maxRadius.
+const (
+	defaultRadius = 25
+	maxRadius     = 250
+)
+
+// GetCalls lists calls a page at a time with a summary of their author. The
+// user_id, urgent, status, category and tag query parameters filter the
+// results, the last three taking comma-separated lists of which a call must
+// match any; closed=true is short for the statuses of calls that have ended
+// and closed=false for the rest. near, either "lat,lng" or a ZIP code,
+// limits the results to calls within radius miles of it, nearest first
+// unless another sort is asked for. Veteran-only calls are left out unless
+// the viewer may see them.
+func (h *Handler) GetCalls(w http.ResponseWriter, r *http.Request) {
+	var filter repository.CallFilter
+	fields := map[string]string{}
+	filter.Near = h.queryNear(r, fields)
+
+	params, err := pagination.FromRequest(r)
+	if filter.Near != nil {
+		params, err = pagination.FromRequestSorted(r, pagination.SortDistance, pagination.SortDistance, pagination.SortID, pagination.SortCreatedAt)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if userID, ok := queryUint(r, "user_id", fields); ok {
+		filter.UserID = userID
+	}
+	if urgent, ok := queryBool(r, "urgent", fields); ok {
+		filter.Urgent = &urgent
+	}
+	if statuses, ok := queryList(r, "status", models.CallStatuses, fields); ok {
+		filter.Statuses = statuses
+	}
+	if r.URL.Query().Get("category") != "" {
+		slugs, err := h.categorySlugs(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if categories, ok := queryList(r, "category", slugs, fields); ok {
+			filter.Categories = categories
+		}
+	}
+	if v := r.URL.Query().Get("tag"); v != "" {
+		tags, msg := normalizeTags(strings.Split(v, ","))
+		if msg != "" {
+			fields["tag"] = msg
+		}
+		filter.Tags = tags
+	}
+	if closed, ok := queryBool(r, "closed", fields); ok {
+		switch {
+		case filter.Statuses != nil:
+			fields["closed"] = "cannot be combined with status"
+		case closed:
+			filter.Statuses = models.ClosedCallStatuses
+		default:
+			filter.Statuses = openCallStatuses()
+		}
+	}
+	if len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+	if !rbac.Can(r.Context(), models.PermissionViewVeteranOnly) {
+		veteranOnly := false
+		filter.VeteranOnly = &veteranOnly
+	}
+	filter.ExcludeDeleting = excludeDeleting(r)
+
+	calls, err := h.calls.List(r.Context(), filter, params)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	views := make([]callView, len(calls))
+	for i, call := range calls {
+		views[i] = newCallView(r, call)
+	}
+	writeJSON(w, http.StatusOK, pagination.NewPage(params, views, callViewKey))
+}
+
+// GetCall returns a single call by ID.
+func (h *Handler) GetCall(w http.ResponseWriter, r *http.Request) {
+	call, ok := h.loadCall(w, r, "id")
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newCallView(r, *call))
+}
+
+// CreateCall creates a call owned by the acting user from a JSON body of
+// the form {"desc": "...", "veteran_only": false, "category": "housing",
+// "tags": ["..."], "location": {"lat": 38.9, "lng": -77.03}}. Calls whose
+// description reads as a crisis are escalated before the response is
+// written. Its route is expected to require the calls:create permission.
+func (h *Handler) CreateCall(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var in callInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	if fields := in.validate(); len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+
+	call := models.Call{UserID: user.ID, Status: models.CallStatusOpen}
+	fields, err := in.apply(r, h.categories, h.locator, &call)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+	if err := h.calls.Create(r.Context(), &call); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	h.screen(r, &call, call.Desc)
+	call.User = *user
+	writeJSON(w, http.StatusCreated, newCallView(r, call))
+}
+
+// UpdateCall changes the description of a call and optionally whether it is
+// veteran-only, its category, its tags and its location. Its status is
+// changed through TransitionCall. Only the call's owner or a user allowed
+// to manage calls may update it.
+func (h *Handler) UpdateCall(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var in callInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	if fields := in.validate(); len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+
+	call, ok := h.loadCall(w, r, "id")
+	if !ok {
+		return
+	}
+	if !canModify(r, user, call.UserID, models.PermissionManageCalls) {
+		writeError(w, r, apierr.Forbidden("only the owner of a call may change it"))
+		return
+	}
+
+	fields, err := in.apply(r, h.categories, h.locator, call)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+	if err := h.calls.Update(r.Context(), call); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	h.screen(r, call, call.Desc)
+	writeJSON(w, http.StatusOK, newCallView(r, *call))
+}
+
+// DeleteCall deletes a call along with its responses. Only the call's owner
+// or a user allowed to manage calls may delete it.
+func (h *Handler) DeleteCall(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	call, ok := h.loadCall(w, r, "id")
+	if !ok {
+		return
+	}
+	if !canModify(r, user, call.UserID, models.PermissionManageCalls) {
+		writeError(w, r, apierr.Forbidden("only the owner of a call may delete it"))
+		return
+	}
+
+	if err := h.calls.Delete(r.Context(), call.ID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// transitionInput is the request body of TransitionCall.
+type transitionInput struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+// validate normalizes the input and returns any field errors.
+func (in *transitionInput) validate() map[string]string {
+	in.Status = strings.TrimSpace(in.Status)
+	in.Note = strings.TrimSpace(in.Note)
+
+	fields := map[string]string{}
+	if !contains(models.CallStatuses, in.Status) {
+		fields["status"] = "must be one of " + strings.Join(models.CallStatuses, ", ")
+	}
+	if len(in.Note) > 255 {
+		fields["note"] = "must be at most 255 characters"
+	}
+	return fields
+}
+
+// TransitionCall moves a call to another status from a JSON body of the form
+// {"status": "claimed", "note": "..."}, recording the change in its history.
+// See mayTransition for who may make which change.
+func (h *Handler) TransitionCall(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var in transitionInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	if fields := in.validate(); len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+
+	call, ok := h.loadCall(w, r, "id")
+	if !ok {
+		return
+	}
+	if !mayTransition(r, user, call, in.Status) {
+		writeError(w, r, apierr.Forbidden("you may not move this call to "+in.Status))
+		return
+	}
+	switch err := h.statuses.Transition(r.Context(), call, user, in.Status, in.Note); {
+	case errors.Is(err, callstatus.ErrInvalidTransition):
+		writeError(w, r, apierr.Conflict("a call that is "+call.Status+" cannot be moved to "+in.Status))
+		return
+	case errors.Is(err, repository.ErrStale):
+		writeError(w, r, apierr.Conflict("call was changed by someone else, reload it and try again"))
+		return
+	case err != nil:
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newCallView(r, *call))
+}
+
+// GetCallHistory lists every status change of a call, oldest first.
+func (h *Handler) GetCallHistory(w http.ResponseWriter, r *http.Request) {
+	call, ok := h.loadCall(w, r, "id")
+	if !ok {
+		return
+	}
+	history, err := h.calls.History(r.Context(), call.ID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, listResponse[models.CallStatusChange]{Data: history})
+}
+
+// screen assesses text written in or in response to call and escalates the
+// call if it reads as a crisis, reporting whether it did. The text is saved
+// by then, so failing to page moderators is logged rather than failing the
+// request.
+func (h *Handler) screen(r *http.Request, call *models.Call, text string) bool {
+	assessment := h.crisis.Assess(text)
+	if !assessment.Urgent {
+		return false
+	}
+	if err := h.crisis.Escalate(r.Context(), call.ID, assessment); err != nil {
+		log.Printf("Failed to escalate urgent call %d: %v", call.ID, err)
+	}
+	call.Urgent = true
+	return true
+}
+
+// queryNear parses the near and radius query parameters into the area to
+// search, recording field errors if they are malformed. It returns nil if
+// near is not given.
+func (h *Handler) queryNear(r *http.Request, fields map[string]string) *geo.Circle {
+	q := r.URL.Query()
+	area := geo.Circle{Radius: defaultRadius}
+	if v := q.Get("radius"); v != "" {
+		radius, err := strconv.ParseFloat(v, 64)
+		switch {
+		case q.Get("near") == "":
+			fields["radius"] = "requires near"
+		case err != nil || !(radius > 0 && radius <= maxRadius):
+			fields["radius"] = fmt.Sprintf("must be a number of miles greater than 0 and at most %d", maxRadius)
+		}
+		area.Radius = radius
+	}
+
+	v := q.Get("near")
+	if v == "" {
+		return nil
+	}
+	if lat, lng, ok := strings.Cut(v, ","); ok {
+		var errLat, errLng error
+		area.Center.Lat, errLat = strconv.ParseFloat(strings.TrimSpace(lat), 64)
+		area.Center.Lng, errLng = strconv.ParseFloat(strings.TrimSpace(lng), 64)
+		if errLat != nil || errLng != nil || !area.Center.Valid() {
+			fields["near"] = "must be a latitude and longitude separated by a comma, or a ZIP code"
+			return nil
+		}
+		return &area
+	}
+	zip, ok := geo.NormalizeZIP(v)
+	if !ok {
+		fields["near"] = "must be a latitude and longitude separated by a comma, or a ZIP code"
+		return nil
+	}
+	p, err := h.locator.ZIP(zip)
+	if err != nil {
+		fields["near"] = zipMessage(err)
+		return nil
+	}
+	area.Center = *p
+	return &area
+}
+
+// categorySlugs returns the slugs of every category.
+func (h *Handler) categorySlugs(r *http.Request) ([]string, error) {
+	categories, err := h.categories.List(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	slugs := make([]string, len(categories))
+	for i, category := range categories {
+		slugs[i] = category.Slug
+	}
+	return slugs, nil
+}
+
+// openCallStatuses returns the statuses of calls that have not ended.
+func openCallStatuses() []string {
+	var statuses []string
+	for _, status := range models.CallStatuses {
+		if !contains(models.ClosedCallStatuses, status) {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// loadCall fetches the call named by the given route variable along with its
+// author, writing a 404 response if it does not exist or is veteran-only and
+// hidden from the viewer.
+func (h *Handler) loadCall(w http.ResponseWriter, r *http.Request, name string) (*models.Call, bool) {
+	id, err := pathID(r, name)
+	if err != nil {
+		writeError(w, r, apierr.NotFound("call not found"))
+		return nil, false
+	}
+
+	call, err := h.calls.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = apierr.NotFound("call not found")
+		}
+		writeError(w, r, err)
+		return nil, false
+	}
+	if !canSeeCall(r, call) {
+		writeError(w, r, apierr.NotFound("call not found"))
+		return nil, false
+	}
+	return call, true
+}
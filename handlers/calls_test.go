@@ -0,0 +1,530 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pageza/vet-app/geo"
+	"github.com/pageza/vet-app/mail/mailtest"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"github.com/pageza/vet-app/rbac"
+	"github.com/pageza/vet-app/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateCall(t *testing.T) {
+	r, repos := setup(t)
+	owner := createVeteran(t, repos, "John Doe", "john@example.com")
+
+	rec := doRequest(r, "POST", "/calls", map[string]string{"desc": "Need a ride"})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = doRequestAs(r, owner.ID, "POST", "/calls", map[string]string{"desc": " "})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequestAs(r, owner.ID, "POST", "/calls", map[string]string{"desc": "Need a ride"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var created callView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	assert.NotZero(t, created.ID)
+	assert.Equal(t, owner.ID, created.UserID)
+	assert.Equal(t, "John Doe", created.Author.Name)
+}
+
+func TestGetCalls(t *testing.T) {
+	r, repos := setup(t)
+	owner := createUser(t, repos, "John Doe", "john@example.com", false)
+	assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: owner.ID, Desc: "Need a ride"}))
+	assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: owner.ID, Desc: "Help moving"}))
+
+	rec := doRequest(r, "GET", "/calls", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var page pagination.Page[callView]
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	assert.Len(t, page.Data, 2)
+	assert.Nil(t, page.NextCursor)
+	assert.Equal(t, authorSummary{ID: owner.ID, Name: "John Doe"}, page.Data[0].Author)
+
+	rec = doRequest(r, "GET", "/calls/999999", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestCallCategoriesAndTags(t *testing.T) {
+	r, repos := setup(t)
+	owner := createVeteran(t, repos, "John Doe", "john@example.com")
+
+	rec := doRequestAs(r, owner.ID, "POST", "/calls", map[string]interface{}{"desc": "Need a ride", "category": "weather"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = doRequestAs(r, owner.ID, "POST", "/calls", map[string]interface{}{"desc": "Need a ride", "tags": []string{"va appointment"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequestAs(r, owner.ID, "POST", "/calls", map[string]interface{}{
+		"desc":     "Behind on rent",
+		"category": "Housing",
+		"tags":     []string{"Rent", "eviction", "rent"},
+	})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var rent callView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&rent))
+	assert.Equal(t, &categorySummary{Slug: "housing", Name: "Housing"}, rent.Category)
+	assert.Equal(t, []string{"eviction", "rent"}, rent.Tags)
+
+	rec = doRequestAs(r, owner.ID, "POST", "/calls", map[string]interface{}{"desc": "Ride to the VA", "category": "transportation", "tags": []string{"va"}})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	rec = doRequestAs(r, owner.ID, "POST", "/calls", map[string]interface{}{"desc": "Just saying hi"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var hi callView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&hi))
+	assert.Nil(t, hi.Category)
+	assert.Empty(t, hi.Tags)
+
+	descs := func(query string) []string {
+		rec := doRequest(r, "GET", "/calls?sort=id&"+query, nil)
+		if !assert.Equal(t, http.StatusOK, rec.Code, query) {
+			return nil
+		}
+		var page pagination.Page[callView]
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+		descs := []string{}
+		for _, call := range page.Data {
+			descs = append(descs, call.Desc)
+		}
+		return descs
+	}
+	assert.Equal(t, []string{"Behind on rent"}, descs("category=housing"))
+	assert.Equal(t, []string{"Behind on rent", "Ride to the VA"}, descs("category=housing,transportation"))
+	assert.Equal(t, []string{"Behind on rent", "Ride to the VA"}, descs("tag=rent,VA"))
+	assert.Empty(t, descs("category=housing&tag=va"))
+
+	rec = doRequest(r, "GET", "/calls?category=weather", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = doRequest(r, "GET", "/calls?tag=a+b", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Leaving out the category and tags keeps them; an empty category
+	// removes it.
+	path := fmt.Sprintf("/calls/%d", rent.ID)
+	rec = doRequestAs(r, owner.ID, "PUT", path, map[string]interface{}{"desc": "Behind on rent again"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var updated callView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&updated))
+	assert.Equal(t, "housing", updated.Category.Slug)
+	assert.Equal(t, []string{"eviction", "rent"}, updated.Tags)
+
+	rec = doRequestAs(r, owner.ID, "PUT", path, map[string]interface{}{"desc": "Behind on rent again", "category": "", "tags": []string{"utilities"}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	updated = callView{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&updated))
+	assert.Nil(t, updated.Category)
+	assert.Equal(t, []string{"utilities"}, updated.Tags)
+	assert.Empty(t, descs("category=housing"))
+}
+
+func TestCallLocations(t *testing.T) {
+	r, repos := setup(t)
+	owner := createVeteran(t, repos, "John Doe", "john@example.com")
+	volunteer := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+
+	for _, location := range []map[string]interface{}{
+		{"lat": 38.9},
+		{"lat": 91.0, "lng": -77.0},
+		{"zip": "2050"},
+		{"zip": "99999"},
+	} {
+		rec := doRequestAs(r, owner.ID, "POST", "/calls", map[string]interface{}{"desc": "Need a ride", "location": location})
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "%v", location)
+	}
+
+	rec := doRequestAs(r, owner.ID, "POST", "/calls", map[string]interface{}{
+		"desc":     "Ride to the VA",
+		"location": map[string]interface{}{"lat": 38.9, "lng": -77.03, "zip": "20500-0003"},
+	})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var ride callView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&ride))
+	if assert.NotNil(t, ride.Location) {
+		assert.Equal(t, locationView{Lat: ptr(38.9), Lng: ptr(-77.03), ZIP: "20500", Exact: true}, *ride.Location)
+	}
+	rec = doRequestAs(r, owner.ID, "POST", "/calls", map[string]interface{}{"desc": "Help moving", "location": map[string]string{"zip": "20500"}})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var moving callView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&moving))
+	assert.Equal(t, &locationView{Lat: ptr(38.8977), Lng: ptr(-77.0365), ZIP: "20500", Exact: true}, moving.Location)
+	assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: owner.ID, Desc: "Anywhere"}))
+
+	// Others see a fuzzed location, which stays put when the call is saved
+	// again in the same place.
+	path := fmt.Sprintf("/calls/%d", ride.ID)
+	public := func(userID uint) locationView {
+		var v callView
+		rec := doRequestAs(r, userID, "GET", path, nil)
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&v))
+		if assert.NotNil(t, v.Location) {
+			return *v.Location
+		}
+		return locationView{}
+	}
+	before := public(volunteer.ID)
+	assert.False(t, before.Exact)
+	assert.NotEqual(t, 38.9, *before.Lat)
+	assert.LessOrEqual(t, geo.Distance(geo.Point{Lat: 38.9, Lng: -77.03}, geo.Point{Lat: *before.Lat, Lng: *before.Lng}), 1.0)
+	rec = doRequestAs(r, owner.ID, "PUT", path, map[string]interface{}{
+		"desc":     "Ride to the VA on Monday",
+		"location": map[string]interface{}{"lat": 38.9, "lng": -77.03, "zip": "20500"},
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, before, public(volunteer.ID))
+	assert.Equal(t, before, public(0))
+
+	// The responder who claims the call sees where it is.
+	rec = doRequestAs(r, volunteer.ID, "POST", path+"/transitions", map[string]string{"status": "claimed"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, public(volunteer.ID).Exact)
+
+	// Searches are sorted nearest first.
+	var page pagination.Page[callView]
+	rec = doRequest(r, "GET", fmt.Sprintf("/calls?near=%v,%v&radius=50", *before.Lat, *before.Lng), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	if assert.Len(t, page.Data, 2) {
+		assert.Equal(t, ride.ID, page.Data[0].ID)
+		assert.Equal(t, ptr(0.0), page.Data[0].Miles)
+		assert.Equal(t, moving.ID, page.Data[1].ID)
+	}
+	rec = doRequest(r, "GET", "/calls?near=20500&sort=-id&limit=1", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	page = pagination.Page[callView]{}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	if assert.Len(t, page.Data, 1) {
+		assert.Equal(t, moving.ID, page.Data[0].ID)
+		assert.NotNil(t, page.Data[0].Miles)
+	}
+	assert.NotNil(t, page.NextCursor)
+
+	for _, query := range []string{"near=somewhere", "near=99999", "near=91,0", "radius=5", "near=20500&radius=1000", "sort=distance"} {
+		rec = doRequest(r, "GET", "/calls?"+query, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+
+	// An empty location removes it.
+	rec = doRequestAs(r, owner.ID, "PUT", path, map[string]interface{}{"desc": "Ride to the VA", "location": map[string]string{}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var removed callView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&removed))
+	assert.Nil(t, removed.Location)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestZIPLookupNotConfigured(t *testing.T) {
+	locator := geo.NewLocator(nil, 1)
+	repos := repository.NewMemory()
+
+	// Calls and service areas given only a ZIP code are refused alike.
+	call := callInput{Location: &locationInput{ZIP: "20500"}}
+	fields, err := call.apply(httptest.NewRequest("POST", "/calls", nil), repos.Categories, locator, &models.Call{})
+	assert.NoError(t, err)
+	assert.Contains(t, fields["location.zip"], "ZIP lookup is not configured")
+
+	profile := volunteerInput{ServiceArea: &serviceAreaInput{locationInput: locationInput{ZIP: "20500"}, Radius: 10}}
+	fields = profile.apply(locator, &models.VolunteerProfile{})
+	assert.Contains(t, fields["service_area.zip"], "ZIP lookup is not configured")
+
+	// Coordinates still work.
+	call = callInput{Location: &locationInput{Lat: ptr(38.9), Lng: ptr(-77.03), ZIP: "20500"}}
+	fields, err = call.apply(httptest.NewRequest("POST", "/calls", nil), repos.Categories, locator, &models.Call{})
+	assert.NoError(t, err)
+	assert.Empty(t, fields)
+}
+
+func TestCrisisEscalation(t *testing.T) {
+	repos := repository.NewMemory()
+	sender := &mailtest.Sender{}
+	authz := newAuthorizer(repos, newRedis(t))
+	h := New(repos, newCrisis(repos, sender), testLocator, 10*time.Minute)
+	r := mux.NewRouter()
+	r.Use(testAuth(repos.Users), authz.Middleware)
+	r.Handle("/calls", rbac.RequireFunc(models.PermissionCreateCalls, h.CreateCall)).Methods("POST")
+	r.HandleFunc("/calls", h.GetCalls).Methods("GET")
+	r.HandleFunc("/calls/{id}", h.GetCall).Methods("GET")
+	r.Handle("/calls/{call_id}/responses", rbac.RequireFunc(models.PermissionCreateResponses, h.CreateResponse)).Methods("POST")
+
+	owner := createVeteran(t, repos, "John Doe", "john@example.com")
+	volunteer := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+	moderator := createUser(t, repos, "Moderator", "mod@example.com", false)
+	assert.NoError(t, repos.Roles.Grant(ctx, moderator.ID, models.RoleOnDuty))
+
+	rec := doRequestAs(r, owner.ID, "POST", "/calls", map[string]string{"desc": "Need a ride to the VA"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var calm callView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&calm))
+	assert.False(t, calm.Urgent)
+	assert.Empty(t, calm.CrisisResources)
+	assert.Empty(t, sender.Messages())
+
+	rec = doRequestAs(r, owner.ID, "POST", "/calls", map[string]string{"desc": "I don't want to be here anymore, thinking about suicide"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var urgent callView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&urgent))
+	assert.True(t, urgent.Urgent)
+	if assert.NotEmpty(t, urgent.CrisisResources) {
+		assert.Equal(t, "Veterans Crisis Line", urgent.CrisisResources[0].Name)
+	}
+	if messages := sender.Messages(); assert.Len(t, messages, 1) {
+		assert.Equal(t, "mod@example.com", messages[0].To)
+	}
+
+	rec = doRequest(r, "GET", fmt.Sprintf("/calls/%d", urgent.ID), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "crisis_resources")
+
+	// A response in crisis language escalates the call it answers.
+	rec = doRequestAs(r, volunteer.ID, "POST", fmt.Sprintf("/calls/%d/responses", calm.ID), map[string]string{"msg": "Honestly I feel hopeless and want to die too"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var response responseView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.NotEmpty(t, response.CrisisResources)
+	assert.Len(t, sender.Messages(), 2)
+
+	rec = doRequest(r, "GET", "/calls?urgent=true", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var page pagination.Page[callView]
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	assert.Len(t, page.Data, 2)
+}
+
+func TestCallOwnership(t *testing.T) {
+	r, repos := setup(t)
+	owner := createUser(t, repos, "John Doe", "john@example.com", false)
+	stranger := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+
+	call := models.Call{UserID: owner.ID, Desc: "Need a ride"}
+	assert.NoError(t, repos.Calls.Create(ctx, &call))
+	path := fmt.Sprintf("/calls/%d", call.ID)
+
+	rec := doRequestAs(r, stranger.ID, "PUT", path, map[string]string{"desc": "Hijacked"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequestAs(r, stranger.ID, "DELETE", path, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequestAs(r, owner.ID, "PUT", path, map[string]string{"desc": "Need a ride to the VA"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var updated callView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&updated))
+	assert.Equal(t, "Need a ride to the VA", updated.Desc)
+
+	rec = doRequestAs(r, admin.ID, "DELETE", path, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = doRequest(r, "GET", path, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestCloseCall(t *testing.T) {
+	r, repos := setup(t)
+	owner := createVeteran(t, repos, "John Doe", "john@example.com")
+
+	// Status is not set through the call's body.
+	rec := doRequestAs(r, owner.ID, "POST", "/calls", map[string]interface{}{"desc": "Need a ride", "status": "closed"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	call := models.Call{UserID: owner.ID, Desc: "Need a ride"}
+	assert.NoError(t, repos.Calls.Create(ctx, &call))
+
+	path := fmt.Sprintf("/calls/%d/transitions", call.ID)
+	rec = doRequestAs(r, owner.ID, "POST", path, map[string]string{"status": "done"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "must be one of")
+
+	rec = doRequestAs(r, owner.ID, "POST", path, map[string]string{"status": "closed", "note": "Found a ride"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var updated callView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&updated))
+	assert.Equal(t, models.CallStatusClosed, updated.Status)
+
+	rec = doRequestAs(r, owner.ID, "POST", path, map[string]string{"status": "resolved"})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	rec = doRequestAs(r, owner.ID, "POST", path, map[string]string{"status": "open"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestCallLifecycle(t *testing.T) {
+	r, repos := setup(t)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+	owner := createVeteran(t, repos, "John Doe", "john@example.com")
+	volunteer := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+	other := createUser(t, repos, "Jim Doe", "jim@example.com", false)
+	call := models.Call{UserID: owner.ID, Desc: "Need a ride"}
+	assert.NoError(t, repos.Calls.Create(ctx, &call))
+	path := fmt.Sprintf("/calls/%d/transitions", call.ID)
+
+	rec := doRequest(r, "POST", path, map[string]string{"status": "claimed"})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = doRequestAs(r, owner.ID, "POST", path, map[string]string{"status": "claimed"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = doRequestAs(r, volunteer.ID, "POST", path, map[string]string{"status": "in_progress"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequestAs(r, volunteer.ID, "POST", path, map[string]string{"status": "claimed", "note": "I can drive"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var claimed callView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&claimed))
+	assert.Equal(t, models.CallStatusClaimed, claimed.Status)
+	assert.Equal(t, volunteer.ID, *claimed.ClaimedByID)
+
+	// Only the claimer works on the call, and others cannot take it over.
+	rec = doRequestAs(r, other.ID, "POST", path, map[string]string{"status": "in_progress"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = doRequestAs(r, other.ID, "POST", path, map[string]string{"status": "claimed"})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	rec = doRequestAs(r, volunteer.ID, "POST", path, map[string]string{"status": "in_progress"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = doRequestAs(r, other.ID, "POST", path, map[string]string{"status": "resolved"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = doRequestAs(r, volunteer.ID, "POST", path, map[string]string{"status": "resolved", "note": "Dropped off at the VA"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = doRequestAs(r, volunteer.ID, "POST", fmt.Sprintf("/calls/%d/responses", call.ID), map[string]string{"msg": "Glad to help"})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	rec = doRequestAs(r, volunteer.ID, "POST", path, map[string]string{"status": "closed"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = doRequestAs(r, admin.ID, "POST", path, map[string]string{"status": "closed"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = doRequest(r, "GET", fmt.Sprintf("/calls/%d/history", call.ID), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var history listResponse[models.CallStatusChange]
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&history))
+	var statuses []string
+	for _, change := range history.Data {
+		statuses = append(statuses, change.ToStatus)
+	}
+	assert.Equal(t, []string{"claimed", "in_progress", "resolved", "closed"}, statuses)
+	assert.Equal(t, "I can drive", history.Data[0].Note)
+	assert.Equal(t, admin.ID, *history.Data[3].UserID)
+}
+
+func TestGetCallsPagination(t *testing.T) {
+	r, repos := setup(t)
+	owner := createUser(t, repos, "John Doe", "john@example.com", false)
+	other := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: owner.ID, Desc: fmt.Sprintf("Call %d", i)}))
+	}
+	assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: other.ID, Desc: "Other call", Status: models.CallStatusResolved}))
+
+	// Page through the owner's calls newest first, two at a time.
+	var descs []string
+	path := fmt.Sprintf("/calls?user_id=%d&sort=-created_at&limit=2", owner.ID)
+	for pages := 0; path != ""; pages++ {
+		assert.Less(t, pages, 3)
+
+		rec := doRequest(r, "GET", path, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var page pagination.Page[callView]
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+		for _, call := range page.Data {
+			descs = append(descs, call.Desc)
+		}
+
+		path = ""
+		if page.NextCursor != nil {
+			path = fmt.Sprintf("/calls?user_id=%d&sort=-created_at&limit=2&cursor=%s", owner.ID, *page.NextCursor)
+		}
+	}
+	assert.Equal(t, []string{"Call 4", "Call 3", "Call 2", "Call 1", "Call 0"}, descs)
+
+	rec := doRequest(r, "GET", "/calls?closed=true", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var closed pagination.Page[callView]
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&closed))
+	assert.Len(t, closed.Data, 1)
+	assert.Equal(t, other.ID, closed.Data[0].UserID)
+
+	rec = doRequest(r, "GET", "/calls?status=open,claimed", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var open pagination.Page[callView]
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&open))
+	assert.Len(t, open.Data, 5)
+
+	rec = doRequest(r, "GET", "/calls?status=done", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = doRequest(r, "GET", "/calls?status=open&closed=true", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(r, "GET", "/calls?user_id=abc&limit=0", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestCreateCallRequiresVerifiedVeteran(t *testing.T) {
+	r, repos := setup(t)
+	volunteer := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+
+	expired := models.User{Name: "John Doe", Email: "john@example.com"}
+	lapsed := time.Now().Add(-time.Hour)
+	expired.Verify(models.VerificationSourceIDme, "Army", "IAL2", time.Now().Add(-2*time.Hour), &lapsed)
+	assert.NoError(t, repos.Users.Create(ctx, &expired))
+
+	rec := doRequestAs(r, volunteer.ID, "POST", "/calls", map[string]string{"desc": "Need a ride"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequestAs(r, expired.ID, "POST", "/calls", map[string]string{"desc": "Need a ride"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestVeteranOnlyCalls(t *testing.T) {
+	r, repos := setup(t)
+	owner := createVeteran(t, repos, "John Doe", "john@example.com")
+	veteran := createVeteran(t, repos, "Jim Doe", "jim@example.com")
+	volunteer := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+
+	rec := doRequestAs(r, owner.ID, "POST", "/calls", map[string]interface{}{"desc": "Rough night", "veteran_only": true})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var call callView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&call))
+	assert.True(t, call.VeteranOnly)
+	assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: owner.ID, Desc: "Need a ride"}))
+
+	count := func(userID uint) int {
+		rec := doRequestAs(r, userID, "GET", "/calls", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var page pagination.Page[callView]
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+		return len(page.Data)
+	}
+	assert.Equal(t, 1, count(0))
+	assert.Equal(t, 1, count(volunteer.ID))
+	assert.Equal(t, 2, count(veteran.ID))
+
+	path := fmt.Sprintf("/calls/%d", call.ID)
+	assert.Equal(t, http.StatusNotFound, doRequestAs(r, volunteer.ID, "GET", path, nil).Code)
+	assert.Equal(t, http.StatusOK, doRequestAs(r, veteran.ID, "GET", path, nil).Code)
+
+	rec = doRequestAs(r, volunteer.ID, "POST", path+"/responses", map[string]string{"msg": "On my way"})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = doRequestAs(r, veteran.ID, "POST", path+"/responses", map[string]string{"msg": "Call me"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	responses := fmt.Sprintf("/users/%d/responses", veteran.ID)
+	var page pagination.Page[responseView]
+	assert.NoError(t, json.NewDecoder(doRequestAs(r, volunteer.ID, "GET", responses, nil).Body).Decode(&page))
+	assert.Empty(t, page.Data)
+	assert.NoError(t, json.NewDecoder(doRequestAs(r, veteran.ID, "GET", responses, nil).Body).Decode(&page))
+	assert.Len(t, page.Data, 1)
+}
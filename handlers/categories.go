@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/repository"
+)
+
+// slugPattern matches category slugs and tag names: lower-case words of
+// letters and digits joined by hyphens.
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// slugError describes what is wrong with a normalized slug or tag name, or
+// returns "" if nothing is.
+func slugError(slug string) string {
+	switch {
+	case slug == "":
+		return "is required"
+	case len(slug) > 32:
+		return "must be at most 32 characters"
+	case !slugPattern.MatchString(slug):
+		return "must be lower-case letters and digits separated by hyphens"
+	}
+	return ""
+}
+
+// categoryInput is the request body accepted by UpdateCategory.
+type categoryInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// validate normalizes the input and returns any field errors.
+func (in *categoryInput) validate() map[string]string {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Description = strings.TrimSpace(in.Description)
+
+	fields := map[string]string{}
+	switch {
+	case in.Name == "":
+		fields["name"] = "is required"
+	case len(in.Name) > 64:
+		fields["name"] = "must be at most 64 characters"
+	}
+	if len(in.Description) > 255 {
+		fields["description"] = "must be at most 255 characters"
+	}
+	return fields
+}
+
+// newCategoryInput is the request body accepted by CreateCategory.
+type newCategoryInput struct {
+	Slug string `json:"slug"`
+	categoryInput
+}
+
+// validate normalizes the input and returns any field errors.
+func (in *newCategoryInput) validate() map[string]string {
+	in.Slug = strings.ToLower(strings.TrimSpace(in.Slug))
+
+	fields := in.categoryInput.validate()
+	if msg := slugError(in.Slug); msg != "" {
+		fields["slug"] = msg
+	}
+	return fields
+}
+
+// GetCategories lists every call category ordered by name.
+func (h *Handler) GetCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.categories.List(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, listResponse[models.Category]{Data: categories})
+}
+
+// CreateCategory adds a call category from a JSON body of the form
+// {"slug": "...", "name": "...", "description": "..."}. Its route is
+// expected to require the categories:manage permission.
+func (h *Handler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var in newCategoryInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	if fields := in.validate(); len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+
+	category := models.Category{Slug: in.Slug, Name: in.Name, Description: in.Description}
+	if err := h.categories.Create(r.Context(), &category); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			err = apierr.Conflict("a category with that slug already exists")
+		}
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, category)
+}
+
+// UpdateCategory changes the name and description of the category named by
+// the slug route variable. Its route is expected to require the
+// categories:manage permission.
+func (h *Handler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	var in categoryInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	if fields := in.validate(); len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+
+	category, err := h.categories.Get(r.Context(), mux.Vars(r)["slug"])
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = apierr.NotFound("category not found")
+		}
+		writeError(w, r, err)
+		return
+	}
+	category.Name = in.Name
+	category.Description = in.Description
+	if err := h.categories.Update(r.Context(), category); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, category)
+}
+
+// DeleteCategory removes the category named by the slug route variable.
+// Categories that still have calls cannot be removed. Its route is expected
+// to require the categories:manage permission.
+func (h *Handler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	switch err := h.categories.Delete(r.Context(), mux.Vars(r)["slug"]); {
+	case errors.Is(err, repository.ErrNotFound):
+		writeError(w, r, apierr.NotFound("category not found"))
+		return
+	case errors.Is(err, repository.ErrForeignKey):
+		writeError(w, r, apierr.Conflict("category still has calls; move them to another category first"))
+		return
+	case err != nil:
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
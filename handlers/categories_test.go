@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/pageza/vet-app/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManageCategories(t *testing.T) {
+	r, repos := setup(t)
+	user := createUser(t, repos, "John Doe", "john@example.com", false)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+
+	rec := doRequest(r, "GET", "/categories", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var list listResponse[models.Category]
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+	assert.Len(t, list.Data, 6)
+
+	food := map[string]string{"slug": "Food", "name": "Food", "description": "Food banks"}
+	rec = doRequestAs(r, user.ID, "POST", "/categories", food)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequestAs(r, admin.ID, "POST", "/categories", map[string]string{"slug": "food banks", "name": "Food"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequestAs(r, admin.ID, "POST", "/categories", food)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var created models.Category
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	assert.Equal(t, "food", created.Slug)
+
+	rec = doRequestAs(r, admin.ID, "POST", "/categories", food)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = doRequestAs(r, admin.ID, "PUT", "/categories/food", map[string]string{"name": "Food and groceries"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var updated models.Category
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&updated))
+	assert.Equal(t, "Food and groceries", updated.Name)
+
+	rec = doRequestAs(r, admin.ID, "PUT", "/categories/weather", map[string]string{"name": "Weather"})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// Categories with calls in them cannot be removed.
+	rec = doRequestAs(r, createVeteran(t, repos, "Vet", "vet@example.com").ID, "POST", "/calls",
+		map[string]interface{}{"desc": "Groceries", "category": "food"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var call callView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&call))
+	rec = doRequestAs(r, admin.ID, "DELETE", "/categories/food", nil)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	assert.NoError(t, repos.Calls.Delete(ctx, call.ID))
+	rec = doRequestAs(r, admin.ID, "DELETE", "/categories/food", nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = doRequestAs(r, admin.ID, "DELETE", "/categories/food", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
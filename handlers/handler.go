@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/pageza/vet-app/callstatus"
+	"github.com/pageza/vet-app/crisis"
+	"github.com/pageza/vet-app/geo"
+	"github.com/pageza/vet-app/matching"
+	"github.com/pageza/vet-app/repository"
+)
+
+// Handler serves the REST API on top of the repositories it is given.
+type Handler struct {
+	users      repository.UserRepository
+	calls      repository.CallRepository
+	responses  repository.ResponseRepository
+	categories repository.CategoryRepository
+	volunteers repository.VolunteerRepository
+	statuses   *callstatus.Service
+	crisis     *crisis.Service
+	locator    *geo.Locator
+	matcher    *matching.Service
+	stepUp     time.Duration
+}
+
+// New returns a Handler backed by repos that screens calls and responses
+// for crisis language with crises and places calls with locator. Changing
+// an email address asks for a second factor entered within stepUp.
+func New(repos repository.Repositories, crises *crisis.Service, locator *geo.Locator, stepUp time.Duration) *Handler {
+	return &Handler{
+		users:      repos.Users,
+		calls:      repos.Calls,
+		responses:  repos.Responses,
+		categories: repos.Categories,
+		volunteers: repos.Volunteers,
+		statuses:   callstatus.NewService(repos),
+		crisis:     crises,
+		locator:    locator,
+		matcher:    matching.NewService(repos),
+		stepUp:     stepUp,
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+	"github.com/pageza/vet-app/auth"
+	"github.com/pageza/vet-app/config"
+	"github.com/pageza/vet-app/crisis"
+	"github.com/pageza/vet-app/geo"
+	"github.com/pageza/vet-app/mail"
+	"github.com/pageza/vet-app/mail/mailtest"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/rbac"
+	"github.com/pageza/vet-app/repository"
+	"github.com/pageza/vet-app/session"
+	"github.com/pageza/vet-app/token"
+	"github.com/pageza/vet-app/twofactor"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+// testUserHeader identifies the acting user in tests, standing in for a
+// session. The user is treated as having entered their second factor as long
+// ago as testSecondFactorAgeHeader says, or just now if it is not set.
+const (
+	testUserHeader            = "X-Test-User-ID"
+	testSecondFactorAgeHeader = "X-Test-Second-Factor-Age"
+)
+
+// testAuth authenticates requests as the user named by testUserHeader.
+func testAuth(users repository.UserRepository) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if id, err := strconv.ParseUint(r.Header.Get(testUserHeader), 10, 64); err == nil {
+				if user, err := users.Get(r.Context(), uint(id)); err == nil {
+					age, _ := time.ParseDuration(r.Header.Get(testSecondFactorAgeHeader))
+					ctx := auth.WithSecondFactor(auth.WithUser(r.Context(), user), time.Now().Add(-age))
+					r = r.WithContext(ctx)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setup returns a router serving every route from a Handler backed by
+// in-memory repositories, along with the repositories for seeding data.
+func setup(t *testing.T) (*mux.Router, repository.Repositories) {
+	repos := repository.NewMemory()
+	authz := newAuthorizer(repos, newRedis(t))
+	authz.RequireSecondFactor(models.RoleModerator, models.RoleAdmin)
+	stepUp := twofactor.RequireStepUp(10 * time.Minute)
+	h := New(repos, newCrisis(repos, &mailtest.Sender{}), testLocator, 10*time.Minute)
+	roles := NewRoles(repos, authz)
+
+	r := mux.NewRouter()
+	r.Use(testAuth(repos.Users), authz.Middleware)
+	r.HandleFunc("/users", h.GetUsers).Methods("GET")
+	r.HandleFunc("/users/{id:[0-9]+}", h.GetUser).Methods("GET")
+	r.HandleFunc("/users/{user_id}/responses", h.GetResponsesForUser).Methods("GET")
+	r.Handle("/users", rbac.RequireFunc(models.PermissionManageUsers, h.CreateUser)).Methods("POST")
+	r.HandleFunc("/users/{id:[0-9]+}", h.UpdateUser).Methods("PUT")
+	r.Handle("/users/{id:[0-9]+}", rbac.RequireFunc(models.PermissionDeleteUsers, stepUp(h.DeleteUser))).Methods("DELETE")
+	r.Handle("/users/{id:[0-9]+}/verification", rbac.RequireFunc(models.PermissionVerifyUsers, h.VerifyUser)).Methods("PUT")
+	r.Handle("/users/{id:[0-9]+}/verification", rbac.RequireFunc(models.PermissionVerifyUsers, stepUp(h.UnverifyUser))).Methods("DELETE")
+
+	r.Handle("/calls", rbac.RequireFunc(models.PermissionCreateCalls, h.CreateCall)).Methods("POST")
+	r.HandleFunc("/calls", h.GetCalls).Methods("GET")
+	r.HandleFunc("/calls/{id}", h.GetCall).Methods("GET")
+	r.HandleFunc("/calls/{id}", h.UpdateCall).Methods("PUT")
+	r.HandleFunc("/calls/{id}", h.DeleteCall).Methods("DELETE")
+	r.HandleFunc("/calls/{id}/transitions", h.TransitionCall).Methods("POST")
+	r.HandleFunc("/calls/{id}/history", h.GetCallHistory).Methods("GET")
+
+	r.HandleFunc("/users/{id:[0-9]+}/volunteer-profile", h.GetVolunteerProfile).Methods("GET")
+	r.Handle("/users/{id:[0-9]+}/volunteer-profile", rbac.RequireFunc(models.PermissionCreateResponses, h.SaveVolunteerProfile)).Methods("PUT")
+	r.HandleFunc("/users/{id:[0-9]+}/volunteer-profile", h.DeleteVolunteerProfile).Methods("DELETE")
+	r.HandleFunc("/users/{id:[0-9]+}/suggested-calls", h.GetSuggestedCalls).Methods("GET")
+	r.HandleFunc("/calls/{id}/suggested-responders", h.GetSuggestedResponders).Methods("GET")
+
+	r.HandleFunc("/categories", h.GetCategories).Methods("GET")
+	r.Handle("/categories", rbac.RequireFunc(models.PermissionManageCategories, h.CreateCategory)).Methods("POST")
+	r.Handle("/categories/{slug}", rbac.RequireFunc(models.PermissionManageCategories, h.UpdateCategory)).Methods("PUT")
+	r.Handle("/categories/{slug}", rbac.RequireFunc(models.PermissionManageCategories, h.DeleteCategory)).Methods("DELETE")
+
+	r.Handle("/calls/{call_id}/responses", rbac.RequireFunc(models.PermissionCreateResponses, h.CreateResponse)).Methods("POST")
+	r.HandleFunc("/calls/{call_id}/responses", h.GetResponses).Methods("GET")
+	r.HandleFunc("/responses/{id}", h.GetResponse).Methods("GET")
+	r.HandleFunc("/responses/{id}", h.UpdateResponse).Methods("PUT")
+	r.HandleFunc("/responses/{id}", h.DeleteResponse).Methods("DELETE")
+	r.Handle("/responses/{id}/hidden", rbac.RequireFunc(models.PermissionHideResponses, h.HideResponse)).Methods("PUT")
+	r.Handle("/responses/{id}/hidden", rbac.RequireFunc(models.PermissionHideResponses, h.UnhideResponse)).Methods("DELETE")
+
+	r.Handle("/roles", rbac.RequireFunc(models.PermissionManageRoles, roles.GetRoles)).Methods("GET")
+	r.Handle("/permissions", rbac.RequireFunc(models.PermissionManageRoles, roles.GetPermissions)).Methods("GET")
+	r.Handle("/roles/{name}/permissions", rbac.RequireFunc(models.PermissionManageRoles, stepUp(roles.SetRolePermissions))).Methods("PUT")
+	r.HandleFunc("/users/{id:[0-9]+}/roles", roles.GetUserRoles).Methods("GET")
+	r.Handle("/users/{id:[0-9]+}/roles/{role}", rbac.RequireFunc(models.PermissionManageRoles, stepUp(roles.GrantRole))).Methods("PUT")
+	r.Handle("/users/{id:[0-9]+}/roles/{role}", rbac.RequireFunc(models.PermissionManageRoles, stepUp(roles.RevokeRole))).Methods("DELETE")
+	return r, repos
+}
+
+// newCrisis returns a crisis service with the default phrases that pages
+// moderators through sender.
+func newCrisis(repos repository.Repositories, sender mail.Sender) *crisis.Service {
+	return crisis.NewService(repos, crisis.NewDetector(crisis.DefaultRules(), crisis.DefaultThreshold), sender)
+}
+
+// testLocator places the one ZIP code tests use, 20500, and fuzzes public
+// locations by up to a mile.
+var testLocator = geo.NewLocator(geo.ZIPCodes{"20500": {Lat: 38.8977, Lng: -77.0365}}, 1)
+
+// newAuthorizer returns an authorizer for the roles in repos that caches
+// them in client.
+func newAuthorizer(repos repository.Repositories, client *redis.Client) *rbac.Authorizer {
+	return rbac.NewAuthorizer(repos.Roles, client, time.Minute)
+}
+
+// newRedis returns a client for an in-process Redis.
+func newRedis(t *testing.T) *redis.Client {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// newSessionStore returns a session store backed by client.
+func newSessionStore(client *redis.Client) *session.Store {
+	return session.NewStore(client, config.SessionConfig{
+		CookieName:  "session",
+		IdleTimeout: time.Hour,
+		MaxLifetime: 24 * time.Hour,
+	})
+}
+
+// newTokenService returns a token service with a generated key that stores
+// refresh tokens in client.
+func newTokenService(t *testing.T, client *redis.Client) *token.Service {
+	keys, err := token.GenerateKeyring()
+	if err != nil {
+		t.Fatalf("generating keys: %v", err)
+	}
+	return token.NewService(keys, client, config.TokenConfig{
+		Issuer:     "vet-app",
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: time.Hour,
+	})
+}
+
+// createUser inserts a user directly into the repository, granting them the
+// admin role if admin is set.
+func createUser(t *testing.T, repos repository.Repositories, name, email string, admin bool) models.User {
+	user := models.User{Name: name, Email: email}
+	assert.NoError(t, repos.Users.Create(ctx, &user))
+	if admin {
+		assert.NoError(t, repos.Roles.Grant(ctx, user.ID, models.RoleAdmin))
+	}
+	return user
+}
+
+// createVeteran inserts a user verified as a veteran through ID.me.
+func createVeteran(t *testing.T, repos repository.Repositories, name, email string) models.User {
+	user := models.User{Name: name, Email: email}
+	expires := time.Now().Add(time.Hour)
+	user.Verify(models.VerificationSourceIDme, "Army", "IAL2", time.Now(), &expires)
+	assert.NoError(t, repos.Users.Create(ctx, &user))
+	return user
+}
+
+// doRequest sends a request with an optional JSON body through the router.
+func doRequest(r http.Handler, method, path string, body interface{}) *httptest.ResponseRecorder {
+	return doRequestAs(r, 0, method, path, body)
+}
+
+// doRequestAs is like doRequest but identifies the acting user when userID
+// is non-zero.
+func doRequestAs(r http.Handler, userID uint, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if userID != 0 {
+		req.Header.Set(testUserHeader, strconv.FormatUint(uint64(userID), 10))
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
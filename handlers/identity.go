@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/auth"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/rbac"
+)
+
+var errUnauthenticated = apierr.Unauthorized("authentication required")
+
+// actingUser returns the user making the request, as loaded by the
+// authentication middleware.
+func actingUser(r *http.Request) (*models.User, error) {
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		return nil, errUnauthenticated
+	}
+	return user, nil
+}
+
+// canModify reports whether the acting user may change a resource owned by
+// ownerID, either as its owner or through permission.
+func canModify(r *http.Request, user *models.User, ownerID uint, permission string) bool {
+	return user.ID == ownerID || rbac.Can(r.Context(), permission)
+}
+
+// canSeeUser reports whether the acting user, if any, may see user and
+// their content. Users who asked for their account to be deleted are only
+// visible to themselves and to users allowed to delete users.
+func canSeeUser(r *http.Request, user *models.User) bool {
+	if !user.DeletionRequested() || rbac.Can(r.Context(), models.PermissionDeleteUsers) {
+		return true
+	}
+	acting := auth.UserFromContext(r.Context())
+	return acting != nil && acting.ID == user.ID
+}
+
+// excludeDeleting reports whether lists should leave out users who asked for
+// their account to be deleted, and their content.
+func excludeDeleting(r *http.Request) bool {
+	return !rbac.Can(r.Context(), models.PermissionDeleteUsers)
+}
+
+// canSeeCall reports whether the acting user, if any, may see call.
+func canSeeCall(r *http.Request, call *models.Call) bool {
+	if !canSeeUser(r, &call.User) {
+		return false
+	}
+	if !call.VeteranOnly || rbac.Can(r.Context(), models.PermissionViewVeteranOnly) {
+		return true
+	}
+	user := auth.UserFromContext(r.Context())
+	return user != nil && user.ID == call.UserID
+}
+
+// canSeeLocation reports whether the acting user may see exactly where call
+// is: its owner, the responder who claimed it and users allowed to manage
+// calls may.
+func canSeeLocation(r *http.Request, call *models.Call) bool {
+	if rbac.Can(r.Context(), models.PermissionManageCalls) {
+		return true
+	}
+	user := auth.UserFromContext(r.Context())
+	if user == nil {
+		return false
+	}
+	return user.ID == call.UserID || call.ClaimedByID != nil && *call.ClaimedByID == user.ID
+}
+
+// mayTransition reports whether the acting user may move call to status.
+// Responders other than the owner may claim an open call, after which the
+// claimer works on it or releases it. The owner, the claimer or a user
+// allowed to manage calls may resolve it, and the owner or a manager may
+// close or reopen it. Only managers may expire a call by hand.
+func mayTransition(r *http.Request, user *models.User, call *models.Call, status string) bool {
+	owner := user.ID == call.UserID
+	claimer := call.ClaimedByID != nil && *call.ClaimedByID == user.ID
+	manager := rbac.Can(r.Context(), models.PermissionManageCalls)
+	switch status {
+	case models.CallStatusClaimed:
+		return !owner && rbac.Can(r.Context(), models.PermissionCreateResponses)
+	case models.CallStatusInProgress:
+		return claimer || manager
+	case models.CallStatusOpen:
+		if call.Status == models.CallStatusClaimed || call.Status == models.CallStatusInProgress {
+			return claimer || owner || manager
+		}
+		return owner || manager
+	case models.CallStatusResolved:
+		return owner || claimer || manager
+	case models.CallStatusClosed:
+		return owner || manager
+	}
+	return manager
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/idme"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"github.com/pageza/vet-app/repository"
+	"github.com/pageza/vet-app/session"
+	"golang.org/x/oauth2"
+)
+
+// idmeCookie holds the state, nonce and PKCE verifier of a login in progress.
+const (
+	idmeCookie     = "idme_login"
+	idmeCookiePath = "/auth/idme"
+	idmeLoginTTL   = 10 * time.Minute
+)
+
+// IDme serves the ID.me login endpoints.
+type IDme struct {
+	users           repository.UserRepository
+	provider        idme.Provider
+	sessions        *session.Store
+	verificationTTL time.Duration
+}
+
+// NewIDme returns the ID.me login handlers. Successful logins start a
+// session in sessions, and veteran verifications from ID.me last for
+// verificationTTL.
+func NewIDme(repos repository.Repositories, provider idme.Provider, sessions *session.Store, verificationTTL time.Duration) *IDme {
+	return &IDme{users: repos.Users, provider: provider, sessions: sessions, verificationTTL: verificationTTL}
+}
+
+// loginResponse is the body of a successful login. If TwoFactorRequired is
+// set the session is pending until the user's code is sent to
+// POST /auth/2fa/verify.
+type loginResponse struct {
+	User              *models.User `json:"user"`
+	TwoFactorRequired bool         `json:"two_factor_required,omitempty"`
+}
+
+// Login handles GET /auth/idme/login by redirecting to ID.me.
+func (h *IDme) Login(w http.ResponseWriter, r *http.Request) {
+	state, nonce, verifier := randomToken(), randomToken(), oauth2.GenerateVerifier()
+	http.SetCookie(w, &http.Cookie{
+		Name:     idmeCookie,
+		Value:    state + "." + nonce + "." + verifier,
+		Path:     idmeCookiePath,
+		MaxAge:   int(idmeLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, h.provider.AuthCodeURL(state, nonce, verifier), http.StatusFound)
+}
+
+// Callback handles GET /auth/idme/callback, where ID.me sends the user back
+// after login. The user is matched by ID.me subject, then by verified email,
+// and created if neither matches. A session is then started for them.
+func (h *IDme) Callback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("error") != "" {
+		writeError(w, r, apierr.Unauthorized("ID.me login was not completed"))
+		return
+	}
+
+	cookie, err := r.Cookie(idmeCookie)
+	if err != nil {
+		writeError(w, r, apierr.BadRequest("login has expired, please start again"))
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: idmeCookie, Path: idmeCookiePath, MaxAge: -1, HttpOnly: true, Secure: true})
+
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(q.Get("state"))) != 1 {
+		writeError(w, r, apierr.BadRequest("login state does not match, please start again"))
+		return
+	}
+
+	identity, err := h.provider.Exchange(r.Context(), q.Get("code"), parts[1], parts[2])
+	if err != nil {
+		log.Printf("ID.me exchange failed: %v", err)
+		writeError(w, r, apierr.Unauthorized("could not verify ID.me login"))
+		return
+	}
+
+	user, err := h.linkUser(r.Context(), identity)
+	if err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			err = apierr.Conflict("email is already in use by another account")
+		}
+		writeError(w, r, err)
+		return
+	}
+	pending := user.TwoFactorEnabled()
+	if _, err := h.sessions.Start(w, r, user.ID, pending); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, loginResponse{User: user, TwoFactorRequired: pending})
+}
+
+// linkUser finds or creates the user for identity and records their
+// veteran status. Users are found by their ID.me subject, or by an email
+// address both ID.me and the account verified.
+func (h *IDme) linkUser(ctx context.Context, identity *idme.Identity) (*models.User, error) {
+	user, err := h.findUser(ctx, repository.UserFilter{IDmeSubject: identity.Subject})
+	if err != nil {
+		return nil, err
+	}
+	if user == nil && identity.Email != "" && identity.EmailVerified {
+		if user, err = h.findUser(ctx, repository.UserFilter{Email: identity.Email}); err != nil {
+			return nil, err
+		}
+		if user != nil && !user.EmailVerified() {
+			// Anyone can give an account an address they do not own, so
+			// only accounts that proved it are linked.
+			return nil, apierr.Conflict("an account with this email address exists but has not verified it, log in to it and verify it first")
+		}
+	}
+
+	if user == nil {
+		if identity.Email == "" {
+			return nil, apierr.Unprocessable("ID.me did not share an email address")
+		}
+		user = &models.User{Name: identity.Name, Email: identity.Email}
+	}
+	now := time.Now()
+	if identity.EmailVerified && identity.Email == user.Email && !user.EmailVerified() {
+		user.EmailVerifiedAt = &now
+	}
+	user.IDmeSubject = &identity.Subject
+	switch {
+	case identity.Veteran:
+		expires := now.Add(h.verificationTTL)
+		user.Verify(models.VerificationSourceIDme, identity.Branch, identity.Level, now, &expires)
+	case user.VerificationSource == models.VerificationSourceIDme:
+		// ID.me no longer vouches for the user. Manual verifications by an
+		// admin are left alone.
+		user.ClearVerification()
+	}
+	if user.Name == "" {
+		user.Name = identity.Name
+	}
+
+	if user.ID == 0 {
+		err = h.users.Create(ctx, user)
+	} else {
+		err = h.users.Update(ctx, user)
+	}
+	return user, err
+}
+
+func (h *IDme) findUser(ctx context.Context, filter repository.UserFilter) (*models.User, error) {
+	users, err := h.users.List(ctx, filter, pagination.Params{Limit: 1, Sort: pagination.SortID})
+	if err != nil || len(users) == 0 {
+		return nil, err
+	}
+	return &users[0], nil
+}
+
+// randomToken returns a random hex string suitable for state and nonce
+// values.
+func randomToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
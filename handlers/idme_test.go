@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pageza/vet-app/idme"
+	"github.com/pageza/vet-app/idme/idmetest"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"github.com/pageza/vet-app/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+const idmeRedirectURL = "https://vet-app.test/auth/idme/callback"
+
+func setupIDme(t *testing.T) (*mux.Router, repository.Repositories, *idmetest.Issuer) {
+	issuer := idmetest.New("vet-app", "secret")
+	provider, err := idme.New(ctx, issuer.Config(idmeRedirectURL), issuer.Client())
+	if err != nil {
+		t.Fatalf("creating provider: %v", err)
+	}
+
+	repos := repository.NewMemory()
+	h := NewIDme(repos, provider, newSessionStore(newRedis(t)), 24*time.Hour)
+	r := mux.NewRouter()
+	r.HandleFunc("/auth/idme/login", h.Login).Methods("GET")
+	r.HandleFunc("/auth/idme/callback", h.Callback).Methods("GET")
+	return r, repos, issuer
+}
+
+// idmeLogin runs the whole login flow as a browser would and returns the
+// callback response.
+func idmeLogin(t *testing.T, r http.Handler, issuer *idmetest.Issuer, claims idmetest.Claims) *httptest.ResponseRecorder {
+	issuer.LoginAs(claims)
+
+	login := httptest.NewRecorder()
+	r.ServeHTTP(login, httptest.NewRequest("GET", "/auth/idme/login", nil))
+	assert.Equal(t, http.StatusFound, login.Code)
+
+	callback, err := issuer.Authorize(login.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorizing: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", callback.RequestURI(), nil)
+	for _, c := range login.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeLoginUser(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	var body struct {
+		User map[string]interface{} `json:"user"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	return body.User
+}
+
+func TestIDmeLoginCreatesVeteran(t *testing.T) {
+	r, repos, issuer := setupIDme(t)
+
+	rec := idmeLogin(t, r, issuer, idmetest.Claims{
+		"sub": "abc123", "email": "vet@example.com", "email_verified": true,
+		"name": "Jane Doe", "groups": []string{"veteran"}, "branch": "Navy", "acr": "IAL2",
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	user := decodeLoginUser(t, rec)
+	assert.Equal(t, "vet@example.com", user["email"])
+	assert.Equal(t, true, user["veteran"])
+	assert.Equal(t, "idme", user["verification_source"])
+	assert.Equal(t, "Navy", user["service_branch"])
+	assert.Equal(t, "IAL2", user["verification_level"])
+	assert.NotNil(t, user["verification_expires_at"])
+	assert.NotNil(t, user["email_verified_at"])
+	assert.Contains(t, rec.Header().Values("Set-Cookie")[1], "session=")
+
+	users, _ := repos.Users.List(ctx, repository.UserFilter{IDmeSubject: "abc123"}, pagination.Params{Limit: 1})
+	assert.Len(t, users, 1)
+}
+
+func TestIDmeLoginLinksExistingUser(t *testing.T) {
+	r, repos, issuer := setupIDme(t)
+	existing := createUser(t, repos, "Jane", "vet@example.com", false)
+	verified := time.Now()
+	existing.EmailVerifiedAt = &verified
+	assert.NoError(t, repos.Users.Update(ctx, &existing))
+
+	rec := idmeLogin(t, r, issuer, idmetest.Claims{
+		"sub": "abc123", "email": "vet@example.com", "email_verified": true, "groups": []string{"veteran"},
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, float64(existing.ID), decodeLoginUser(t, rec)["id"])
+
+	linked, _ := repos.Users.Get(ctx, existing.ID)
+	assert.Equal(t, "abc123", *linked.IDmeSubject)
+	assert.True(t, linked.Veteran)
+
+	// Logging in again finds the user by subject even after an email change
+	// at ID.me, and picks up changes to their veteran status.
+	rec = idmeLogin(t, r, issuer, idmetest.Claims{"sub": "abc123", "email": "new@example.com"})
+	assert.Equal(t, float64(existing.ID), decodeLoginUser(t, rec)["id"])
+	assert.Equal(t, false, decodeLoginUser(t, rec)["veteran"])
+	assert.Nil(t, decodeLoginUser(t, rec)["verified_at"])
+}
+
+func TestIDmeLoginKeepsManualVerification(t *testing.T) {
+	r, repos, issuer := setupIDme(t)
+	verified := time.Now()
+	user := models.User{Name: "Jane", Email: "vet@example.com", EmailVerifiedAt: &verified}
+	user.Verify(models.VerificationSourceManual, "Marines", "", time.Now(), nil)
+	assert.NoError(t, repos.Users.Create(ctx, &user))
+
+	rec := idmeLogin(t, r, issuer, idmetest.Claims{"sub": "abc123", "email": "vet@example.com", "email_verified": true})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	linked, _ := repos.Users.Get(ctx, user.ID)
+	assert.True(t, linked.IsVerifiedVeteran(time.Now()))
+	assert.Equal(t, models.VerificationSourceManual, linked.VerificationSource)
+}
+
+func TestIDmeLoginWithTwoFactor(t *testing.T) {
+	r, repos, issuer := setupIDme(t)
+	enabled := time.Now()
+	user := models.User{Name: "Jane", Email: "vet@example.com", EmailVerifiedAt: &enabled, TOTPEnabledAt: &enabled}
+	assert.NoError(t, repos.Users.Create(ctx, &user))
+
+	rec := idmeLogin(t, r, issuer, idmetest.Claims{"sub": "abc123", "email": "vet@example.com", "email_verified": true})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		TwoFactorRequired bool `json:"two_factor_required"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	assert.True(t, body.TwoFactorRequired)
+
+	rec = idmeLogin(t, r, issuer, idmetest.Claims{"sub": "def456", "email": "new@example.com", "email_verified": true})
+	assert.NotContains(t, rec.Body.String(), "two_factor_required")
+}
+
+func TestIDmeLoginUnverifiedEmailConflict(t *testing.T) {
+	r, repos, issuer := setupIDme(t)
+	createUser(t, repos, "Jane", "vet@example.com", false)
+
+	rec := idmeLogin(t, r, issuer, idmetest.Claims{"sub": "abc123", "email": "vet@example.com"})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	// The account never proved it owns the address, so even an address
+	// ID.me verified does not log into it.
+	rec = idmeLogin(t, r, issuer, idmetest.Claims{"sub": "abc123", "email": "vet@example.com", "email_verified": true})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestIDmeCallbackRejectsBadState(t *testing.T) {
+	r, _, _ := setupIDme(t)
+
+	login := httptest.NewRecorder()
+	r.ServeHTTP(login, httptest.NewRequest("GET", "/auth/idme/login", nil))
+
+	req := httptest.NewRequest("GET", "/auth/idme/callback?code=x&state=forged", nil)
+	for _, c := range login.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestIDmeCallbackWithoutLogin(t *testing.T) {
+	r, _, _ := setupIDme(t)
+
+	rec := doRequest(r, "GET", "/auth/idme/callback?code=x&state=y", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(r, "GET", "/auth/idme/callback?error=access_denied", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pageza/vet-app/apierr"
+)
+
+// maxBodyBytes caps the size of JSON request bodies.
+const maxBodyBytes = 1 << 20
+
+var errInvalidID = errors.New("invalid id")
+
+// writeJSON encodes v as the JSON response body with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// writeError renders err using the shared API error envelope.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apierr.Write(w, r, err)
+}
+
+// decodeJSON reads a single JSON object from the request body into v,
+// rejecting unknown fields.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// pathID parses the named route variable as a positive database ID.
+func pathID(r *http.Request, name string) (uint, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)[name], 10, 64)
+	if err != nil || id == 0 {
+		return 0, errInvalidID
+	}
+	return uint(id), nil
+}
+
+// queryUint parses an optional positive integer query parameter, recording a
+// field error if it is malformed.
+func queryUint(r *http.Request, name string, fields map[string]string) (uint, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil || n == 0 {
+		fields[name] = "must be a positive integer"
+		return 0, false
+	}
+	return uint(n), true
+}
+
+// queryBool parses an optional boolean query parameter, recording a field
+// error if it is malformed.
+func queryBool(r *http.Request, name string, fields map[string]string) (bool, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return false, false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		fields[name] = "must be true or false"
+		return false, false
+	}
+	return b, true
+}
+
+// queryList parses an optional comma-separated query parameter whose values
+// must each be one of allowed, recording a field error otherwise.
+func queryList(r *http.Request, name string, allowed []string, fields map[string]string) ([]string, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, false
+	}
+	values := strings.Split(v, ",")
+	for i, value := range values {
+		values[i] = strings.TrimSpace(value)
+		if !contains(allowed, values[i]) {
+			fields[name] = "must be one of " + strings.Join(allowed, ", ")
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
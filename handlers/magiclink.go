@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/magiclink"
+	"github.com/pageza/vet-app/session"
+)
+
+// MagicLink serves the endpoints for logging in through a link sent by
+// email.
+type MagicLink struct {
+	service  *magiclink.Service
+	sessions *session.Store
+}
+
+// NewMagicLink returns the magic link handlers. Successful logins start a
+// session in sessions.
+func NewMagicLink(service *magiclink.Service, sessions *session.Store) *MagicLink {
+	return &MagicLink{service: service, sessions: sessions}
+}
+
+// magicLinkInput is the request body of SendLink. Name is only used if the
+// email address has no account yet, and defaults to the part of the
+// address before the @.
+type magicLinkInput struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+func (in *magicLinkInput) validate() map[string]string {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Email = strings.ToLower(strings.TrimSpace(in.Email))
+
+	fields := map[string]string{}
+	if msg := emailError(in.Email); msg != "" {
+		fields["email"] = msg
+	}
+	if len(in.Name) > 255 {
+		fields["name"] = "must be at most 255 characters"
+	}
+	return fields
+}
+
+// tokenInput is the request body of Redeem.
+type tokenInput struct {
+	Token string `json:"token"`
+}
+
+// SendLink handles POST /auth/magic-link, emailing a login link to the given
+// address. It answers 202 whether or not the address has an account.
+func (h *MagicLink) SendLink(w http.ResponseWriter, r *http.Request) {
+	var in magicLinkInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	if fields := in.validate(); len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+	if err := h.service.Send(r.Context(), in.Email, in.Name); err != nil {
+		if errors.Is(err, magiclink.ErrRateLimited) {
+			err = apierr.TooManyRequests("too many login links were requested for this email address, try again later")
+		}
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Redeem handles POST /auth/magic-link/verify, where the web client sends
+// the token from a login or verification link. The user is created if they
+// have no account, and a session is started for them. Login links for an
+// account that has not verified its email address are refused.
+func (h *MagicLink) Redeem(w http.ResponseWriter, r *http.Request) {
+	var in tokenInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	user, err := h.service.Redeem(r.Context(), strings.TrimSpace(in.Token))
+	if err != nil {
+		switch {
+		case errors.Is(err, magiclink.ErrInvalidToken):
+			err = apierr.Unauthorized("login link is invalid, expired or already used")
+		case errors.Is(err, magiclink.ErrUnverifiedEmail):
+			err = apierr.Forbidden("this email address has not been verified for its account, log in another way and verify it first")
+		}
+		writeError(w, r, err)
+		return
+	}
+	pending := user.TwoFactorEnabled()
+	if _, err := h.sessions.Start(w, r, user.ID, pending); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, loginResponse{User: user, TwoFactorRequired: pending})
+}
+
+// SendVerification handles POST /users/{id}/email-verification, emailing
+// the logged-in user a link that verifies their email address so that
+// login links work for their account.
+func (h *MagicLink) SendVerification(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("user not found"))
+		return
+	}
+	if id != user.ID {
+		writeError(w, r, apierr.Forbidden("you may only verify your own email address"))
+		return
+	}
+	if user.EmailVerified() {
+		writeError(w, r, apierr.Conflict("your email address is already verified"))
+		return
+	}
+	if err := h.service.SendVerification(r.Context(), user); err != nil {
+		if errors.Is(err, magiclink.ErrRateLimited) {
+			err = apierr.TooManyRequests("too many links were requested for this email address, try again later")
+		}
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
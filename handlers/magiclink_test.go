@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pageza/vet-app/config"
+	"github.com/pageza/vet-app/magiclink"
+	"github.com/pageza/vet-app/mail/mailtest"
+	"github.com/pageza/vet-app/ratelimit"
+	"github.com/pageza/vet-app/repository"
+	"github.com/pageza/vet-app/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupMagicLink(t *testing.T) (*mux.Router, repository.Repositories, *session.Store, *mailtest.Sender) {
+	repos := repository.NewMemory()
+	client := newRedis(t)
+	store := newSessionStore(client)
+	sender := &mailtest.Sender{}
+	secret, err := magiclink.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := magiclink.NewService(repos, client, ratelimit.NewLimiter(client), sender, secret, config.MagicLinkConfig{
+		URL:             "https://app.example.org/login",
+		TTL:             15 * time.Minute,
+		RateLimit:       2,
+		RateLimitWindow: time.Hour,
+	})
+	h := NewMagicLink(service, store)
+
+	r := mux.NewRouter()
+	r.Use(testAuth(repos.Users))
+	r.HandleFunc("/auth/magic-link", h.SendLink).Methods("POST")
+	r.HandleFunc("/auth/magic-link/verify", h.Redeem).Methods("POST")
+	r.HandleFunc("/users/{id:[0-9]+}/email-verification", h.SendVerification).Methods("POST")
+	return r, repos, store, sender
+}
+
+var magicLinkPattern = regexp.MustCompile(`https://\S+`)
+
+func TestMagicLinkLogin(t *testing.T) {
+	r, repos, store, sender := setupMagicLink(t)
+
+	rec := doRequest(r, "POST", "/auth/magic-link", map[string]string{"email": "not an email"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "email")
+
+	rec = doRequest(r, "POST", "/auth/magic-link", map[string]string{"email": " Jane@Example.com ", "name": "Jane Doe"})
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	messages := sender.Messages()
+	if !assert.Len(t, messages, 1) {
+		return
+	}
+	assert.Equal(t, "jane@example.com", messages[0].To)
+	link, err := url.Parse(magicLinkPattern.FindString(messages[0].Body))
+	assert.NoError(t, err)
+	token := link.Query().Get("token")
+
+	rec = doRequest(r, "POST", "/auth/magic-link/verify", map[string]string{"token": token})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var body loginResponse
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, "Jane Doe", body.User.Name)
+	assert.False(t, body.User.Veteran)
+	assert.False(t, body.TwoFactorRequired)
+	stored, err := repos.Users.Get(ctx, body.User.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "jane@example.com", stored.Email)
+
+	cookies := rec.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		sess, err := store.Get(ctx, cookies[0].Value)
+		assert.NoError(t, err)
+		assert.Equal(t, body.User.ID, sess.UserID)
+	}
+
+	rec = doRequest(r, "POST", "/auth/magic-link/verify", map[string]string{"token": token})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+// sentLinkToken returns the token in the link of the last email sent.
+func sentLinkToken(t *testing.T, sender *mailtest.Sender) string {
+	messages := sender.Messages()
+	if len(messages) == 0 {
+		t.Fatal("no email was sent")
+	}
+	link, err := url.Parse(magicLinkPattern.FindString(messages[len(messages)-1].Body))
+	assert.NoError(t, err)
+	return link.Query().Get("token")
+}
+
+func TestMagicLinkUnverifiedEmail(t *testing.T) {
+	r, repos, _, sender := setupMagicLink(t)
+	user := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+	other := createUser(t, repos, "John Doe", "john@example.com", false)
+	path := fmt.Sprintf("/users/%d/email-verification", user.ID)
+
+	rec := doRequest(r, "POST", "/auth/magic-link", map[string]string{"email": "jane@example.com"})
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	rec = doRequest(r, "POST", "/auth/magic-link/verify", map[string]string{"token": sentLinkToken(t, sender)})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequest(r, "POST", path, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = doRequestAs(r, other.ID, "POST", path, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = doRequestAs(r, user.ID, "POST", path, nil)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	rec = doRequest(r, "POST", "/auth/magic-link/verify", map[string]string{"token": sentLinkToken(t, sender)})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	stored, err := repos.Users.Get(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.True(t, stored.EmailVerified())
+
+	rec = doRequestAs(r, user.ID, "POST", path, nil)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestMagicLinkRateLimit(t *testing.T) {
+	r, _, _, sender := setupMagicLink(t)
+	for i := 0; i < 2; i++ {
+		rec := doRequest(r, "POST", "/auth/magic-link", map[string]string{"email": "jane@example.com"})
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+	}
+	rec := doRequest(r, "POST", "/auth/magic-link", map[string]string{"email": "jane@example.com"})
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Len(t, sender.Messages(), 2)
+}
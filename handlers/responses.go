@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/crisis"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"github.com/pageza/vet-app/rbac"
+	"github.com/pageza/vet-app/repository"
+)
+
+// callSummary is the view of a call attached to a user's responses.
+type callSummary struct {
+	ID     uint   `json:"id"`
+	Desc   string `json:"desc"`
+	Status string `json:"status"`
+}
+
+// responseView is the JSON representation of a response. Call is only
+// included when listing a user's responses, and CrisisResources when the
+// response just written reads as a crisis.
+type responseView struct {
+	models.Response
+	Author          authorSummary     `json:"author"`
+	Call            *callSummary      `json:"call,omitempty"`
+	CrisisResources []crisis.Resource `json:"crisis_resources,omitempty"`
+}
+
+func newResponseView(response models.Response) responseView {
+	return responseView{Response: response, Author: newAuthorSummary(response.User)}
+}
+
+func responseViewKey(v responseView) pagination.Key {
+	return pagination.Key{ID: v.ID, CreatedAt: v.CreatedAt}
+}
+
+// responseInput is the request body accepted by CreateResponse and
+// UpdateResponse.
+type responseInput struct {
+	Msg string `json:"msg"`
+}
+
+// validate normalizes the input and returns any field errors.
+func (in *responseInput) validate() map[string]string {
+	in.Msg = strings.TrimSpace(in.Msg)
+
+	fields := map[string]string{}
+	switch {
+	case in.Msg == "":
+		fields["msg"] = "is required"
+	case len(in.Msg) > 255:
+		fields["msg"] = "must be at most 255 characters"
+	}
+	return fields
+}
+
+// GetResponses lists the responses to a call a page at a time, optionally
+// filtered by user_id. Hidden responses are only listed for moderators.
+func (h *Handler) GetResponses(w http.ResponseWriter, r *http.Request) {
+	params, err := pagination.FromRequest(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	call, ok := h.loadCall(w, r, "call_id")
+	if !ok {
+		return
+	}
+
+	filter := repository.ResponseFilter{CallID: call.ID}
+	fields := map[string]string{}
+	if userID, ok := queryUint(r, "user_id", fields); ok {
+		filter.UserID = userID
+	}
+	if len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+	hideHidden(r, &filter)
+	filter.ExcludeDeleting = excludeDeleting(r)
+
+	responses, err := h.responses.List(r.Context(), filter, params)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	views := make([]responseView, len(responses))
+	for i, response := range responses {
+		views[i] = newResponseView(response)
+	}
+	writeJSON(w, http.StatusOK, pagination.NewPage(params, views, responseViewKey))
+}
+
+// GetResponsesForUser lists every response a user has made a page at a
+// time, along with a summary of the call each one answers. The call_id query
+// parameter filters the results. Responses to veteran-only calls are left out
+// unless the viewer may see them, as are hidden responses.
+func (h *Handler) GetResponsesForUser(w http.ResponseWriter, r *http.Request) {
+	params, err := pagination.FromRequest(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	id, err := pathID(r, "user_id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("user not found"))
+		return
+	}
+
+	user, err := h.users.Get(r.Context(), id)
+	if err == nil && !canSeeUser(r, user) {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+
+	filter := repository.ResponseFilter{UserID: user.ID}
+	fields := map[string]string{}
+	if callID, ok := queryUint(r, "call_id", fields); ok {
+		filter.CallID = callID
+	}
+	if len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+	if !rbac.Can(r.Context(), models.PermissionViewVeteranOnly) {
+		veteranOnly := false
+		filter.CallVeteranOnly = &veteranOnly
+	}
+	hideHidden(r, &filter)
+
+	responses, err := h.responses.List(r.Context(), filter, params)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	views := make([]responseView, len(responses))
+	for i, response := range responses {
+		views[i] = newResponseView(response)
+		views[i].Call = &callSummary{ID: response.Call.ID, Desc: response.Call.Desc, Status: response.Call.Status}
+	}
+	writeJSON(w, http.StatusOK, pagination.NewPage(params, views, responseViewKey))
+}
+
+// GetResponse returns a single response by ID.
+func (h *Handler) GetResponse(w http.ResponseWriter, r *http.Request) {
+	response, ok := h.loadResponse(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newResponseView(*response))
+}
+
+// CreateResponse adds a response from the acting user to an open call, from
+// a JSON body of the form {"msg": "..."}. Responses that read as a crisis
+// escalate their call.
+func (h *Handler) CreateResponse(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var in responseInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	if fields := in.validate(); len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+
+	call, ok := h.loadCall(w, r, "call_id")
+	if !ok {
+		return
+	}
+	if call.Closed() {
+		writeError(w, r, apierr.Conflict("call is closed to new responses"))
+		return
+	}
+
+	response := models.Response{CallID: call.ID, UserID: user.ID, Msg: in.Msg}
+	if err := h.responses.Create(r.Context(), &response); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	response.User = *user
+	view := newResponseView(response)
+	if h.screen(r, call, response.Msg) {
+		view.CrisisResources = crisis.Resources
+	}
+	writeJSON(w, http.StatusCreated, view)
+}
+
+// UpdateResponse changes the message of a response. Only the response's
+// author or a user allowed to manage responses may update it.
+func (h *Handler) UpdateResponse(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var in responseInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	if fields := in.validate(); len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+
+	response, ok := h.loadResponse(w, r)
+	if !ok {
+		return
+	}
+	if !canModify(r, user, response.UserID, models.PermissionManageResponses) {
+		writeError(w, r, apierr.Forbidden("only the author of a response may change it"))
+		return
+	}
+
+	response.Msg = in.Msg
+	if err := h.responses.Update(r.Context(), response); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	view := newResponseView(*response)
+	if h.screen(r, &response.Call, response.Msg) {
+		view.CrisisResources = crisis.Resources
+	}
+	writeJSON(w, http.StatusOK, view)
+}
+
+// DeleteResponse deletes a response. Only the response's author or a user
+// allowed to manage responses may delete it.
+func (h *Handler) DeleteResponse(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response, ok := h.loadResponse(w, r)
+	if !ok {
+		return
+	}
+	if !canModify(r, user, response.UserID, models.PermissionManageResponses) {
+		writeError(w, r, apierr.Forbidden("only the author of a response may delete it"))
+		return
+	}
+
+	if err := h.responses.Delete(r.Context(), response.ID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HideResponse hides a response from everyone but moderators. Its route is
+// expected to require the responses:hide permission.
+func (h *Handler) HideResponse(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	response, ok := h.loadResponse(w, r)
+	if !ok {
+		return
+	}
+	if response.HiddenAt == nil {
+		now := time.Now()
+		response.HiddenAt = &now
+		response.HiddenByID = &user.ID
+		if err := h.responses.Update(r.Context(), response); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, newResponseView(*response))
+}
+
+// UnhideResponse makes a hidden response visible again. Its route is
+// expected to require the responses:hide permission.
+func (h *Handler) UnhideResponse(w http.ResponseWriter, r *http.Request) {
+	response, ok := h.loadResponse(w, r)
+	if !ok {
+		return
+	}
+	if response.HiddenAt != nil {
+		response.HiddenAt = nil
+		response.HiddenByID = nil
+		if err := h.responses.Update(r.Context(), response); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, newResponseView(*response))
+}
+
+// hideHidden narrows filter to visible responses unless the acting user may
+// see hidden ones.
+func hideHidden(r *http.Request, filter *repository.ResponseFilter) {
+	if !rbac.Can(r.Context(), models.PermissionHideResponses) {
+		hidden := false
+		filter.Hidden = &hidden
+	}
+}
+
+// loadResponse fetches the response named by the "id" route variable along
+// with its author, writing a 404 response if it does not exist or is hidden
+// from the viewer.
+func (h *Handler) loadResponse(w http.ResponseWriter, r *http.Request) (*models.Response, bool) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("response not found"))
+		return nil, false
+	}
+
+	response, err := h.responses.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = apierr.NotFound("response not found")
+		}
+		writeError(w, r, err)
+		return nil, false
+	}
+	if !canSeeCall(r, &response.Call) || !canSeeUser(r, &response.User) || (response.HiddenAt != nil && !rbac.Can(r.Context(), models.PermissionHideResponses)) {
+		writeError(w, r, apierr.NotFound("response not found"))
+		return nil, false
+	}
+	return response, true
+}
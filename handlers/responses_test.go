@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateResponse(t *testing.T) {
+	r, repos := setup(t)
+	veteran := createUser(t, repos, "John Doe", "john@example.com", false)
+	volunteer := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+
+	call := models.Call{UserID: veteran.ID, Desc: "Need a ride"}
+	assert.NoError(t, repos.Calls.Create(ctx, &call))
+	path := fmt.Sprintf("/calls/%d/responses", call.ID)
+
+	rec := doRequestAs(r, volunteer.ID, "POST", "/calls/999999/responses", map[string]string{"msg": "On my way"})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = doRequestAs(r, volunteer.ID, "POST", path, map[string]string{"msg": ""})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequestAs(r, volunteer.ID, "POST", path, map[string]string{"msg": "On my way"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var created responseView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	assert.Equal(t, call.ID, created.CallID)
+	assert.Equal(t, volunteer.ID, created.Author.ID)
+
+	rec = doRequest(r, "GET", path, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var page pagination.Page[responseView]
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	assert.Len(t, page.Data, 1)
+}
+
+func TestCreateResponseOnClosedCall(t *testing.T) {
+	r, repos := setup(t)
+	veteran := createUser(t, repos, "John Doe", "john@example.com", false)
+	volunteer := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+
+	call := models.Call{UserID: veteran.ID, Desc: "Need a ride", Status: models.CallStatusClosed}
+	assert.NoError(t, repos.Calls.Create(ctx, &call))
+
+	rec := doRequestAs(r, volunteer.ID, "POST", fmt.Sprintf("/calls/%d/responses", call.ID), map[string]string{"msg": "On my way"})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestGetResponsesForUser(t *testing.T) {
+	r, repos := setup(t)
+	veteran := createUser(t, repos, "John Doe", "john@example.com", false)
+	volunteer := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+
+	for _, desc := range []string{"Need a ride", "Help moving"} {
+		call := models.Call{UserID: veteran.ID, Desc: desc}
+		assert.NoError(t, repos.Calls.Create(ctx, &call))
+		assert.NoError(t, repos.Responses.Create(ctx, &models.Response{CallID: call.ID, UserID: volunteer.ID, Msg: "I can help"}))
+	}
+
+	rec := doRequest(r, "GET", fmt.Sprintf("/users/%d/responses", volunteer.ID), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var page pagination.Page[responseView]
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	assert.Len(t, page.Data, 2)
+	assert.Equal(t, "Need a ride", page.Data[0].Call.Desc)
+	assert.Equal(t, "Help moving", page.Data[1].Call.Desc)
+
+	rec = doRequest(r, "GET", "/users/999999/responses", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestResponseOwnership(t *testing.T) {
+	r, repos := setup(t)
+	veteran := createUser(t, repos, "John Doe", "john@example.com", false)
+	volunteer := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+
+	call := models.Call{UserID: veteran.ID, Desc: "Need a ride"}
+	assert.NoError(t, repos.Calls.Create(ctx, &call))
+	response := models.Response{CallID: call.ID, UserID: volunteer.ID, Msg: "I can help"}
+	assert.NoError(t, repos.Responses.Create(ctx, &response))
+	path := fmt.Sprintf("/responses/%d", response.ID)
+
+	rec := doRequestAs(r, veteran.ID, "PUT", path, map[string]string{"msg": "Edited"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequestAs(r, volunteer.ID, "PUT", path, map[string]string{"msg": "I can help on Tuesday"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = doRequest(r, "GET", path, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var fetched responseView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&fetched))
+	assert.Equal(t, "I can help on Tuesday", fetched.Msg)
+
+	rec = doRequestAs(r, volunteer.ID, "DELETE", path, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = doRequest(r, "GET", path, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHideResponse(t *testing.T) {
+	r, repos := setup(t)
+	veteran := createUser(t, repos, "John Doe", "john@example.com", false)
+	volunteer := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+	moderator := createUser(t, repos, "Mod", "mod@example.com", false)
+	assert.NoError(t, repos.Roles.Grant(ctx, moderator.ID, models.RoleModerator))
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+
+	call := models.Call{UserID: veteran.ID, Desc: "Need a ride"}
+	assert.NoError(t, repos.Calls.Create(ctx, &call))
+	response := models.Response{CallID: call.ID, UserID: volunteer.ID, Msg: "Spam"}
+	assert.NoError(t, repos.Responses.Create(ctx, &response))
+	path := fmt.Sprintf("/responses/%d", response.ID)
+
+	// Only moderators can hide responses, not even their author.
+	assert.Equal(t, http.StatusForbidden, doRequestAs(r, volunteer.ID, "PUT", path+"/hidden", nil).Code)
+
+	rec := doRequestAs(r, moderator.ID, "PUT", path+"/hidden", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var hidden responseView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&hidden))
+	assert.NotNil(t, hidden.HiddenAt)
+	assert.Equal(t, moderator.ID, *hidden.HiddenByID)
+
+	count := func(userID uint) int {
+		var page pagination.Page[responseView]
+		rec := doRequestAs(r, userID, "GET", fmt.Sprintf("/calls/%d/responses", call.ID), nil)
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+		return len(page.Data)
+	}
+	assert.Equal(t, 0, count(veteran.ID))
+	assert.Equal(t, 1, count(moderator.ID))
+	assert.Equal(t, http.StatusNotFound, doRequestAs(r, volunteer.ID, "GET", path, nil).Code)
+	assert.Equal(t, http.StatusOK, doRequestAs(r, admin.ID, "GET", path, nil).Code)
+
+	rec = doRequestAs(r, moderator.ID, "DELETE", path+"/hidden", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1, count(veteran.ID))
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/rbac"
+	"github.com/pageza/vet-app/repository"
+)
+
+// Roles serves the endpoints for managing roles, so that moderators can be
+// appointed without database access. Apart from GetUserRoles, their routes
+// are expected to require the roles:manage permission.
+type Roles struct {
+	users repository.UserRepository
+	roles repository.RoleRepository
+	authz *rbac.Authorizer
+}
+
+// NewRoles returns the role handlers. Changes go through authz so that its
+// cache stays current.
+func NewRoles(repos repository.Repositories, authz *rbac.Authorizer) *Roles {
+	return &Roles{users: repos.Users, roles: repos.Roles, authz: authz}
+}
+
+// roleView is the JSON representation of a role.
+type roleView struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+func newRoleView(role models.Role) roleView {
+	v := roleView{Name: role.Name, Description: role.Description, Permissions: []string{}}
+	for _, p := range role.Permissions {
+		v.Permissions = append(v.Permissions, p.Name)
+	}
+	return v
+}
+
+type listResponse[T any] struct {
+	Data []T `json:"data"`
+}
+
+// permissionsInput is the request body accepted by SetRolePermissions.
+type permissionsInput struct {
+	Permissions []string `json:"permissions"`
+}
+
+// GetRoles handles GET /roles.
+func (h *Roles) GetRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.roles.List(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	views := make([]roleView, len(roles))
+	for i, role := range roles {
+		views[i] = newRoleView(role)
+	}
+	writeJSON(w, http.StatusOK, listResponse[roleView]{Data: views})
+}
+
+// GetPermissions handles GET /permissions.
+func (h *Roles) GetPermissions(w http.ResponseWriter, r *http.Request) {
+	permissions, err := h.roles.Permissions(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, listResponse[models.Permission]{Data: permissions})
+}
+
+// SetRolePermissions handles PUT /roles/{name}/permissions, replacing the
+// permissions a role grants with those in a JSON body of the form
+// {"permissions": ["..."]}.
+func (h *Roles) SetRolePermissions(w http.ResponseWriter, r *http.Request) {
+	var in permissionsInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	if in.Permissions == nil {
+		writeError(w, r, apierr.Validation(map[string]string{"permissions": "is required"}))
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	switch err := h.authz.SetPermissions(r.Context(), name, in.Permissions); {
+	case errors.Is(err, repository.ErrNotFound):
+		writeError(w, r, apierr.NotFound("role not found"))
+		return
+	case errors.Is(err, repository.ErrForeignKey):
+		writeError(w, r, apierr.Validation(map[string]string{"permissions": "contains an unknown permission"}))
+		return
+	case err != nil:
+		writeError(w, r, err)
+		return
+	}
+
+	role, err := h.roles.Get(r.Context(), name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newRoleView(*role))
+}
+
+// GetUserRoles handles GET /users/{id}/roles, listing every role a user
+// holds including implicit ones. Users may list their own roles and users
+// allowed to manage roles may list anyone's.
+func (h *Roles) GetUserRoles(w http.ResponseWriter, r *http.Request) {
+	acting, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("user not found"))
+		return
+	}
+	if !canModify(r, acting, id, models.PermissionManageRoles) {
+		writeError(w, r, apierr.Forbidden("you may only list your own roles"))
+		return
+	}
+
+	user, err := h.users.Get(r.Context(), id)
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	roles, err := h.authz.Roles(r.Context(), user)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, listResponse[string]{Data: roles})
+}
+
+// GrantRole handles PUT /users/{id}/roles/{role}.
+func (h *Roles) GrantRole(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("user not found"))
+		return
+	}
+
+	switch err := h.authz.Grant(r.Context(), id, mux.Vars(r)["role"]); {
+	case errors.Is(err, repository.ErrNotFound):
+		writeError(w, r, apierr.NotFound("role not found"))
+	case errors.Is(err, repository.ErrForeignKey):
+		writeError(w, r, apierr.NotFound("user not found"))
+	case errors.Is(err, rbac.ErrImplicitRole):
+		writeError(w, r, apierr.Unprocessable("the veteran and volunteer roles are implied and cannot be granted"))
+	case err != nil:
+		writeError(w, r, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RevokeRole handles DELETE /users/{id}/roles/{role}.
+func (h *Roles) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("user not found"))
+		return
+	}
+
+	switch err := h.authz.Revoke(r.Context(), id, mux.Vars(r)["role"]); {
+	case errors.Is(err, repository.ErrNotFound):
+		writeError(w, r, apierr.NotFound("user does not have this role"))
+	case errors.Is(err, rbac.ErrImplicitRole):
+		writeError(w, r, apierr.Unprocessable("the veteran and volunteer roles are implied and cannot be revoked"))
+	case err != nil:
+		writeError(w, r, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pageza/vet-app/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrantAndRevokeRoles(t *testing.T) {
+	r, repos := setup(t)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+	user := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+	other := createUser(t, repos, "John Doe", "john@example.com", false)
+	path := fmt.Sprintf("/users/%d/roles", user.ID)
+
+	userRoles := func(actingID uint) []string {
+		rec := doRequestAs(r, actingID, "GET", path, nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var body listResponse[string]
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		return body.Data
+	}
+
+	assert.Equal(t, http.StatusForbidden, doRequestAs(r, user.ID, "PUT", path+"/moderator", nil).Code)
+	assert.Equal(t, http.StatusForbidden, doRequestAs(r, other.ID, "GET", path, nil).Code)
+	assert.Equal(t, []string{models.RoleVolunteer}, userRoles(user.ID))
+
+	assert.Equal(t, http.StatusNoContent, doRequestAs(r, admin.ID, "PUT", path+"/moderator", nil).Code)
+	assert.Equal(t, []string{models.RoleModerator, models.RoleVolunteer}, userRoles(admin.ID))
+
+	assert.Equal(t, http.StatusNotFound, doRequestAs(r, admin.ID, "PUT", path+"/overlord", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doRequestAs(r, admin.ID, "PUT", "/users/999999/roles/moderator", nil).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, doRequestAs(r, admin.ID, "PUT", path+"/veteran", nil).Code)
+
+	assert.Equal(t, http.StatusNoContent, doRequestAs(r, admin.ID, "DELETE", path+"/moderator", nil).Code)
+	assert.Equal(t, http.StatusNotFound, doRequestAs(r, admin.ID, "DELETE", path+"/moderator", nil).Code)
+	assert.Equal(t, []string{models.RoleVolunteer}, userRoles(user.ID))
+}
+
+func TestSetRolePermissions(t *testing.T) {
+	r, repos := setup(t)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+	moderator := createUser(t, repos, "Mod", "mod@example.com", false)
+	assert.NoError(t, repos.Roles.Grant(ctx, moderator.ID, models.RoleModerator))
+
+	call := models.Call{UserID: admin.ID, Desc: "Need a ride"}
+	assert.NoError(t, repos.Calls.Create(ctx, &call))
+	path := fmt.Sprintf("/calls/%d", call.ID)
+	assert.Equal(t, http.StatusForbidden, doRequestAs(r, moderator.ID, "DELETE", path, nil).Code)
+
+	rec := doRequestAs(r, admin.ID, "PUT", "/roles/moderator/permissions", map[string][]string{"permissions": {"world:conquer"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequestAs(r, admin.ID, "PUT", "/roles/moderator/permissions", map[string][]string{
+		"permissions": {models.PermissionHideResponses, models.PermissionManageCalls},
+	})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var role roleView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&role))
+	assert.Equal(t, []string{models.PermissionManageCalls, models.PermissionHideResponses}, role.Permissions)
+
+	// The change applies at once, without waiting for the cache to expire.
+	assert.Equal(t, http.StatusNoContent, doRequestAs(r, moderator.ID, "DELETE", path, nil).Code)
+
+	rec = doRequestAs(r, admin.ID, "GET", "/roles", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var roles listResponse[roleView]
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&roles))
+	assert.Len(t, roles.Data, 5)
+
+	assert.Equal(t, http.StatusForbidden, doRequestAs(r, moderator.ID, "GET", "/roles", nil).Code)
+}
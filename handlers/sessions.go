@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/session"
+	"github.com/pageza/vet-app/token"
+)
+
+// Sessions serves the endpoints for ending and revoking sessions.
+type Sessions struct {
+	store  *session.Store
+	tokens *token.Service
+}
+
+// NewSessions returns the session handlers. Revoking a user's sessions also
+// revokes their refresh tokens in tokens.
+func NewSessions(store *session.Store, tokens *token.Service) *Sessions {
+	return &Sessions{store: store, tokens: tokens}
+}
+
+type sessionsResponse struct {
+	Data []session.Session `json:"data"`
+}
+
+// Logout handles POST /auth/logout by ending the current session.
+func (h *Sessions) Logout(w http.ResponseWriter, r *http.Request) {
+	if err := h.store.End(w, r); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetSessions handles GET /users/{id}/sessions. Users may list their own
+// sessions and users allowed to manage sessions may list anyone's.
+func (h *Sessions) GetSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	sessions, err := h.store.List(r.Context(), userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if sessions == nil {
+		sessions = []session.Session{}
+	}
+	writeJSON(w, http.StatusOK, sessionsResponse{Data: sessions})
+}
+
+// RevokeSessions handles DELETE /users/{id}/sessions, logging the user out
+// everywhere, including their mobile refresh tokens. Users may revoke their
+// own sessions and users allowed to manage sessions may revoke anyone's,
+// for example when banning them.
+func (h *Sessions) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.authorize(w, r)
+	if !ok {
+		return
+	}
+	if _, err := h.store.DeleteUser(r.Context(), userID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := h.tokens.RevokeUser(r.Context(), userID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorize returns the user ID from the path if the acting user may manage
+// that user's sessions, writing an error otherwise.
+func (h *Sessions) authorize(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	userID, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("user not found"))
+		return 0, false
+	}
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return 0, false
+	}
+	if !canModify(r, user, userID, models.PermissionManageSessions) {
+		writeError(w, r, apierr.Forbidden("you may only manage your own sessions"))
+		return 0, false
+	}
+	return userID, true
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pageza/vet-app/repository"
+	"github.com/pageza/vet-app/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupSessions(t *testing.T) (*mux.Router, repository.Repositories, *session.Store) {
+	repos := repository.NewMemory()
+	client := newRedis(t)
+	store := newSessionStore(client)
+	h := NewSessions(store, newTokenService(t, client))
+
+	r := mux.NewRouter()
+	r.Use(store.Middleware(repos.Users), newAuthorizer(repos, client).Middleware)
+	r.HandleFunc("/auth/logout", h.Logout).Methods("POST")
+	r.HandleFunc("/users/{id:[0-9]+}/sessions", h.GetSessions).Methods("GET")
+	r.HandleFunc("/users/{id:[0-9]+}/sessions", h.RevokeSessions).Methods("DELETE")
+	return r, repos, store
+}
+
+// login starts a session for userID and returns its cookie.
+func login(t *testing.T, store *session.Store, userID uint) *http.Cookie {
+	rec := httptest.NewRecorder()
+	if _, err := store.Start(rec, httptest.NewRequest("POST", "/", nil), userID, false); err != nil {
+		t.Fatalf("starting session: %v", err)
+	}
+	return rec.Result().Cookies()[0]
+}
+
+// doRequestWithCookie sends a request carrying cookie, if it is not nil,
+// after applying any extra changes to it.
+func doRequestWithCookie(r http.Handler, cookie *http.Cookie, method, path string, extra ...func(*http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	for _, f := range extra {
+		f(req)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLogout(t *testing.T) {
+	r, repos, store := setupSessions(t)
+	user := createUser(t, repos, "Jane", "jane@example.com", false)
+	cookie := login(t, store, user.ID)
+
+	rec := doRequestWithCookie(r, cookie, "POST", "/auth/logout")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	path := fmt.Sprintf("/users/%d/sessions", user.ID)
+	rec = doRequestWithCookie(r, cookie, "GET", path)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestGetSessions(t *testing.T) {
+	r, repos, store := setupSessions(t)
+	user := createUser(t, repos, "Jane", "jane@example.com", false)
+	other := createUser(t, repos, "John", "john@example.com", false)
+	cookie := login(t, store, user.ID)
+	login(t, store, user.ID)
+
+	rec := doRequestWithCookie(r, cookie, "GET", fmt.Sprintf("/users/%d/sessions", user.ID))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Data []session.Session `json:"data"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	assert.Len(t, body.Data, 2)
+
+	rec = doRequestWithCookie(r, cookie, "GET", fmt.Sprintf("/users/%d/sessions", other.ID))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestAdminRevokesSessions(t *testing.T) {
+	r, repos, store := setupSessions(t)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+	banned := createUser(t, repos, "Troll", "troll@example.com", false)
+	adminCookie := login(t, store, admin.ID)
+	bannedCookie := login(t, store, banned.ID)
+
+	path := fmt.Sprintf("/users/%d/sessions", banned.ID)
+	rec := doRequestWithCookie(r, bannedCookie, "DELETE", fmt.Sprintf("/users/%d/sessions", admin.ID))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequestWithCookie(r, adminCookie, "DELETE", path)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = doRequestWithCookie(r, bannedCookie, "GET", path)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
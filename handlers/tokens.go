@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/session"
+	"github.com/pageza/vet-app/token"
+)
+
+// Tokens serves the bearer token endpoints used by the mobile clients.
+type Tokens struct {
+	service *token.Service
+}
+
+// NewTokens returns the token handlers.
+func NewTokens(service *token.Service) *Tokens {
+	return &Tokens{service: service}
+}
+
+type refreshInput struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (in *refreshInput) validate() error {
+	in.RefreshToken = strings.TrimSpace(in.RefreshToken)
+	if in.RefreshToken == "" {
+		return apierr.Validation(map[string]string{"refresh_token": "is required"})
+	}
+	return nil
+}
+
+var errSessionRequired = apierr.Unauthorized("a logged-in session is required")
+
+// IssueToken handles POST /auth/token, exchanging the caller's session (for
+// example the one started by ID.me login in a web view) for a token pair.
+// Only a session that is not waiting for its second factor will do: a
+// stolen access token or API key must not be able to mint new logins.
+func (h *Tokens) IssueToken(w http.ResponseWriter, r *http.Request) {
+	sess := session.FromContext(r.Context())
+	if r.Header.Get("Authorization") != "" || sess == nil || sess.Pending {
+		writeError(w, r, errSessionRequired)
+		return
+	}
+	var secondFactorAt time.Time
+	if sess.SecondFactorAt != nil {
+		secondFactorAt = *sess.SecondFactorAt
+	}
+	pair, err := h.service.Issue(r.Context(), sess.UserID, secondFactorAt)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeTokenPair(w, pair)
+}
+
+// RefreshToken handles POST /auth/token/refresh. The refresh token sent is
+// retired and a new pair is returned.
+func (h *Tokens) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var in refreshInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	if err := in.validate(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	pair, err := h.service.Refresh(r.Context(), in.RefreshToken)
+	switch {
+	case errors.Is(err, token.ErrRefreshReused):
+		writeError(w, r, apierr.Unauthorized("refresh token was already used; all tokens from this login have been revoked"))
+		return
+	case errors.Is(err, token.ErrInvalidRefresh):
+		writeError(w, r, apierr.Unauthorized("invalid or expired refresh token"))
+		return
+	case err != nil:
+		writeError(w, r, err)
+		return
+	}
+	writeTokenPair(w, pair)
+}
+
+// RevokeToken handles POST /auth/token/revoke, logging out the login the
+// refresh token belongs to.
+func (h *Tokens) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	var in refreshInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	if err := in.validate(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := h.service.Revoke(r.Context(), in.RefreshToken); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeTokenPair(w http.ResponseWriter, pair *token.Pair) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, pair)
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/rbac"
+	"github.com/pageza/vet-app/repository"
+	"github.com/pageza/vet-app/session"
+	"github.com/pageza/vet-app/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTokens(t *testing.T) (*mux.Router, repository.Repositories, *session.Store) {
+	repos := repository.NewMemory()
+	client := newRedis(t)
+	store := newSessionStore(client)
+	service := newTokenService(t, client)
+	h := NewTokens(service)
+	sessions := NewSessions(store, service)
+
+	r := mux.NewRouter()
+	r.Use(store.Middleware(repos.Users), service.Access().Middleware(repos.Users), newAuthorizer(repos, client).Middleware)
+	r.HandleFunc("/auth/token", h.IssueToken).Methods("POST")
+	r.HandleFunc("/auth/token/refresh", h.RefreshToken).Methods("POST")
+	r.HandleFunc("/auth/token/revoke", h.RevokeToken).Methods("POST")
+	r.HandleFunc("/users/{id:[0-9]+}/sessions", sessions.GetSessions).Methods("GET")
+	r.HandleFunc("/users/{id:[0-9]+}/sessions", sessions.RevokeSessions).Methods("DELETE")
+	return r, repos, store
+}
+
+func decodePair(t *testing.T, body []byte) token.Pair {
+	var pair token.Pair
+	assert.NoError(t, json.Unmarshal(body, &pair))
+	return pair
+}
+
+func doRequestWithBearer(r http.Handler, accessToken, method, path string) int {
+	rec := doRequestWithCookie(r, nil, method, path, func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	})
+	return rec.Code
+}
+
+func TestTokenLifecycle(t *testing.T) {
+	r, repos, store := setupTokens(t)
+	user := createUser(t, repos, "Jane", "jane@example.com", false)
+	sessionsPath := fmt.Sprintf("/users/%d/sessions", user.ID)
+
+	rec := doRequest(r, "POST", "/auth/token", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = doRequestWithCookie(r, login(t, store, user.ID), "POST", "/auth/token")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	first := decodePair(t, rec.Body.Bytes())
+	assert.Equal(t, http.StatusOK, doRequestWithBearer(r, first.AccessToken, "GET", sessionsPath))
+
+	rec = doRequest(r, "POST", "/auth/token/refresh", refreshInput{first.RefreshToken})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	second := decodePair(t, rec.Body.Bytes())
+	assert.Equal(t, http.StatusOK, doRequestWithBearer(r, second.AccessToken, "GET", sessionsPath))
+
+	// Replaying the first refresh token revokes the second as well.
+	rec = doRequest(r, "POST", "/auth/token/refresh", refreshInput{first.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), "already used")
+	rec = doRequest(r, "POST", "/auth/token/refresh", refreshInput{second.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestIssueTokenRequiresSession(t *testing.T) {
+	r, repos, store := setupTokens(t)
+	user := createUser(t, repos, "Jane", "jane@example.com", false)
+	rec := doRequestWithCookie(r, login(t, store, user.ID), "POST", "/auth/token")
+	pair := decodePair(t, rec.Body.Bytes())
+
+	// An access token cannot be traded for a new login, with or without
+	// the session it came from.
+	rec = doRequestWithCookie(r, nil, "POST", "/auth/token", func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = doRequestWithCookie(r, login(t, store, user.ID), "POST", "/auth/token", func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// Neither can a session still waiting for its second factor.
+	start := httptest.NewRecorder()
+	_, err := store.Start(start, httptest.NewRequest("POST", "/", nil), user.ID, true)
+	assert.NoError(t, err)
+	rec = doRequestWithCookie(r, start.Result().Cookies()[0], "POST", "/auth/token")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestTokensCarrySecondFactor(t *testing.T) {
+	repos := repository.NewMemory()
+	client := newRedis(t)
+	store := newSessionStore(client)
+	service := newTokenService(t, client)
+	authz := newAuthorizer(repos, client)
+	authz.RequireSecondFactor(models.RoleAdmin)
+	h := NewTokens(service)
+
+	r := mux.NewRouter()
+	r.Use(store.Middleware(repos.Users), service.Access().Middleware(repos.Users), authz.Middleware)
+	r.HandleFunc("/auth/token", h.IssueToken).Methods("POST")
+	r.HandleFunc("/auth/token/refresh", h.RefreshToken).Methods("POST")
+	r.Handle("/admin", rbac.RequireFunc(models.PermissionManageUsers, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+
+	// Tokens from a login without a second factor do not get the role.
+	rec := doRequestWithCookie(r, login(t, store, admin.ID), "POST", "/auth/token")
+	pair := decodePair(t, rec.Body.Bytes())
+	assert.Equal(t, http.StatusForbidden, doRequestWithBearer(r, pair.AccessToken, "GET", "/admin"))
+
+	// Tokens from one with a second factor do, even after a refresh.
+	sess, err := store.Start(httptest.NewRecorder(), httptest.NewRequest("POST", "/", nil), admin.ID, true)
+	assert.NoError(t, err)
+	sess, err = store.PassSecondFactor(ctx, sess.ID)
+	assert.NoError(t, err)
+	rec = doRequestWithCookie(r, &http.Cookie{Name: "session", Value: sess.ID}, "POST", "/auth/token")
+	pair = decodePair(t, rec.Body.Bytes())
+	assert.Equal(t, http.StatusNoContent, doRequestWithBearer(r, pair.AccessToken, "GET", "/admin"))
+
+	rec = doRequest(r, "POST", "/auth/token/refresh", refreshInput{pair.RefreshToken})
+	pair = decodePair(t, rec.Body.Bytes())
+	assert.Equal(t, http.StatusNoContent, doRequestWithBearer(r, pair.AccessToken, "GET", "/admin"))
+}
+
+func TestRefreshTokenValidation(t *testing.T) {
+	r, _, _ := setupTokens(t)
+
+	rec := doRequest(r, "POST", "/auth/token/refresh", refreshInput{})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "refresh_token")
+
+	assert.Equal(t, http.StatusUnauthorized, doRequestWithBearer(r, "garbage", "GET", "/users/1/sessions"))
+}
+
+func TestRevokeToken(t *testing.T) {
+	r, repos, store := setupTokens(t)
+	user := createUser(t, repos, "Jane", "jane@example.com", false)
+	rec := doRequestWithCookie(r, login(t, store, user.ID), "POST", "/auth/token")
+	pair := decodePair(t, rec.Body.Bytes())
+
+	rec = doRequest(r, "POST", "/auth/token/revoke", refreshInput{pair.RefreshToken})
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = doRequest(r, "POST", "/auth/token/refresh", refreshInput{pair.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestRevokeSessionsRevokesRefreshTokens(t *testing.T) {
+	r, repos, store := setupTokens(t)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+	banned := createUser(t, repos, "Troll", "troll@example.com", false)
+	rec := doRequestWithCookie(r, login(t, store, banned.ID), "POST", "/auth/token")
+	pair := decodePair(t, rec.Body.Bytes())
+
+	rec = doRequestWithCookie(r, login(t, store, admin.ID), "DELETE", fmt.Sprintf("/users/%d/sessions", banned.ID))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = doRequest(r, "POST", "/auth/token/refresh", refreshInput{pair.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/rbac"
+	"github.com/pageza/vet-app/repository"
+	"github.com/pageza/vet-app/session"
+	"github.com/pageza/vet-app/twofactor"
+)
+
+// TwoFactor serves the endpoints for setting up and entering TOTP
+// two-factor codes.
+type TwoFactor struct {
+	users    repository.UserRepository
+	service  *twofactor.Service
+	sessions *session.Store
+	authz    *rbac.Authorizer
+}
+
+// NewTwoFactor returns the two-factor handlers. Entering a code marks the
+// session in sessions as having passed the second factor, and authz decides
+// which users may not turn two-factor authentication off.
+func NewTwoFactor(repos repository.Repositories, service *twofactor.Service, sessions *session.Store, authz *rbac.Authorizer) *TwoFactor {
+	return &TwoFactor{users: repos.Users, service: service, sessions: sessions, authz: authz}
+}
+
+// codeInput is the request body of the endpoints that take a TOTP or
+// recovery code.
+type codeInput struct {
+	Code string `json:"code"`
+}
+
+func (in *codeInput) validate() error {
+	in.Code = strings.TrimSpace(in.Code)
+	if in.Code == "" {
+		return apierr.Validation(map[string]string{"code": "is required"})
+	}
+	return nil
+}
+
+type twoFactorStatus struct {
+	Enabled   bool       `json:"enabled"`
+	EnabledAt *time.Time `json:"enabled_at"`
+	// Required is set for users whose roles require a second factor.
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type twoFactorVerifyResponse struct {
+	User                   *models.User `json:"user"`
+	RecoveryCodesRemaining int          `json:"recovery_codes_remaining"`
+}
+
+// GetStatus handles GET /auth/2fa, describing the acting user's two-factor
+// setup.
+func (h *TwoFactor) GetStatus(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	required, err := h.authz.RequiresSecondFactor(r.Context(), user)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	remaining, err := h.service.RecoveryCodesRemaining(r.Context(), user.ID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, twoFactorStatus{
+		Enabled:                user.TwoFactorEnabled(),
+		EnabledAt:              user.TOTPEnabledAt,
+		Required:               required,
+		RecoveryCodesRemaining: remaining,
+	})
+}
+
+// Enroll handles POST /auth/2fa/enroll, returning a new TOTP secret and its
+// otpauth:// URI for the user to add to an authenticator app.
+func (h *TwoFactor) Enroll(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	enrollment, err := h.service.Enroll(r.Context(), user)
+	if err != nil {
+		writeTwoFactorError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, enrollment)
+}
+
+// Confirm handles POST /auth/2fa/confirm, enabling two-factor
+// authentication once the user sends a code from their authenticator app.
+// The response holds their recovery codes, which are shown only once.
+func (h *TwoFactor) Confirm(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var in codeInput
+	if !h.decode(w, r, &in) {
+		return
+	}
+	codes, err := h.service.Confirm(r.Context(), user, in.Code)
+	if err != nil {
+		writeTwoFactorError(w, r, err)
+		return
+	}
+	if !h.passSecondFactor(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Verify handles POST /auth/2fa/verify, which takes a TOTP or recovery
+// code to complete a login that is waiting for one or to step up before a
+// destructive action. Either way the session is replaced by one recording
+// the second factor, so it only works for session logins.
+func (h *TwoFactor) Verify(w http.ResponseWriter, r *http.Request) {
+	sess := session.FromContext(r.Context())
+	if sess == nil {
+		if _, err := actingUser(r); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		writeError(w, r, apierr.BadRequest("two-factor codes can only be entered in a browser session"))
+		return
+	}
+	var in codeInput
+	if !h.decode(w, r, &in) {
+		return
+	}
+
+	// A pending session has no user in the context.
+	user, err := h.users.Get(r.Context(), sess.UserID)
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	if err := h.service.Verify(r.Context(), user, in.Code); err != nil {
+		writeTwoFactorError(w, r, err)
+		return
+	}
+	if !h.passSecondFactor(w, r) {
+		return
+	}
+	remaining, err := h.service.RecoveryCodesRemaining(r.Context(), user.ID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, twoFactorVerifyResponse{User: user, RecoveryCodesRemaining: remaining})
+}
+
+// RegenerateRecoveryCodes handles POST /auth/2fa/recovery-codes, replacing
+// the user's recovery codes after checking a TOTP or recovery code.
+func (h *TwoFactor) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var in codeInput
+	if !h.decode(w, r, &in) {
+		return
+	}
+	codes, err := h.service.RegenerateRecoveryCodes(r.Context(), user, in.Code)
+	if err != nil {
+		writeTwoFactorError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Disable handles POST /auth/2fa/disable, turning two-factor
+// authentication off after checking a TOTP or recovery code. Users whose
+// roles require it cannot turn it off.
+func (h *TwoFactor) Disable(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var in codeInput
+	if !h.decode(w, r, &in) {
+		return
+	}
+	required, err := h.authz.RequiresSecondFactor(r.Context(), user)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if required {
+		writeError(w, r, apierr.Forbidden("your roles require two-factor authentication"))
+		return
+	}
+	if err := h.service.Disable(r.Context(), user, in.Code); err != nil {
+		writeTwoFactorError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *TwoFactor) decode(w http.ResponseWriter, r *http.Request, in *codeInput) bool {
+	if err := decodeJSON(w, r, in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return false
+	}
+	if err := in.validate(); err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	return true
+}
+
+// passSecondFactor records in the request's session, if there is one, that
+// the user just entered a code.
+func (h *TwoFactor) passSecondFactor(w http.ResponseWriter, r *http.Request) bool {
+	if session.FromContext(r.Context()) == nil {
+		return true
+	}
+	if _, err := h.sessions.ConfirmSecondFactor(w, r); err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	return true
+}
+
+// writeTwoFactorError writes err, translating the errors of the two-factor
+// service.
+func writeTwoFactorError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, twofactor.ErrAlreadyEnabled):
+		err = apierr.Conflict("two-factor authentication is already enabled")
+	case errors.Is(err, twofactor.ErrNotEnrolled):
+		err = apierr.Unprocessable("two-factor authentication is not set up")
+	case errors.Is(err, twofactor.ErrInvalidCode):
+		err = apierr.Validation(map[string]string{"code": "is incorrect or was already used"})
+	case errors.Is(err, twofactor.ErrTooManyAttempts):
+		err = apierr.TooManyRequests("too many incorrect codes, try again later")
+	}
+	writeError(w, r, err)
+}
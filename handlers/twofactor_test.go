@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pageza/vet-app/mail/mailtest"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/rbac"
+	"github.com/pageza/vet-app/repository"
+	"github.com/pageza/vet-app/session"
+	"github.com/pageza/vet-app/twofactor"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTwoFactor(t *testing.T) (*mux.Router, repository.Repositories, *session.Store, *twofactor.Service) {
+	repos := repository.NewMemory()
+	client := newRedis(t)
+	store := newSessionStore(client)
+	authz := newAuthorizer(repos, client)
+	authz.RequireSecondFactor(models.RoleModerator, models.RoleAdmin)
+	cipher, err := twofactor.GenerateCipher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := twofactor.NewService(repos, client, cipher, "Vet App")
+	h := NewTwoFactor(repos, service, store, authz)
+	users := New(repos, newCrisis(repos, &mailtest.Sender{}), testLocator, 10*time.Minute)
+
+	r := mux.NewRouter()
+	r.Use(store.Middleware(repos.Users), authz.Middleware)
+	r.HandleFunc("/auth/2fa", h.GetStatus).Methods("GET")
+	r.HandleFunc("/auth/2fa/enroll", h.Enroll).Methods("POST")
+	r.HandleFunc("/auth/2fa/confirm", h.Confirm).Methods("POST")
+	r.HandleFunc("/auth/2fa/verify", h.Verify).Methods("POST")
+	r.HandleFunc("/auth/2fa/recovery-codes", h.RegenerateRecoveryCodes).Methods("POST")
+	r.HandleFunc("/auth/2fa/disable", h.Disable).Methods("POST")
+	stepUp := twofactor.RequireStepUp(10 * time.Minute)
+	r.Handle("/users/{id:[0-9]+}", rbac.RequireFunc(models.PermissionDeleteUsers, stepUp(users.DeleteUser))).Methods("DELETE")
+	return r, repos, store, service
+}
+
+// enableTwoFactor turns on two-factor authentication for user and returns
+// their recovery codes.
+func enableTwoFactor(t *testing.T, service *twofactor.Service, user *models.User) []string {
+	enrollment, err := service.Enroll(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := totp.GenerateCode(enrollment.Secret, time.Now())
+	codes, err := service.Confirm(ctx, user, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codes
+}
+
+// postCode sends code to a two-factor endpoint with the session cookie.
+func postCode(r http.Handler, cookie *http.Cookie, path, code string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(codeInput{Code: code})
+	req := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+// renewedCookie returns the session cookie set by a response.
+func renewedCookie(t *testing.T, rec *httptest.ResponseRecorder) *http.Cookie {
+	cookies := rec.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("no cookie set")
+	}
+	return cookies[len(cookies)-1]
+}
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	r, repos, store, _ := setupTwoFactor(t)
+	user := createUser(t, repos, "Jane", "jane@example.com", false)
+	cookie := login(t, store, user.ID)
+
+	rec := doRequestWithCookie(r, cookie, "POST", "/auth/2fa/enroll")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var enrollment twofactor.Enrollment
+	json.Unmarshal(rec.Body.Bytes(), &enrollment)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/")
+
+	rec = postCode(r, cookie, "/auth/2fa/confirm", "000000")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	code, _ := totp.GenerateCode(enrollment.Secret, time.Now())
+	rec = postCode(r, cookie, "/auth/2fa/confirm", code)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var codes recoveryCodesResponse
+	json.Unmarshal(rec.Body.Bytes(), &codes)
+	assert.Len(t, codes.RecoveryCodes, 10)
+
+	// Confirming counts as entering the second factor, in a new session.
+	_, err := store.Get(ctx, cookie.Value)
+	assert.ErrorIs(t, err, session.ErrNotFound)
+	cookie = renewedCookie(t, rec)
+	rec = doRequestWithCookie(r, cookie, "GET", "/auth/2fa")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var status twoFactorStatus
+	json.Unmarshal(rec.Body.Bytes(), &status)
+	assert.True(t, status.Enabled)
+	assert.False(t, status.Required)
+	assert.Equal(t, 10, status.RecoveryCodesRemaining)
+
+	rec = doRequestWithCookie(r, cookie, "POST", "/auth/2fa/enroll")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = postCode(r, cookie, "/auth/2fa/disable", codes.RecoveryCodes[0])
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	stored, _ := repos.Users.Get(ctx, user.ID)
+	assert.False(t, stored.TwoFactorEnabled())
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	r, repos, store, service := setupTwoFactor(t)
+	user := createUser(t, repos, "Jane", "jane@example.com", false)
+	codes := enableTwoFactor(t, service, &user)
+
+	rec := httptest.NewRecorder()
+	_, err := store.Start(rec, httptest.NewRequest("GET", "/auth/idme/callback", nil), user.ID, true)
+	assert.NoError(t, err)
+	pending := rec.Result().Cookies()[0]
+
+	// The pending session does not log the user in.
+	rec = doRequestWithCookie(r, pending, "GET", "/auth/2fa")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = postCode(r, pending, "/auth/2fa/verify", "aaaaa-aaaaa")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = postCode(r, pending, "/auth/2fa/verify", codes[0])
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var body twoFactorVerifyResponse
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	assert.Equal(t, user.ID, body.User.ID)
+	assert.Equal(t, 9, body.RecoveryCodesRemaining)
+
+	rec = doRequestWithCookie(r, renewedCookie(t, rec), "GET", "/auth/2fa")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequestWithCookie(r, pending, "GET", "/auth/2fa")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestTwoFactorLoginLocksOut(t *testing.T) {
+	r, repos, store, service := setupTwoFactor(t)
+	user := createUser(t, repos, "Jane", "jane@example.com", false)
+	codes := enableTwoFactor(t, service, &user)
+
+	rec := httptest.NewRecorder()
+	store.Start(rec, httptest.NewRequest("GET", "/auth/idme/callback", nil), user.ID, true)
+	pending := rec.Result().Cookies()[0]
+
+	for i := 0; i < 5; i++ {
+		postCode(r, pending, "/auth/2fa/verify", "000000")
+	}
+	rec = postCode(r, pending, "/auth/2fa/verify", codes[0])
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+}
+
+func TestTwoFactorRequiredForAdmins(t *testing.T) {
+	r, repos, store, service := setupTwoFactor(t)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+	other := createUser(t, repos, "Jane", "jane@example.com", false)
+	path := fmt.Sprintf("/users/%d", other.ID)
+
+	// Without a second factor the admin role grants nothing.
+	cookie := login(t, store, admin.ID)
+	rec := doRequestWithCookie(r, cookie, "DELETE", path)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), models.PermissionDeleteUsers)
+
+	codes := enableTwoFactor(t, service, &admin)
+	rec = postCode(r, cookie, "/auth/2fa/verify", codes[0])
+	assert.Equal(t, http.StatusOK, rec.Code)
+	cookie = renewedCookie(t, rec)
+
+	rec = postCode(r, cookie, "/auth/2fa/disable", codes[1])
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequestWithCookie(r, cookie, "DELETE", path)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/auth"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"github.com/pageza/vet-app/rbac"
+	"github.com/pageza/vet-app/repository"
+	"github.com/pageza/vet-app/twofactor"
+)
+
+// userInput is the request body accepted by CreateUser and UpdateUser.
+type userInput struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// validate normalizes the input and returns any field errors.
+func (in *userInput) validate() map[string]string {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Email = strings.ToLower(strings.TrimSpace(in.Email))
+
+	fields := map[string]string{}
+	switch {
+	case in.Name == "":
+		fields["name"] = "is required"
+	case len(in.Name) > 255:
+		fields["name"] = "must be at most 255 characters"
+	}
+	if msg := emailError(in.Email); msg != "" {
+		fields["email"] = msg
+	}
+	return fields
+}
+
+// emailError describes what is wrong with a normalized email address, or
+// returns "" if nothing is.
+func emailError(email string) string {
+	switch {
+	case email == "":
+		return "is required"
+	case len(email) > 255:
+		return "must be at most 255 characters"
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+// publicUser is the view of a user shown to everyone but themselves and
+// users allowed to manage users, leaving out their email address and
+// verification.
+type publicUser struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newPublicUser(user models.User) publicUser {
+	return publicUser{ID: user.ID, Name: user.Name, CreatedAt: user.CreatedAt}
+}
+
+// canSeeAccount reports whether the acting user may see all of user's
+// account: they may see their own, and users allowed to manage users
+// anyone's.
+func canSeeAccount(r *http.Request, user *models.User) bool {
+	acting := auth.UserFromContext(r.Context())
+	return acting != nil && acting.ID == user.ID || rbac.Can(r.Context(), models.PermissionManageUsers)
+}
+
+// GetUsers lists users a page at a time. Only users allowed to manage users
+// see their whole accounts and may filter by email, so that nobody else can
+// learn who has an account.
+func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	params, err := pagination.FromRequest(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	manager := rbac.Can(r.Context(), models.PermissionManageUsers)
+	filter := repository.UserFilter{
+		Email:           strings.ToLower(strings.TrimSpace(r.URL.Query().Get("email"))),
+		ExcludeDeleting: excludeDeleting(r),
+	}
+	if filter.Email != "" && !manager {
+		writeError(w, r, apierr.Forbidden("only admins may look users up by email"))
+		return
+	}
+	users, err := h.users.List(r.Context(), filter, params)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if manager {
+		writeJSON(w, http.StatusOK, pagination.NewPage(params, users, userKey))
+		return
+	}
+	views := make([]publicUser, len(users))
+	for i, user := range users {
+		views[i] = newPublicUser(user)
+	}
+	writeJSON(w, http.StatusOK, pagination.NewPage(params, views, publicUserKey))
+}
+
+// GetUser returns a single user by ID, in full to themselves and users
+// allowed to manage users and as a publicUser to everyone else.
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("user not found"))
+		return
+	}
+
+	user, err := h.users.Get(r.Context(), id)
+	if err == nil && !canSeeUser(r, user) {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	if !canSeeAccount(r, user) {
+		writeJSON(w, http.StatusOK, newPublicUser(*user))
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// CreateUser creates a user from a JSON body of the form
+// {"name": "...", "email": "..."}. Users sign up through ID.me or a magic
+// link, so its route is expected to require the users:manage permission.
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var in userInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	if fields := in.validate(); len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+
+	user := models.User{Name: in.Name, Email: in.Email}
+	if err := h.users.Create(r.Context(), &user); err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, user)
+}
+
+// UpdateUser replaces the name and email of an existing user. Users may
+// change their own account, and users allowed to manage users anyone's.
+// Changing an email address asks for a recent second factor from users who
+// have one and from anyone changing someone else's address, since the
+// address is how the account is recovered.
+func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	acting, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("user not found"))
+		return
+	}
+	if !canModify(r, acting, id, models.PermissionManageUsers) {
+		writeError(w, r, apierr.Forbidden("you may only change your own account"))
+		return
+	}
+
+	var in userInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	if fields := in.validate(); len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+
+	user, err := h.users.Get(r.Context(), id)
+	if err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	if in.Email != user.Email && (acting.TwoFactorEnabled() || acting.ID != user.ID) {
+		if err := twofactor.CheckStepUp(r, h.stepUp); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	user.Name = in.Name
+	user.SetEmail(in.Email)
+	if err := h.users.Update(r.Context(), user); err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// DeleteUser deletes a user along with their calls and responses. Its route
+// is expected to require the users:delete permission.
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("user not found"))
+		return
+	}
+
+	if err := h.users.Delete(r.Context(), id); err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verificationInput is the request body accepted by VerifyUser.
+type verificationInput struct {
+	ServiceBranch     string     `json:"service_branch"`
+	VerificationLevel string     `json:"verification_level"`
+	ExpiresAt         *time.Time `json:"expires_at"`
+}
+
+// VerifyUser records a manual veteran verification for a user, for veterans
+// who cannot verify through ID.me. Its route is expected to require the
+// users:verify permission.
+func (h *Handler) VerifyUser(w http.ResponseWriter, r *http.Request) {
+	var in verificationInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	in.ServiceBranch = strings.TrimSpace(in.ServiceBranch)
+	in.VerificationLevel = strings.TrimSpace(in.VerificationLevel)
+	now := time.Now()
+	fields := map[string]string{}
+	if len(in.ServiceBranch) > 64 {
+		fields["service_branch"] = "must be at most 64 characters"
+	}
+	if len(in.VerificationLevel) > 64 {
+		fields["verification_level"] = "must be at most 64 characters"
+	}
+	if in.ExpiresAt != nil && !in.ExpiresAt.After(now) {
+		fields["expires_at"] = "must be in the future"
+	}
+	if len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+
+	user, ok := h.loadUser(w, r)
+	if !ok {
+		return
+	}
+	user.Verify(models.VerificationSourceManual, in.ServiceBranch, in.VerificationLevel, now, in.ExpiresAt)
+	if err := h.users.Update(r.Context(), user); err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// UnverifyUser removes a user's veteran verification, whatever its source.
+// Its route is expected to require the users:verify permission.
+func (h *Handler) UnverifyUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.loadUser(w, r)
+	if !ok {
+		return
+	}
+	user.ClearVerification()
+	if err := h.users.Update(r.Context(), user); err != nil {
+		writeUserError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// loadUser fetches the user named by the "id" route variable, writing a 404
+// response if they do not exist.
+func (h *Handler) loadUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("user not found"))
+		return nil, false
+	}
+
+	user, err := h.users.Get(r.Context(), id)
+	if err != nil {
+		writeUserError(w, r, err)
+		return nil, false
+	}
+	return user, true
+}
+
+func userKey(u models.User) pagination.Key {
+	return pagination.Key{ID: u.ID, CreatedAt: u.CreatedAt}
+}
+
+func publicUserKey(u publicUser) pagination.Key {
+	return pagination.Key{ID: u.ID, CreatedAt: u.CreatedAt}
+}
+
+// writeUserError renders an error from a user query, naming the resource in
+// not-found and conflict messages.
+func writeUserError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		err = apierr.NotFound("user not found")
+	case errors.Is(err, repository.ErrDuplicate):
+		err = apierr.Conflict("email is already in use")
+	}
+	writeError(w, r, err)
+}
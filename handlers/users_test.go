@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"github.com/pageza/vet-app/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAndGetUser(t *testing.T) {
+	r, repos := setup(t)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+
+	rec := doRequestAs(r, admin.ID, "POST", "/users", map[string]string{"name": "John Doe", "email": "John@Example.com"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var created models.User
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	assert.NotZero(t, created.ID)
+	assert.Equal(t, "john@example.com", created.Email)
+
+	rec = doRequestAs(r, created.ID, "GET", fmt.Sprintf("/users/%d", created.ID), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var fetched models.User
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&fetched))
+	assert.Equal(t, created, fetched)
+
+	// Others only see the public view.
+	rec = doRequest(r, "GET", fmt.Sprintf("/users/%d", created.ID), nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "john@example.com")
+	var public publicUser
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&public))
+	assert.Equal(t, newPublicUser(created), public)
+}
+
+func TestCreateUserRequiresPermission(t *testing.T) {
+	r, repos := setup(t)
+	user := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+
+	// Otherwise anyone could claim someone else's address before they sign
+	// up, locking them out of it.
+	body := map[string]string{"name": "John Doe", "email": "john@example.com"}
+	rec := doRequest(r, "POST", "/users", body)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = doRequestAs(r, user.ID, "POST", "/users", body)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	users, err := repos.Users.List(ctx, repository.UserFilter{Email: "john@example.com"}, pagination.Params{Limit: 1, Sort: pagination.SortID})
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+}
+
+func TestCreateUserValidation(t *testing.T) {
+	r, repos := setup(t)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+
+	rec := doRequestAs(r, admin.ID, "POST", "/users", map[string]string{"name": "", "email": "not-an-email"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var body struct {
+		Error apierr.Error `json:"error"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, apierr.CodeValidation, body.Error.Code)
+	assert.Contains(t, body.Error.Fields, "name")
+	assert.Contains(t, body.Error.Fields, "email")
+
+	rec = doRequestAs(r, admin.ID, "POST", "/users", map[string]string{"name": "John Doe", "email": "john@example.com", "admin": "true"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestCreateUserDuplicateEmail(t *testing.T) {
+	r, repos := setup(t)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+
+	rec := doRequestAs(r, admin.ID, "POST", "/users", map[string]string{"name": "John Doe", "email": "john@example.com"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = doRequestAs(r, admin.ID, "POST", "/users", map[string]string{"name": "Jane Doe", "email": "john@example.com"})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestUpdateAndDeleteUser(t *testing.T) {
+	r, repos := setup(t)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+
+	user := models.User{Name: "John Doe", Email: "john@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, &user))
+	other := models.User{Name: "Jane Doe", Email: "jane@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, &other))
+
+	path := fmt.Sprintf("/users/%d", user.ID)
+	rec := doRequest(r, "PUT", path, map[string]string{"name": "Johnny Doe", "email": "john@example.com"})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = doRequestAs(r, other.ID, "PUT", path, map[string]string{"name": "Johnny Doe", "email": "jane@example.com"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequestAs(r, user.ID, "PUT", path, map[string]string{"name": "Johnny Doe", "email": "johnny@example.com"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = doRequestAs(r, user.ID, "PUT", path, map[string]string{"name": "Johnny Doe", "email": "jane@example.com"})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	// Admins may change anyone's account.
+	rec = doRequestAs(r, admin.ID, "PUT", path, map[string]string{"name": "John Doe", "email": "johnny@example.com"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Only admins may delete users.
+	rec = doRequestAs(r, other.ID, "DELETE", path, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequestAs(r, admin.ID, "DELETE", path, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = doRequest(r, "GET", path, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = doRequestAs(r, admin.ID, "DELETE", path, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestDeleteUserRequiresStepUp(t *testing.T) {
+	r, repos := setup(t)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+	user := createUser(t, repos, "John Doe", "john@example.com", false)
+
+	req := httptest.NewRequest("DELETE", fmt.Sprintf("/users/%d", user.ID), nil)
+	req.Header.Set(testUserHeader, strconv.FormatUint(uint64(admin.ID), 10))
+	req.Header.Set(testSecondFactorAgeHeader, "1h")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), apierr.CodeStepUpRequired)
+
+	_, err := repos.Users.Get(ctx, user.ID)
+	assert.NoError(t, err)
+}
+
+func TestUpdateEmailRequiresStepUp(t *testing.T) {
+	r, repos := setup(t)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+	user := createUser(t, repos, "John Doe", "john@example.com", false)
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	user.TOTPEnabledAt = &now
+	assert.NoError(t, repos.Users.Update(ctx, &user))
+	path := fmt.Sprintf("/users/%d", user.ID)
+
+	update := func(actingID uint, body map[string]string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(body)
+		req := httptest.NewRequest("PUT", path, &buf)
+		req.Header.Set(testUserHeader, strconv.FormatUint(uint64(actingID), 10))
+		req.Header.Set(testSecondFactorAgeHeader, "1h")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Names can be changed without a second factor, but not emails.
+	rec := update(user.ID, map[string]string{"name": "Johnny Doe", "email": "john@example.com"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = update(user.ID, map[string]string{"name": "Johnny Doe", "email": "attacker@example.com"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), apierr.CodeStepUpRequired)
+
+	// Nor can an admin change someone else's.
+	rec = update(admin.ID, map[string]string{"name": "Johnny Doe", "email": "attacker@example.com"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), apierr.CodeStepUpRequired)
+
+	stored, err := repos.Users.Get(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "john@example.com", stored.Email)
+	assert.True(t, stored.EmailVerified())
+
+	// A new address has to be verified again.
+	rec = doRequestAs(r, user.ID, "PUT", path, map[string]string{"name": "Johnny Doe", "email": "johnny@example.com"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	stored, err = repos.Users.Get(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.False(t, stored.EmailVerified())
+
+	// Users without a second factor have none to enter.
+	stored.TOTPEnabledAt = nil
+	assert.NoError(t, repos.Users.Update(ctx, stored))
+	rec = update(user.ID, map[string]string{"name": "Johnny Doe", "email": "john@example.com"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestGetUsers(t *testing.T) {
+	r, repos := setup(t)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+
+	assert.NoError(t, repos.Users.Create(ctx, &models.User{Name: "John Doe", Email: "john@example.com"}))
+	assert.NoError(t, repos.Users.Create(ctx, &models.User{Name: "Jane Doe", Email: "jane@example.com"}))
+
+	rec := doRequest(r, "GET", "/users", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "@example.com")
+
+	var public pagination.Page[publicUser]
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&public))
+	assert.Len(t, public.Data, 3)
+
+	// Only admins may look users up by email.
+	rec = doRequest(r, "GET", "/users?email=Jane@Example.com", nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequestAs(r, admin.ID, "GET", "/users?email=Jane@Example.com", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var page pagination.Page[models.User]
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	if assert.Len(t, page.Data, 1) {
+		assert.Equal(t, "Jane Doe", page.Data[0].Name)
+		assert.Equal(t, "jane@example.com", page.Data[0].Email)
+	}
+}
+
+func TestManualVerification(t *testing.T) {
+	r, repos := setup(t)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+	user := createUser(t, repos, "John Doe", "john@example.com", false)
+	path := fmt.Sprintf("/users/%d/verification", user.ID)
+	body := map[string]string{"service_branch": "Marines", "verification_level": "DD-214"}
+
+	rec := doRequestAs(r, user.ID, "PUT", path, body)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = doRequestAs(r, admin.ID, "PUT", path, map[string]string{"expires_at": "2000-01-01T00:00:00Z"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequestAs(r, admin.ID, "PUT", path, body)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var verified models.User
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&verified))
+	assert.Equal(t, models.VerificationSourceManual, verified.VerificationSource)
+	assert.Equal(t, "Marines", verified.ServiceBranch)
+	assert.True(t, verified.IsVerifiedVeteran(time.Now()))
+
+	rec = doRequestAs(r, user.ID, "POST", "/calls", map[string]string{"desc": "Need a ride"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = doRequestAs(r, admin.ID, "DELETE", path, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = doRequestAs(r, user.ID, "POST", "/calls", map[string]string{"desc": "Need a ride"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/auth"
+	"github.com/pageza/vet-app/geo"
+	"github.com/pageza/vet-app/matching"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/rbac"
+	"github.com/pageza/vet-app/repository"
+)
+
+// Caps on what a volunteer profile may list.
+const (
+	maxProfileWords   = 20
+	maxProfileWindows = 28
+)
+
+// Suggestions are limited to defaultSuggestions unless asked for up to
+// maxSuggestions.
+const (
+	defaultSuggestions = 10
+	maxSuggestions     = 50
+)
+
+// serviceAreaView says where a volunteer takes calls.
+type serviceAreaView struct {
+	Lat    float64 `json:"lat"`
+	Lng    float64 `json:"lng"`
+	Radius float64 `json:"radius"`
+}
+
+// volunteerView is the JSON representation of a volunteer profile. The
+// service area, which says roughly where the volunteer lives, is only shown
+// to them and to users allowed to manage calls.
+type volunteerView struct {
+	models.VolunteerProfile
+	ServiceArea *serviceAreaView `json:"service_area,omitempty"`
+}
+
+func newVolunteerView(r *http.Request, profile models.VolunteerProfile) volunteerView {
+	v := volunteerView{VolunteerProfile: profile}
+	v.Skills, v.Certifications, v.Languages = orEmpty(v.Skills), orEmpty(v.Certifications), orEmpty(v.Languages)
+	if v.Availability == nil {
+		v.Availability = models.Availability{}
+	}
+	user := auth.UserFromContext(r.Context())
+	self := user != nil && user.ID == profile.UserID
+	if area := profile.ServiceArea(); area != nil && (self || rbac.Can(r.Context(), models.PermissionManageCalls)) {
+		v.ServiceArea = &serviceAreaView{Lat: area.Center.Lat, Lng: area.Center.Lng, Radius: area.Radius}
+	}
+	return v
+}
+
+// volunteerInput is the request body accepted by SaveVolunteerProfile. It
+// replaces the whole profile; a missing ServiceArea takes calls from
+// anywhere.
+type volunteerInput struct {
+	Bio            string            `json:"bio"`
+	Skills         []string          `json:"skills"`
+	Certifications []string          `json:"certifications"`
+	Languages      []string          `json:"languages"`
+	Availability   []models.Window   `json:"availability"`
+	TimeZone       string            `json:"time_zone"`
+	ServiceArea    *serviceAreaInput `json:"service_area"`
+	Paused         bool              `json:"paused"`
+}
+
+// serviceAreaInput centers a service area on coordinates or a ZIP code.
+type serviceAreaInput struct {
+	locationInput
+	Radius float64 `json:"radius"`
+}
+
+// validate normalizes the input and returns any field errors.
+func (in *volunteerInput) validate() map[string]string {
+	in.Bio = strings.TrimSpace(in.Bio)
+	in.TimeZone = strings.TrimSpace(in.TimeZone)
+
+	fields := map[string]string{}
+	if len(in.Bio) > 500 {
+		fields["bio"] = "must be at most 500 characters"
+	}
+	for name, words := range map[string]*[]string{"skills": &in.Skills, "certifications": &in.Certifications, "languages": &in.Languages} {
+		normalized, msg := normalizeWords(*words)
+		if msg != "" {
+			fields[name] = msg
+		}
+		*words = normalized
+	}
+	if len(in.Availability) > maxProfileWindows {
+		fields["availability"] = fmt.Sprintf("must have at most %d windows", maxProfileWindows)
+	}
+	for i := range in.Availability {
+		w := &in.Availability[i]
+		w.Day = strings.ToLower(strings.TrimSpace(w.Day))
+		if !w.Valid() {
+			fields["availability"] = "each window must name a day of the week and a start before its end, written like 09:00 and 17:30"
+		}
+	}
+	if in.TimeZone == "" {
+		in.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(in.TimeZone); err != nil || len(in.TimeZone) > 64 || in.TimeZone == "Local" {
+		fields["time_zone"] = "must be an IANA time zone such as America/New_York"
+	}
+	if area := in.ServiceArea; area != nil {
+		switch {
+		case area.Lat == nil && area.Lng == nil && area.ZIP == "":
+			fields["service_area"] = "must have lat and lng or a zip"
+		case (area.Lat == nil) != (area.Lng == nil):
+			fields["service_area"] = "must have both lat and lng or neither"
+		case area.Lat != nil && !(geo.Point{Lat: *area.Lat, Lng: *area.Lng}).Valid():
+			fields["service_area"] = "must have lat between -90 and 90 and lng between -180 and 180"
+		}
+		if area.ZIP != "" {
+			zip, ok := geo.NormalizeZIP(area.ZIP)
+			if !ok {
+				fields["service_area.zip"] = "must be a five-digit ZIP code"
+			}
+			area.ZIP = zip
+		}
+		if !(area.Radius > 0 && area.Radius <= maxRadius) {
+			fields["service_area.radius"] = fmt.Sprintf("must be a number of miles greater than 0 and at most %d", maxRadius)
+		}
+	}
+	return fields
+}
+
+// apply copies the input onto profile, placing its service area. It
+// returns field errors if the ZIP code is not known.
+func (in *volunteerInput) apply(locator *geo.Locator, profile *models.VolunteerProfile) map[string]string {
+	profile.Bio = in.Bio
+	profile.Skills = in.Skills
+	profile.Certifications = in.Certifications
+	profile.Languages = in.Languages
+	profile.Availability = in.Availability
+	profile.TimeZone = in.TimeZone
+	profile.Paused = in.Paused
+	area := in.ServiceArea
+	if area == nil {
+		profile.SetServiceArea(nil)
+		return nil
+	}
+	var center *geo.Point
+	if area.Lat != nil {
+		center = &geo.Point{Lat: *area.Lat, Lng: *area.Lng}
+	} else {
+		p, err := locator.ZIP(area.ZIP)
+		if err != nil {
+			return map[string]string{"service_area.zip": zipMessage(err)}
+		}
+		center = p
+	}
+	profile.SetServiceArea(&geo.Circle{Center: *center, Radius: area.Radius})
+	return nil
+}
+
+// normalizeWords lower-cases skills, certifications or languages and drops
+// duplicates, returning a message if any of them is malformed or there are
+// too many.
+func normalizeWords(names []string) ([]string, string) {
+	words, msg := normalizeSlugs(names, "entry")
+	switch {
+	case msg != "":
+		return nil, msg
+	case len(words) > maxProfileWords:
+		return nil, fmt.Sprintf("must have at most %d entries", maxProfileWords)
+	}
+	return words, ""
+}
+
+// orEmpty returns words, or an empty list if it is nil, so that it is
+// written as [] rather than null.
+func orEmpty(words models.Words) models.Words {
+	if words == nil {
+		return models.Words{}
+	}
+	return words
+}
+
+// GetVolunteerProfile returns a user's volunteer profile.
+func (h *Handler) GetVolunteerProfile(w http.ResponseWriter, r *http.Request) {
+	profile, ok := h.loadVolunteerProfile(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newVolunteerView(r, *profile))
+}
+
+// SaveVolunteerProfile creates or replaces the acting user's volunteer
+// profile from a JSON body of the form {"bio": "...", "skills": ["rides"],
+// "certifications": ["cpr"], "languages": ["spanish"], "availability":
+// [{"day": "monday", "start": "09:00", "end": "17:00"}], "time_zone":
+// "America/New_York", "service_area": {"zip": "20500", "radius": 10},
+// "paused": false}. Its route is expected to require the responses:create
+// permission.
+func (h *Handler) SaveVolunteerProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("user not found"))
+		return
+	}
+	if id != user.ID {
+		writeError(w, r, apierr.Forbidden("you may only change your own volunteer profile"))
+		return
+	}
+
+	var in volunteerInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeError(w, r, apierr.BadRequest("invalid JSON body"))
+		return
+	}
+	if fields := in.validate(); len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+
+	profile := models.VolunteerProfile{UserID: user.ID}
+	if fields := in.apply(h.locator, &profile); len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+	if err := h.volunteers.Save(r.Context(), &profile); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	profile.User = *user
+	writeJSON(w, http.StatusOK, newVolunteerView(r, profile))
+}
+
+// DeleteVolunteerProfile deletes a user's volunteer profile, so they are no
+// longer suggested for calls. Users may delete their own, and users allowed
+// to delete users anyone's.
+func (h *Handler) DeleteVolunteerProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	profile, ok := h.loadVolunteerProfile(w, r)
+	if !ok {
+		return
+	}
+	if !canModify(r, user, profile.UserID, models.PermissionDeleteUsers) {
+		writeError(w, r, apierr.Forbidden("you may only delete your own volunteer profile"))
+		return
+	}
+	if err := h.volunteers.Delete(r.Context(), profile.UserID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// responderView is a volunteer suggested for a call. Distance is how many
+// whole miles the call is from the center of their service area, rounded so
+// as not to say where they live.
+type responderView struct {
+	Volunteer      authorSummary `json:"volunteer"`
+	Bio            string        `json:"bio"`
+	Skills         models.Words  `json:"skills"`
+	Certifications models.Words  `json:"certifications"`
+	Languages      models.Words  `json:"languages"`
+	Score          float64       `json:"score"`
+	Distance       *float64      `json:"distance,omitempty"`
+	Reasons        []string      `json:"reasons"`
+}
+
+func newResponderView(m matching.Match) responderView {
+	p := m.Profile
+	view := responderView{
+		Volunteer:      newAuthorSummary(p.User),
+		Bio:            p.Bio,
+		Skills:         orEmpty(p.Skills),
+		Certifications: orEmpty(p.Certifications),
+		Languages:      orEmpty(p.Languages),
+		Score:          m.Score,
+		Reasons:        m.Reasons,
+	}
+	if m.Distance != nil {
+		miles := math.Round(*m.Distance)
+		view.Distance = &miles
+	}
+	return view
+}
+
+// suggestedCallView is a call suggested to a volunteer, with its distance
+// from the center of their service area.
+type suggestedCallView struct {
+	callView
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
+// GetSuggestedResponders lists the volunteers best suited to a call, best
+// first, up to limit of them. Only the call's owner and users allowed to
+// manage calls may see them.
+func (h *Handler) GetSuggestedResponders(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	fields := map[string]string{}
+	limit := querySuggestions(r, fields)
+	if len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+
+	call, ok := h.loadCall(w, r, "id")
+	if !ok {
+		return
+	}
+	if !canModify(r, user, call.UserID, models.PermissionManageCalls) {
+		writeError(w, r, apierr.Forbidden("only the owner of a call may see who is suggested for it"))
+		return
+	}
+
+	matches, err := h.matcher.Responders(r.Context(), call, limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	views := make([]responderView, len(matches))
+	for i, m := range matches {
+		views[i] = newResponderView(m)
+	}
+	writeJSON(w, http.StatusOK, listResponse[responderView]{Data: views})
+}
+
+// GetSuggestedCalls lists the open calls a volunteer is best suited to,
+// best first, up to limit of them. Volunteers may only see their own
+// suggestions.
+func (h *Handler) GetSuggestedCalls(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("user not found"))
+		return
+	}
+	if id != user.ID {
+		writeError(w, r, apierr.Forbidden("you may only see calls suggested to you"))
+		return
+	}
+	fields := map[string]string{}
+	limit := querySuggestions(r, fields)
+	if len(fields) > 0 {
+		writeError(w, r, apierr.Validation(fields))
+		return
+	}
+
+	profile, ok := h.loadVolunteerProfile(w, r)
+	if !ok {
+		return
+	}
+	filter := repository.CallFilter{ExcludeDeleting: excludeDeleting(r)}
+	if !rbac.Can(r.Context(), models.PermissionViewVeteranOnly) {
+		veteranOnly := false
+		filter.VeteranOnly = &veteranOnly
+	}
+	matches, err := h.matcher.Calls(r.Context(), profile, filter, limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	views := make([]suggestedCallView, len(matches))
+	for i, m := range matches {
+		m.Call.Distance = m.Distance
+		views[i] = suggestedCallView{callView: newCallView(r, m.Call), Score: m.Score, Reasons: m.Reasons}
+	}
+	writeJSON(w, http.StatusOK, listResponse[suggestedCallView]{Data: views})
+}
+
+// querySuggestions parses the limit query parameter of suggestion lists,
+// recording a field error if it is malformed.
+func querySuggestions(r *http.Request, fields map[string]string) int {
+	limit, ok := queryUint(r, "limit", fields)
+	switch {
+	case !ok:
+		return defaultSuggestions
+	case limit > maxSuggestions:
+		fields["limit"] = fmt.Sprintf("must be at most %d", maxSuggestions)
+	}
+	return int(limit)
+}
+
+// loadVolunteerProfile fetches the volunteer profile of the user named by
+// the "id" route variable, writing a 404 response if they have none or are
+// hidden from the viewer.
+func (h *Handler) loadVolunteerProfile(w http.ResponseWriter, r *http.Request) (*models.VolunteerProfile, bool) {
+	id, err := pathID(r, "id")
+	if err != nil {
+		writeError(w, r, apierr.NotFound("volunteer profile not found"))
+		return nil, false
+	}
+
+	profile, err := h.volunteers.Get(r.Context(), id)
+	if err == nil && !canSeeUser(r, &profile.User) {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = apierr.NotFound("volunteer profile not found")
+		}
+		writeError(w, r, err)
+		return nil, false
+	}
+	return profile, true
+}
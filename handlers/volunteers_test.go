@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pageza/vet-app/geo"
+	"github.com/pageza/vet-app/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolunteerProfile(t *testing.T) {
+	r, repos := setup(t)
+	volunteer := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+	other := createUser(t, repos, "John Doe", "john@example.com", false)
+	admin := createUser(t, repos, "Admin", "admin@example.com", true)
+	path := fmt.Sprintf("/users/%d/volunteer-profile", volunteer.ID)
+
+	rec := doRequest(r, "GET", path, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	profile := map[string]interface{}{
+		"bio":            "Retired medic",
+		"skills":         []string{"Rides", "housing", "rides"},
+		"certifications": []string{"cpr"},
+		"languages":      []string{"spanish"},
+		"availability":   []map[string]string{{"day": "Monday", "start": "09:00", "end": "17:00"}},
+		"time_zone":      "America/New_York",
+		"service_area":   map[string]interface{}{"zip": "20500", "radius": 10},
+	}
+	rec = doRequestAs(r, other.ID, "PUT", path, profile)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	for name, bad := range map[string]interface{}{
+		"skills":       []string{"first aid"},
+		"availability": []map[string]string{{"day": "monday", "start": "17:00", "end": "09:00"}},
+		"time_zone":    "Mars/Olympus_Mons",
+		"service_area": map[string]interface{}{"zip": "20500"},
+	} {
+		body := map[string]interface{}{name: bad}
+		rec = doRequestAs(r, volunteer.ID, "PUT", path, body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, name)
+	}
+	rec = doRequestAs(r, volunteer.ID, "PUT", path, map[string]interface{}{"service_area": map[string]interface{}{"zip": "99999", "radius": 10}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequestAs(r, volunteer.ID, "PUT", path, profile)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var saved volunteerView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&saved))
+	assert.Equal(t, models.Words{"rides", "housing"}, saved.Skills)
+	assert.Equal(t, "monday", saved.Availability[0].Day)
+	assert.Equal(t, &serviceAreaView{Lat: 38.8977, Lng: -77.0365, Radius: 10}, saved.ServiceArea)
+
+	// Only the volunteer and managers see where they take calls from.
+	rec = doRequestAs(r, other.ID, "GET", path, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var seen volunteerView
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&seen))
+	assert.Equal(t, "Retired medic", seen.Bio)
+	assert.Nil(t, seen.ServiceArea)
+	rec = doRequestAs(r, admin.ID, "GET", path, nil)
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&seen))
+	assert.NotNil(t, seen.ServiceArea)
+
+	// Saving again replaces the whole profile.
+	rec = doRequestAs(r, volunteer.ID, "PUT", path, map[string]interface{}{"skills": []string{"cooking"}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	stored, err := repos.Volunteers.Get(ctx, volunteer.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.Words{"cooking"}, stored.Skills)
+	assert.Nil(t, stored.ServiceArea())
+	assert.Equal(t, "UTC", stored.TimeZone)
+
+	rec = doRequestAs(r, other.ID, "DELETE", path, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = doRequestAs(r, volunteer.ID, "DELETE", path, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = doRequest(r, "GET", path, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestSuggestedResponders(t *testing.T) {
+	r, repos := setup(t)
+	owner := createUser(t, repos, "John Doe", "john@example.com", false)
+	other := createUser(t, repos, "Jim Doe", "jim@example.com", false)
+	medic := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+	driver := createUser(t, repos, "Joan Doe", "joan@example.com", false)
+	far := createUser(t, repos, "Jack Doe", "jack@example.com", false)
+
+	center := geo.Point{Lat: 38.8977, Lng: -77.0365}
+	save := func(user models.User, area *geo.Circle, skills ...string) {
+		profile := models.VolunteerProfile{UserID: user.ID, Skills: skills}
+		profile.SetServiceArea(area)
+		assert.NoError(t, repos.Volunteers.Save(ctx, &profile))
+	}
+	save(medic, &geo.Circle{Center: center, Radius: 10}, "housing", "eviction")
+	save(driver, nil, "housing")
+	save(far, &geo.Circle{Center: geo.Offset(center, 100, 0), Radius: 10}, "housing")
+
+	housing, err := repos.Categories.Get(ctx, "housing")
+	assert.NoError(t, err)
+	call := models.Call{UserID: owner.ID, Desc: "Behind on rent", CategoryID: &housing.ID, Tags: []models.Tag{{Name: "eviction"}}}
+	call.SetLocation(&center, &center)
+	assert.NoError(t, repos.Calls.Create(ctx, &call))
+	path := fmt.Sprintf("/calls/%d/suggested-responders", call.ID)
+
+	rec := doRequest(r, "GET", path, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = doRequestAs(r, other.ID, "GET", path, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = doRequestAs(r, owner.ID, "GET", path+"?limit=51", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequestAs(r, owner.ID, "GET", path, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var list listResponse[responderView]
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+	if assert.Len(t, list.Data, 2) {
+		assert.Equal(t, authorSummary{ID: medic.ID, Name: "Jane Doe"}, list.Data[0].Volunteer)
+		assert.Equal(t, 0.0, *list.Data[0].Distance)
+		assert.Contains(t, list.Data[0].Reasons, "skilled in eviction")
+		assert.Equal(t, driver.ID, list.Data[1].Volunteer.ID)
+		assert.Nil(t, list.Data[1].Distance)
+	}
+
+	rec = doRequestAs(r, owner.ID, "GET", path+"?limit=1", nil)
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+	assert.Len(t, list.Data, 1)
+}
+
+func TestSuggestedCalls(t *testing.T) {
+	r, repos := setup(t)
+	owner := createUser(t, repos, "John Doe", "john@example.com", false)
+	volunteer := createUser(t, repos, "Jane Doe", "jane@example.com", false)
+	path := fmt.Sprintf("/users/%d/suggested-calls", volunteer.ID)
+
+	rec := doRequestAs(r, owner.ID, "GET", path, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = doRequestAs(r, volunteer.ID, "GET", path, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	assert.NoError(t, repos.Volunteers.Save(ctx, &models.VolunteerProfile{UserID: volunteer.ID, Skills: models.Words{"rides"}}))
+	ride := models.Call{UserID: owner.ID, Desc: "Ride to the VA", Tags: []models.Tag{{Name: "rides"}}}
+	assert.NoError(t, repos.Calls.Create(ctx, &ride))
+	hidden := models.Call{UserID: owner.ID, Desc: "Ride to the VFW", VeteranOnly: true, Tags: []models.Tag{{Name: "rides"}}}
+	assert.NoError(t, repos.Calls.Create(ctx, &hidden))
+	assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: owner.ID, Desc: "Paperwork"}))
+
+	rec = doRequestAs(r, volunteer.ID, "GET", path, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var list listResponse[suggestedCallView]
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+	if assert.Len(t, list.Data, 1) {
+		assert.Equal(t, ride.ID, list.Data[0].ID)
+		assert.Equal(t, "John Doe", list.Data[0].Author.Name)
+		assert.Equal(t, []string{"skilled in rides"}, list.Data[0].Reasons)
+	}
+}
@@ -0,0 +1,38 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pageza/vet-app/migrations"
+)
+
+// Postgres checks that the database answers a ping. It is critical.
+func Postgres(db *sql.DB) Check {
+	return Check{Name: "postgres", Critical: true, Run: db.PingContext}
+}
+
+// Redis checks that Redis answers a ping. Redis only backs optional
+// features, so a failure degrades the service rather than taking it down.
+func Redis(client *redis.Client) Check {
+	return Check{Name: "redis", Run: func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}}
+}
+
+// Migrations checks that every embedded migration has been applied. It is
+// critical because the handlers assume the latest schema.
+func Migrations(m *migrations.Migrator) Check {
+	return Check{Name: "migrations", Critical: true, Run: func(ctx context.Context) error {
+		pending, err := m.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending migrations, first is %d_%s", len(pending), pending[0].Version, pending[0].Name)
+		}
+		return nil
+	}}
+}
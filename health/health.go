@@ -0,0 +1,136 @@
+// Package health serves the liveness and readiness probes.
+//
+// GET /healthz reports only that the process is running. GET /readyz runs
+// every registered check and responds with
+//
+//	{"status": "degraded", "checks": {"postgres": {"status": "up", "latency_ms": 1.3}, ...}}
+//
+// The overall status is "ok" when every check passes, "degraded" when only
+// non-critical checks fail and "unavailable" when a critical check fails.
+// Only "unavailable" responds with 503, so a degraded instance keeps
+// receiving traffic.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Overall and per-check statuses.
+const (
+	StatusOK          = "ok"
+	StatusDegraded    = "degraded"
+	StatusUnavailable = "unavailable"
+
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// DefaultTimeout bounds each check when no timeout is given to New.
+const DefaultTimeout = 2 * time.Second
+
+// Check is a single dependency check.
+type Check struct {
+	Name string
+	// Critical checks make the service unavailable when they fail; other
+	// failures only degrade it.
+	Critical bool
+	Run      func(ctx context.Context) error
+}
+
+// Result is the outcome of a Check.
+type Result struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the body returned by the readiness probe.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checker runs the readiness checks.
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+}
+
+// New returns a Checker that gives each check at most timeout to finish.
+func New(timeout time.Duration, checks ...Check) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{checks: checks, timeout: timeout}
+}
+
+// Run runs every check concurrently and summarises the results.
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(c.checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			result := c.run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = result
+			if result.Status == StatusDown {
+				if check.Critical {
+					report.Status = StatusUnavailable
+				} else if report.Status == StatusOK {
+					report.Status = StatusDegraded
+				}
+			}
+		}(check)
+	}
+	wg.Wait()
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Run(ctx)
+	result := Result{
+		Status:    StatusUp,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Liveness handles GET /healthz.
+func (c *Checker) Liveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": StatusOK})
+}
+
+// Readiness handles GET /readyz.
+func (c *Checker) Readiness(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+	status := http.StatusOK
+	if report.Status == StatusUnavailable {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
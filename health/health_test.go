@@ -0,0 +1,78 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func up(name string, critical bool) Check {
+	return Check{Name: name, Critical: critical, Run: func(context.Context) error { return nil }}
+}
+
+func down(name string, critical bool) Check {
+	return Check{Name: name, Critical: critical, Run: func(context.Context) error { return errors.New("connection refused") }}
+}
+
+func readyz(t *testing.T, c *Checker) (int, Report) {
+	rr := httptest.NewRecorder()
+	c.Readiness(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+	var report Report
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decoding report: %v", err)
+	}
+	return rr.Code, report
+}
+
+func TestLiveness(t *testing.T) {
+	rr := httptest.NewRecorder()
+	New(0, down("postgres", true)).Liveness(rr, httptest.NewRequest("GET", "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rr.Body.String())
+}
+
+func TestReadinessOK(t *testing.T) {
+	code, report := readyz(t, New(0, up("postgres", true), up("redis", false)))
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, report.Status)
+	assert.Equal(t, StatusUp, report.Checks["postgres"].Status)
+	assert.Equal(t, StatusUp, report.Checks["redis"].Status)
+}
+
+func TestReadinessDegraded(t *testing.T) {
+	code, report := readyz(t, New(0, up("postgres", true), down("redis", false)))
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.Equal(t, StatusDown, report.Checks["redis"].Status)
+	assert.Equal(t, "connection refused", report.Checks["redis"].Error)
+}
+
+func TestReadinessUnavailable(t *testing.T) {
+	code, report := readyz(t, New(0, down("postgres", true), down("redis", false)))
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusUnavailable, report.Status)
+	assert.Equal(t, StatusDown, report.Checks["postgres"].Status)
+}
+
+func TestCheckTimeout(t *testing.T) {
+	slow := Check{Name: "postgres", Critical: true, Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	code, report := readyz(t, New(20*time.Millisecond, slow))
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["postgres"].Error)
+	assert.GreaterOrEqual(t, report.Checks["postgres"].LatencyMS, 20.0)
+}
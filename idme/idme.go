@@ -0,0 +1,156 @@
+// Package idme logs users in through ID.me with the OpenID Connect
+// authorization code flow and reports whether they are verified veterans.
+package idme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/pageza/vet-app/config"
+	"golang.org/x/oauth2"
+)
+
+// ErrNonceMismatch is returned when the ID token was not issued for the
+// login attempt being completed.
+var ErrNonceMismatch = errors.New("id token nonce does not match")
+
+// Identity is what the provider asserts about a user who logged in. Branch
+// is the veteran's branch of service and Level the assurance level of the
+// verification, when the provider shares them.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Groups        []string
+	Veteran       bool
+	Branch        string
+	Level         string
+}
+
+// Provider runs the authorization code flow. The state, nonce and PKCE
+// verifier are generated by the caller and must be the same for both calls.
+type Provider interface {
+	// AuthCodeURL returns the URL to send the user to for login.
+	AuthCodeURL(state, nonce, verifier string) string
+	// Exchange redeems the code returned to the redirect URL and returns the
+	// verified identity from the ID token.
+	Exchange(ctx context.Context, code, nonce, verifier string) (*Identity, error)
+}
+
+// OIDC is the Provider for a real OpenID Connect issuer.
+type OIDC struct {
+	oauth        oauth2.Config
+	verifier     *oidc.IDTokenVerifier
+	client       *http.Client
+	veteranClaim string
+	veteranGroup string
+	branchClaim  string
+}
+
+// New discovers the issuer in cfg and returns a Provider for it. client is
+// used for every request to the issuer; nil means http.DefaultClient.
+func New(ctx context.Context, cfg config.IDmeConfig, client *http.Client) (*OIDC, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, client), cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discovering %s: %w", cfg.Issuer, err)
+	}
+
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID}
+	}
+	return &OIDC{
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier:     provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		client:       client,
+		veteranClaim: cfg.VeteranClaim,
+		veteranGroup: cfg.VeteranGroup,
+		branchClaim:  cfg.BranchClaim,
+	}, nil
+}
+
+func (p *OIDC) AuthCodeURL(state, nonce, verifier string) string {
+	return p.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+func (p *OIDC) Exchange(ctx context.Context, code, nonce, verifier string) (*Identity, error) {
+	ctx = oidc.ClientContext(ctx, p.client)
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verifying id token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("reading id token claims: %w", err)
+	}
+	return p.identity(idToken.Subject, claims), nil
+}
+
+func (p *OIDC) identity(subject string, claims map[string]interface{}) *Identity {
+	id := &Identity{
+		Subject: subject,
+		Email:   strings.ToLower(stringClaim(claims, "email")),
+		Name:    stringClaim(claims, "name"),
+		Groups:  stringsClaim(claims, p.veteranClaim),
+		Branch:  stringClaim(claims, p.branchClaim),
+		Level:   stringClaim(claims, "acr"),
+	}
+	id.EmailVerified, _ = claims["email_verified"].(bool)
+	if id.Name == "" {
+		id.Name = strings.TrimSpace(stringClaim(claims, "given_name") + " " + stringClaim(claims, "family_name"))
+	}
+	for _, group := range id.Groups {
+		if strings.EqualFold(group, p.veteranGroup) {
+			id.Veteran = true
+		}
+	}
+	return id
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// stringsClaim reads a claim that may be a single string or a list of them.
+func stringsClaim(claims map[string]interface{}, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
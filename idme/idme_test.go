@@ -0,0 +1,123 @@
+package idme_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/pageza/vet-app/idme"
+	"github.com/pageza/vet-app/idme/idmetest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+const redirectURL = "https://vet-app.test/auth/idme/callback"
+
+func newProvider(t *testing.T) (*idme.OIDC, *idmetest.Issuer) {
+	issuer := idmetest.New("vet-app", "secret")
+	p, err := idme.New(context.Background(), issuer.Config(redirectURL), issuer.Client())
+	if err != nil {
+		t.Fatalf("creating provider: %v", err)
+	}
+	return p, issuer
+}
+
+// login runs the flow up to the redirect back to the client and returns the
+// code.
+func login(t *testing.T, p idme.Provider, issuer *idmetest.Issuer, nonce, verifier string) string {
+	callback, err := issuer.Authorize(p.AuthCodeURL("state-1", nonce, verifier))
+	if err != nil {
+		t.Fatalf("authorizing: %v", err)
+	}
+	assert.Equal(t, "state-1", callback.Query().Get("state"))
+	return callback.Query().Get("code")
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	p, _ := newProvider(t)
+	u, err := url.Parse(p.AuthCodeURL("state-1", "nonce-1", oauth2.GenerateVerifier()))
+	assert.NoError(t, err)
+
+	q := u.Query()
+	assert.Equal(t, idmetest.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, "vet-app", q.Get("client_id"))
+	assert.Equal(t, redirectURL, q.Get("redirect_uri"))
+	assert.Equal(t, "openid email military", q.Get("scope"))
+	assert.Equal(t, "nonce-1", q.Get("nonce"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+}
+
+func TestExchangeVeteran(t *testing.T) {
+	p, issuer := newProvider(t)
+	issuer.LoginAs(idmetest.Claims{
+		"sub":            "abc123",
+		"email":          "Vet@Example.com",
+		"email_verified": true,
+		"given_name":     "Jane",
+		"family_name":    "Doe",
+		"groups":         []string{"military", "veteran"},
+		"branch":         "Army",
+		"acr":            "IAL2",
+	})
+	verifier := oauth2.GenerateVerifier()
+	code := login(t, p, issuer, "nonce-1", verifier)
+
+	id, err := p.Exchange(context.Background(), code, "nonce-1", verifier)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &idme.Identity{
+			Subject:       "abc123",
+			Email:         "vet@example.com",
+			EmailVerified: true,
+			Name:          "Jane Doe",
+			Groups:        []string{"military", "veteran"},
+			Veteran:       true,
+			Branch:        "Army",
+			Level:         "IAL2",
+		}, id)
+	}
+}
+
+func TestExchangeNonVeteran(t *testing.T) {
+	p, issuer := newProvider(t)
+	issuer.LoginAs(idmetest.Claims{"sub": "abc123", "name": "John Doe", "groups": "student"})
+	verifier := oauth2.GenerateVerifier()
+	code := login(t, p, issuer, "nonce-1", verifier)
+
+	id, err := p.Exchange(context.Background(), code, "nonce-1", verifier)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "John Doe", id.Name)
+		assert.Equal(t, []string{"student"}, id.Groups)
+		assert.False(t, id.Veteran)
+	}
+}
+
+func TestExchangeRejectsWrongNonce(t *testing.T) {
+	p, issuer := newProvider(t)
+	issuer.LoginAs(idmetest.Claims{"sub": "abc123"})
+	verifier := oauth2.GenerateVerifier()
+	code := login(t, p, issuer, "nonce-1", verifier)
+
+	_, err := p.Exchange(context.Background(), code, "nonce-2", verifier)
+	assert.ErrorIs(t, err, idme.ErrNonceMismatch)
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	p, issuer := newProvider(t)
+	issuer.LoginAs(idmetest.Claims{"sub": "abc123"})
+	code := login(t, p, issuer, "nonce-1", oauth2.GenerateVerifier())
+
+	_, err := p.Exchange(context.Background(), code, "nonce-1", oauth2.GenerateVerifier())
+	assert.ErrorContains(t, err, "invalid_grant")
+}
+
+func TestExchangeRejectsReusedCode(t *testing.T) {
+	p, issuer := newProvider(t)
+	issuer.LoginAs(idmetest.Claims{"sub": "abc123"})
+	verifier := oauth2.GenerateVerifier()
+	code := login(t, p, issuer, "nonce-1", verifier)
+
+	_, err := p.Exchange(context.Background(), code, "nonce-1", verifier)
+	assert.NoError(t, err)
+	_, err = p.Exchange(context.Background(), code, "nonce-1", verifier)
+	assert.Error(t, err)
+}
@@ -0,0 +1,278 @@
+// Package idmetest provides an in-process OpenID Connect issuer that stands
+// in for ID.me in tests. It is reached through the http.Client returned by
+// Client, so no network is involved.
+package idmetest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/pageza/vet-app/config"
+)
+
+// URL is the issuer identifier of every fake issuer.
+const URL = "https://idme.test"
+
+const keyID = "idmetest"
+
+// Claims are added to the ID token issued for a login. They must include
+// "sub".
+type Claims map[string]interface{}
+
+type grant struct {
+	claims      Claims
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+// Issuer is a fake OpenID Connect issuer.
+type Issuer struct {
+	ClientID     string
+	ClientSecret string
+
+	key    *rsa.PrivateKey
+	signer jose.Signer
+
+	mu     sync.Mutex
+	next   Claims
+	grants map[string]grant
+}
+
+// New returns an issuer that accepts the given client credentials.
+func New(clientID, clientSecret string) *Issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", keyID),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return &Issuer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		signer:       signer,
+		grants:       map[string]grant{},
+	}
+}
+
+// Config returns the ID.me configuration for a client of this issuer.
+func (i *Issuer) Config(redirectURL string) config.IDmeConfig {
+	return config.IDmeConfig{
+		Issuer:       URL,
+		ClientID:     i.ClientID,
+		ClientSecret: i.ClientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"openid", "email", "military"},
+		VeteranClaim: "groups",
+		VeteranGroup: "veteran",
+		BranchClaim:  "branch",
+	}
+}
+
+// Client returns an http.Client whose requests are served by the issuer.
+func (i *Issuer) Client() *http.Client {
+	return &http.Client{
+		Transport: roundTripper{i},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+type roundTripper struct {
+	h http.Handler
+}
+
+func (t roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rr := httptest.NewRecorder()
+	t.h.ServeHTTP(rr, req)
+	return rr.Result(), nil
+}
+
+// LoginAs makes the next authorization request log in a user with claims.
+func (i *Issuer) LoginAs(claims Claims) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.next = claims
+}
+
+// Authorize follows an authorization URL, as a browser would, and returns
+// the redirect back to the client with the code and state.
+func (i *Issuer) Authorize(authURL string) (*url.URL, error) {
+	resp, err := i.Client().Get(authURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("authorize returned %s", resp.Status)
+	}
+	return resp.Location()
+}
+
+// ServeHTTP implements the discovery, authorization, token and JWKS
+// endpoints.
+func (i *Issuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                URL,
+			"authorization_endpoint":                URL + "/authorize",
+			"token_endpoint":                        URL + "/token",
+			"jwks_uri":                              URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	case "/jwks":
+		writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+			Key: &i.key.PublicKey, KeyID: keyID, Algorithm: string(jose.RS256), Use: "sig",
+		}}})
+	case "/authorize":
+		i.authorize(w, r)
+	case "/token":
+		i.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (i *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != i.ClientID || q.Get("response_type") != "code" {
+		oauthError(w, "unauthorized_client")
+		return
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		oauthError(w, "invalid_request")
+		return
+	}
+
+	i.mu.Lock()
+	claims := i.next
+	i.next = nil
+	code := randomString()
+	if claims != nil {
+		i.grants[code] = grant{
+			claims:      claims,
+			nonce:       q.Get("nonce"),
+			challenge:   q.Get("code_challenge"),
+			redirectURI: q.Get("redirect_uri"),
+		}
+	}
+	i.mu.Unlock()
+
+	if claims == nil {
+		oauthError(w, "access_denied")
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		oauthError(w, "invalid_request")
+		return
+	}
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, "invalid_request")
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != i.ClientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(i.ClientSecret)) != 1 {
+		oauthError(w, "invalid_client")
+		return
+	}
+
+	i.mu.Lock()
+	g, ok := i.grants[r.PostForm.Get("code")]
+	delete(i.grants, r.PostForm.Get("code"))
+	i.mu.Unlock()
+
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("redirect_uri") != g.redirectURI {
+		oauthError(w, "invalid_grant")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		oauthError(w, "invalid_grant")
+		return
+	}
+
+	idToken, err := i.idToken(g)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (i *Issuer) idToken(g grant) (string, error) {
+	sub, _ := g.claims["sub"].(string)
+	if sub == "" {
+		return "", errors.New("idmetest: login claims have no sub")
+	}
+	now := time.Now()
+	registered := jwt.Claims{
+		Issuer:   URL,
+		Subject:  sub,
+		Audience: jwt.Audience{i.ClientID},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+	}
+	extra := map[string]interface{}{}
+	for k, v := range g.claims {
+		extra[k] = v
+	}
+	if g.nonce != "" {
+		extra["nonce"] = g.nonce
+	}
+	return jwt.Signed(i.signer).Claims(extra).Claims(registered).Serialize()
+}
+
+func oauthError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,289 @@
+// Package magiclink logs users in through links sent to their email
+// address, for volunteers who cannot verify through ID.me.
+//
+// A link carries a token holding the email address, an expiry and a random
+// ID, signed with HMAC-SHA256 so it cannot be forged. Redeeming the token
+// records its ID in Redis until it expires, so that it only works once.
+// Users who do not have an account get one on their first login; since
+// email proves nothing about veteran status they start out as unverified
+// volunteers.
+//
+// A login link only logs into an existing account if that account's email
+// address was verified, since anyone can give an account an address they
+// do not own. Logged-in users verify their address with a verification
+// link, which is bound to their account and to the address it was sent to.
+package magiclink
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pageza/vet-app/config"
+	"github.com/pageza/vet-app/mail"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"github.com/pageza/vet-app/ratelimit"
+	"github.com/pageza/vet-app/repository"
+)
+
+// Errors returned by Service.
+var (
+	ErrInvalidToken    = errors.New("login link is invalid, expired or already used")
+	ErrRateLimited     = errors.New("too many login links requested")
+	ErrUnverifiedEmail = errors.New("the account with this email address has not verified it")
+)
+
+// claims is the signed content of a token. Name is only used if the user
+// has no account yet. UserID is set in verification links to the account
+// whose address they verify.
+type claims struct {
+	ID        string `json:"jti"`
+	Email     string `json:"email"`
+	Name      string `json:"name,omitempty"`
+	UserID    uint   `json:"uid,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Service sends login links and redeems their tokens.
+type Service struct {
+	users   repository.UserRepository
+	client  *redis.Client
+	limiter *ratelimit.Limiter
+	sender  mail.Sender
+	secret  []byte
+	cfg     config.MagicLinkConfig
+	now     func() time.Time
+}
+
+// NewService returns a Service that signs tokens with secret and emails
+// links to the page at cfg.URL through sender.
+func NewService(repos repository.Repositories, client *redis.Client, limiter *ratelimit.Limiter, sender mail.Sender, secret []byte, cfg config.MagicLinkConfig) *Service {
+	return &Service{
+		users:   repos.Users,
+		client:  client,
+		limiter: limiter,
+		sender:  sender,
+		secret:  secret,
+		cfg:     cfg,
+		now:     time.Now,
+	}
+}
+
+// ParseSecret decodes a base64-encoded signing key of at least 32 bytes.
+func ParseSecret(encoded string) ([]byte, error) {
+	secret, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding magic link secret: %w", err)
+	}
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("magic link secret must be at least 32 bytes, got %d", len(secret))
+	}
+	return secret, nil
+}
+
+// GenerateSecret returns a new random signing key. Links it signs stop
+// working after a restart and are not accepted by other instances.
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+func usedKey(id string) string {
+	return "magiclink:used:" + id
+}
+
+// Send emails a login link to email, returning ErrRateLimited if too many
+// were sent to it recently. name is given to the account if one has to be
+// created, falling back to the part of the address before the @. It does not matter whether email already has an account, so that
+// callers cannot learn who does.
+func (s *Service) Send(ctx context.Context, email, name string) error {
+	email = strings.ToLower(email)
+	return s.send(ctx, claims{Email: email, Name: name}, "Your login link", "log in")
+}
+
+// SendVerification emails user a link that verifies their email address
+// and logs them in, returning ErrRateLimited if too many links were sent to
+// the address recently.
+func (s *Service) SendVerification(ctx context.Context, user *models.User) error {
+	return s.send(ctx, claims{Email: user.Email, UserID: user.ID}, "Verify your email address", "verify your email address")
+}
+
+// send signs c with a new ID and expiry and emails a link holding it to
+// c.Email.
+func (s *Service) send(ctx context.Context, c claims, subject, action string) error {
+	res, err := s.limiter.Allow(ctx, "magiclink:"+c.Email, ratelimit.Limit{Requests: s.cfg.RateLimit, Window: s.cfg.RateLimitWindow})
+	if err != nil {
+		return err
+	}
+	if !res.Allowed {
+		return ErrRateLimited
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	c.ID = hex.EncodeToString(id)
+	c.ExpiresAt = s.now().Add(s.cfg.TTL).Unix()
+	token, err := s.sign(c)
+	if err != nil {
+		return err
+	}
+	link, err := url.Parse(s.cfg.URL)
+	if err != nil {
+		return err
+	}
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+
+	return s.sender.Send(ctx, mail.Message{
+		To:      c.Email,
+		Subject: subject,
+		Body: fmt.Sprintf("Follow this link to %s:\n\n%s\n\nIt works once and expires in %s. If you did not ask for it you can ignore this email.\n",
+			action, link, s.cfg.TTL),
+	})
+}
+
+// Redeem checks token and uses it up, returning the user it logs in. A user
+// is created if none has the token's email address, with that address
+// verified. An existing user is only logged in if they verified their
+// address; otherwise Redeem returns ErrUnverifiedEmail. Verification links
+// verify the address of the user they were sent to, as long as it has not
+// changed since.
+func (s *Service) Redeem(ctx context.Context, token string) (*models.User, error) {
+	c, err := s.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	ttl := time.Unix(c.ExpiresAt, 0).Sub(s.now())
+	if ttl <= 0 {
+		return nil, ErrInvalidToken
+	}
+	fresh, err := s.client.SetNX(ctx, usedKey(c.ID), 1, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, ErrInvalidToken
+	}
+	if c.UserID != 0 {
+		return s.verifyEmail(ctx, c)
+	}
+
+	user, err := s.existingUser(ctx, c.Email)
+	if err != nil || user != nil {
+		return user, err
+	}
+	now := s.now()
+	name := c.Name
+	if name == "" {
+		name, _, _ = strings.Cut(c.Email, "@")
+	}
+	user = &models.User{Name: name, Email: c.Email, EmailVerifiedAt: &now}
+	if err := s.users.Create(ctx, user); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			// Another link for the same address was redeemed at the
+			// same time.
+			return s.existingUser(ctx, c.Email)
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// verifyEmail marks the address in the verification link c as verified for
+// its user.
+func (s *Service) verifyEmail(ctx context.Context, c *claims) (*models.User, error) {
+	user, err := s.users.Get(ctx, c.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Email != c.Email {
+		return nil, ErrInvalidToken
+	}
+	if !user.EmailVerified() {
+		now := s.now()
+		user.EmailVerifiedAt = &now
+		if err := s.users.Update(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// existingUser returns the user with email, or nil if there is none, and
+// ErrUnverifiedEmail if they have not verified it.
+func (s *Service) existingUser(ctx context.Context, email string) (*models.User, error) {
+	user, err := s.findUser(ctx, email)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	if !user.EmailVerified() {
+		return nil, ErrUnverifiedEmail
+	}
+	return user, nil
+}
+
+func (s *Service) findUser(ctx context.Context, email string) (*models.User, error) {
+	users, err := s.users.List(ctx, repository.UserFilter{Email: email}, pagination.Params{Limit: 1, Sort: pagination.SortID})
+	if err != nil || len(users) == 0 {
+		return nil, err
+	}
+	return &users[0], nil
+}
+
+// sign encodes c as base64url JSON followed by a dot and its signature.
+func (s *Service) sign(c claims) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded)), nil
+}
+
+// verify checks token's signature and returns its claims. Expiry is left
+// to the caller.
+func (s *Service) verify(token string) (*claims, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, s.mac(encoded)) {
+		return nil, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil || c.ID == "" || c.Email == "" {
+		return nil, ErrInvalidToken
+	}
+	return &c, nil
+}
+
+func (s *Service) mac(encoded string) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(encoded))
+	return h.Sum(nil)
+}
@@ -0,0 +1,176 @@
+package magiclink
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/pageza/vet-app/config"
+	"github.com/pageza/vet-app/mail/mailtest"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/ratelimit"
+	"github.com/pageza/vet-app/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+var linkPattern = regexp.MustCompile(`https://\S+`)
+
+func setup(t *testing.T) (*Service, repository.Repositories, *mailtest.Sender) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	repos := repository.NewMemory()
+	sender := &mailtest.Sender{}
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.MagicLinkConfig{
+		URL:             "https://app.example.org/login?source=email",
+		TTL:             15 * time.Minute,
+		RateLimit:       3,
+		RateLimitWindow: time.Hour,
+	}
+	return NewService(repos, client, ratelimit.NewLimiter(client), sender, secret, cfg), repos, sender
+}
+
+// sentToken returns the token in the link of the last email sent.
+func sentToken(t *testing.T, sender *mailtest.Sender) string {
+	messages := sender.Messages()
+	if len(messages) == 0 {
+		t.Fatal("no email was sent")
+	}
+	link, err := url.Parse(linkPattern.FindString(messages[len(messages)-1].Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "email", link.Query().Get("source"))
+	return link.Query().Get("token")
+}
+
+func TestRedeemCreatesUser(t *testing.T) {
+	s, repos, sender := setup(t)
+	assert.NoError(t, s.Send(ctx, "Jane@Example.com", "Jane Doe"))
+	messages := sender.Messages()
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "jane@example.com", messages[0].To)
+	}
+
+	user, err := s.Redeem(ctx, sentToken(t, sender))
+	assert.NoError(t, err)
+	assert.NotZero(t, user.ID)
+	assert.Equal(t, "Jane Doe", user.Name)
+	assert.Equal(t, "jane@example.com", user.Email)
+	assert.True(t, user.EmailVerified())
+	assert.False(t, user.IsVerifiedVeteran(time.Now()))
+	roles, err := repos.Roles.UserRoles(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, roles)
+}
+
+func TestRedeemCreatesUserWithoutName(t *testing.T) {
+	s, _, sender := setup(t)
+	assert.NoError(t, s.Send(ctx, "jane.doe@example.com", ""))
+
+	user, err := s.Redeem(ctx, sentToken(t, sender))
+	assert.NoError(t, err)
+	assert.Equal(t, "jane.doe", user.Name)
+}
+
+func TestRedeemExistingUser(t *testing.T) {
+	s, repos, sender := setup(t)
+	verified := time.Now()
+	existing := models.User{Name: "John Doe", Email: "john@example.com", EmailVerifiedAt: &verified}
+	assert.NoError(t, repos.Users.Create(ctx, &existing))
+
+	assert.NoError(t, s.Send(ctx, "john@example.com", "Someone Else"))
+	user, err := s.Redeem(ctx, sentToken(t, sender))
+	assert.NoError(t, err)
+	assert.Equal(t, existing.ID, user.ID)
+	assert.Equal(t, "John Doe", user.Name)
+}
+
+func TestRedeemUnverifiedUser(t *testing.T) {
+	s, repos, sender := setup(t)
+	existing := models.User{Name: "John Doe", Email: "john@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, &existing))
+
+	assert.NoError(t, s.Send(ctx, "john@example.com", ""))
+	_, err := s.Redeem(ctx, sentToken(t, sender))
+	assert.ErrorIs(t, err, ErrUnverifiedEmail)
+
+	// A verification link proves the address, after which login links
+	// work.
+	assert.NoError(t, s.SendVerification(ctx, &existing))
+	assert.Equal(t, "john@example.com", sender.Messages()[1].To)
+	user, err := s.Redeem(ctx, sentToken(t, sender))
+	assert.NoError(t, err)
+	assert.Equal(t, existing.ID, user.ID)
+	assert.True(t, user.EmailVerified())
+
+	assert.NoError(t, s.Send(ctx, "john@example.com", ""))
+	user, err = s.Redeem(ctx, sentToken(t, sender))
+	assert.NoError(t, err)
+	assert.Equal(t, existing.ID, user.ID)
+}
+
+func TestRedeemVerificationAfterEmailChange(t *testing.T) {
+	s, repos, sender := setup(t)
+	user := models.User{Name: "John Doe", Email: "john@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, &user))
+	assert.NoError(t, s.SendVerification(ctx, &user))
+
+	user.SetEmail("jim@example.com")
+	assert.NoError(t, repos.Users.Update(ctx, &user))
+	_, err := s.Redeem(ctx, sentToken(t, sender))
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	stored, err := repos.Users.Get(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.False(t, stored.EmailVerified())
+}
+
+func TestRedeemOnce(t *testing.T) {
+	s, _, sender := setup(t)
+	assert.NoError(t, s.Send(ctx, "jane@example.com", ""))
+	token := sentToken(t, sender)
+
+	_, err := s.Redeem(ctx, token)
+	assert.NoError(t, err)
+	_, err = s.Redeem(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestRedeemInvalid(t *testing.T) {
+	s, _, sender := setup(t)
+	assert.NoError(t, s.Send(ctx, "jane@example.com", ""))
+	token := sentToken(t, sender)
+
+	for _, bad := range []string{"", "garbage", token + "x", "x" + token} {
+		_, err := s.Redeem(ctx, bad)
+		assert.ErrorIs(t, err, ErrInvalidToken, bad)
+	}
+
+	other, _, _ := setup(t)
+	_, err := other.Redeem(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken, "signed with another secret")
+
+	s.now = func() time.Time { return time.Now().Add(16 * time.Minute) }
+	_, err = s.Redeem(ctx, token)
+	assert.ErrorIs(t, err, ErrInvalidToken, "expired")
+}
+
+func TestSendRateLimited(t *testing.T) {
+	s, _, sender := setup(t)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, s.Send(ctx, "jane@example.com", ""))
+	}
+	assert.ErrorIs(t, s.Send(ctx, "JANE@example.com", ""), ErrRateLimited)
+	assert.NoError(t, s.Send(ctx, "john@example.com", ""))
+	assert.Len(t, sender.Messages(), 4)
+}
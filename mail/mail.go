@@ -0,0 +1,120 @@
+// Package mail sends plain-text email through SMTP.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pageza/vet-app/config"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender sends email.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns a Sender for cfg, or one that logs messages if no SMTP server
+// is configured.
+func New(cfg config.MailConfig) Sender {
+	if cfg.SMTPHost == "" {
+		return Log{}
+	}
+	return &SMTP{cfg: cfg}
+}
+
+// SMTP sends email through an SMTP server, upgrading the connection with
+// STARTTLS when the server offers it.
+type SMTP struct {
+	cfg config.MailConfig
+}
+
+// Send delivers msg, giving up when ctx is done.
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(s.cfg.From)
+	if err != nil {
+		return fmt.Errorf("mail: invalid MAIL_FROM: %w", err)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(s.cfg.SMTPHost, strconv.Itoa(s.cfg.SMTPPort)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, s.cfg.SMTPHost)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.cfg.SMTPHost}); err != nil {
+			return err
+		}
+	}
+	if s.cfg.SMTPUsername != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.SMTPUsername, s.cfg.SMTPPassword, s.cfg.SMTPHost)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(format(from, msg, time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// format renders msg with its headers, ready for the DATA command.
+func format(from *mail.Address, msg Message, now time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from.String())
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// Log writes messages to the log instead of sending them. Since messages may
+// hold login links it only suits development.
+type Log struct{}
+
+// Send logs msg.
+func (Log) Send(ctx context.Context, msg Message) error {
+	log.Printf("mail: to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,31 @@
+package mail
+
+import (
+	"net/mail"
+	"testing"
+	"time"
+
+	"github.com/pageza/vet-app/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	from := &mail.Address{Name: "Vet App", Address: "no-reply@example.org"}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	msg := Message{To: "jane@example.com", Subject: "Your login link ✓", Body: "Hello,\nclick here."}
+
+	got := string(format(from, msg, now))
+	assert.Equal(t, "From: \"Vet App\" <no-reply@example.org>\r\n"+
+		"To: jane@example.com\r\n"+
+		"Subject: =?utf-8?q?Your_login_link_=E2=9C=93?=\r\n"+
+		"Date: Wed, 01 May 2024 12:00:00 +0000\r\n"+
+		"MIME-Version: 1.0\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n"+
+		"\r\n"+
+		"Hello,\r\nclick here.", got)
+}
+
+func TestNew(t *testing.T) {
+	assert.IsType(t, Log{}, New(config.MailConfig{}))
+	assert.IsType(t, &SMTP{}, New(config.MailConfig{SMTPHost: "smtp.example.org", SMTPPort: 587}))
+}
@@ -0,0 +1,31 @@
+// Package mailtest provides a mail.Sender that keeps messages for tests to
+// inspect instead of sending them.
+package mailtest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pageza/vet-app/mail"
+)
+
+// Sender records every message sent through it.
+type Sender struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+// Send records msg.
+func (s *Sender) Send(ctx context.Context, msg mail.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first.
+func (s *Sender) Messages() []mail.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]mail.Message(nil), s.messages...)
+}
@@ -1,14 +1,37 @@
 package main
 
 import (
-    "fmt"
+    "context"
     "log"
+    "log/slog"
     "net/http"
     "os"
+    "os/signal"
+    "syscall"
 
     "github.com/gorilla/mux"
+    "github.com/pageza/vet-app/account"
+    "github.com/pageza/vet-app/apikey"
+    "github.com/pageza/vet-app/callstatus"
     "github.com/pageza/vet-app/config"
+    "github.com/pageza/vet-app/crisis"
     "github.com/pageza/vet-app/db"
+    "github.com/pageza/vet-app/geo"
+    "github.com/pageza/vet-app/handlers"
+    "github.com/pageza/vet-app/health"
+    "github.com/pageza/vet-app/idme"
+    "github.com/pageza/vet-app/magiclink"
+    "github.com/pageza/vet-app/mail"
+    "github.com/pageza/vet-app/middleware"
+    "github.com/pageza/vet-app/migrations"
+    "github.com/pageza/vet-app/models"
+    "github.com/pageza/vet-app/ratelimit"
+    "github.com/pageza/vet-app/rbac"
+    "github.com/pageza/vet-app/repository"
+    "github.com/pageza/vet-app/server"
+    "github.com/pageza/vet-app/session"
+    "github.com/pageza/vet-app/token"
+    "github.com/pageza/vet-app/twofactor"
 )
 
 func main() {
@@ -32,12 +55,23 @@ func main() {
     log.Printf("Test Database password: %s", config.TestDB.Password)
     log.Printf("Test Database name: %s", config.TestDB.Name)
 
+    // Run the migrate subcommand instead of the server if requested
+    if len(os.Args) > 1 && os.Args[1] == "migrate" {
+        if err := runMigrate(config, os.Args[2:]); err != nil {
+            log.Fatalf("Migration failed: %v", err)
+        }
+        return
+    }
+
     // Initialize PostgreSQL
     log.Println("Initializing PostgreSQL...")
-    db.InitDB(config.DB)
+    postgres, err := db.Open(config.DB)
+    if err != nil {
+        log.Fatalf("Failed to initialize PostgreSQL: %v", err)
+    }
 
     // Test PostgreSQL connection
-    sqlDB, err := db.DB.DB()
+    sqlDB, err := postgres.DB()
     if err != nil {
         log.Fatalf("Failed to get SQL DB: %v", err)
     }
@@ -50,47 +84,246 @@ func main() {
 
     // Initialize Redis
     log.Println("Initializing Redis...")
-    db.InitRedis(config)
-
-    // Test Redis connection
-    result, err := db.RedisClient.Ping(db.RedisCtx).Result()
+    redisClient, err := db.NewRedisClient(config)
     if err != nil {
         log.Fatalf("Could not connect to Redis: %v", err)
-    } else {
-        log.Printf("Redis connection successful: %v", result)
     }
 
     // Set up the router
     log.Println("Setting up the router...")
     r := mux.NewRouter()
+    repos := repository.NewPostgres(postgres)
+    if config.Mail.SMTPHost == "" {
+        log.Println("SMTP_HOST is not set; emails will be logged instead of sent")
+    }
+    mailer := mail.New(config.Mail)
+
+    // Load the phrases that flag calls from veterans in crisis
+    crisisRules := crisis.DefaultRules()
+    if config.Crisis.PhrasesFile != "" {
+        crisisRules, err = crisis.LoadRules(config.Crisis.PhrasesFile)
+        if err != nil {
+            log.Fatalf("Failed to load crisis phrases: %v", err)
+        }
+    }
+    crises := crisis.NewService(repos, crisis.NewDetector(crisisRules, config.Crisis.Threshold), mailer)
+
+    // Load the ZIP codes used to place calls
+    var zips geo.ZIPCodes
+    if config.Geo.ZIPFile != "" {
+        zips, err = geo.LoadZIPCodes(config.Geo.ZIPFile)
+        if err != nil {
+            log.Fatalf("Failed to load ZIP codes: %v", err)
+        }
+    } else {
+        log.Println("GEO_ZIP_FILE is not set; ZIP codes will be rejected")
+    }
+    h := handlers.New(repos, crises, geo.NewLocator(zips, config.Geo.FuzzRadius), config.TwoFactor.StepUpWindow)
+
+    // Load the signing keys for access tokens
+    var keys *token.Keyring
+    if config.Token.KeysDir != "" {
+        keys, err = token.LoadKeyring(config.Token.KeysDir, config.Token.ActiveKeyID)
+    } else {
+        log.Println("TOKEN_KEYS_DIR is not set; generating a temporary signing key")
+        keys, err = token.GenerateKeyring()
+    }
+    if err != nil {
+        log.Fatalf("Failed to load token signing keys: %v", err)
+    }
+    tokens := token.NewService(keys, redisClient, config.Token)
+
+    // Load the key that encrypts TOTP secrets
+    var totpCipher *twofactor.Cipher
+    if config.TwoFactor.EncryptionKey != "" {
+        totpCipher, err = twofactor.ParseCipher(config.TwoFactor.EncryptionKey)
+    } else {
+        log.Println("TWO_FACTOR_ENCRYPTION_KEY is not set; generating a temporary key")
+        totpCipher, err = twofactor.GenerateCipher()
+    }
+    if err != nil {
+        log.Fatalf("Failed to load two-factor encryption key: %v", err)
+    }
+    stepUp := twofactor.RequireStepUp(config.TwoFactor.StepUpWindow)
+
+    // Load the session or bearer token user, and their permissions, into
+    // every request, and check API keys
+    sessions := session.NewStore(redisClient, config.Session)
+    authz := rbac.NewAuthorizer(repos.Roles, redisClient, config.RBAC.CacheTTL)
+    authz.RequireSecondFactor(config.TwoFactor.RequiredRoles...)
+    limiter := ratelimit.NewLimiter(redisClient)
+    apiKeys := apikey.NewService(repos, limiter, config.APIKey.DefaultRateLimit)
+    r.Use(sessions.Middleware(repos.Users), tokens.Access().Middleware(repos.Users), apiKeys.Middleware, authz.Middleware)
+
+    // Define routes for sessions
+    sessionHandler := handlers.NewSessions(sessions, tokens)
+    r.HandleFunc("/auth/logout", sessionHandler.Logout).Methods("POST")
+    r.HandleFunc("/users/{id:[0-9]+}/sessions", sessionHandler.GetSessions).Methods("GET")
+    r.HandleFunc("/users/{id:[0-9]+}/sessions", sessionHandler.RevokeSessions).Methods("DELETE")
+
+    // Define routes for two-factor authentication
+    twoFactor := twofactor.NewService(repos, redisClient, totpCipher, config.TwoFactor.Issuer)
+    twoFactorHandler := handlers.NewTwoFactor(repos, twoFactor, sessions, authz)
+    r.HandleFunc("/auth/2fa", twoFactorHandler.GetStatus).Methods("GET")
+    r.HandleFunc("/auth/2fa/enroll", twoFactorHandler.Enroll).Methods("POST")
+    r.HandleFunc("/auth/2fa/confirm", twoFactorHandler.Confirm).Methods("POST")
+    r.HandleFunc("/auth/2fa/verify", twoFactorHandler.Verify).Methods("POST")
+    r.HandleFunc("/auth/2fa/recovery-codes", twoFactorHandler.RegenerateRecoveryCodes).Methods("POST")
+    r.HandleFunc("/auth/2fa/disable", twoFactorHandler.Disable).Methods("POST")
+
+    // Define routes for mobile tokens
+    tokenHandler := handlers.NewTokens(tokens)
+    r.HandleFunc("/auth/token", tokenHandler.IssueToken).Methods("POST")
+    r.HandleFunc("/auth/token/refresh", tokenHandler.RefreshToken).Methods("POST")
+    r.HandleFunc("/auth/token/revoke", tokenHandler.RevokeToken).Methods("POST")
+    r.HandleFunc("/.well-known/jwks.json", keys.ServeJWKS).Methods("GET")
+
+    // Define routes for ID.me login, if it is configured
+    if config.IDme.ClientID != "" {
+        provider, err := idme.New(context.Background(), config.IDme, nil)
+        if err != nil {
+            log.Printf("ID.me login disabled: %v", err)
+        } else {
+            idmeHandler := handlers.NewIDme(repos, provider, sessions, config.IDme.VerificationTTL)
+            r.HandleFunc("/auth/idme/login", idmeHandler.Login).Methods("GET")
+            r.HandleFunc("/auth/idme/callback", idmeHandler.Callback).Methods("GET")
+        }
+    }
+
+    // Define routes for magic link login, if it is configured
+    if config.MagicLink.URL != "" {
+        var secret []byte
+        if config.MagicLink.Secret != "" {
+            secret, err = magiclink.ParseSecret(config.MagicLink.Secret)
+        } else {
+            log.Println("MAGIC_LINK_SECRET is not set; generating a temporary key")
+            secret, err = magiclink.GenerateSecret()
+        }
+        if err != nil {
+            log.Fatalf("Failed to load magic link secret: %v", err)
+        }
+        magicLinks := magiclink.NewService(repos, redisClient, limiter, mailer, secret, config.MagicLink)
+        magicLinkHandler := handlers.NewMagicLink(magicLinks, sessions)
+        r.HandleFunc("/auth/magic-link", magicLinkHandler.SendLink).Methods("POST")
+        r.HandleFunc("/auth/magic-link/verify", magicLinkHandler.Redeem).Methods("POST")
+        r.HandleFunc("/users/{id:[0-9]+}/email-verification", magicLinkHandler.SendVerification).Methods("POST")
+    }
+
+    // Define health probes
+    migrator, err := migrations.New(sqlDB)
+    if err != nil {
+        log.Fatalf("Failed to load migrations: %v", err)
+    }
+    checker := health.New(health.DefaultTimeout,
+        health.Postgres(sqlDB),
+        health.Redis(redisClient),
+        health.Migrations(migrator),
+    )
+    r.HandleFunc("/healthz", checker.Liveness).Methods("GET")
+    r.HandleFunc("/readyz", checker.Readiness).Methods("GET")
 
     // Define routes
-    // r.HandleFunc("/users", handlers.GetUsers).Methods("GET")
-    // r.HandleFunc("/users/{id:[0-9]+}", handlers.GetUser).Methods("GET")
-    // r.HandleFunc("/users/{user_id}/responses", handlers.GetResponsesForUser).Methods("GET")
-    // r.HandleFunc("/users", handlers.CreateUser).Methods("POST")
-    // r.HandleFunc("/users/{id:[0-9]+}", handlers.UpdateUser).Methods("PUT")
-    // r.HandleFunc("/users/{id:[0-9]+}", handlers.DeleteUser).Methods("DELETE")
+    r.HandleFunc("/users", h.GetUsers).Methods("GET")
+    r.HandleFunc("/users/{id:[0-9]+}", h.GetUser).Methods("GET")
+    r.HandleFunc("/users/{user_id}/responses", h.GetResponsesForUser).Methods("GET")
+    r.Handle("/users", rbac.RequireFunc(models.PermissionManageUsers, h.CreateUser)).Methods("POST")
+    r.HandleFunc("/users/{id:[0-9]+}", h.UpdateUser).Methods("PUT")
+    r.Handle("/users/{id:[0-9]+}", rbac.RequireFunc(models.PermissionDeleteUsers, stepUp(h.DeleteUser))).Methods("DELETE")
+    r.Handle("/users/{id:[0-9]+}/verification", rbac.RequireFunc(models.PermissionVerifyUsers, h.VerifyUser)).Methods("PUT")
+    r.Handle("/users/{id:[0-9]+}/verification", rbac.RequireFunc(models.PermissionVerifyUsers, stepUp(h.UnverifyUser))).Methods("DELETE")
+
+    // Define routes for exporting data and deleting accounts
+    accounts := account.NewService(repos, sessions, tokens, authz, config.Account.DeletionGracePeriod)
+    accountHandler := handlers.NewAccount(repos, accounts)
+    r.HandleFunc("/users/{id:[0-9]+}/export", accountHandler.ExportUser).Methods("GET")
+    r.HandleFunc("/users/{id:[0-9]+}/deletion", accountHandler.RequestDeletion).Methods("POST")
+    r.HandleFunc("/users/{id:[0-9]+}/deletion", accountHandler.CancelDeletion).Methods("DELETE")
+
+    // Define routes for roles
+    roleHandler := handlers.NewRoles(repos, authz)
+    r.Handle("/roles", rbac.RequireFunc(models.PermissionManageRoles, roleHandler.GetRoles)).Methods("GET")
+    r.Handle("/permissions", rbac.RequireFunc(models.PermissionManageRoles, roleHandler.GetPermissions)).Methods("GET")
+    r.Handle("/roles/{name}/permissions", rbac.RequireFunc(models.PermissionManageRoles, stepUp(roleHandler.SetRolePermissions))).Methods("PUT")
+    r.HandleFunc("/users/{id:[0-9]+}/roles", roleHandler.GetUserRoles).Methods("GET")
+    r.Handle("/users/{id:[0-9]+}/roles/{role}", rbac.RequireFunc(models.PermissionManageRoles, stepUp(roleHandler.GrantRole))).Methods("PUT")
+    r.Handle("/users/{id:[0-9]+}/roles/{role}", rbac.RequireFunc(models.PermissionManageRoles, stepUp(roleHandler.RevokeRole))).Methods("DELETE")
+
+    // Define routes for partner organizations and their API keys
+    apiKeyHandler := handlers.NewAPIKeys(repos, apiKeys)
+    r.Handle("/organizations", rbac.RequireFunc(models.PermissionManageAPIKeys, apiKeyHandler.GetOrganizations)).Methods("GET")
+    r.Handle("/organizations", rbac.RequireFunc(models.PermissionManageAPIKeys, apiKeyHandler.CreateOrganization)).Methods("POST")
+    r.Handle("/organizations/{id:[0-9]+}/api-keys", rbac.RequireFunc(models.PermissionManageAPIKeys, apiKeyHandler.GetAPIKeys)).Methods("GET")
+    r.Handle("/organizations/{id:[0-9]+}/api-keys", rbac.RequireFunc(models.PermissionManageAPIKeys, stepUp(apiKeyHandler.CreateAPIKey))).Methods("POST")
+    r.Handle("/api-keys/{id:[0-9]+}", rbac.RequireFunc(models.PermissionManageAPIKeys, apiKeyHandler.RevokeAPIKey)).Methods("DELETE")
 
     // Define routes for calls
-    // r.HandleFunc("/calls", handlers.CreateCall).Methods("POST")
-    // r.HandleFunc("/calls", handlers.GetCalls).Methods("GET")
-    // r.HandleFunc("/calls/{id}", handlers.GetCall).Methods("GET")
-    // r.HandleFunc("/calls/{id}", handlers.UpdateCall).Methods("PUT")
-    // r.HandleFunc("/calls/{id}", handlers.DeleteCall).Methods("DELETE")
+    limitCalls := limiter.Middleware("calls:create", ratelimit.Limit{Requests: config.RateLimit.CreateCalls, Window: config.RateLimit.CreateCallsWindow})
+    r.Handle("/calls", limitCalls(rbac.RequireFunc(models.PermissionCreateCalls, h.CreateCall))).Methods("POST")
+    r.Handle("/calls", apiKeys.RequireScope(models.ScopeCallsRead, http.HandlerFunc(h.GetCalls))).Methods("GET")
+    r.Handle("/calls/{id}", apiKeys.RequireScope(models.ScopeCallsRead, http.HandlerFunc(h.GetCall))).Methods("GET")
+    r.HandleFunc("/calls/{id}", h.UpdateCall).Methods("PUT")
+    r.HandleFunc("/calls/{id}", h.DeleteCall).Methods("DELETE")
+    r.HandleFunc("/calls/{id}/transitions", h.TransitionCall).Methods("POST")
+    r.Handle("/calls/{id}/history", apiKeys.RequireScope(models.ScopeCallsRead, http.HandlerFunc(h.GetCallHistory))).Methods("GET")
+
+    // Define routes for volunteer profiles and matching them with calls
+    r.HandleFunc("/users/{id:[0-9]+}/volunteer-profile", h.GetVolunteerProfile).Methods("GET")
+    r.Handle("/users/{id:[0-9]+}/volunteer-profile", rbac.RequireFunc(models.PermissionCreateResponses, h.SaveVolunteerProfile)).Methods("PUT")
+    r.HandleFunc("/users/{id:[0-9]+}/volunteer-profile", h.DeleteVolunteerProfile).Methods("DELETE")
+    r.HandleFunc("/users/{id:[0-9]+}/suggested-calls", h.GetSuggestedCalls).Methods("GET")
+    r.HandleFunc("/calls/{id}/suggested-responders", h.GetSuggestedResponders).Methods("GET")
+
+    // Define routes for call categories
+    r.Handle("/categories", apiKeys.RequireScope(models.ScopeCallsRead, http.HandlerFunc(h.GetCategories))).Methods("GET")
+    r.Handle("/categories", rbac.RequireFunc(models.PermissionManageCategories, h.CreateCategory)).Methods("POST")
+    r.Handle("/categories/{slug}", rbac.RequireFunc(models.PermissionManageCategories, h.UpdateCategory)).Methods("PUT")
+    r.Handle("/categories/{slug}", rbac.RequireFunc(models.PermissionManageCategories, h.DeleteCategory)).Methods("DELETE")
 
     // Define routes for responses
-    // r.HandleFunc("/calls/{call_id}/responses", handlers.CreateResponse).Methods("POST")
-    // r.HandleFunc("/calls/{call_id}/responses", handlers.GetResponses).Methods("GET")
-    // r.HandleFunc("/responses/{id}", handlers.GetResponse).Methods("GET")
-    // r.HandleFunc("/responses/{id}", handlers.UpdateResponse).Methods("PUT")
-    // r.HandleFunc("/responses/{id}", handlers.DeleteResponse).Methods("DELETE")
-
-    // Start the server
-    port := os.Getenv("PORT")
-    if port == "" {
-        port = "8080" // default port if not specified
-    }
-    log.Printf("Server running on port %s\n", port)
-    log.Fatal(http.ListenAndServe(fmt.Sprintf("0.0.0.0:%s", port), r))
+    limitResponses := limiter.Middleware("responses:create", ratelimit.Limit{Requests: config.RateLimit.CreateResponses, Window: config.RateLimit.CreateResponsesWindow})
+    r.Handle("/calls/{call_id}/responses", limitResponses(apiKeys.RequireScope(models.ScopeResponsesWrite, rbac.RequireFunc(models.PermissionCreateResponses, h.CreateResponse)))).Methods("POST")
+    r.Handle("/calls/{call_id}/responses", apiKeys.RequireScope(models.ScopeResponsesRead, http.HandlerFunc(h.GetResponses))).Methods("GET")
+    r.Handle("/responses/{id}", apiKeys.RequireScope(models.ScopeResponsesRead, http.HandlerFunc(h.GetResponse))).Methods("GET")
+    r.HandleFunc("/responses/{id}", h.UpdateResponse).Methods("PUT")
+    r.HandleFunc("/responses/{id}", h.DeleteResponse).Methods("DELETE")
+    r.Handle("/responses/{id}/hidden", rbac.RequireFunc(models.PermissionHideResponses, h.HideResponse)).Methods("PUT")
+    r.Handle("/responses/{id}/hidden", rbac.RequireFunc(models.PermissionHideResponses, h.UnhideResponse)).Methods("DELETE")
+
+    // Start the server and block until SIGINT or SIGTERM
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    // Purge deleted accounts in the background
+    go accounts.RunPurge(ctx, config.Account.PurgeInterval)
+
+    // Expire calls nobody took up in the background
+    if config.Call.ExpireAfter > 0 {
+        go callstatus.NewService(repos).RunExpiry(ctx, config.Call.ExpireAfter, config.Call.ExpiryInterval)
+    }
+
+    handler := middleware.Chain(r,
+        middleware.RequestID,
+        middleware.AccessLog(slog.New(slog.NewJSONHandler(os.Stdout, nil))),
+        middleware.Recover,
+        middleware.CORS(config.CORS),
+    )
+    srv := server.New(config.Server, handler)
+    log.Printf("Server running on port %d\n", config.Server.Port)
+    serveErr := srv.Run(ctx)
+    if serveErr != nil {
+        log.Printf("HTTP server error: %v", serveErr)
+    }
+
+    // Close connections only once no request can still be using them
+    if err := redisClient.Close(); err != nil {
+        log.Printf("Error closing Redis: %v", err)
+    }
+    if err := sqlDB.Close(); err != nil {
+        log.Printf("Error closing PostgreSQL: %v", err)
+    }
+    log.Println("Shutdown complete")
+
+    if serveErr != nil {
+        os.Exit(1)
+    }
 }
@@ -0,0 +1,209 @@
+// Package matching steers calls to the volunteers best placed to help,
+// ranking volunteers for a call and open calls for a volunteer by how well
+// the volunteer's profile fits what the call needs.
+package matching
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pageza/vet-app/geo"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"github.com/pageza/vet-app/repository"
+)
+
+// What a volunteer scores for each way they fit a call. Skills naming the
+// call's category, and skills, certifications and languages naming one of
+// its tags, score for each match. Nearness scores up to weightNearby at the
+// center of the volunteer's service area, falling to nothing at its edge.
+const (
+	weightCategory      = 3.0
+	weightSkill         = 2.0
+	weightCertification = 2.0
+	weightLanguage      = 2.0
+	weightAvailable     = 1.0
+	weightNearby        = 3.0
+)
+
+// batch is how many profiles are loaded at a time.
+const batch = 100
+
+// candidates is how many calls with and without a location Calls scores.
+const candidates = 500
+
+// Match pairs a volunteer with a call. Distance is how many miles the call
+// is from the center of the volunteer's service area, if both have a
+// location. Reasons explain the score.
+type Match struct {
+	Profile  models.VolunteerProfile
+	Call     models.Call
+	Score    float64
+	Distance *float64
+	Reasons  []string
+}
+
+// Score rates how well profile fits call at now. It returns false if the
+// volunteer should not be suggested for the call at all: if the call is
+// closed or theirs, if they paused their profile or are deleting their
+// account, if the call is veteran-only and they are not a verified veteran,
+// or if the call lies outside their service area. Calls without a location
+// may be helped from anywhere.
+func Score(call *models.Call, profile *models.VolunteerProfile, now time.Time) (Match, bool) {
+	m := Match{Profile: *profile, Call: *call}
+	switch {
+	case call.Closed(), call.UserID == profile.UserID, profile.Paused, profile.User.DeletionRequested():
+		return m, false
+	case call.VeteranOnly && !profile.User.IsVerifiedVeteran(now):
+		return m, false
+	}
+
+	if area, p := profile.ServiceArea(), call.PublicLocation(); area != nil && p != nil {
+		d := geo.Distance(area.Center, *p)
+		if d > area.Radius {
+			return m, false
+		}
+		m.Distance = &d
+		reason := "under a mile away"
+		if d >= 1 {
+			reason = fmt.Sprintf("%.0f miles away", d)
+		}
+		m.add(weightNearby*(1-d/area.Radius), reason)
+	}
+	if call.Category != nil && profile.Skills.Has(call.Category.Slug) {
+		m.add(weightCategory, "helps with "+call.Category.Name)
+	}
+	for _, tag := range call.Tags {
+		if profile.Skills.Has(tag.Name) {
+			m.add(weightSkill, "skilled in "+tag.Name)
+		}
+		if profile.Certifications.Has(tag.Name) {
+			m.add(weightCertification, "certified in "+tag.Name)
+		}
+		if profile.Languages.Has(tag.Name) {
+			m.add(weightLanguage, "speaks "+tag.Name)
+		}
+	}
+	if profile.AvailableAt(now) {
+		m.add(weightAvailable, "usually available now")
+	}
+	return m, true
+}
+
+func (m *Match) add(score float64, reason string) {
+	m.Score += score
+	m.Reasons = append(m.Reasons, reason)
+}
+
+// Service finds matches among the stored volunteers and calls.
+type Service struct {
+	volunteers repository.VolunteerRepository
+	calls      repository.CallRepository
+	now        func() time.Time
+}
+
+// NewService returns a Service reading from repos.
+func NewService(repos repository.Repositories) *Service {
+	return &Service{volunteers: repos.Volunteers, calls: repos.Calls, now: time.Now}
+}
+
+// Responders returns up to limit of the volunteers best suited to call,
+// best first. Volunteers who fit it in no way are left out.
+func (s *Service) Responders(ctx context.Context, call *models.Call, limit int) ([]Match, error) {
+	paused := false
+	filter := repository.VolunteerFilter{Paused: &paused, Serving: call.PublicLocation(), ExcludeDeleting: true}
+	page := pagination.Params{Limit: batch, Sort: pagination.SortID}
+	now := s.now()
+	var matches []Match
+	for {
+		profiles, err := s.volunteers.List(ctx, filter, page)
+		if err != nil {
+			return nil, err
+		}
+		more := len(profiles) > batch
+		if more {
+			profiles = profiles[:batch]
+		}
+		for i := range profiles {
+			if m, ok := Score(call, &profiles[i], now); ok && m.Score > 0 {
+				matches = append(matches, m)
+			}
+		}
+		if !more {
+			break
+		}
+		page.After = &pagination.Cursor{Sort: pagination.SortID, ID: profiles[len(profiles)-1].ID}
+	}
+	return best(matches, limit), nil
+}
+
+// Calls returns up to limit of the open calls matching filter that profile
+// is best suited to, best first. Calls it fits in no way are left out. Only
+// the candidates nearest the center of the volunteer's service area, or the
+// newest if they did not limit it, are considered, along with the newest
+// calls without a location.
+func (s *Service) Calls(ctx context.Context, profile *models.VolunteerProfile, filter repository.CallFilter, limit int) ([]Match, error) {
+	filter.Statuses = []string{models.CallStatusOpen}
+	located, unlocated := true, false
+	near, anywhere := filter, filter
+	near.Located, anywhere.Located = &located, &unlocated
+	newest := pagination.Params{Limit: candidates, Sort: pagination.SortCreatedAt, Desc: true}
+	nearest := newest
+	if area := profile.ServiceArea(); area != nil {
+		near.Near = area
+		nearest = pagination.Params{Limit: candidates, Sort: pagination.SortDistance}
+	}
+
+	now := s.now()
+	matches, err := s.scoreCalls(ctx, nil, profile, near, nearest, now)
+	if err != nil {
+		return nil, err
+	}
+	matches, err = s.scoreCalls(ctx, matches, profile, anywhere, newest, now)
+	if err != nil {
+		return nil, err
+	}
+	return best(matches, limit), nil
+}
+
+// scoreCalls appends to matches how profile fits the first page of calls
+// matching filter.
+func (s *Service) scoreCalls(ctx context.Context, matches []Match, profile *models.VolunteerProfile, filter repository.CallFilter, page pagination.Params, now time.Time) ([]Match, error) {
+	calls, err := s.calls.List(ctx, filter, page)
+	if err != nil {
+		return nil, err
+	}
+	if len(calls) > page.Limit {
+		calls = calls[:page.Limit]
+	}
+	for i := range calls {
+		if m, ok := Score(&calls[i], profile, now); ok && m.Score > 0 {
+			matches = append(matches, m)
+		}
+	}
+	return matches, nil
+}
+
+// best sorts matches by score, then by distance, nearest first, and keeps
+// the first limit.
+func best(matches []Match, limit int) []Match {
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		switch {
+		case a.Score != b.Score:
+			return a.Score > b.Score
+		case a.Distance != nil && b.Distance != nil:
+			return *a.Distance < *b.Distance
+		}
+		return a.Distance != nil && b.Distance == nil
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	if matches == nil {
+		matches = []Match{}
+	}
+	return matches
+}
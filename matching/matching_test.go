@@ -0,0 +1,183 @@
+package matching
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pageza/vet-app/geo"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+// monday is a Monday at 10:00 UTC.
+var monday = time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC)
+
+var capitol = geo.Point{Lat: 38.8899, Lng: -77.0091}
+
+func createUser(t *testing.T, repos repository.Repositories, name, email string) *models.User {
+	user := &models.User{Name: name, Email: email}
+	assert.NoError(t, repos.Users.Create(ctx, user))
+	return user
+}
+
+func createProfile(t *testing.T, repos repository.Repositories, profile models.VolunteerProfile) {
+	assert.NoError(t, repos.Volunteers.Save(ctx, &profile))
+}
+
+func TestScore(t *testing.T) {
+	housing := &models.Category{Slug: "housing", Name: "Housing"}
+	call := &models.Call{ID: 1, UserID: 1, Status: models.CallStatusOpen, Category: housing,
+		Tags: []models.Tag{{Name: "eviction"}, {Name: "spanish"}}}
+	call.SetLocation(&capitol, &capitol)
+	profile := &models.VolunteerProfile{UserID: 2,
+		Skills:       models.Words{"housing", "eviction"},
+		Languages:    models.Words{"spanish"},
+		Availability: models.Availability{{Day: "monday", Start: "09:00", End: "17:00"}},
+		TimeZone:     "UTC",
+	}
+	profile.SetServiceArea(&geo.Circle{Center: capitol, Radius: 10})
+
+	m, ok := Score(call, profile, monday)
+	assert.True(t, ok)
+	assert.InDelta(t, weightNearby+weightCategory+weightSkill+weightLanguage+weightAvailable, m.Score, 0.001)
+	assert.InDelta(t, 0, *m.Distance, 0.001)
+	assert.Equal(t, []string{"under a mile away", "helps with Housing", "skilled in eviction", "speaks spanish", "usually available now"}, m.Reasons)
+
+	// Nearness counts for less toward the edge of the service area.
+	far := geo.Offset(capitol, 5, 90)
+	call.SetLocation(&far, &far)
+	m, ok = Score(call, profile, monday)
+	assert.True(t, ok)
+	assert.InDelta(t, weightNearby/2+weightCategory+weightSkill+weightLanguage+weightAvailable, m.Score, 0.01)
+
+	// The time zone decides whether a window is open.
+	profile.TimeZone = "America/New_York"
+	m, _ = Score(call, profile, monday)
+	assert.NotContains(t, m.Reasons, "usually available now")
+	profile.TimeZone = "UTC"
+
+	for name, c := range map[string]struct {
+		call    models.Call
+		profile models.VolunteerProfile
+	}{
+		"outside the area": {call: models.Call{UserID: 1, PublicLatitude: ptr(40.0), PublicLongitude: ptr(-77.0)}, profile: *profile},
+		"closed":           {call: models.Call{UserID: 1, Status: models.CallStatusResolved}, profile: *profile},
+		"own call":         {call: models.Call{UserID: 2}, profile: *profile},
+		"paused":           {call: models.Call{UserID: 1}, profile: models.VolunteerProfile{UserID: 2, Paused: true}},
+		"deleting":         {call: models.Call{UserID: 1}, profile: models.VolunteerProfile{UserID: 2, User: models.User{DeletionRequestedAt: &monday}}},
+		"veteran-only":     {call: models.Call{UserID: 1, VeteranOnly: true}, profile: *profile},
+	} {
+		_, ok := Score(&c.call, &c.profile, monday)
+		assert.False(t, ok, name)
+	}
+
+	// Calls without a location can be helped from anywhere.
+	m, ok = Score(&models.Call{UserID: 1, Category: housing}, profile, monday)
+	assert.True(t, ok)
+	assert.Nil(t, m.Distance)
+}
+
+func TestResponders(t *testing.T) {
+	repos := repository.NewMemory()
+	s := NewService(repos)
+	s.now = func() time.Time { return monday }
+	owner := createUser(t, repos, "John Doe", "john@example.com")
+	near := createUser(t, repos, "Jane Doe", "jane@example.com")
+	far := createUser(t, repos, "Jim Doe", "jim@example.com")
+	anywhere := createUser(t, repos, "Joan Doe", "joan@example.com")
+	paused := createUser(t, repos, "Jill Doe", "jill@example.com")
+	unskilled := createUser(t, repos, "Jack Doe", "jack@example.com")
+	away := createUser(t, repos, "Joe Doe", "joe@example.com")
+
+	area := func(p geo.Point, radius float64) models.VolunteerProfile {
+		var profile models.VolunteerProfile
+		profile.SetServiceArea(&geo.Circle{Center: p, Radius: radius})
+		return profile
+	}
+	withSkills := func(profile models.VolunteerProfile, user *models.User, skills ...string) models.VolunteerProfile {
+		profile.UserID, profile.Skills = user.ID, skills
+		return profile
+	}
+	createProfile(t, repos, withSkills(area(capitol, 10), near, "housing"))
+	createProfile(t, repos, withSkills(area(geo.Offset(capitol, 8, 0), 10), far, "housing"))
+	createProfile(t, repos, withSkills(models.VolunteerProfile{}, anywhere, "housing", "eviction"))
+	createProfile(t, repos, withSkills(models.VolunteerProfile{Paused: true}, paused, "housing"))
+	createProfile(t, repos, withSkills(models.VolunteerProfile{}, unskilled, "cooking"))
+	createProfile(t, repos, withSkills(area(geo.Offset(capitol, 50, 0), 10), away, "housing"))
+	createProfile(t, repos, withSkills(models.VolunteerProfile{}, owner, "housing"))
+
+	housing, err := repos.Categories.Get(ctx, "housing")
+	assert.NoError(t, err)
+	call := models.Call{UserID: owner.ID, Desc: "Behind on rent", CategoryID: &housing.ID, Tags: []models.Tag{{Name: "eviction"}}}
+	call.SetLocation(&capitol, &capitol)
+	assert.NoError(t, repos.Calls.Create(ctx, &call))
+
+	matches, err := s.Responders(ctx, &call, 10)
+	assert.NoError(t, err)
+	var users []uint
+	for _, m := range matches {
+		users = append(users, m.Profile.UserID)
+	}
+	assert.Equal(t, []uint{near.ID, anywhere.ID, far.ID}, users)
+
+	matches, err = s.Responders(ctx, &call, 1)
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+}
+
+func TestCalls(t *testing.T) {
+	repos := repository.NewMemory()
+	s := NewService(repos)
+	s.now = func() time.Time { return monday }
+	owner := createUser(t, repos, "John Doe", "john@example.com")
+	volunteer := createUser(t, repos, "Jane Doe", "jane@example.com")
+	createProfile(t, repos, models.VolunteerProfile{UserID: volunteer.ID, Skills: models.Words{"rides"}, Languages: models.Words{"spanish"}})
+	profile, err := repos.Volunteers.Get(ctx, volunteer.ID)
+	assert.NoError(t, err)
+
+	ride := models.Call{UserID: owner.ID, Desc: "Ride to the VA", Tags: []models.Tag{{Name: "rides"}, {Name: "spanish"}}}
+	assert.NoError(t, repos.Calls.Create(ctx, &ride))
+	translator := models.Call{UserID: owner.ID, Desc: "Translator", Tags: []models.Tag{{Name: "spanish"}}}
+	assert.NoError(t, repos.Calls.Create(ctx, &translator))
+	claimed := models.Call{UserID: owner.ID, Desc: "Ride home", Status: models.CallStatusClaimed, Tags: []models.Tag{{Name: "rides"}}}
+	assert.NoError(t, repos.Calls.Create(ctx, &claimed))
+	assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: owner.ID, Desc: "Paperwork"}))
+	own := models.Call{UserID: volunteer.ID, Desc: "My ride", Tags: []models.Tag{{Name: "rides"}}}
+	assert.NoError(t, repos.Calls.Create(ctx, &own))
+
+	matches, err := s.Calls(ctx, profile, repository.CallFilter{}, 10)
+	assert.NoError(t, err)
+	var calls []uint
+	for _, m := range matches {
+		calls = append(calls, m.Call.ID)
+	}
+	assert.Equal(t, []uint{ride.ID, translator.ID}, calls)
+	assert.Equal(t, []string{"skilled in rides", "speaks spanish"}, matches[0].Reasons)
+
+	// Volunteers with a service area are offered the calls in it and the
+	// calls without a location.
+	profile.SetServiceArea(&geo.Circle{Center: capitol, Radius: 10})
+	located := func(desc string, p geo.Point) models.Call {
+		call := models.Call{UserID: owner.ID, Desc: desc, Tags: []models.Tag{{Name: "rides"}}}
+		call.SetLocation(&p, &p)
+		assert.NoError(t, repos.Calls.Create(ctx, &call))
+		return call
+	}
+	nearby := located("Ride downtown", capitol)
+	located("Ride in Baltimore", geo.Offset(capitol, 40, 45))
+	matches, err = s.Calls(ctx, profile, repository.CallFilter{}, 10)
+	assert.NoError(t, err)
+	calls = nil
+	for _, m := range matches {
+		calls = append(calls, m.Call.ID)
+	}
+	assert.Equal(t, []uint{nearby.ID, ride.ID, translator.ID}, calls)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pageza/vet-app/config"
+)
+
+// CORS answers preflight requests and adds CORS headers for the origins in
+// cfg. Requests from other origins are served without CORS headers, which
+// makes browsers block them. An origin of "*" allows every origin, but not
+// together with credentials.
+func CORS(cfg config.CORSConfig) Middleware {
+	allowAll := false
+	origins := map[string]bool{}
+	for _, o := range cfg.AllowedOrigins {
+		o = strings.TrimSpace(o)
+		if o == "*" {
+			allowAll = true
+		} else if o != "" {
+			origins[strings.ToLower(o)] = true
+		}
+	}
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			allowed := origins[strings.ToLower(origin)] || (allowAll && !cfg.AllowCredentials)
+			if !allowed {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Set("Access-Control-Allow-Origin", origin)
+			if cfg.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				h.Set("Access-Control-Allow-Methods", methods)
+				h.Set("Access-Control-Allow-Headers", headers)
+				if cfg.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", maxAge)
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			h.Set("Access-Control-Expose-Headers", RequestIDHeader)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pageza/vet-app/config"
+	"github.com/stretchr/testify/assert"
+)
+
+var corsConfig = config.CORSConfig{
+	AllowedOrigins: []string{"https://app.example.org"},
+	AllowedMethods: []string{"GET", "POST"},
+	AllowedHeaders: []string{"Content-Type"},
+	MaxAge:         10 * time.Minute,
+}
+
+func TestCORSPreflight(t *testing.T) {
+	called := false
+	h := CORS(corsConfig)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	req := httptest.NewRequest("OPTIONS", "/calls", nil)
+	req.Header.Set("Origin", "https://app.example.org")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rr := serve(h, req)
+
+	assert.False(t, called)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "https://app.example.org", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST", rr.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type", rr.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", rr.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestCORSSimpleRequest(t *testing.T) {
+	h := CORS(corsConfig)(http.NotFoundHandler())
+	req := httptest.NewRequest("GET", "/calls", nil)
+	req.Header.Set("Origin", "https://app.example.org")
+	rr := serve(h, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "https://app.example.org", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, RequestIDHeader, rr.Header().Get("Access-Control-Expose-Headers"))
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	h := CORS(corsConfig)(http.NotFoundHandler())
+	req := httptest.NewRequest("GET", "/calls", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rr := serve(h, req)
+
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", rr.Header().Get("Vary"))
+}
+
+func TestCORSWildcard(t *testing.T) {
+	cfg := corsConfig
+	cfg.AllowedOrigins = []string{"*"}
+	req := httptest.NewRequest("GET", "/calls", nil)
+	req.Header.Set("Origin", "https://anything.example.com")
+
+	rr := serve(CORS(cfg)(http.NotFoundHandler()), req)
+	assert.Equal(t, "https://anything.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+
+	cfg.AllowCredentials = true
+	rr = serve(CORS(cfg)(http.NotFoundHandler()), req)
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+}
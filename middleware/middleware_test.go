@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func serve(h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := Chain(http.NotFoundHandler(), mw("first"), mw("second"))
+	serve(h, httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, []string{"first", "second"}, order)
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	var seen string
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+	rr := serve(h, httptest.NewRequest("GET", "/", nil))
+
+	assert.Len(t, seen, 32)
+	assert.Equal(t, seen, rr.Header().Get(RequestIDHeader))
+}
+
+func TestRequestIDPropagated(t *testing.T) {
+	var seen string
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(RequestIDHeader)
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	rr := serve(h, req)
+
+	assert.Equal(t, "abc-123", seen)
+	assert.Equal(t, "abc-123", rr.Header().Get(RequestIDHeader))
+}
+
+func TestRequestIDRejectsUnsafeValues(t *testing.T) {
+	h := RequestID(http.NotFoundHandler())
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\nwith newline")
+	rr := serve(h, req)
+
+	assert.NotEqual(t, "bad id\nwith newline", rr.Header().Get(RequestIDHeader))
+	assert.Len(t, rr.Header().Get(RequestIDHeader), 32)
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}), RequestID, AccessLog(logger))
+
+	req := httptest.NewRequest("POST", "/calls", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	serve(h, req)
+
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "request", entry["msg"])
+	assert.Equal(t, "req-1", entry["request_id"])
+	assert.Equal(t, "POST", entry["method"])
+	assert.Equal(t, "/calls", entry["path"])
+	assert.Equal(t, float64(http.StatusCreated), entry["status"])
+	assert.Equal(t, float64(5), entry["bytes"])
+	assert.Contains(t, entry, "duration_ms")
+}
+
+func TestRecover(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), RequestID, AccessLog(logger), Recover)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "req-2")
+	rr := serve(h, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	var body struct {
+		Error struct {
+			Code          string `json:"code"`
+			CorrelationID string `json:"correlation_id"`
+		} `json:"error"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	assert.Equal(t, "internal_error", body.Error.Code)
+	assert.Equal(t, "req-2", body.Error.CorrelationID)
+	assert.True(t, strings.Contains(buf.String(), `"status":500`))
+}
+
+func TestRecoverAfterResponseStarted(t *testing.T) {
+	h := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic("boom")
+	}))
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		serve(h, httptest.NewRequest("GET", "/", nil))
+	})
+}
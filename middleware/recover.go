@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/pageza/vet-app/apierr"
+)
+
+// Recover turns a panicking handler into a 500 JSON error. The panic value
+// and stack are logged under the request's correlation ID. If the handler
+// had already started its response, the connection is aborted instead.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := recorder(w)
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			log.Printf("[%s] panic serving %s %s: %v\n%s",
+				r.Header.Get(RequestIDHeader), r.Method, r.URL.Path, v, debug.Stack())
+			if rec.status != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			apierr.Write(rec, r, apierr.Internal(fmt.Errorf("panic: %v", v)))
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
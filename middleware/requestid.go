@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/pageza/vet-app/apierr"
+)
+
+// RequestIDHeader carries the request ID on requests and responses.
+const RequestIDHeader = apierr.CorrelationHeader
+
+// maxRequestIDLength bounds the IDs accepted from clients.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestID gives every request an ID, reusing a valid X-Request-ID sent by
+// the client or a proxy. The ID is echoed in the response, stored in the
+// request context and set on the request header so that apierr uses it as
+// the correlation ID.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+			r.Header.Set(RequestIDHeader, id)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestIDFromContext returns the ID assigned by RequestID, or "" if there
+// is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID accepts short IDs made of characters that are safe to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
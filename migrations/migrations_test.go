@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	migrations, err := Load()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+		if i > 0 {
+			assert.Greater(t, m.Version, migrations[i-1].Version)
+		}
+	}
+}
+
+func TestLoadOrdersByVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/0002_add_index.up.sql":      {Data: []byte("CREATE INDEX ...")},
+		"sql/0002_add_index.down.sql":    {Data: []byte("DROP INDEX ...")},
+		"sql/0001_create_table.up.sql":   {Data: []byte("CREATE TABLE ...")},
+		"sql/0001_create_table.down.sql": {Data: []byte("DROP TABLE ...")},
+	}
+
+	migrations, err := load(fsys, "sql")
+	assert.NoError(t, err)
+	if assert.Len(t, migrations, 2) {
+		assert.Equal(t, int64(1), migrations[0].Version)
+		assert.Equal(t, "create_table", migrations[0].Name)
+		assert.Equal(t, "CREATE TABLE ...", migrations[0].Up)
+		assert.Equal(t, int64(2), migrations[1].Version)
+	}
+}
+
+func TestLoadRejectsInvalidFiles(t *testing.T) {
+	_, err := load(fstest.MapFS{
+		"sql/0001_create_table.up.sql": {Data: []byte("CREATE TABLE ...")},
+	}, "sql")
+	assert.Error(t, err, "missing down migration")
+
+	_, err = load(fstest.MapFS{
+		"sql/create_table.sql": {Data: []byte("CREATE TABLE ...")},
+	}, "sql")
+	assert.Error(t, err, "invalid filename")
+}
@@ -0,0 +1,81 @@
+package migrations_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pageza/vet-app/db"
+	"github.com/pageza/vet-app/migrations"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateDownAndUp(t *testing.T) {
+	db.SetupDB(t)
+	ctx := context.Background()
+
+	sqlDB, err := db.DB.DB()
+	assert.NoError(t, err)
+	migrator, err := migrations.New(sqlDB)
+	assert.NoError(t, err)
+
+	all, err := migrations.Load()
+	assert.NoError(t, err)
+
+	// SetupDB has already applied everything.
+	pending, err := migrator.Pending(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+
+	reverted, err := migrator.Down(ctx, len(all))
+	assert.NoError(t, err)
+	assert.Len(t, reverted, len(all))
+
+	statuses, err := migrator.Status(ctx)
+	assert.NoError(t, err)
+	for _, s := range statuses {
+		assert.Nil(t, s.AppliedAt)
+	}
+
+	applied, err := migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(all))
+
+	applied, err = migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+}
+
+// TestMigrateAutoMigratedDatabase upgrades the schema the original models
+// left behind through GORM's AutoMigrate.
+func TestMigrateAutoMigratedDatabase(t *testing.T) {
+	db.SetupDB(t)
+	ctx := context.Background()
+
+	sqlDB, err := db.DB.DB()
+	assert.NoError(t, err)
+	migrator, err := migrations.New(sqlDB)
+	assert.NoError(t, err)
+	all, err := migrations.Load()
+	assert.NoError(t, err)
+	_, err = migrator.Down(ctx, len(all))
+	assert.NoError(t, err)
+
+	for _, stmt := range []string{
+		`CREATE TABLE users (id BIGSERIAL PRIMARY KEY, name VARCHAR(255), email VARCHAR(255) UNIQUE)`,
+		`CREATE TABLE calls (id BIGSERIAL PRIMARY KEY, user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE, "desc" VARCHAR(255))`,
+		`CREATE TABLE responses (id BIGSERIAL PRIMARY KEY, call_id BIGINT NOT NULL REFERENCES calls (id) ON DELETE CASCADE, user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE, msg VARCHAR(255))`,
+		`INSERT INTO users (name, email) VALUES ('Jane Doe', 'jane@example.com')`,
+		`INSERT INTO calls (user_id, "desc") SELECT id, 'Need a ride' FROM users`,
+	} {
+		_, err := sqlDB.ExecContext(ctx, stmt)
+		assert.NoError(t, err, stmt)
+	}
+
+	applied, err := migrator.Up(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(all))
+
+	var status string
+	assert.NoError(t, sqlDB.QueryRowContext(ctx, `SELECT status FROM calls`).Scan(&status))
+	assert.Equal(t, "open", status)
+}
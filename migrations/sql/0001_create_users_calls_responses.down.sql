@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS responses;
+DROP TABLE IF EXISTS calls;
+DROP TABLE IF EXISTS users;
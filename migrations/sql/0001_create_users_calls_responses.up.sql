@@ -0,0 +1,49 @@
+-- Tables may already exist in databases that were set up with GORM's
+-- AutoMigrate, so this baseline migration is written to be idempotent.
+-- Such tables may predate some of the columns below, which are added
+-- before anything relies on them: the indexes here, and the backfills of
+-- users.admin and calls.closed in later migrations.
+
+CREATE TABLE IF NOT EXISTS users (
+    id         BIGSERIAL PRIMARY KEY,
+    name       VARCHAR(255),
+    email      VARCHAR(255) UNIQUE,
+    admin      BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS admin      BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_users_created_at ON users (created_at);
+
+CREATE TABLE IF NOT EXISTS calls (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    "desc"     VARCHAR(255),
+    closed     BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE calls
+    ADD COLUMN IF NOT EXISTS closed     BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_calls_user_id ON calls (user_id);
+CREATE INDEX IF NOT EXISTS idx_calls_created_at ON calls (created_at);
+
+CREATE TABLE IF NOT EXISTS responses (
+    id         BIGSERIAL PRIMARY KEY,
+    call_id    BIGINT NOT NULL REFERENCES calls (id) ON DELETE CASCADE,
+    user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    msg        VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE responses
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS idx_responses_call_id ON responses (call_id);
+CREATE INDEX IF NOT EXISTS idx_responses_user_id ON responses (user_id);
+CREATE INDEX IF NOT EXISTS idx_responses_created_at ON responses (created_at);
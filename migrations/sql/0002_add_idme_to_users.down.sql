@@ -0,0 +1,3 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS veteran,
+    DROP COLUMN IF EXISTS idme_subject;
@@ -0,0 +1,3 @@
+ALTER TABLE users
+    ADD COLUMN idme_subject VARCHAR(255) UNIQUE,
+    ADD COLUMN veteran      BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,8 @@
+ALTER TABLE calls DROP COLUMN IF EXISTS veteran_only;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS verification_expires_at,
+    DROP COLUMN IF EXISTS verification_level,
+    DROP COLUMN IF EXISTS service_branch,
+    DROP COLUMN IF EXISTS verification_source,
+    DROP COLUMN IF EXISTS verified_at;
@@ -0,0 +1,12 @@
+ALTER TABLE users
+    ADD COLUMN verified_at             TIMESTAMPTZ,
+    ADD COLUMN verification_source     VARCHAR(32),
+    ADD COLUMN service_branch          VARCHAR(64),
+    ADD COLUMN verification_level      VARCHAR(64),
+    ADD COLUMN verification_expires_at TIMESTAMPTZ;
+
+-- Veterans recorded before verification details existed were all verified
+-- through ID.me.
+UPDATE users SET verified_at = NOW(), verification_source = 'idme' WHERE veteran;
+
+ALTER TABLE calls ADD COLUMN veteran_only BOOLEAN NOT NULL DEFAULT FALSE;
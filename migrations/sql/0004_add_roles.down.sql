@@ -0,0 +1,15 @@
+ALTER TABLE responses
+    DROP COLUMN IF EXISTS hidden_by_id,
+    DROP COLUMN IF EXISTS hidden_at;
+
+ALTER TABLE users ADD COLUMN admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users SET admin = TRUE
+WHERE id IN (
+    SELECT ur.user_id FROM user_roles ur JOIN roles r ON r.id = ur.role_id WHERE r.name = 'admin'
+);
+
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,71 @@
+CREATE TABLE roles (
+    id          BIGSERIAL PRIMARY KEY,
+    name        VARCHAR(32) NOT NULL UNIQUE,
+    description VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+CREATE TABLE permissions (
+    id          BIGSERIAL PRIMARY KEY,
+    name        VARCHAR(64) NOT NULL UNIQUE,
+    description VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+CREATE TABLE role_permissions (
+    role_id       BIGINT NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission_id BIGINT NOT NULL REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE user_roles (
+    user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_id    BIGINT NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX idx_user_roles_role_id ON user_roles (role_id);
+
+-- Keep in sync with the defaults in repository/memory.go.
+INSERT INTO roles (name, description) VALUES
+    ('veteran',   'Held by every verified veteran'),
+    ('volunteer', 'Held by every user'),
+    ('moderator', 'Moderates calls and responses'),
+    ('admin',     'Manages users and roles');
+
+INSERT INTO permissions (name, description) VALUES
+    ('calls:create',            'Create calls'),
+    ('calls:view_veteran_only', 'See veteran-only calls'),
+    ('calls:manage',            'Change or delete any call'),
+    ('responses:create',        'Respond to calls'),
+    ('responses:hide',          'Hide and unhide responses'),
+    ('responses:manage',        'Change or delete any response'),
+    ('users:verify',            'Verify veterans by hand'),
+    ('users:delete',            'Delete users'),
+    ('users:sessions',          'List and revoke anyone''s sessions'),
+    ('roles:manage',            'Grant roles and change their permissions');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM (VALUES
+    ('veteran',   'calls:create'),
+    ('veteran',   'calls:view_veteran_only'),
+    ('veteran',   'responses:create'),
+    ('volunteer', 'responses:create'),
+    ('moderator', 'calls:view_veteran_only'),
+    ('moderator', 'responses:hide')
+) AS grants (role, permission)
+JOIN roles r ON r.name = grants.role
+JOIN permissions p ON p.name = grants.permission;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p WHERE r.name = 'admin';
+
+-- The admin flag is replaced by the admin role.
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.id FROM users u JOIN roles r ON r.name = 'admin' WHERE u.admin;
+
+ALTER TABLE users DROP COLUMN admin;
+
+ALTER TABLE responses
+    ADD COLUMN hidden_at    TIMESTAMPTZ,
+    ADD COLUMN hidden_by_id BIGINT REFERENCES users (id) ON DELETE SET NULL;
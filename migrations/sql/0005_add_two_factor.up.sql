@@ -0,0 +1,13 @@
+ALTER TABLE users
+    ADD COLUMN totp_secret     TEXT NOT NULL DEFAULT '',
+    ADD COLUMN totp_enabled_at TIMESTAMPTZ;
+
+CREATE TABLE recovery_codes (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash  VARCHAR(64) NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes (user_id);
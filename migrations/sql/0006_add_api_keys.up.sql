@@ -0,0 +1,29 @@
+CREATE TABLE organizations (
+    id         BIGSERIAL PRIMARY KEY,
+    name       VARCHAR(255) NOT NULL UNIQUE,
+    user_id    BIGINT NOT NULL UNIQUE REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE api_keys (
+    id              BIGSERIAL PRIMARY KEY,
+    organization_id BIGINT NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    name            VARCHAR(255) NOT NULL DEFAULT '',
+    prefix          VARCHAR(16) NOT NULL UNIQUE,
+    key_hash        VARCHAR(64) NOT NULL,
+    scopes          TEXT NOT NULL,
+    rate_limit      INTEGER NOT NULL,
+    expires_at      TIMESTAMPTZ,
+    last_used_at    TIMESTAMPTZ,
+    revoked_at      TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_api_keys_organization_id ON api_keys (organization_id);
+
+-- Keep in sync with the defaults in repository/memory.go.
+INSERT INTO permissions (name, description) VALUES
+    ('api_keys:manage', 'Manage partner organizations and their API keys');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name = 'api_keys:manage' WHERE r.name = 'admin';
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN deletion_requested_at TIMESTAMPTZ;
+
+CREATE INDEX idx_users_deletion_requested_at ON users (deletion_requested_at);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS call_status_history;
+
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS closed BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE calls SET closed = TRUE WHERE status IN ('resolved', 'closed', 'expired');
+ALTER TABLE calls DROP COLUMN IF EXISTS claimed_by_id;
+ALTER TABLE calls DROP COLUMN IF EXISTS status;
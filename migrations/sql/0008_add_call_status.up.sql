@@ -0,0 +1,21 @@
+ALTER TABLE calls ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'open';
+ALTER TABLE calls ADD COLUMN claimed_by_id BIGINT REFERENCES users (id) ON DELETE SET NULL;
+UPDATE calls SET status = 'closed' WHERE closed;
+ALTER TABLE calls DROP COLUMN closed;
+
+CREATE INDEX idx_calls_status ON calls (status);
+CREATE INDEX idx_calls_claimed_by_id ON calls (claimed_by_id);
+
+CREATE TABLE call_status_history (
+    id          BIGSERIAL PRIMARY KEY,
+    call_id     BIGINT NOT NULL REFERENCES calls (id) ON DELETE CASCADE,
+    user_id     BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    from_status VARCHAR(16) NOT NULL,
+    to_status   VARCHAR(16) NOT NULL,
+    note        VARCHAR(255) NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_call_status_history_call_id ON call_status_history (call_id);
+CREATE INDEX idx_call_status_history_user_id ON call_status_history (user_id);
+CREATE INDEX idx_call_status_history_created_at ON call_status_history (created_at);
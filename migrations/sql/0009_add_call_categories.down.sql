@@ -0,0 +1,7 @@
+DELETE FROM permissions WHERE name = 'categories:manage';
+
+ALTER TABLE calls DROP COLUMN IF EXISTS category_id;
+
+DROP TABLE IF EXISTS call_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS categories;
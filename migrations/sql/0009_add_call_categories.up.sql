@@ -0,0 +1,39 @@
+CREATE TABLE categories (
+    id          BIGSERIAL PRIMARY KEY,
+    slug        VARCHAR(32) NOT NULL UNIQUE,
+    name        VARCHAR(64) NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE tags (
+    id   BIGSERIAL PRIMARY KEY,
+    name VARCHAR(32) NOT NULL UNIQUE
+);
+
+CREATE TABLE call_tags (
+    call_id BIGINT NOT NULL REFERENCES calls (id) ON DELETE CASCADE,
+    tag_id  BIGINT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (call_id, tag_id)
+);
+
+CREATE INDEX idx_call_tags_tag_id ON call_tags (tag_id);
+
+ALTER TABLE calls ADD COLUMN category_id BIGINT REFERENCES categories (id) ON DELETE RESTRICT;
+
+CREATE INDEX idx_calls_category_id ON calls (category_id);
+
+-- Keep in sync with the defaults in repository/memory.go.
+INSERT INTO categories (slug, name) VALUES
+    ('benefits',       'Benefits'),
+    ('housing',        'Housing'),
+    ('mental-health',  'Mental health'),
+    ('employment',     'Employment'),
+    ('transportation', 'Transportation'),
+    ('legal',          'Legal');
+
+INSERT INTO permissions (name, description) VALUES
+    ('categories:manage', 'Add, change and remove call categories');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name = 'categories:manage' WHERE r.name = 'admin';
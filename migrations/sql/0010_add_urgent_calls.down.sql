@@ -0,0 +1,3 @@
+DELETE FROM roles WHERE name = 'on_duty';
+
+ALTER TABLE calls DROP COLUMN IF EXISTS urgent;
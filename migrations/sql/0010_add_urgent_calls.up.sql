@@ -0,0 +1,7 @@
+ALTER TABLE calls ADD COLUMN urgent BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_calls_urgent ON calls (urgent);
+
+-- Keep in sync with the defaults in repository/memory.go.
+INSERT INTO roles (name, description) VALUES
+    ('on_duty', 'Moderators on duty, paged about calls from veterans in crisis');
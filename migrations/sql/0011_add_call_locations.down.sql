@@ -0,0 +1,6 @@
+ALTER TABLE calls
+    DROP COLUMN IF EXISTS latitude,
+    DROP COLUMN IF EXISTS longitude,
+    DROP COLUMN IF EXISTS public_latitude,
+    DROP COLUMN IF EXISTS public_longitude,
+    DROP COLUMN IF EXISTS zip;
@@ -0,0 +1,8 @@
+ALTER TABLE calls
+    ADD COLUMN latitude DOUBLE PRECISION,
+    ADD COLUMN longitude DOUBLE PRECISION,
+    ADD COLUMN public_latitude DOUBLE PRECISION,
+    ADD COLUMN public_longitude DOUBLE PRECISION,
+    ADD COLUMN zip VARCHAR(5) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_calls_public_location ON calls (public_latitude, public_longitude);
@@ -0,0 +1,18 @@
+CREATE TABLE volunteer_profiles (
+    id             BIGSERIAL PRIMARY KEY,
+    user_id        BIGINT NOT NULL UNIQUE REFERENCES users (id) ON DELETE CASCADE,
+    bio            VARCHAR(500) NOT NULL DEFAULT '',
+    skills         TEXT NOT NULL DEFAULT '',
+    certifications TEXT NOT NULL DEFAULT '',
+    languages      TEXT NOT NULL DEFAULT '',
+    availability   TEXT NOT NULL DEFAULT '[]',
+    time_zone      VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    latitude       DOUBLE PRECISION,
+    longitude      DOUBLE PRECISION,
+    service_radius DOUBLE PRECISION NOT NULL DEFAULT 0,
+    paused         BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_volunteer_profiles_paused ON volunteer_profiles (paused);
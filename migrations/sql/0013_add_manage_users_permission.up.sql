@@ -0,0 +1,6 @@
+-- Keep in sync with the defaults in repository/memory.go.
+INSERT INTO permissions (name, description) VALUES
+    ('users:manage', 'Change anyone''s name and email');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r JOIN permissions p ON p.name = 'users:manage' WHERE r.name = 'admin';
@@ -0,0 +1,3 @@
+-- Existing addresses were never proven, so every account starts out
+-- unverified.
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
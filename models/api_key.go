@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Scopes limit what an API key may do. ScopeCallsReadVeteranOnly opens no
+// routes itself; it lets the other scopes reach veteran-only calls.
+const (
+	ScopeCallsRead            = "calls:read"
+	ScopeCallsReadVeteranOnly = "calls:read_veteran_only"
+	ScopeResponsesRead        = "responses:read"
+	ScopeResponsesWrite       = "responses:write"
+)
+
+// ValidScope reports whether scope is one of the known scopes.
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeCallsRead, ScopeCallsReadVeteranOnly, ScopeResponsesRead, ScopeResponsesWrite:
+		return true
+	}
+	return false
+}
+
+// Organization is a partner, such as a veteran service organization, that
+// uses the API with API keys. It acts through a service account, UserID,
+// which authors whatever its keys write.
+type Organization struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:255;not null;unique" json:"name"`
+	UserID    uint      `gorm:"not null;unique" json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	User      User      `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// APIKey lets an organization call the API. The key itself is only shown
+// when it is created; Prefix, its public part, finds it again and KeyHash
+// checks the rest. RateLimit is how many requests it may make per minute.
+type APIKey struct {
+	ID             uint         `gorm:"primaryKey" json:"id"`
+	OrganizationID uint         `gorm:"not null;index" json:"organization_id"`
+	Name           string       `gorm:"size:255" json:"name"`
+	Prefix         string       `gorm:"size:16;not null;unique" json:"prefix"`
+	KeyHash        string       `gorm:"size:64;not null" json:"-"`
+	Scopes         Words        `gorm:"not null" json:"scopes"`
+	RateLimit      int          `gorm:"not null" json:"rate_limit"`
+	ExpiresAt      *time.Time   `json:"expires_at"`
+	LastUsedAt     *time.Time   `json:"last_used_at"`
+	RevokedAt      *time.Time   `json:"revoked_at"`
+	CreatedAt      time.Time    `json:"created_at"`
+	Organization   Organization `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// Active reports whether the key may be used at now.
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
@@ -1,8 +1,144 @@
 package models
 
+import (
+	"time"
+
+	"github.com/pageza/vet-app/geo"
+)
+
+// Call statuses. A call starts out open, may be claimed by a responder who
+// then works on it, and ends up resolved, closed by its owner or a
+// moderator, or expired after going unanswered.
+const (
+	CallStatusOpen       = "open"
+	CallStatusClaimed    = "claimed"
+	CallStatusInProgress = "in_progress"
+	CallStatusResolved   = "resolved"
+	CallStatusClosed     = "closed"
+	CallStatusExpired    = "expired"
+)
+
+// callTransitions lists the statuses a call may move to from each status.
+var callTransitions = map[string][]string{
+	CallStatusOpen:       {CallStatusClaimed, CallStatusResolved, CallStatusClosed, CallStatusExpired},
+	CallStatusClaimed:    {CallStatusOpen, CallStatusInProgress, CallStatusResolved, CallStatusClosed, CallStatusExpired},
+	CallStatusInProgress: {CallStatusOpen, CallStatusResolved, CallStatusClosed},
+	CallStatusResolved:   {CallStatusOpen, CallStatusClosed},
+	CallStatusClosed:     {CallStatusOpen},
+	CallStatusExpired:    {CallStatusOpen},
+}
+
+// CallStatuses lists every call status in lifecycle order.
+var CallStatuses = []string{
+	CallStatusOpen,
+	CallStatusClaimed,
+	CallStatusInProgress,
+	CallStatusResolved,
+	CallStatusClosed,
+	CallStatusExpired,
+}
+
+// ClosedCallStatuses lists the statuses of calls that take no more
+// responses.
+var ClosedCallStatuses = []string{CallStatusResolved, CallStatusClosed, CallStatusExpired}
+
+// CanTransition reports whether a call may move from one status to another.
+func CanTransition(from, to string) bool {
+	for _, status := range callTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Call is a request for help. VeteranOnly calls are only shown to verified
+// veterans. ClaimedByID is the responder who claimed the call, if any; it
+// is kept once the call is resolved so they can be credited. CategoryID and
+// Tags say what kind of help it needs, so responders can find it. Urgent
+// calls read as though they come from someone in crisis.
+//
+// Calls for local help may say where they are, by coordinates or ZIP code.
+// Latitude and Longitude are only shown to those helping; everyone else
+// sees PublicLatitude and PublicLongitude, fuzzed once when the location is
+// set. Distance is filled in by searches near a point.
 type Call struct {
-	ID     uint   `gorm:"primaryKey"`
-	UserID uint   `gorm:"not null"`
-	Desc   string `gorm:"size:255"`
-	User   User   `gorm:"constraint:OnDelete:CASCADE;"`
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"not null;index" json:"user_id"`
+	Desc        string    `gorm:"size:255" json:"desc"`
+	Status      string    `gorm:"size:16;not null;default:open;index" json:"status"`
+	ClaimedByID *uint     `gorm:"index" json:"claimed_by_id"`
+	VeteranOnly bool      `gorm:"not null;default:false" json:"veteran_only"`
+	Urgent      bool      `gorm:"not null;default:false;index" json:"urgent"`
+	CategoryID  *uint     `gorm:"index" json:"-"`
+	CreatedAt   time.Time `gorm:"index" json:"created_at"`
+	User        User      `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	ClaimedBy   *User     `gorm:"constraint:OnDelete:SET NULL;" json:"-"`
+	Category    *Category `gorm:"constraint:OnDelete:RESTRICT;" json:"-"`
+	Tags        []Tag     `gorm:"many2many:call_tags;constraint:OnDelete:CASCADE;" json:"-"`
+
+	Latitude        *float64 `json:"-"`
+	Longitude       *float64 `json:"-"`
+	PublicLatitude  *float64 `gorm:"index:idx_calls_public_location" json:"-"`
+	PublicLongitude *float64 `gorm:"index:idx_calls_public_location" json:"-"`
+	ZIP             string   `gorm:"size:5;not null;default:''" json:"-"`
+	Distance        *float64 `gorm:"->;-:migration" json:"-"`
+}
+
+// Closed reports whether the call has ended and takes no more responses.
+func (c *Call) Closed() bool {
+	for _, status := range ClosedCallStatuses {
+		if c.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Location returns where the call is, or nil if it has no coordinates.
+func (c *Call) Location() *geo.Point {
+	return point(c.Latitude, c.Longitude)
+}
+
+// PublicLocation returns where the call is shown to the public, or nil if
+// it has no coordinates.
+func (c *Call) PublicLocation() *geo.Point {
+	return point(c.PublicLatitude, c.PublicLongitude)
+}
+
+// SetLocation places the call at p, shown to the public at public. A nil p
+// removes its coordinates.
+func (c *Call) SetLocation(p, public *geo.Point) {
+	if p == nil {
+		c.Latitude, c.Longitude, c.PublicLatitude, c.PublicLongitude = nil, nil, nil, nil
+		return
+	}
+	lat, lng, publicLat, publicLng := p.Lat, p.Lng, public.Lat, public.Lng
+	c.Latitude, c.Longitude = &lat, &lng
+	c.PublicLatitude, c.PublicLongitude = &publicLat, &publicLng
+}
+
+func point(lat, lng *float64) *geo.Point {
+	if lat == nil || lng == nil {
+		return nil
+	}
+	return &geo.Point{Lat: *lat, Lng: *lng}
 }
+
+// CallStatusChange records a call moving from one status to another, for
+// auditing and for measuring how long calls take to resolve. UserID is who
+// moved it, or nil if the app did, as when a call expires.
+type CallStatusChange struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CallID     uint      `gorm:"not null;index" json:"call_id"`
+	UserID     *uint     `gorm:"index" json:"user_id"`
+	FromStatus string    `gorm:"size:16;not null" json:"from_status"`
+	ToStatus   string    `gorm:"size:16;not null" json:"to_status"`
+	Note       string    `gorm:"size:255;not null;default:''" json:"note,omitempty"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+	Call       Call      `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	User       *User     `gorm:"constraint:OnDelete:SET NULL;" json:"-"`
+}
+
+// TableName names the table after what it holds.
+func (CallStatusChange) TableName() string { return "call_status_history" }
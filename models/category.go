@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Category is one of the kinds of help a call can ask for, such as housing.
+// Categories are managed by admins; Slug names one in requests and filters.
+type Category struct {
+	ID          uint      `gorm:"primaryKey" json:"-"`
+	Slug        string    `gorm:"size:32;not null;unique" json:"slug"`
+	Name        string    `gorm:"size:64;not null" json:"name"`
+	Description string    `gorm:"size:255;not null;default:''" json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Tag is a free-form label that users put on calls. Names are stored in
+// lower case.
+type Tag struct {
+	ID   uint   `gorm:"primaryKey" json:"-"`
+	Name string `gorm:"size:32;not null;unique" json:"name"`
+}
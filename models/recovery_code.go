@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// RecoveryCode is a one-time code that stands in for a TOTP code when a user
+// has lost their authenticator. Only a hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	User      User       `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+}
@@ -1,10 +1,18 @@
 package models
 
+import "time"
+
+// Response is a reply to a call. Moderators hide responses by setting
+// HiddenAt, after which only other moderators can see them.
 type Response struct {
-	ID     uint   `gorm:"primaryKey"`
-	CallID uint   `gorm:"not null"`
-	UserID uint   `gorm:"not null"`
-	Msg    string `gorm:"size:255"`
-	Call   Call   `gorm:"constraint:OnDelete:CASCADE;"`
-	User   User   `gorm:"constraint:OnDelete:CASCADE;"`
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	CallID     uint       `gorm:"not null;index" json:"call_id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Msg        string     `gorm:"size:255" json:"msg"`
+	HiddenAt   *time.Time `json:"hidden_at,omitempty"`
+	HiddenByID *uint      `json:"hidden_by_id,omitempty"`
+	CreatedAt  time.Time  `gorm:"index" json:"created_at"`
+	Call       Call       `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	User       User       `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	HiddenBy   *User      `gorm:"constraint:OnDelete:SET NULL;" json:"-"`
 }
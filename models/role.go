@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Role names. Every user implicitly holds RoleVolunteer and verified
+// veterans implicitly hold RoleVeteran; the other roles are granted.
+// RoleOnDuty grants nothing but is held by the moderators currently on
+// duty, who are paged about calls from veterans in crisis.
+const (
+	RoleVeteran   = "veteran"
+	RoleVolunteer = "volunteer"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+	RoleOnDuty    = "on_duty"
+)
+
+// Permissions granted by roles.
+const (
+	PermissionCreateCalls      = "calls:create"
+	PermissionViewVeteranOnly  = "calls:view_veteran_only"
+	PermissionManageCalls      = "calls:manage"
+	PermissionCreateResponses  = "responses:create"
+	PermissionHideResponses    = "responses:hide"
+	PermissionManageResponses  = "responses:manage"
+	PermissionManageUsers      = "users:manage"
+	PermissionVerifyUsers      = "users:verify"
+	PermissionDeleteUsers      = "users:delete"
+	PermissionManageSessions   = "users:sessions"
+	PermissionManageRoles      = "roles:manage"
+	PermissionManageAPIKeys    = "api_keys:manage"
+	PermissionManageCategories = "categories:manage"
+)
+
+// Role is a named set of permissions.
+type Role struct {
+	ID          uint         `gorm:"primaryKey" json:"-"`
+	Name        string       `gorm:"size:32;not null;unique" json:"name"`
+	Description string       `gorm:"size:255;not null;default:''" json:"description"`
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions"`
+}
+
+// Permission allows an action, such as hiding responses.
+type Permission struct {
+	ID          uint   `gorm:"primaryKey" json:"-"`
+	Name        string `gorm:"size:64;not null;unique" json:"name"`
+	Description string `gorm:"size:255;not null;default:''" json:"description"`
+}
+
+// UserRole records that a user was granted a role.
+type UserRole struct {
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false"`
+	RoleID    uint      `gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt time.Time `gorm:"not null"`
+	User      User      `gorm:"constraint:OnDelete:CASCADE;"`
+	Role      Role      `gorm:"constraint:OnDelete:CASCADE;"`
+}
@@ -1,7 +1,100 @@
 package models
 
+import "time"
+
+// Sources of a veteran verification.
+const (
+	VerificationSourceIDme   = "idme"
+	VerificationSourceManual = "manual"
+)
+
+// User is a person using the app. What they may do is decided by their
+// roles. IDmeSubject is their subject identifier at ID.me, set once they have
+// logged in through it. EmailVerifiedAt is set once they proved they own
+// Email, and cleared when it changes.
+//
+// Veteran status is established by a verification, recorded in the
+// Verified* and related fields, which must be renewed before
+// VerificationExpiresAt.
+//
+// Users who turned on two-factor authentication have a TOTPSecret, encrypted
+// at rest, and a TOTPEnabledAt. A secret without TOTPEnabledAt is an
+// enrollment that has not been confirmed yet.
+//
+// Users who asked for their account to be deleted have a
+// DeletionRequestedAt. Until the grace period ends and the account is purged
+// they can still cancel, and their profile and content are hidden from
+// everyone else.
 type User struct {
-	ID    uint   `gorm:"primaryKey"`
-	Name  string `gorm:"size:255"`
-	Email string `gorm:"size:255;unique"`
+	ID                    uint       `gorm:"primaryKey" json:"id"`
+	Name                  string     `gorm:"size:255" json:"name"`
+	Email                 string     `gorm:"size:255;unique" json:"email"`
+	EmailVerifiedAt       *time.Time `json:"email_verified_at"`
+	IDmeSubject           *string    `gorm:"column:idme_subject;size:255;unique" json:"-"`
+	Veteran               bool       `gorm:"not null;default:false" json:"veteran"`
+	VerifiedAt            *time.Time `json:"verified_at"`
+	VerificationSource    string     `gorm:"size:32" json:"verification_source,omitempty"`
+	ServiceBranch         string     `gorm:"size:64" json:"service_branch,omitempty"`
+	VerificationLevel     string     `gorm:"size:64" json:"verification_level,omitempty"`
+	VerificationExpiresAt *time.Time `json:"verification_expires_at"`
+	TOTPSecret            string     `gorm:"column:totp_secret" json:"-"`
+	TOTPEnabledAt         *time.Time `gorm:"column:totp_enabled_at" json:"totp_enabled_at"`
+	DeletionRequestedAt   *time.Time `gorm:"index" json:"deletion_requested_at"`
+	CreatedAt             time.Time  `gorm:"index" json:"created_at"`
+}
+
+// IsVerifiedVeteran reports whether the user has a veteran verification
+// that is still current at now.
+func (u *User) IsVerifiedVeteran(now time.Time) bool {
+	if !u.Veteran || u.VerifiedAt == nil {
+		return false
+	}
+	return u.VerificationExpiresAt == nil || now.Before(*u.VerificationExpiresAt)
+}
+
+// Verify records a veteran verification from source, valid until expiresAt.
+func (u *User) Verify(source, branch, level string, now time.Time, expiresAt *time.Time) {
+	u.Veteran = true
+	u.VerifiedAt = &now
+	u.VerificationSource = source
+	u.ServiceBranch = branch
+	u.VerificationLevel = level
+	u.VerificationExpiresAt = expiresAt
+}
+
+// EmailVerified reports whether the user proved they own their email
+// address.
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// SetEmail changes the user's email address, which then has to be verified
+// again.
+func (u *User) SetEmail(email string) {
+	if email != u.Email {
+		u.Email = email
+		u.EmailVerifiedAt = nil
+	}
+}
+
+// TwoFactorEnabled reports whether the user must enter a TOTP code to log
+// in.
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+// ClearVerification removes the user's veteran verification.
+func (u *User) ClearVerification() {
+	u.Veteran = false
+	u.VerifiedAt = nil
+	u.VerificationSource = ""
+	u.ServiceBranch = ""
+	u.VerificationLevel = ""
+	u.VerificationExpiresAt = nil
+}
+
+// DeletionRequested reports whether the user asked for their account to be
+// deleted.
+func (u *User) DeletionRequested() bool {
+	return u.DeletionRequestedAt != nil
 }
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pageza/vet-app/geo"
+)
+
+// VolunteerProfile describes how a user can help, so that calls can be
+// steered to the right responders. Skills, Certifications and Languages are
+// lower-case words matched against a call's category and tags. Availability
+// lists the weekly windows, in TimeZone, when the volunteer can usually
+// take calls. A volunteer with a ServiceRadius only takes calls within that
+// many miles of Latitude and Longitude. Paused profiles are not suggested.
+type VolunteerProfile struct {
+	ID             uint         `gorm:"primaryKey" json:"-"`
+	UserID         uint         `gorm:"not null;unique" json:"user_id"`
+	Bio            string       `gorm:"size:500;not null;default:''" json:"bio"`
+	Skills         Words        `gorm:"not null;default:''" json:"skills"`
+	Certifications Words        `gorm:"not null;default:''" json:"certifications"`
+	Languages      Words        `gorm:"not null;default:''" json:"languages"`
+	Availability   Availability `gorm:"not null;default:'[]'" json:"availability"`
+	TimeZone       string       `gorm:"size:64;not null;default:UTC" json:"time_zone"`
+	Latitude       *float64     `json:"-"`
+	Longitude      *float64     `json:"-"`
+	ServiceRadius  float64      `gorm:"not null;default:0" json:"-"`
+	Paused         bool         `gorm:"not null;default:false;index" json:"paused"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+	User           User         `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// ServiceArea returns the area the volunteer serves, or nil if they did not
+// limit it.
+func (p *VolunteerProfile) ServiceArea() *geo.Circle {
+	center := point(p.Latitude, p.Longitude)
+	if center == nil || p.ServiceRadius <= 0 {
+		return nil
+	}
+	return &geo.Circle{Center: *center, Radius: p.ServiceRadius}
+}
+
+// SetServiceArea limits the volunteer to area, or lifts the limit if area is
+// nil.
+func (p *VolunteerProfile) SetServiceArea(area *geo.Circle) {
+	if area == nil {
+		p.Latitude, p.Longitude, p.ServiceRadius = nil, nil, 0
+		return
+	}
+	lat, lng := area.Center.Lat, area.Center.Lng
+	p.Latitude, p.Longitude, p.ServiceRadius = &lat, &lng, area.Radius
+}
+
+// AvailableAt reports whether t falls in one of the volunteer's windows.
+func (p *VolunteerProfile) AvailableAt(t time.Time) bool {
+	loc, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return p.Availability.Covers(t.In(loc))
+}
+
+// Weekdays names the days of the week as windows write them, indexed by
+// time.Weekday.
+var Weekdays = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+// Window is a weekly stretch of time, from Start to End on Day, written
+// like "09:00" and "17:30". End may be "24:00" for the end of the day.
+type Window struct {
+	Day   string `json:"day"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Valid reports whether the window names a day and ends after it starts.
+func (w Window) Valid() bool {
+	start, okStart := minuteOfDay(w.Start)
+	end, okEnd := minuteOfDay(w.End)
+	return weekday(w.Day) >= 0 && okStart && okEnd && start < end
+}
+
+// Covers reports whether t, in the window's time zone, falls in it.
+func (w Window) Covers(t time.Time) bool {
+	start, okStart := minuteOfDay(w.Start)
+	end, okEnd := minuteOfDay(w.End)
+	minute := t.Hour()*60 + t.Minute()
+	return okStart && okEnd && weekday(w.Day) == int(t.Weekday()) && minute >= start && minute < end
+}
+
+func weekday(day string) int {
+	for i, name := range Weekdays {
+		if name == day {
+			return i
+		}
+	}
+	return -1
+}
+
+// minuteOfDay parses a time of day written like "17:30".
+func minuteOfDay(s string) (int, bool) {
+	if s == "24:00" {
+		return 24 * 60, true
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil || len(s) != 5 {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// Availability is a list of windows, stored as JSON.
+type Availability []Window
+
+// Covers reports whether t falls in any of the windows.
+func (a Availability) Covers(t time.Time) bool {
+	for _, w := range a {
+		if w.Covers(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// GormDataType implements gorm's schema.GormDataTypeInterface.
+func (Availability) GormDataType() string {
+	return "text"
+}
+
+// Value implements driver.Valuer.
+func (a Availability) Value() (driver.Value, error) {
+	if a == nil {
+		a = Availability{}
+	}
+	b, err := json.Marshal(a)
+	return string(b), err
+}
+
+// Scan implements sql.Scanner.
+func (a *Availability) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	case nil:
+		*a = Availability{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Availability", value)
+	}
+	return json.Unmarshal(b, a)
+}
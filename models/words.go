@@ -0,0 +1,47 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// Words is a list of words, such as an API key's scopes or a volunteer's
+// skills, stored as a space-separated string.
+type Words []string
+
+// Has reports whether word is in the list.
+func (w Words) Has(word string) bool {
+	for _, v := range w {
+		if v == word {
+			return true
+		}
+	}
+	return false
+}
+
+// GormDataType implements gorm's schema.GormDataTypeInterface.
+func (Words) GormDataType() string {
+	return "text"
+}
+
+// Value implements driver.Valuer.
+func (w Words) Value() (driver.Value, error) {
+	return strings.Join(w, " "), nil
+}
+
+// Scan implements sql.Scanner.
+func (w *Words) Scan(value interface{}) error {
+	var str string
+	switch v := value.(type) {
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("cannot scan %T into Words", value)
+	}
+	*w = strings.Fields(str)
+	return nil
+}
@@ -0,0 +1,245 @@
+// Package pagination implements keyset (cursor) pagination for list
+// endpoints.
+//
+// Clients pass ?limit=, ?sort= and ?cursor= query parameters. sort is one of
+// "id", "-id", "created_at" or "-created_at" (a leading "-" sorts
+// descending); lists searched near a point also offer "distance". Every list
+// response has the shape
+//
+//	{"data": [...], "next_cursor": "eyJzIjoiaWQiLCJpZCI6MjB9"}
+//
+// where next_cursor is null on the last page. Cursors are opaque to clients
+// and remember the sort order they were issued for. Because they point at the
+// last row returned rather than an offset, rows inserted while a client is
+// paging never cause items to be skipped or repeated.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pageza/vet-app/apierr"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultLimit is the page size used when no limit is given.
+	DefaultLimit = 20
+	// MaxLimit caps the page size a client may request.
+	MaxLimit = 100
+)
+
+// Sort fields accepted by the sort parameter. Queries sorted by
+// SortDistance must have a distance column.
+const (
+	SortID        = "id"
+	SortCreatedAt = "created_at"
+	SortDistance  = "distance"
+)
+
+// Cursor identifies the last row of a page.
+type Cursor struct {
+	Sort      string    `json:"s"`
+	Desc      bool      `json:"d,omitempty"`
+	ID        uint      `json:"id"`
+	CreatedAt time.Time `json:"t,omitempty"`
+	Distance  float64   `json:"m,omitempty"`
+}
+
+// Key holds the values a row is sorted by. Distance is only needed when
+// sorting by SortDistance.
+type Key struct {
+	ID        uint
+	CreatedAt time.Time
+	Distance  float64
+}
+
+// Encode returns the opaque string form of the cursor.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor produced by Encode.
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
+
+// Params describes the page a client asked for.
+type Params struct {
+	Limit int
+	Sort  string
+	Desc  bool
+	After *Cursor
+}
+
+// FromRequest parses the limit, sort and cursor query parameters, returning
+// a validation error if any of them are invalid.
+func FromRequest(r *http.Request) (Params, error) {
+	return FromRequestSorted(r, SortID, SortID, SortCreatedAt)
+}
+
+// FromRequestSorted is FromRequest for lists offering the given sort
+// fields, sorted by def unless the client asks otherwise.
+func FromRequestSorted(r *http.Request, def string, sorts ...string) (Params, error) {
+	q := r.URL.Query()
+	p := Params{Limit: DefaultLimit, Sort: def}
+	fields := map[string]string{}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			fields["limit"] = "must be a positive integer"
+		} else if limit > MaxLimit {
+			p.Limit = MaxLimit
+		} else {
+			p.Limit = limit
+		}
+	}
+
+	if v := q.Get("sort"); v != "" {
+		if v[0] == '-' {
+			p.Desc = true
+			v = v[1:]
+		}
+		if !contains(sorts, v) {
+			allowed := make([]string, 0, 2*len(sorts))
+			for _, name := range sorts {
+				allowed = append(allowed, name, "-"+name)
+			}
+			fields["sort"] = "must be one of " + strings.Join(allowed, ", ")
+		}
+		p.Sort = v
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		c, err := DecodeCursor(v)
+		switch {
+		case err != nil:
+			fields["cursor"] = "is invalid"
+		case c.Sort != p.Sort || c.Desc != p.Desc:
+			fields["cursor"] = "was issued for a different sort order"
+		default:
+			p.After = &c
+		}
+	}
+
+	if len(fields) > 0 {
+		return p, apierr.Validation(fields)
+	}
+	return p, nil
+}
+
+// Scope applies the sort order, cursor position and limit to a query. It
+// fetches one row more than the limit so that NewPage can tell whether
+// another page exists.
+func (p Params) Scope(db *gorm.DB) *gorm.DB {
+	dir, cmp := "ASC", ">"
+	if p.Desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	switch p.Sort {
+	case SortCreatedAt:
+		if p.After != nil {
+			db = db.Where("(created_at, id) "+cmp+" (?, ?)", p.After.CreatedAt, p.After.ID)
+		}
+		db = db.Order("created_at " + dir).Order("id " + dir)
+	case SortDistance:
+		if p.After != nil {
+			db = db.Where("(distance, id) "+cmp+" (?, ?)", p.After.Distance, p.After.ID)
+		}
+		db = db.Order("distance " + dir).Order("id " + dir)
+	default:
+		if p.After != nil {
+			db = db.Where("id "+cmp+" ?", p.After.ID)
+		}
+		db = db.Order("id " + dir)
+	}
+	return db.Limit(p.Limit + 1)
+}
+
+// Slice applies the sort order, cursor position and limit to an in-memory
+// slice the same way Scope does to a query. items is not modified.
+func Slice[T any](p Params, items []T, key func(T) Key) []T {
+	out := make([]T, 0, len(items))
+	for _, item := range items {
+		if p.After == nil || p.before(p.After.key(), key(item)) {
+			out = append(out, item)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return p.before(key(out[i]), key(out[j]))
+	})
+	if len(out) > p.Limit+1 {
+		out = out[:p.Limit+1]
+	}
+	return out
+}
+
+// before reports whether row a sorts before row b in the requested order.
+func (p Params) before(a, b Key) bool {
+	if p.Desc {
+		a, b = b, a
+	}
+	switch {
+	case p.Sort == SortCreatedAt && !a.CreatedAt.Equal(b.CreatedAt):
+		return a.CreatedAt.Before(b.CreatedAt)
+	case p.Sort == SortDistance && a.Distance != b.Distance:
+		return a.Distance < b.Distance
+	}
+	return a.ID < b.ID
+}
+
+func (c Cursor) key() Key {
+	return Key{ID: c.ID, CreatedAt: c.CreatedAt, Distance: c.Distance}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Page is the JSON body returned by list endpoints.
+type Page[T any] struct {
+	Data       []T     `json:"data"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+// NewPage builds a page from rows fetched with Scope. key returns the values
+// an item is sorted by, from which the next cursor is built.
+func NewPage[T any](p Params, items []T, key func(T) Key) Page[T] {
+	page := Page[T]{Data: items}
+	if page.Data == nil {
+		page.Data = []T{}
+	}
+	if len(items) > p.Limit {
+		page.Data = items[:p.Limit]
+		last := key(page.Data[p.Limit-1])
+		c := Cursor{Sort: p.Sort, Desc: p.Desc, ID: last.ID}
+		switch p.Sort {
+		case SortCreatedAt:
+			c.CreatedAt = last.CreatedAt
+		case SortDistance:
+			c.Distance = last.Distance
+		}
+		next := c.Encode()
+		page.NextCursor = &next
+	}
+	return page
+}
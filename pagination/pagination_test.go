@@ -0,0 +1,100 @@
+package pagination
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromRequestDefaults(t *testing.T) {
+	p, err := FromRequest(httptest.NewRequest("GET", "/calls", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, Params{Limit: DefaultLimit, Sort: SortID}, p)
+}
+
+func TestFromRequestCapsLimit(t *testing.T) {
+	p, err := FromRequest(httptest.NewRequest("GET", "/calls?limit=5000&sort=-created_at", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, MaxLimit, p.Limit)
+	assert.Equal(t, SortCreatedAt, p.Sort)
+	assert.True(t, p.Desc)
+}
+
+func TestFromRequestInvalid(t *testing.T) {
+	_, err := FromRequest(httptest.NewRequest("GET", "/calls?limit=-1&sort=name&cursor=%25%25", nil))
+	e := apierr.From(err)
+	assert.Equal(t, apierr.CodeValidation, e.Code)
+	assert.Contains(t, e.Fields, "limit")
+	assert.Contains(t, e.Fields, "sort")
+	assert.Contains(t, e.Fields, "cursor")
+}
+
+func TestCursorMustMatchSort(t *testing.T) {
+	cursor := Cursor{Sort: SortID, ID: 10}.Encode()
+
+	p, err := FromRequest(httptest.NewRequest("GET", "/calls?cursor="+cursor, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(10), p.After.ID)
+
+	_, err = FromRequest(httptest.NewRequest("GET", "/calls?sort=-id&cursor="+cursor, nil))
+	assert.Error(t, err)
+}
+
+func TestNewPage(t *testing.T) {
+	created := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	key := func(id uint) Key { return Key{ID: id, CreatedAt: created.Add(time.Duration(id) * time.Second)} }
+	p := Params{Limit: 2, Sort: SortCreatedAt}
+
+	page := NewPage(p, []uint{1, 2, 3}, key)
+	assert.Equal(t, []uint{1, 2}, page.Data)
+	if assert.NotNil(t, page.NextCursor) {
+		c, err := DecodeCursor(*page.NextCursor)
+		assert.NoError(t, err)
+		assert.Equal(t, uint(2), c.ID)
+		assert.True(t, c.CreatedAt.Equal(created.Add(2*time.Second)))
+	}
+
+	page = NewPage(p, []uint{1, 2}, key)
+	assert.Len(t, page.Data, 2)
+	assert.Nil(t, page.NextCursor)
+
+	page = NewPage(p, nil, key)
+	assert.NotNil(t, page.Data)
+	assert.Nil(t, page.NextCursor)
+}
+
+func TestFromRequestSorted(t *testing.T) {
+	p, err := FromRequestSorted(httptest.NewRequest("GET", "/calls", nil), SortDistance, SortDistance, SortID)
+	assert.NoError(t, err)
+	assert.Equal(t, SortDistance, p.Sort)
+
+	cursor := Cursor{Sort: SortDistance, ID: 3, Distance: 1.5}.Encode()
+	p, err = FromRequestSorted(httptest.NewRequest("GET", "/calls?cursor="+cursor, nil), SortDistance, SortDistance, SortID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, p.After.Distance)
+
+	_, err = FromRequestSorted(httptest.NewRequest("GET", "/calls?sort=created_at", nil), SortDistance, SortDistance, SortID)
+	assert.Equal(t, "must be one of distance, -distance, id, -id", apierr.From(err).Fields["sort"])
+	_, err = FromRequest(httptest.NewRequest("GET", "/calls?cursor="+cursor, nil))
+	assert.Error(t, err)
+}
+
+func TestSliceByDistance(t *testing.T) {
+	distances := map[uint]float64{1: 3, 2: 1, 3: 1, 4: 2}
+	key := func(id uint) Key { return Key{ID: id, Distance: distances[id]} }
+	p := Params{Limit: 2, Sort: SortDistance}
+
+	items := Slice(p, []uint{1, 2, 3, 4}, key)
+	assert.Equal(t, []uint{2, 3, 4}, items)
+	page := NewPage(p, items, key)
+	if assert.NotNil(t, page.NextCursor) {
+		c, err := DecodeCursor(*page.NextCursor)
+		assert.NoError(t, err)
+		assert.Equal(t, Cursor{Sort: SortDistance, ID: 3, Distance: 1}, c)
+		p.After = &c
+	}
+	assert.Equal(t, []uint{4, 1}, Slice(p, []uint{1, 2, 3, 4}, key))
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/auth"
+)
+
+type clientKey struct{}
+
+// WithClient returns a copy of ctx in which requests are counted under
+// client rather than the user or IP address, e.g. to count each API key
+// separately.
+func WithClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// Client names who is making a request: the client set with WithClient,
+// otherwise the acting user, otherwise the remote IP address.
+func Client(r *http.Request) string {
+	if client, ok := r.Context().Value(clientKey{}).(string); ok {
+		return client
+	}
+	if user := auth.UserFromContext(r.Context()); user != nil {
+		return fmt.Sprintf("user:%d", user.ID)
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return "ip:" + ip
+}
+
+// SetHeaders describes res in the X-RateLimit-Limit, X-RateLimit-Remaining
+// and X-RateLimit-Reset headers, the last as a Unix time, and sets
+// Retry-After if the request was blocked. Requests that are not limited get
+// no headers.
+func SetHeaders(h http.Header, res Result) {
+	if res.Limit <= 0 {
+		return
+	}
+	h.Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(int64(math.Ceil(float64(res.Reset.UnixMilli())/1000)), 10))
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+	}
+}
+
+// Middleware limits each client to limit requests to the routes it wraps.
+// Routes wrapped under the same name share a count. It must run after the
+// authentication middleware so that users are counted separately from
+// their IP address. If Redis cannot be reached requests are let through.
+func (l *Limiter) Middleware(route string, limit Limit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit.Requests <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := Client(r)
+			res, err := l.Allow(r.Context(), route+":"+client, limit)
+			if err != nil {
+				log.Printf("ratelimit: counting request of %s to %s: %v", client, route, err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			SetHeaders(w.Header(), res)
+			if !res.Allowed {
+				apierr.Write(w, r, apierr.TooManyRequests("rate limit exceeded, try again later"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// Package ratelimit limits how often clients may call routes, using sliding
+// windows stored in Redis so that every server instance shares the counts.
+//
+// Each client and route has a sorted set of the times of its recent
+// requests. A request is allowed if fewer than the limit fall within the
+// window before it; blocked requests are not recorded, so a client that
+// keeps retrying is let through again as soon as its oldest request ages
+// out.
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Limit allows Requests requests per Window. A zero Limit allows any number.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Result describes a client's standing after a request.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is when the oldest request counted against the limit leaves
+	// the window.
+	Reset time.Time
+	// RetryAfter is how long a blocked client must wait.
+	RetryAfter time.Duration
+}
+
+// slide drops requests older than the window from the set in KEYS[1] and
+// records one at ARGV[1] if fewer than ARGV[3] remain. Times are in
+// milliseconds. It returns whether the request was recorded, how many
+// requests the window holds and the time of the oldest.
+var slide = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', KEYS[1], window)
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return {allowed, count, oldest[2]}
+`)
+
+// Limiter counts requests in Redis.
+type Limiter struct {
+	client *redis.Client
+	now    func() time.Time
+}
+
+// NewLimiter returns a Limiter that stores its windows in client.
+func NewLimiter(client *redis.Client) *Limiter {
+	return &Limiter{client: client, now: time.Now}
+}
+
+func windowKey(key string) string {
+	return "ratelimit:" + key
+}
+
+// Allow counts a request under key against limit. Requests under a limit
+// of no requests are always allowed and not counted.
+func (l *Limiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if limit.Requests <= 0 {
+		return Result{Allowed: true}, nil
+	}
+	now := l.now().Truncate(time.Millisecond)
+	member := make([]byte, 8)
+	if _, err := rand.Read(member); err != nil {
+		return Result{}, err
+	}
+	reply, err := slide.Run(ctx, l.client, []string{windowKey(key)},
+		now.UnixMilli(), limit.Window.Milliseconds(), limit.Requests, hex.EncodeToString(member)).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	// Lua drops a trailing nil from a table, so the oldest request is
+	// missing when the set is empty, as it is after a zero window.
+	if len(reply) != 2 && len(reply) != 3 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply %v", reply)
+	}
+	allowed, _ := reply[0].(int64)
+	count, _ := reply[1].(int64)
+	oldest := float64(now.UnixMilli())
+	if len(reply) == 3 {
+		oldestText, _ := reply[2].(string)
+		if oldest, err = strconv.ParseFloat(oldestText, 64); err != nil {
+			return Result{}, fmt.Errorf("ratelimit: parsing oldest request: %w", err)
+		}
+	}
+
+	res := Result{
+		Allowed:   allowed == 1,
+		Limit:     limit.Requests,
+		Remaining: limit.Requests - int(count),
+		Reset:     time.UnixMilli(int64(oldest)).Add(limit.Window),
+	}
+	if !res.Allowed {
+		res.RetryAfter = res.Reset.Sub(now)
+	}
+	return res, nil
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/pageza/vet-app/auth"
+	"github.com/pageza/vet-app/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+func setup(t *testing.T) (*Limiter, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewLimiter(client), mr
+}
+
+func TestAllow(t *testing.T) {
+	l, _ := setup(t)
+	start := time.Now()
+	now := start
+	l.now = func() time.Time { return now }
+	limit := Limit{Requests: 2, Window: time.Minute}
+
+	res, err := l.Allow(ctx, "calls:create:ip:192.0.2.1", limit)
+	assert.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+
+	now = start.Add(30 * time.Second)
+	res, _ = l.Allow(ctx, "calls:create:ip:192.0.2.1", limit)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// The window slides: the first request leaves it after a minute, not at
+	// the start of the next minute.
+	now = start.Add(45 * time.Second)
+	res, _ = l.Allow(ctx, "calls:create:ip:192.0.2.1", limit)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, start.Add(time.Minute).UnixMilli(), res.Reset.UnixMilli())
+	assert.Equal(t, 15*time.Second, res.RetryAfter.Round(time.Millisecond))
+
+	res, _ = l.Allow(ctx, "calls:create:ip:192.0.2.2", limit)
+	assert.True(t, res.Allowed)
+
+	now = start.Add(61 * time.Second)
+	res, _ = l.Allow(ctx, "calls:create:ip:192.0.2.1", limit)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, start.Add(90*time.Second).UnixMilli(), res.Reset.UnixMilli())
+}
+
+func TestAllowUnlimited(t *testing.T) {
+	l, mr := setup(t)
+
+	for _, limit := range []Limit{{}, {Requests: -1, Window: time.Minute}} {
+		res, err := l.Allow(ctx, "magiclink:jane@example.com", limit)
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed)
+	}
+	assert.Empty(t, mr.Keys())
+
+	// Without a window requests leave it as soon as they are made.
+	for i := 0; i < 2; i++ {
+		res, err := l.Allow(ctx, "magiclink:jane@example.com", Limit{Requests: 1})
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l, mr := setup(t)
+	h := l.Middleware("calls:create", Limit{Requests: 1, Window: time.Hour})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	serve := func(ctx context.Context, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/calls", nil).WithContext(ctx)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(ctx, "192.0.2.1:1234")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"))
+	assert.NotEmpty(t, rec.Header().Get("X-RateLimit-Reset"))
+
+	rec = serve(ctx, "192.0.2.1:5678")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "3600", rec.Header().Get("Retry-After"))
+
+	// Users and other clients are counted apart from their IP address.
+	user := auth.WithUser(ctx, &models.User{ID: 7})
+	assert.Equal(t, http.StatusCreated, serve(user, "192.0.2.1:1234").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(user, "192.0.2.2:1234").Code)
+	assert.Equal(t, http.StatusCreated, serve(WithClient(user, "apikey:3"), "192.0.2.1:1234").Code)
+
+	// Requests are let through while Redis is down.
+	mr.Close()
+	assert.Equal(t, http.StatusCreated, serve(ctx, "192.0.2.1:1234").Code)
+}
@@ -0,0 +1,75 @@
+package rbac
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/auth"
+)
+
+type permissionsKey struct{}
+
+// WithPermissions returns a copy of ctx carrying the acting user's
+// permissions.
+func WithPermissions(ctx context.Context, permissions Set) context.Context {
+	return context.WithValue(ctx, permissionsKey{}, permissions)
+}
+
+// Can reports whether the acting user has permission, as loaded by
+// Middleware. Anonymous requests have no permissions.
+func Can(ctx context.Context, permission string) bool {
+	permissions, _ := ctx.Value(permissionsKey{}).(Set)
+	return permissions.Has(permission)
+}
+
+// Middleware loads the permissions of the user set by the authentication
+// middleware, which must run first. Roles requiring a second factor only
+// count if the authentication middleware recorded one: sessions do once
+// the code is entered, and bearer tokens if they were issued from such a
+// session.
+func (a *Authorizer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := auth.UserFromContext(r.Context())
+		if user == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		permissions := a.Permissions
+		if auth.SecondFactorAt(r.Context()).IsZero() {
+			permissions = a.PermissionsWithoutSecondFactor
+		}
+		set, err := permissions(r.Context(), user)
+		if err != nil {
+			apierr.Write(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPermissions(r.Context(), set)))
+	})
+}
+
+// Require only lets through users holding every one of permissions,
+// rejecting anonymous requests with 401 and everyone else with 403.
+func Require(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if auth.UserFromContext(r.Context()) == nil {
+				apierr.Write(w, r, apierr.Unauthorized("authentication required"))
+				return
+			}
+			for _, p := range permissions {
+				if !Can(r.Context(), p) {
+					apierr.Write(w, r, apierr.Forbidden("you need the "+p+" permission to do this"))
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireFunc is Require for a single handler function, for use when
+// registering routes.
+func RequireFunc(permission string, f http.HandlerFunc) http.Handler {
+	return Require(permission)(f)
+}
@@ -0,0 +1,229 @@
+// Package rbac decides what users may do.
+//
+// Users hold roles, each of which grants a set of permissions. Roles and
+// their permissions are stored in Postgres and cached in Redis. Every user
+// implicitly holds the volunteer role and verified veterans implicitly hold
+// the veteran role, so those two are never granted directly.
+//
+// Roles can be made to require a second factor, in which case they grant
+// nothing to a user until they have entered a two-factor code in their
+// session.
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/repository"
+)
+
+// ErrImplicitRole is returned when granting or revoking a role that users
+// hold implicitly.
+var ErrImplicitRole = errors.New("role is implied and cannot be granted or revoked")
+
+// Set is a set of permission names.
+type Set map[string]bool
+
+// Has reports whether the set contains permission.
+func (s Set) Has(permission string) bool {
+	return s[permission]
+}
+
+// Authorizer resolves users' roles and permissions.
+type Authorizer struct {
+	roles  repository.RoleRepository
+	client *redis.Client
+	ttl    time.Duration
+	now    func() time.Time
+
+	secondFactorRoles map[string]bool
+}
+
+// NewAuthorizer returns an Authorizer that caches lookups from roles in
+// client for ttl.
+func NewAuthorizer(roles repository.RoleRepository, client *redis.Client, ttl time.Duration) *Authorizer {
+	return &Authorizer{roles: roles, client: client, ttl: ttl, now: time.Now}
+}
+
+// RequireSecondFactor makes roles grant their permissions only to users who
+// entered a second factor. It must be called before the Authorizer is used.
+func (a *Authorizer) RequireSecondFactor(roles ...string) {
+	a.secondFactorRoles = map[string]bool{}
+	for _, role := range roles {
+		a.secondFactorRoles[role] = true
+	}
+}
+
+func userRolesKey(userID uint) string {
+	return fmt.Sprintf("rbac:user:%d:roles", userID)
+}
+
+func rolePermissionsKey(role string) string {
+	return "rbac:role:" + role + ":permissions"
+}
+
+// Implicit reports whether every user, or every verified veteran, holds
+// role without it being granted.
+func Implicit(role string) bool {
+	return role == models.RoleVolunteer || role == models.RoleVeteran
+}
+
+// Roles returns the names of every role user holds, including implicit
+// ones, in order.
+func (a *Authorizer) Roles(ctx context.Context, user *models.User) ([]string, error) {
+	roles, err := a.cached(ctx, userRolesKey(user.ID), func() ([]string, error) {
+		return a.roles.UserRoles(ctx, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	roles = append([]string{models.RoleVolunteer}, roles...)
+	if user.IsVerifiedVeteran(a.now()) {
+		roles = append(roles, models.RoleVeteran)
+	}
+	sort.Strings(roles)
+	return roles, nil
+}
+
+// RequiresSecondFactor reports whether user holds a role that requires a
+// second factor.
+func (a *Authorizer) RequiresSecondFactor(ctx context.Context, user *models.User) (bool, error) {
+	roles, err := a.Roles(ctx, user)
+	if err != nil {
+		return false, err
+	}
+	for _, role := range roles {
+		if a.secondFactorRoles[role] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Permissions returns every permission granted by user's roles.
+func (a *Authorizer) Permissions(ctx context.Context, user *models.User) (Set, error) {
+	roles, err := a.Roles(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return a.permissions(ctx, roles)
+}
+
+// PermissionsWithoutSecondFactor is Permissions for a user who has not
+// entered a second factor, leaving out roles that require one.
+func (a *Authorizer) PermissionsWithoutSecondFactor(ctx context.Context, user *models.User) (Set, error) {
+	roles, err := a.Roles(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	allowed := roles[:0]
+	for _, role := range roles {
+		if !a.secondFactorRoles[role] {
+			allowed = append(allowed, role)
+		}
+	}
+	return a.permissions(ctx, allowed)
+}
+
+func (a *Authorizer) permissions(ctx context.Context, roles []string) (Set, error) {
+	set := Set{}
+	for _, role := range roles {
+		permissions, err := a.cached(ctx, rolePermissionsKey(role), func() ([]string, error) {
+			return a.rolePermissions(ctx, role)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range permissions {
+			set[p] = true
+		}
+	}
+	return set, nil
+}
+
+func (a *Authorizer) rolePermissions(ctx context.Context, name string) ([]string, error) {
+	role, err := a.roles.Get(ctx, name)
+	if errors.Is(err, repository.ErrNotFound) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(role.Permissions))
+	for i, p := range role.Permissions {
+		names[i] = p.Name
+	}
+	return names, nil
+}
+
+// Grant gives a user a role.
+func (a *Authorizer) Grant(ctx context.Context, userID uint, role string) error {
+	if Implicit(role) {
+		return ErrImplicitRole
+	}
+	if err := a.roles.Grant(ctx, userID, role); err != nil {
+		return err
+	}
+	return a.forget(ctx, userRolesKey(userID))
+}
+
+// Revoke takes a role away from a user.
+func (a *Authorizer) Revoke(ctx context.Context, userID uint, role string) error {
+	if Implicit(role) {
+		return ErrImplicitRole
+	}
+	if err := a.roles.Revoke(ctx, userID, role); err != nil {
+		return err
+	}
+	return a.forget(ctx, userRolesKey(userID))
+}
+
+// ForgetUser drops the cached roles of a user, for when they are deleted.
+func (a *Authorizer) ForgetUser(ctx context.Context, userID uint) error {
+	return a.forget(ctx, userRolesKey(userID))
+}
+
+// SetPermissions replaces the permissions a role grants.
+func (a *Authorizer) SetPermissions(ctx context.Context, role string, permissions []string) error {
+	if err := a.roles.SetPermissions(ctx, role, permissions); err != nil {
+		return err
+	}
+	return a.forget(ctx, rolePermissionsKey(role))
+}
+
+// cached returns the list stored at key, calling load and storing its result
+// on a miss. Redis errors fall back to load so that authorization keeps
+// working, more slowly, while Redis is down.
+func (a *Authorizer) cached(ctx context.Context, key string, load func() ([]string, error)) ([]string, error) {
+	raw, err := a.client.Get(ctx, key).Bytes()
+	if err == nil {
+		var values []string
+		if err := json.Unmarshal(raw, &values); err == nil {
+			return values, nil
+		}
+	} else if !errors.Is(err, redis.Nil) {
+		log.Printf("rbac: reading %s from cache: %v", key, err)
+	}
+
+	values, err := load()
+	if err != nil {
+		return nil, err
+	}
+	raw, _ = json.Marshal(values)
+	if err := a.client.Set(ctx, key, raw, a.ttl).Err(); err != nil {
+		log.Printf("rbac: caching %s: %v", key, err)
+	}
+	return values, nil
+}
+
+// forget drops a cached entry after the data behind it changed.
+func (a *Authorizer) forget(ctx context.Context, key string) error {
+	return a.client.Del(ctx, key).Err()
+}
@@ -0,0 +1,156 @@
+package rbac
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/pageza/vet-app/auth"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+func setup(t *testing.T) (*Authorizer, repository.Repositories, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	repos := repository.NewMemory()
+	return NewAuthorizer(repos.Roles, client, time.Minute), repos, mr
+}
+
+func createUser(t *testing.T, repos repository.Repositories, email string) *models.User {
+	user := &models.User{Name: "Jane Doe", Email: email}
+	assert.NoError(t, repos.Users.Create(ctx, user))
+	return user
+}
+
+func TestImplicitRoles(t *testing.T) {
+	a, repos, _ := setup(t)
+	volunteer := createUser(t, repos, "jane@example.com")
+	veteran := createUser(t, repos, "john@example.com")
+	veteran.Verify(models.VerificationSourceIDme, "Army", "IAL2", time.Now(), nil)
+
+	roles, err := a.Roles(ctx, volunteer)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{models.RoleVolunteer}, roles)
+
+	roles, err = a.Roles(ctx, veteran)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{models.RoleVeteran, models.RoleVolunteer}, roles)
+
+	permissions, err := a.Permissions(ctx, veteran)
+	assert.NoError(t, err)
+	assert.True(t, permissions.Has(models.PermissionCreateCalls))
+	assert.False(t, permissions.Has(models.PermissionHideResponses))
+
+	assert.ErrorIs(t, a.Grant(ctx, volunteer.ID, models.RoleVeteran), ErrImplicitRole)
+	assert.ErrorIs(t, a.Revoke(ctx, volunteer.ID, models.RoleVolunteer), ErrImplicitRole)
+}
+
+func TestGrantInvalidatesCache(t *testing.T) {
+	a, repos, mr := setup(t)
+	user := createUser(t, repos, "jane@example.com")
+
+	permissions, err := a.Permissions(ctx, user)
+	assert.NoError(t, err)
+	assert.False(t, permissions.Has(models.PermissionHideResponses))
+	assert.True(t, mr.Exists(userRolesKey(user.ID)))
+
+	// Changes made behind the cache's back are not seen until it expires.
+	assert.NoError(t, repos.Roles.Grant(ctx, user.ID, models.RoleModerator))
+	permissions, _ = a.Permissions(ctx, user)
+	assert.False(t, permissions.Has(models.PermissionHideResponses))
+	mr.FastForward(time.Minute)
+	permissions, _ = a.Permissions(ctx, user)
+	assert.True(t, permissions.Has(models.PermissionHideResponses))
+
+	// Changes made through the Authorizer are seen at once.
+	assert.NoError(t, a.Revoke(ctx, user.ID, models.RoleModerator))
+	permissions, _ = a.Permissions(ctx, user)
+	assert.False(t, permissions.Has(models.PermissionHideResponses))
+
+	assert.NoError(t, a.Grant(ctx, user.ID, models.RoleModerator))
+	assert.NoError(t, a.SetPermissions(ctx, models.RoleModerator, []string{models.PermissionManageResponses}))
+	permissions, _ = a.Permissions(ctx, user)
+	assert.False(t, permissions.Has(models.PermissionHideResponses))
+	assert.True(t, permissions.Has(models.PermissionManageResponses))
+}
+
+func TestCacheFallsBackWhenRedisIsDown(t *testing.T) {
+	a, repos, mr := setup(t)
+	user := createUser(t, repos, "jane@example.com")
+	assert.NoError(t, repos.Roles.Grant(ctx, user.ID, models.RoleAdmin))
+	mr.Close()
+
+	permissions, err := a.Permissions(ctx, user)
+	assert.NoError(t, err)
+	assert.True(t, permissions.Has(models.PermissionDeleteUsers))
+}
+
+func TestRequire(t *testing.T) {
+	a, repos, _ := setup(t)
+	moderator := createUser(t, repos, "mod@example.com")
+	assert.NoError(t, a.Grant(ctx, moderator.ID, models.RoleModerator))
+	volunteer := createUser(t, repos, "jane@example.com")
+
+	h := a.Middleware(RequireFunc(models.PermissionHideResponses, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(user *models.User) int {
+		req := httptest.NewRequest("PUT", "/responses/1/hidden", nil)
+		if user != nil {
+			req = req.WithContext(auth.WithUser(req.Context(), user))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(nil))
+	assert.Equal(t, http.StatusForbidden, serve(volunteer))
+	assert.Equal(t, http.StatusNoContent, serve(moderator))
+}
+
+func TestRequireSecondFactor(t *testing.T) {
+	a, repos, _ := setup(t)
+	a.RequireSecondFactor(models.RoleModerator, models.RoleAdmin)
+	moderator := createUser(t, repos, "mod@example.com")
+	assert.NoError(t, a.Grant(ctx, moderator.ID, models.RoleModerator))
+	volunteer := createUser(t, repos, "jane@example.com")
+
+	required, err := a.RequiresSecondFactor(ctx, moderator)
+	assert.NoError(t, err)
+	assert.True(t, required)
+	required, _ = a.RequiresSecondFactor(ctx, volunteer)
+	assert.False(t, required)
+
+	h := a.Middleware(RequireFunc(models.PermissionHideResponses, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(secondFactor bool) int {
+		req := httptest.NewRequest("PUT", "/responses/1/hidden", nil)
+		ctx := auth.WithUser(req.Context(), moderator)
+		if secondFactor {
+			ctx = auth.WithSecondFactor(ctx, time.Now())
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req.WithContext(ctx))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, serve(false))
+	assert.Equal(t, http.StatusNoContent, serve(true))
+
+	// Permissions of other roles are unaffected.
+	permissions, err := a.PermissionsWithoutSecondFactor(ctx, moderator)
+	assert.NoError(t, err)
+	assert.True(t, permissions.Has(models.PermissionCreateResponses))
+	assert.False(t, permissions.Has(models.PermissionHideResponses))
+}
@@ -0,0 +1,1197 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pageza/vet-app/geo"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+)
+
+// NewMemory returns repositories that keep everything in memory. They
+// enforce the same unique email, foreign key and cascading delete rules as
+// the Postgres schema, so handlers can be tested without a database.
+//
+// The default roles, permissions and categories are seeded as they are by
+// the migrations that create them.
+func NewMemory() Repositories {
+	s := &memoryStore{
+		users:         map[uint]models.User{},
+		calls:         map[uint]models.Call{},
+		callHistory:   map[uint]models.CallStatusChange{},
+		responses:     map[uint]models.Response{},
+		categories:    map[uint]models.Category{},
+		tags:          map[uint]models.Tag{},
+		callTags:      map[uint][]uint{},
+		volunteers:    map[uint]models.VolunteerProfile{},
+		roles:         map[string]models.Role{},
+		userRoles:     map[uint]map[string]bool{},
+		recoveryCodes: map[uint]models.RecoveryCode{},
+		organizations: map[uint]models.Organization{},
+		apiKeys:       map[uint]models.APIKey{},
+	}
+	s.seedRoles()
+	s.seedCategories()
+	return Repositories{
+		Users:         &memoryUsers{s},
+		Calls:         &memoryCalls{s},
+		Responses:     &memoryResponses{s},
+		Categories:    &memoryCategories{s},
+		Volunteers:    &memoryVolunteers{s},
+		Roles:         &memoryRoles{s},
+		RecoveryCodes: &memoryRecoveryCodes{s},
+		Organizations: &memoryOrganizations{s},
+		APIKeys:       &memoryAPIKeys{s},
+	}
+}
+
+// defaultGrants lists the permissions of each default role other than admin,
+// which has them all. Keep in sync with migrations 0004_add_roles,
+// 0006_add_api_keys, 0009_add_call_categories and 0010_add_urgent_calls.
+var defaultGrants = map[string][]string{
+	models.RoleVeteran:   {models.PermissionCreateCalls, models.PermissionViewVeteranOnly, models.PermissionCreateResponses},
+	models.RoleVolunteer: {models.PermissionCreateResponses},
+	models.RoleModerator: {models.PermissionViewVeteranOnly, models.PermissionHideResponses},
+	models.RoleAdmin:     nil,
+	models.RoleOnDuty:    {},
+}
+
+var defaultPermissions = []string{
+	models.PermissionCreateCalls,
+	models.PermissionViewVeteranOnly,
+	models.PermissionManageCalls,
+	models.PermissionCreateResponses,
+	models.PermissionHideResponses,
+	models.PermissionManageResponses,
+	models.PermissionManageUsers,
+	models.PermissionVerifyUsers,
+	models.PermissionDeleteUsers,
+	models.PermissionManageSessions,
+	models.PermissionManageRoles,
+	models.PermissionManageAPIKeys,
+	models.PermissionManageCategories,
+}
+
+// defaultCategories lists the slugs and names of the default categories.
+// Keep in sync with migration 0009_add_call_categories.
+var defaultCategories = [][2]string{
+	{"benefits", "Benefits"},
+	{"housing", "Housing"},
+	{"mental-health", "Mental health"},
+	{"employment", "Employment"},
+	{"transportation", "Transportation"},
+	{"legal", "Legal"},
+}
+
+func (s *memoryStore) seedRoles() {
+	for i, name := range defaultPermissions {
+		s.permissions = append(s.permissions, models.Permission{ID: uint(i + 1), Name: name})
+	}
+	sort.Slice(s.permissions, func(i, j int) bool { return s.permissions[i].Name < s.permissions[j].Name })
+
+	var id uint
+	for name, grants := range defaultGrants {
+		id++
+		if name == models.RoleAdmin {
+			grants = defaultPermissions
+		}
+		s.roles[name] = models.Role{ID: id, Name: name, Permissions: s.findPermissions(grants)}
+	}
+}
+
+func (s *memoryStore) seedCategories() {
+	now := time.Now()
+	for _, c := range defaultCategories {
+		s.lastCategoryID++
+		s.categories[s.lastCategoryID] = models.Category{ID: s.lastCategoryID, Slug: c[0], Name: c[1], CreatedAt: now}
+	}
+}
+
+// findPermissions returns the named permissions ordered by name, skipping
+// unknown ones.
+func (s *memoryStore) findPermissions(names []string) []models.Permission {
+	want := uniqueStrings(names)
+	permissions := []models.Permission{}
+	for _, p := range s.permissions {
+		if want[p.Name] {
+			permissions = append(permissions, p)
+		}
+	}
+	return permissions
+}
+
+// memoryStore holds the rows of every table. Associations are stripped
+// before rows are stored and filled in again when they are read.
+type memoryStore struct {
+	mu sync.RWMutex
+
+	lastUserID         uint
+	lastCallID         uint
+	lastCallChangeID   uint
+	lastResponseID     uint
+	lastCategoryID     uint
+	lastTagID          uint
+	lastVolunteerID    uint
+	lastRecoveryCodeID uint
+	lastOrganizationID uint
+	lastAPIKeyID       uint
+
+	users       map[uint]models.User
+	calls       map[uint]models.Call
+	callHistory map[uint]models.CallStatusChange
+	responses   map[uint]models.Response
+
+	categories map[uint]models.Category
+	tags       map[uint]models.Tag
+	// callTags holds the IDs of each call's tags.
+	callTags map[uint][]uint
+
+	volunteers map[uint]models.VolunteerProfile
+
+	roles       map[string]models.Role
+	permissions []models.Permission
+	userRoles   map[uint]map[string]bool
+
+	recoveryCodes map[uint]models.RecoveryCode
+	organizations map[uint]models.Organization
+	apiKeys       map[uint]models.APIKey
+}
+
+// duplicateUser reports whether another user has the same email or ID.me
+// subject as user.
+func (s *memoryStore) duplicateUser(user *models.User) bool {
+	for _, u := range s.users {
+		if u.ID == user.ID {
+			continue
+		}
+		if u.Email == user.Email {
+			return true
+		}
+		if u.IDmeSubject != nil && user.IDmeSubject != nil && *u.IDmeSubject == *user.IDmeSubject {
+			return true
+		}
+	}
+	return false
+}
+
+// deleting reports whether the user asked for their account to be deleted.
+func (s *memoryStore) deleting(userID uint) bool {
+	user := s.users[userID]
+	return user.DeletionRequested()
+}
+
+func (s *memoryStore) call(id uint) models.Call {
+	call := s.calls[id]
+	call.User = s.users[call.UserID]
+	if call.CategoryID != nil {
+		category := s.categories[*call.CategoryID]
+		call.Category = &category
+	}
+	call.Tags = []models.Tag{}
+	for _, tagID := range s.callTags[id] {
+		call.Tags = append(call.Tags, s.tags[tagID])
+	}
+	sort.Slice(call.Tags, func(i, j int) bool { return call.Tags[i].Name < call.Tags[j].Name })
+	return call
+}
+
+// checkCategory returns ErrForeignKey if call is in a category that does
+// not exist.
+func (s *memoryStore) checkCategory(call *models.Call) error {
+	if call.CategoryID == nil {
+		return nil
+	}
+	if _, ok := s.categories[*call.CategoryID]; !ok {
+		return ErrForeignKey
+	}
+	return nil
+}
+
+// saveCallTags replaces the tags of call with call.Tags, creating the ones
+// that do not exist yet, and fills them in as they are stored.
+func (s *memoryStore) saveCallTags(call *models.Call) {
+	names := uniqueStrings(tagNames(call.Tags))
+	ids := []uint{}
+	for id, tag := range s.tags {
+		if names[tag.Name] {
+			ids = append(ids, id)
+			delete(names, tag.Name)
+		}
+	}
+	for name := range names {
+		s.lastTagID++
+		s.tags[s.lastTagID] = models.Tag{ID: s.lastTagID, Name: name}
+		ids = append(ids, s.lastTagID)
+	}
+	s.callTags[call.ID] = ids
+	call.Tags = s.call(call.ID).Tags
+}
+
+func (s *memoryStore) response(id uint) models.Response {
+	response := s.responses[id]
+	response.User = s.users[response.UserID]
+	response.Call = s.calls[response.CallID]
+	return response
+}
+
+func (s *memoryStore) deleteCall(id uint) {
+	delete(s.calls, id)
+	delete(s.callTags, id)
+	for hid, change := range s.callHistory {
+		if change.CallID == id {
+			delete(s.callHistory, hid)
+		}
+	}
+	for rid, response := range s.responses {
+		if response.CallID == id {
+			delete(s.responses, rid)
+		}
+	}
+}
+
+func userKey(u models.User) pagination.Key {
+	return pagination.Key{ID: u.ID, CreatedAt: u.CreatedAt}
+}
+
+func callKey(c models.Call) pagination.Key {
+	key := pagination.Key{ID: c.ID, CreatedAt: c.CreatedAt}
+	if c.Distance != nil {
+		key.Distance = *c.Distance
+	}
+	return key
+}
+
+func responseKey(r models.Response) pagination.Key {
+	return pagination.Key{ID: r.ID, CreatedAt: r.CreatedAt}
+}
+
+func volunteerKey(p models.VolunteerProfile) pagination.Key {
+	return pagination.Key{ID: p.ID, CreatedAt: p.CreatedAt}
+}
+
+type memoryUsers struct {
+	s *memoryStore
+}
+
+func (r *memoryUsers) List(ctx context.Context, filter UserFilter, page pagination.Params) ([]models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	users := []models.User{}
+	for _, u := range r.s.users {
+		if filter.Email != "" && u.Email != filter.Email {
+			continue
+		}
+		if filter.IDmeSubject != "" && (u.IDmeSubject == nil || *u.IDmeSubject != filter.IDmeSubject) {
+			continue
+		}
+		if filter.Role != "" && !r.s.userRoles[u.ID][filter.Role] {
+			continue
+		}
+		if filter.ExcludeDeleting && u.DeletionRequested() {
+			continue
+		}
+		if filter.DeletionRequestedBefore != nil && (u.DeletionRequestedAt == nil || !u.DeletionRequestedAt.Before(*filter.DeletionRequestedBefore)) {
+			continue
+		}
+		users = append(users, u)
+	}
+	return pagination.Slice(page, users, userKey), nil
+}
+
+func (r *memoryUsers) Get(ctx context.Context, id uint) (*models.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *memoryUsers) Create(ctx context.Context, user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.s.duplicateUser(user) {
+		return ErrDuplicate
+	}
+	r.s.lastUserID++
+	user.ID = r.s.lastUserID
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	r.s.users[user.ID] = *user
+	return nil
+}
+
+func (r *memoryUsers) Update(ctx context.Context, user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[user.ID]; !ok {
+		return ErrNotFound
+	}
+	if r.s.duplicateUser(user) {
+		return ErrDuplicate
+	}
+	r.s.users[user.ID] = *user
+	return nil
+}
+
+func (r *memoryUsers) Delete(ctx context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.users, id)
+	delete(r.s.userRoles, id)
+	if profile, ok := r.s.volunteerProfile(id); ok {
+		delete(r.s.volunteers, profile.ID)
+	}
+	r.s.deleteRecoveryCodes(id)
+	for oid, org := range r.s.organizations {
+		if org.UserID == id {
+			r.s.deleteOrganization(oid)
+		}
+	}
+	for cid, call := range r.s.calls {
+		switch {
+		case call.UserID == id:
+			r.s.deleteCall(cid)
+		case call.ClaimedByID != nil && *call.ClaimedByID == id:
+			call.ClaimedByID = nil
+			r.s.calls[cid] = call
+		}
+	}
+	for hid, change := range r.s.callHistory {
+		if change.UserID != nil && *change.UserID == id {
+			change.UserID = nil
+			r.s.callHistory[hid] = change
+		}
+	}
+	for rid, response := range r.s.responses {
+		switch {
+		case response.UserID == id:
+			delete(r.s.responses, rid)
+		case response.HiddenByID != nil && *response.HiddenByID == id:
+			response.HiddenByID = nil
+			r.s.responses[rid] = response
+		}
+	}
+	return nil
+}
+
+type memoryCalls struct {
+	s *memoryStore
+}
+
+func (r *memoryCalls) List(ctx context.Context, filter CallFilter, page pagination.Params) ([]models.Call, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	statuses := uniqueStrings(filter.Statuses)
+	categories := uniqueStrings(filter.Categories)
+	tags := uniqueStrings(filter.Tags)
+	calls := []models.Call{}
+	for id, c := range r.s.calls {
+		if filter.UserID != 0 && c.UserID != filter.UserID {
+			continue
+		}
+		if len(statuses) > 0 && !statuses[c.Status] {
+			continue
+		}
+		if len(categories) > 0 && (c.CategoryID == nil || !categories[r.s.categories[*c.CategoryID].Slug]) {
+			continue
+		}
+		if len(tags) > 0 && !r.s.hasAnyTag(id, tags) {
+			continue
+		}
+		if filter.VeteranOnly != nil && c.VeteranOnly != *filter.VeteranOnly {
+			continue
+		}
+		if filter.Urgent != nil && c.Urgent != *filter.Urgent {
+			continue
+		}
+		if filter.CreatedBefore != nil && !c.CreatedAt.Before(*filter.CreatedBefore) {
+			continue
+		}
+		if filter.Located != nil && (c.PublicLocation() != nil) != *filter.Located {
+			continue
+		}
+		var distance *float64
+		if filter.Near != nil {
+			p := c.PublicLocation()
+			if p == nil {
+				continue
+			}
+			d := geo.Distance(filter.Near.Center, *p)
+			if d > filter.Near.Radius {
+				continue
+			}
+			distance = &d
+		}
+		if filter.ExcludeDeleting && r.s.deleting(c.UserID) {
+			continue
+		}
+		call := r.s.call(id)
+		call.Distance = distance
+		calls = append(calls, call)
+	}
+	return pagination.Slice(page, calls, callKey), nil
+}
+
+func (r *memoryCalls) Get(ctx context.Context, id uint) (*models.Call, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	if _, ok := r.s.calls[id]; !ok {
+		return nil, ErrNotFound
+	}
+	call := r.s.call(id)
+	return &call, nil
+}
+
+func (r *memoryCalls) Create(ctx context.Context, call *models.Call) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[call.UserID]; !ok {
+		return ErrForeignKey
+	}
+	if err := r.s.checkCategory(call); err != nil {
+		return err
+	}
+	r.s.lastCallID++
+	call.ID = r.s.lastCallID
+	if call.Status == "" {
+		call.Status = models.CallStatusOpen
+	}
+	if call.CreatedAt.IsZero() {
+		call.CreatedAt = time.Now()
+	}
+	r.s.calls[call.ID] = stripCall(*call)
+	r.s.saveCallTags(call)
+	return nil
+}
+
+func (r *memoryCalls) Update(ctx context.Context, call *models.Call) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.calls[call.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if _, ok := r.s.users[call.UserID]; !ok {
+		return ErrForeignKey
+	}
+	if err := r.s.checkCategory(call); err != nil {
+		return err
+	}
+	updated := stripCall(*call)
+	updated.Status, updated.ClaimedByID, updated.Urgent = stored.Status, stored.ClaimedByID, stored.Urgent
+	r.s.calls[call.ID] = updated
+	r.s.saveCallTags(call)
+	return nil
+}
+
+func (r *memoryCalls) Delete(ctx context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.calls[id]; !ok {
+		return ErrNotFound
+	}
+	r.s.deleteCall(id)
+	return nil
+}
+
+func (r *memoryCalls) MarkUrgent(ctx context.Context, id uint) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	call, ok := r.s.calls[id]
+	if !ok {
+		return false, ErrNotFound
+	}
+	if call.Urgent {
+		return false, nil
+	}
+	call.Urgent = true
+	r.s.calls[id] = call
+	return true, nil
+}
+
+func (r *memoryCalls) Transition(ctx context.Context, call *models.Call, change *models.CallStatusChange) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	stored, ok := r.s.calls[call.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Status != change.FromStatus {
+		return ErrStale
+	}
+	if call.ClaimedByID != nil {
+		if _, ok := r.s.users[*call.ClaimedByID]; !ok {
+			return ErrForeignKey
+		}
+	}
+	stored.Status, stored.ClaimedByID = call.Status, call.ClaimedByID
+	r.s.calls[call.ID] = stored
+
+	r.s.lastCallChangeID++
+	change.ID = r.s.lastCallChangeID
+	change.CallID = call.ID
+	if change.CreatedAt.IsZero() {
+		change.CreatedAt = time.Now()
+	}
+	change.Call, change.User = models.Call{}, nil
+	r.s.callHistory[change.ID] = *change
+	return nil
+}
+
+func (r *memoryCalls) History(ctx context.Context, callID uint) ([]models.CallStatusChange, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	changes := []models.CallStatusChange{}
+	for _, change := range r.s.callHistory {
+		if change.CallID == callID {
+			changes = append(changes, change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if !changes[i].CreatedAt.Equal(changes[j].CreatedAt) {
+			return changes[i].CreatedAt.Before(changes[j].CreatedAt)
+		}
+		return changes[i].ID < changes[j].ID
+	})
+	return changes, nil
+}
+
+// hasAnyTag reports whether the call has any of the named tags.
+func (s *memoryStore) hasAnyTag(callID uint, names map[string]bool) bool {
+	for _, tagID := range s.callTags[callID] {
+		if names[s.tags[tagID].Name] {
+			return true
+		}
+	}
+	return false
+}
+
+type memoryResponses struct {
+	s *memoryStore
+}
+
+func (r *memoryResponses) List(ctx context.Context, filter ResponseFilter, page pagination.Params) ([]models.Response, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	responses := []models.Response{}
+	for id, resp := range r.s.responses {
+		if filter.CallID != 0 && resp.CallID != filter.CallID {
+			continue
+		}
+		if filter.UserID != 0 && resp.UserID != filter.UserID {
+			continue
+		}
+		if filter.CallVeteranOnly != nil && r.s.calls[resp.CallID].VeteranOnly != *filter.CallVeteranOnly {
+			continue
+		}
+		if filter.Hidden != nil && (resp.HiddenAt != nil) != *filter.Hidden {
+			continue
+		}
+		if filter.ExcludeDeleting && r.s.deleting(resp.UserID) {
+			continue
+		}
+		responses = append(responses, r.s.response(id))
+	}
+	return pagination.Slice(page, responses, responseKey), nil
+}
+
+func (r *memoryResponses) Get(ctx context.Context, id uint) (*models.Response, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	if _, ok := r.s.responses[id]; !ok {
+		return nil, ErrNotFound
+	}
+	response := r.s.response(id)
+	return &response, nil
+}
+
+func (r *memoryResponses) Create(ctx context.Context, response *models.Response) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if err := r.checkReferences(response); err != nil {
+		return err
+	}
+	r.s.lastResponseID++
+	response.ID = r.s.lastResponseID
+	if response.CreatedAt.IsZero() {
+		response.CreatedAt = time.Now()
+	}
+	r.s.responses[response.ID] = stripResponse(*response)
+	return nil
+}
+
+func (r *memoryResponses) Update(ctx context.Context, response *models.Response) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.responses[response.ID]; !ok {
+		return ErrNotFound
+	}
+	if err := r.checkReferences(response); err != nil {
+		return err
+	}
+	r.s.responses[response.ID] = stripResponse(*response)
+	return nil
+}
+
+func (r *memoryResponses) Delete(ctx context.Context, id uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.responses[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.responses, id)
+	return nil
+}
+
+func (r *memoryResponses) checkReferences(response *models.Response) error {
+	if _, ok := r.s.users[response.UserID]; !ok {
+		return ErrForeignKey
+	}
+	if _, ok := r.s.calls[response.CallID]; !ok {
+		return ErrForeignKey
+	}
+	return nil
+}
+
+type memoryVolunteers struct {
+	s *memoryStore
+}
+
+func (r *memoryVolunteers) List(ctx context.Context, filter VolunteerFilter, page pagination.Params) ([]models.VolunteerProfile, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	profiles := []models.VolunteerProfile{}
+	for id, p := range r.s.volunteers {
+		if filter.Paused != nil && p.Paused != *filter.Paused {
+			continue
+		}
+		if filter.Serving != nil {
+			if area := p.ServiceArea(); area != nil && !area.Contains(*filter.Serving) {
+				continue
+			}
+		}
+		if filter.ExcludeDeleting && r.s.deleting(p.UserID) {
+			continue
+		}
+		profiles = append(profiles, r.s.volunteer(id))
+	}
+	return pagination.Slice(page, profiles, volunteerKey), nil
+}
+
+func (r *memoryVolunteers) Get(ctx context.Context, userID uint) (*models.VolunteerProfile, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	stored, ok := r.s.volunteerProfile(userID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	profile := r.s.volunteer(stored.ID)
+	return &profile, nil
+}
+
+func (r *memoryVolunteers) Save(ctx context.Context, profile *models.VolunteerProfile) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[profile.UserID]; !ok {
+		return ErrForeignKey
+	}
+	now := time.Now()
+	if existing, ok := r.s.volunteerProfile(profile.UserID); ok {
+		profile.ID, profile.CreatedAt = existing.ID, existing.CreatedAt
+	} else {
+		r.s.lastVolunteerID++
+		profile.ID = r.s.lastVolunteerID
+		profile.CreatedAt = now
+	}
+	profile.UpdatedAt = now
+	stored := *profile
+	stored.User = models.User{}
+	stored.Skills = append(models.Words{}, profile.Skills...)
+	stored.Certifications = append(models.Words{}, profile.Certifications...)
+	stored.Languages = append(models.Words{}, profile.Languages...)
+	stored.Availability = append(models.Availability{}, profile.Availability...)
+	r.s.volunteers[profile.ID] = stored
+	return nil
+}
+
+func (r *memoryVolunteers) Delete(ctx context.Context, userID uint) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	profile, ok := r.s.volunteerProfile(userID)
+	if !ok {
+		return ErrNotFound
+	}
+	delete(r.s.volunteers, profile.ID)
+	return nil
+}
+
+type memoryCategories struct {
+	s *memoryStore
+}
+
+func (r *memoryCategories) List(ctx context.Context) ([]models.Category, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	categories := make([]models.Category, 0, len(r.s.categories))
+	for _, category := range r.s.categories {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Name < categories[j].Name })
+	return categories, nil
+}
+
+func (r *memoryCategories) Get(ctx context.Context, slug string) (*models.Category, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for _, category := range r.s.categories {
+		if category.Slug == slug {
+			return &category, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryCategories) Create(ctx context.Context, category *models.Category) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, c := range r.s.categories {
+		if c.Slug == category.Slug {
+			return ErrDuplicate
+		}
+	}
+	r.s.lastCategoryID++
+	category.ID = r.s.lastCategoryID
+	if category.CreatedAt.IsZero() {
+		category.CreatedAt = time.Now()
+	}
+	r.s.categories[category.ID] = *category
+	return nil
+}
+
+func (r *memoryCategories) Update(ctx context.Context, category *models.Category) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.categories[category.ID]; !ok {
+		return ErrNotFound
+	}
+	for _, c := range r.s.categories {
+		if c.ID != category.ID && c.Slug == category.Slug {
+			return ErrDuplicate
+		}
+	}
+	r.s.categories[category.ID] = *category
+	return nil
+}
+
+func (r *memoryCategories) Delete(ctx context.Context, slug string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, category := range r.s.categories {
+		if category.Slug != slug {
+			continue
+		}
+		for _, call := range r.s.calls {
+			if call.CategoryID != nil && *call.CategoryID == id {
+				return ErrForeignKey
+			}
+		}
+		delete(r.s.categories, id)
+		return nil
+	}
+	return ErrNotFound
+}
+
+type memoryRoles struct {
+	s *memoryStore
+}
+
+func (r *memoryRoles) List(ctx context.Context) ([]models.Role, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	roles := make([]models.Role, 0, len(r.s.roles))
+	for _, role := range r.s.roles {
+		roles = append(roles, copyRole(role))
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+func (r *memoryRoles) Get(ctx context.Context, name string) (*models.Role, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	role, ok := r.s.roles[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	role = copyRole(role)
+	return &role, nil
+}
+
+func (r *memoryRoles) Permissions(ctx context.Context) ([]models.Permission, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	return append([]models.Permission{}, r.s.permissions...), nil
+}
+
+func (r *memoryRoles) SetPermissions(ctx context.Context, name string, names []string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	role, ok := r.s.roles[name]
+	if !ok {
+		return ErrNotFound
+	}
+	permissions := r.s.findPermissions(names)
+	if len(permissions) != len(uniqueStrings(names)) {
+		return ErrForeignKey
+	}
+	role.Permissions = permissions
+	r.s.roles[name] = role
+	return nil
+}
+
+func (r *memoryRoles) UserRoles(ctx context.Context, userID uint) ([]string, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	names := []string{}
+	for name := range r.s.userRoles[userID] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (r *memoryRoles) Grant(ctx context.Context, userID uint, name string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.roles[name]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := r.s.users[userID]; !ok {
+		return ErrForeignKey
+	}
+	if r.s.userRoles[userID] == nil {
+		r.s.userRoles[userID] = map[string]bool{}
+	}
+	r.s.userRoles[userID][name] = true
+	return nil
+}
+
+func (r *memoryRoles) Revoke(ctx context.Context, userID uint, name string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if !r.s.userRoles[userID][name] {
+		return ErrNotFound
+	}
+	delete(r.s.userRoles[userID], name)
+	return nil
+}
+
+type memoryRecoveryCodes struct {
+	s *memoryStore
+}
+
+func (r *memoryRecoveryCodes) Replace(ctx context.Context, userID uint, hashes []string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[userID]; !ok {
+		return ErrForeignKey
+	}
+	r.s.deleteRecoveryCodes(userID)
+	for _, hash := range hashes {
+		r.s.lastRecoveryCodeID++
+		r.s.recoveryCodes[r.s.lastRecoveryCodeID] = models.RecoveryCode{
+			ID:        r.s.lastRecoveryCodeID,
+			UserID:    userID,
+			CodeHash:  hash,
+			CreatedAt: time.Now(),
+		}
+	}
+	return nil
+}
+
+func (r *memoryRecoveryCodes) Use(ctx context.Context, userID uint, hash string, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, code := range r.s.recoveryCodes {
+		if code.UserID == userID && code.CodeHash == hash && code.UsedAt == nil {
+			code.UsedAt = &at
+			r.s.recoveryCodes[id] = code
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryRecoveryCodes) Remaining(ctx context.Context, userID uint) (int, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	remaining := 0
+	for _, code := range r.s.recoveryCodes {
+		if code.UserID == userID && code.UsedAt == nil {
+			remaining++
+		}
+	}
+	return remaining, nil
+}
+
+func (s *memoryStore) deleteRecoveryCodes(userID uint) {
+	for id, code := range s.recoveryCodes {
+		if code.UserID == userID {
+			delete(s.recoveryCodes, id)
+		}
+	}
+}
+
+type memoryOrganizations struct {
+	s *memoryStore
+}
+
+func (r *memoryOrganizations) List(ctx context.Context) ([]models.Organization, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	orgs := make([]models.Organization, 0, len(r.s.organizations))
+	for _, org := range r.s.organizations {
+		orgs = append(orgs, org)
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].Name < orgs[j].Name })
+	return orgs, nil
+}
+
+func (r *memoryOrganizations) Get(ctx context.Context, id uint) (*models.Organization, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	org, ok := r.s.organizations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &org, nil
+}
+
+func (r *memoryOrganizations) Create(ctx context.Context, org *models.Organization) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, o := range r.s.organizations {
+		if o.Name == org.Name {
+			return ErrDuplicate
+		}
+	}
+	if r.s.duplicateUser(&org.User) {
+		return ErrDuplicate
+	}
+	now := time.Now()
+	r.s.lastUserID++
+	org.User.ID = r.s.lastUserID
+	if org.User.CreatedAt.IsZero() {
+		org.User.CreatedAt = now
+	}
+	r.s.users[org.User.ID] = org.User
+
+	r.s.lastOrganizationID++
+	org.ID = r.s.lastOrganizationID
+	org.UserID = org.User.ID
+	if org.CreatedAt.IsZero() {
+		org.CreatedAt = now
+	}
+	stored := *org
+	stored.User = models.User{}
+	r.s.organizations[org.ID] = stored
+	return nil
+}
+
+type memoryAPIKeys struct {
+	s *memoryStore
+}
+
+func (r *memoryAPIKeys) List(ctx context.Context, organizationID uint) ([]models.APIKey, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	keys := []models.APIKey{}
+	for id, key := range r.s.apiKeys {
+		if key.OrganizationID == organizationID {
+			keys = append(keys, r.s.apiKey(id))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+func (r *memoryAPIKeys) Get(ctx context.Context, id uint) (*models.APIKey, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	if _, ok := r.s.apiKeys[id]; !ok {
+		return nil, ErrNotFound
+	}
+	key := r.s.apiKey(id)
+	return &key, nil
+}
+
+func (r *memoryAPIKeys) GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+
+	for id, key := range r.s.apiKeys {
+		if key.Prefix == prefix {
+			key := r.s.apiKey(id)
+			return &key, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryAPIKeys) Create(ctx context.Context, key *models.APIKey) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.organizations[key.OrganizationID]; !ok {
+		return ErrForeignKey
+	}
+	for _, k := range r.s.apiKeys {
+		if k.Prefix == key.Prefix {
+			return ErrDuplicate
+		}
+	}
+	r.s.lastAPIKeyID++
+	key.ID = r.s.lastAPIKeyID
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	stored := *key
+	stored.Scopes = append(models.Words{}, key.Scopes...)
+	stored.Organization = models.Organization{}
+	r.s.apiKeys[key.ID] = stored
+	return nil
+}
+
+func (r *memoryAPIKeys) Revoke(ctx context.Context, id uint, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	key, ok := r.s.apiKeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &at
+		r.s.apiKeys[id] = key
+	}
+	return nil
+}
+
+func (r *memoryAPIKeys) Touch(ctx context.Context, id uint, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if key, ok := r.s.apiKeys[id]; ok {
+		key.LastUsedAt = &at
+		r.s.apiKeys[id] = key
+	}
+	return nil
+}
+
+// volunteerProfile finds the stored profile of a user.
+func (s *memoryStore) volunteerProfile(userID uint) (models.VolunteerProfile, bool) {
+	for _, p := range s.volunteers {
+		if p.UserID == userID {
+			return p, true
+		}
+	}
+	return models.VolunteerProfile{}, false
+}
+
+func (s *memoryStore) volunteer(id uint) models.VolunteerProfile {
+	p := s.volunteers[id]
+	p.Skills = append(models.Words{}, p.Skills...)
+	p.Certifications = append(models.Words{}, p.Certifications...)
+	p.Languages = append(models.Words{}, p.Languages...)
+	p.Availability = append(models.Availability{}, p.Availability...)
+	p.User = s.users[p.UserID]
+	return p
+}
+
+func (s *memoryStore) apiKey(id uint) models.APIKey {
+	key := s.apiKeys[id]
+	key.Scopes = append(models.Words{}, key.Scopes...)
+	key.Organization = s.organizations[key.OrganizationID]
+	return key
+}
+
+func (s *memoryStore) deleteOrganization(id uint) {
+	delete(s.organizations, id)
+	for kid, key := range s.apiKeys {
+		if key.OrganizationID == id {
+			delete(s.apiKeys, kid)
+		}
+	}
+}
+
+func copyRole(role models.Role) models.Role {
+	role.Permissions = append([]models.Permission{}, role.Permissions...)
+	return role
+}
+
+func stripCall(call models.Call) models.Call {
+	call.User = models.User{}
+	call.ClaimedBy = nil
+	call.Category = nil
+	call.Tags = nil
+	call.Distance = nil
+	return call
+}
+
+func stripResponse(response models.Response) models.Response {
+	response.User = models.User{}
+	response.Call = models.Call{}
+	response.HiddenBy = nil
+	return response
+}
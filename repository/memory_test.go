@@ -0,0 +1,55 @@
+package repository
+
+import "testing"
+
+func TestMemoryUserRepository(t *testing.T) {
+	testUserRepository(t, NewMemory())
+}
+
+func TestMemoryDeletingUsers(t *testing.T) {
+	testDeletingUsers(t, NewMemory())
+}
+
+func TestMemoryCallRepository(t *testing.T) {
+	testCallRepository(t, NewMemory())
+}
+
+func TestMemoryCallTransitions(t *testing.T) {
+	testCallTransitions(t, NewMemory())
+}
+
+func TestMemoryCallCategoriesAndTags(t *testing.T) {
+	testCallCategoriesAndTags(t, NewMemory())
+}
+
+func TestMemoryCallLocations(t *testing.T) {
+	testCallLocations(t, NewMemory())
+}
+
+func TestMemoryVolunteerRepository(t *testing.T) {
+	testVolunteerRepository(t, NewMemory())
+}
+
+func TestMemoryCategoryRepository(t *testing.T) {
+	testCategoryRepository(t, NewMemory())
+}
+
+func TestMemoryResponseRepository(t *testing.T) {
+	testResponseRepository(t, NewMemory())
+}
+
+func TestMemoryRoleRepository(t *testing.T) {
+	testRoleRepository(t, NewMemory())
+}
+
+func TestMemoryRecoveryCodeRepository(t *testing.T) {
+	testRecoveryCodeRepository(t, NewMemory())
+}
+
+func TestMemoryOrganizationRepository(t *testing.T) {
+	testOrganizationRepository(t, NewMemory())
+}
+
+func TestMemoryAPIKeyRepository(t *testing.T) {
+	testAPIKeyRepository(t, NewMemory())
+}
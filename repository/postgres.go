@@ -0,0 +1,670 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pageza/vet-app/geo"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NewPostgres returns repositories backed by the given database connection.
+func NewPostgres(db *gorm.DB) Repositories {
+	return Repositories{
+		Users:         &postgresUsers{db: db},
+		Calls:         &postgresCalls{db: db},
+		Responses:     &postgresResponses{db: db},
+		Categories:    &postgresCategories{db: db},
+		Volunteers:    &postgresVolunteers{db: db},
+		Roles:         &postgresRoles{db: db},
+		RecoveryCodes: &postgresRecoveryCodes{db: db},
+		Organizations: &postgresOrganizations{db: db},
+		APIKeys:       &postgresAPIKeys{db: db},
+	}
+}
+
+type postgresUsers struct {
+	db *gorm.DB
+}
+
+func (r *postgresUsers) List(ctx context.Context, filter UserFilter, page pagination.Params) ([]models.User, error) {
+	query := r.db.WithContext(ctx).Model(&models.User{})
+	if filter.Email != "" {
+		query = query.Where("email = ?", filter.Email)
+	}
+	if filter.IDmeSubject != "" {
+		query = query.Where("idme_subject = ?", filter.IDmeSubject)
+	}
+	if filter.Role != "" {
+		query = query.Where("id IN (SELECT user_roles.user_id FROM user_roles JOIN roles ON roles.id = user_roles.role_id WHERE roles.name = ?)", filter.Role)
+	}
+	if filter.ExcludeDeleting {
+		query = query.Where("deletion_requested_at IS NULL")
+	}
+	if filter.DeletionRequestedBefore != nil {
+		query = query.Where("deletion_requested_at < ?", *filter.DeletionRequestedBefore)
+	}
+
+	users := []models.User{}
+	err := page.Scope(query).Find(&users).Error
+	return users, err
+}
+
+func (r *postgresUsers) Get(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *postgresUsers) Create(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r *postgresUsers) Update(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Save(user).Error
+}
+
+func (r *postgresUsers) Delete(ctx context.Context, id uint) error {
+	return deleteByID(r.db.WithContext(ctx), &models.User{}, id)
+}
+
+// activeAuthor matches rows whose user has not asked for their account to
+// be deleted.
+const activeAuthor = "user_id IN (SELECT id FROM users WHERE deletion_requested_at IS NULL)"
+
+type postgresCalls struct {
+	db *gorm.DB
+}
+
+// withCallAssociations loads the associations calls are returned with.
+func withCallAssociations(db *gorm.DB) *gorm.DB {
+	return db.Preload("User").Preload("Category").Preload("Tags", orderByName)
+}
+
+func (r *postgresCalls) List(ctx context.Context, filter CallFilter, page pagination.Params) ([]models.Call, error) {
+	query := withCallAssociations(r.db.WithContext(ctx).Model(&models.Call{}))
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if len(filter.Statuses) > 0 {
+		query = query.Where("status IN ?", filter.Statuses)
+	}
+	if len(filter.Categories) > 0 {
+		query = query.Where("category_id IN (SELECT id FROM categories WHERE slug IN ?)", filter.Categories)
+	}
+	if len(filter.Tags) > 0 {
+		query = query.Where("id IN (SELECT call_tags.call_id FROM call_tags JOIN tags ON tags.id = call_tags.tag_id WHERE tags.name IN ?)", filter.Tags)
+	}
+	if filter.VeteranOnly != nil {
+		query = query.Where("veteran_only = ?", *filter.VeteranOnly)
+	}
+	if filter.Urgent != nil {
+		query = query.Where("urgent = ?", *filter.Urgent)
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *filter.CreatedBefore)
+	}
+	if filter.Located != nil {
+		if *filter.Located {
+			query = query.Where("public_latitude IS NOT NULL")
+		} else {
+			query = query.Where("public_latitude IS NULL")
+		}
+	}
+	if filter.Near != nil {
+		query = query.Table("(?) AS calls", callsNear(r.db.WithContext(ctx), *filter.Near)).
+			Where("distance <= ?", filter.Near.Radius)
+	}
+	if filter.ExcludeDeleting {
+		query = query.Where(activeAuthor)
+	}
+
+	calls := []models.Call{}
+	err := page.Scope(query).Find(&calls).Error
+	return calls, err
+}
+
+// distanceFrom returns the haversine distance in miles of the position in
+// the given columns from a point given as latitude, latitude and longitude.
+func distanceFrom(lat, lng string) string {
+	return fmt.Sprintf("%v * 2 * asin(sqrt("+
+		"power(sin(radians(%[2]s - ?) / 2), 2) + "+
+		"cos(radians(?)) * cos(radians(%[2]s)) * power(sin(radians(%[3]s - ?) / 2), 2)))", geo.EarthRadius, lat, lng)
+}
+
+// callDistance is the distance of a call's public location from a point.
+var callDistance = distanceFrom("public_latitude", "public_longitude")
+
+// callsNear selects the calls whose public location lies in the bounding
+// box of area, with their distance from its center.
+func callsNear(db *gorm.DB, area geo.Circle) *gorm.DB {
+	min, max := area.Bounds()
+	center := area.Center
+	return db.Model(&models.Call{}).
+		Select("*, "+callDistance+" AS distance", center.Lat, center.Lat, center.Lng).
+		Where("public_latitude BETWEEN ? AND ? AND public_longitude BETWEEN ? AND ?", min.Lat, max.Lat, min.Lng, max.Lng)
+}
+
+func (r *postgresCalls) Get(ctx context.Context, id uint) (*models.Call, error) {
+	var call models.Call
+	if err := withCallAssociations(r.db.WithContext(ctx)).First(&call, id).Error; err != nil {
+		return nil, err
+	}
+	return &call, nil
+}
+
+func (r *postgresCalls) Create(ctx context.Context, call *models.Call) error {
+	if call.Status == "" {
+		call.Status = models.CallStatusOpen
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("User", "ClaimedBy", "Category", "Tags").Create(call).Error; err != nil {
+			return err
+		}
+		return saveCallTags(tx, call)
+	})
+}
+
+func (r *postgresCalls) Update(ctx context.Context, call *models.Call) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("User", "ClaimedBy", "Category", "Tags", "Status", "ClaimedByID", "Urgent").Save(call).Error; err != nil {
+			return err
+		}
+		return saveCallTags(tx, call)
+	})
+}
+
+// saveCallTags replaces the tags of call with call.Tags, creating the ones
+// that do not exist yet, and fills them in as they are stored.
+func saveCallTags(tx *gorm.DB, call *models.Call) error {
+	if err := tx.Where("call_id = ?", call.ID).Delete(&callTag{}).Error; err != nil {
+		return err
+	}
+	names := make([]string, 0, len(call.Tags))
+	for name := range uniqueStrings(tagNames(call.Tags)) {
+		names = append(names, name)
+	}
+	call.Tags = []models.Tag{}
+	if len(names) == 0 {
+		return nil
+	}
+
+	tags := make([]models.Tag, len(names))
+	for i, name := range names {
+		tags[i] = models.Tag{Name: name}
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("name IN ?", names).Order("name").Find(&call.Tags).Error; err != nil {
+		return err
+	}
+	for _, tag := range call.Tags {
+		if err := tx.Create(&callTag{CallID: call.ID, TagID: tag.ID}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *postgresCalls) Delete(ctx context.Context, id uint) error {
+	return deleteByID(r.db.WithContext(ctx), &models.Call{}, id)
+}
+
+func (r *postgresCalls) MarkUrgent(ctx context.Context, id uint) (bool, error) {
+	db := r.db.WithContext(ctx)
+	result := db.Model(&models.Call{}).Where("id = ? AND NOT urgent", id).Update("urgent", true)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+	var count int64
+	if err := db.Model(&models.Call{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return false, ErrNotFound
+	}
+	return false, nil
+}
+
+func (r *postgresCalls) Transition(ctx context.Context, call *models.Call, change *models.CallStatusChange) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Call{}).
+			Where("id = ? AND status = ?", call.ID, change.FromStatus).
+			Updates(map[string]interface{}{"status": call.Status, "claimed_by_id": call.ClaimedByID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			var count int64
+			if err := tx.Model(&models.Call{}).Where("id = ?", call.ID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return ErrNotFound
+			}
+			return ErrStale
+		}
+		change.CallID = call.ID
+		return tx.Omit("Call", "User").Create(change).Error
+	})
+}
+
+func (r *postgresCalls) History(ctx context.Context, callID uint) ([]models.CallStatusChange, error) {
+	changes := []models.CallStatusChange{}
+	err := r.db.WithContext(ctx).Where("call_id = ?", callID).Order("created_at, id").Find(&changes).Error
+	return changes, err
+}
+
+type postgresResponses struct {
+	db *gorm.DB
+}
+
+func (r *postgresResponses) List(ctx context.Context, filter ResponseFilter, page pagination.Params) ([]models.Response, error) {
+	query := r.db.WithContext(ctx).Model(&models.Response{}).Preload("User").Preload("Call")
+	if filter.CallID != 0 {
+		query = query.Where("call_id = ?", filter.CallID)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.CallVeteranOnly != nil {
+		query = query.Where("call_id IN (SELECT id FROM calls WHERE veteran_only = ?)", *filter.CallVeteranOnly)
+	}
+	if filter.Hidden != nil {
+		if *filter.Hidden {
+			query = query.Where("hidden_at IS NOT NULL")
+		} else {
+			query = query.Where("hidden_at IS NULL")
+		}
+	}
+	if filter.ExcludeDeleting {
+		query = query.Where(activeAuthor)
+	}
+
+	responses := []models.Response{}
+	err := page.Scope(query).Find(&responses).Error
+	return responses, err
+}
+
+func (r *postgresResponses) Get(ctx context.Context, id uint) (*models.Response, error) {
+	var response models.Response
+	if err := r.db.WithContext(ctx).Preload("User").Preload("Call").First(&response, id).Error; err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func (r *postgresResponses) Create(ctx context.Context, response *models.Response) error {
+	return r.db.WithContext(ctx).Omit("User", "Call", "HiddenBy").Create(response).Error
+}
+
+func (r *postgresResponses) Update(ctx context.Context, response *models.Response) error {
+	return r.db.WithContext(ctx).Omit("User", "Call", "HiddenBy").Save(response).Error
+}
+
+func (r *postgresResponses) Delete(ctx context.Context, id uint) error {
+	return deleteByID(r.db.WithContext(ctx), &models.Response{}, id)
+}
+
+type postgresCategories struct {
+	db *gorm.DB
+}
+
+func (r *postgresCategories) List(ctx context.Context) ([]models.Category, error) {
+	categories := []models.Category{}
+	err := r.db.WithContext(ctx).Order("name").Find(&categories).Error
+	return categories, err
+}
+
+func (r *postgresCategories) Get(ctx context.Context, slug string) (*models.Category, error) {
+	var category models.Category
+	if err := r.db.WithContext(ctx).Where("slug = ?", slug).First(&category).Error; err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (r *postgresCategories) Create(ctx context.Context, category *models.Category) error {
+	return r.db.WithContext(ctx).Create(category).Error
+}
+
+func (r *postgresCategories) Update(ctx context.Context, category *models.Category) error {
+	return r.db.WithContext(ctx).Save(category).Error
+}
+
+func (r *postgresCategories) Delete(ctx context.Context, slug string) error {
+	result := r.db.WithContext(ctx).Where("slug = ?", slug).Delete(&models.Category{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type postgresVolunteers struct {
+	db *gorm.DB
+}
+
+// volunteerDistance is the distance of the center of a volunteer's service
+// area from a point.
+var volunteerDistance = distanceFrom("latitude", "longitude")
+
+func (r *postgresVolunteers) List(ctx context.Context, filter VolunteerFilter, page pagination.Params) ([]models.VolunteerProfile, error) {
+	query := r.db.WithContext(ctx).Model(&models.VolunteerProfile{}).Preload("User")
+	if filter.Paused != nil {
+		query = query.Where("paused = ?", *filter.Paused)
+	}
+	if p := filter.Serving; p != nil {
+		query = query.Where("(latitude IS NULL OR service_radius <= 0 OR "+volunteerDistance+" <= service_radius)", p.Lat, p.Lat, p.Lng)
+	}
+	if filter.ExcludeDeleting {
+		query = query.Where(activeAuthor)
+	}
+
+	profiles := []models.VolunteerProfile{}
+	err := page.Scope(query).Find(&profiles).Error
+	return profiles, err
+}
+
+func (r *postgresVolunteers) Get(ctx context.Context, userID uint) (*models.VolunteerProfile, error) {
+	var profile models.VolunteerProfile
+	if err := r.db.WithContext(ctx).Preload("User").Where("user_id = ?", userID).First(&profile).Error; err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (r *postgresVolunteers) Save(ctx context.Context, profile *models.VolunteerProfile) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing models.VolunteerProfile
+		err := tx.Where("user_id = ?", profile.UserID).First(&existing).Error
+		switch {
+		case err == nil:
+			profile.ID, profile.CreatedAt = existing.ID, existing.CreatedAt
+			return tx.Omit("User").Save(profile).Error
+		case errors.Is(err, ErrNotFound):
+			profile.ID = 0
+			return tx.Omit("User").Create(profile).Error
+		}
+		return err
+	})
+}
+
+func (r *postgresVolunteers) Delete(ctx context.Context, userID uint) error {
+	result := r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.VolunteerProfile{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type postgresRoles struct {
+	db *gorm.DB
+}
+
+func (r *postgresRoles) List(ctx context.Context) ([]models.Role, error) {
+	roles := []models.Role{}
+	err := r.db.WithContext(ctx).Preload("Permissions", orderByName).Order("name").Find(&roles).Error
+	return roles, err
+}
+
+func (r *postgresRoles) Get(ctx context.Context, name string) (*models.Role, error) {
+	var role models.Role
+	err := r.db.WithContext(ctx).Preload("Permissions", orderByName).Where("name = ?", name).First(&role).Error
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *postgresRoles) Permissions(ctx context.Context) ([]models.Permission, error) {
+	permissions := []models.Permission{}
+	err := r.db.WithContext(ctx).Order("name").Find(&permissions).Error
+	return permissions, err
+}
+
+func (r *postgresRoles) SetPermissions(ctx context.Context, name string, names []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var role models.Role
+		if err := tx.Where("name = ?", name).First(&role).Error; err != nil {
+			return err
+		}
+		permissions := []models.Permission{}
+		if len(names) > 0 {
+			if err := tx.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+				return err
+			}
+		}
+		if len(permissions) != len(uniqueStrings(names)) {
+			return ErrForeignKey
+		}
+		if err := tx.Where("role_id = ?", role.ID).Delete(&rolePermission{}).Error; err != nil {
+			return err
+		}
+		for _, permission := range permissions {
+			if err := tx.Create(&rolePermission{RoleID: role.ID, PermissionID: permission.ID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *postgresRoles) UserRoles(ctx context.Context, userID uint) ([]string, error) {
+	names := []string{}
+	err := r.db.WithContext(ctx).Model(&models.Role{}).
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").
+		Pluck("roles.name", &names).Error
+	return names, err
+}
+
+func (r *postgresRoles) Grant(ctx context.Context, userID uint, name string) error {
+	db := r.db.WithContext(ctx)
+	var role models.Role
+	if err := db.Where("name = ?", name).First(&role).Error; err != nil {
+		return err
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).
+		Omit("User", "Role").
+		Create(&models.UserRole{UserID: userID, RoleID: role.ID}).Error
+}
+
+func (r *postgresRoles) Revoke(ctx context.Context, userID uint, name string) error {
+	result := r.db.WithContext(ctx).
+		Where("user_id = ? AND role_id IN (SELECT id FROM roles WHERE name = ?)", userID, name).
+		Delete(&models.UserRole{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type postgresRecoveryCodes struct {
+	db *gorm.DB
+}
+
+func (r *postgresRecoveryCodes) Replace(ctx context.Context, userID uint, hashes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(hashes) == 0 {
+			return nil
+		}
+		codes := make([]models.RecoveryCode, len(hashes))
+		for i, hash := range hashes {
+			codes[i] = models.RecoveryCode{UserID: userID, CodeHash: hash}
+		}
+		return tx.Omit("User").Create(&codes).Error
+	})
+}
+
+func (r *postgresRecoveryCodes) Use(ctx context.Context, userID uint, hash string, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *postgresRecoveryCodes) Remaining(ctx context.Context, userID uint) (int, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return int(count), err
+}
+
+type postgresOrganizations struct {
+	db *gorm.DB
+}
+
+func (r *postgresOrganizations) List(ctx context.Context) ([]models.Organization, error) {
+	orgs := []models.Organization{}
+	err := r.db.WithContext(ctx).Order("name").Find(&orgs).Error
+	return orgs, err
+}
+
+func (r *postgresOrganizations) Get(ctx context.Context, id uint) (*models.Organization, error) {
+	var org models.Organization
+	if err := r.db.WithContext(ctx).First(&org, id).Error; err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *postgresOrganizations) Create(ctx context.Context, org *models.Organization) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org.User).Error; err != nil {
+			return err
+		}
+		org.UserID = org.User.ID
+		return tx.Omit("User").Create(org).Error
+	})
+}
+
+type postgresAPIKeys struct {
+	db *gorm.DB
+}
+
+func (r *postgresAPIKeys) List(ctx context.Context, organizationID uint) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	err := r.db.WithContext(ctx).Preload("Organization").
+		Where("organization_id = ?", organizationID).
+		Order("id").
+		Find(&keys).Error
+	return keys, err
+}
+
+func (r *postgresAPIKeys) Get(ctx context.Context, id uint) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.db.WithContext(ctx).Preload("Organization").First(&key, id).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *postgresAPIKeys) GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.db.WithContext(ctx).Preload("Organization").Where("prefix = ?", prefix).First(&key).Error
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *postgresAPIKeys) Create(ctx context.Context, key *models.APIKey) error {
+	return r.db.WithContext(ctx).Omit("Organization").Create(key).Error
+}
+
+func (r *postgresAPIKeys) Revoke(ctx context.Context, id uint, at time.Time) error {
+	result := r.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ?", id).
+		Update("revoked_at", gorm.Expr("COALESCE(revoked_at, ?)", at))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *postgresAPIKeys) Touch(ctx context.Context, id uint, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
+
+// rolePermission is a row of the role_permissions join table.
+type rolePermission struct {
+	RoleID       uint
+	PermissionID uint
+}
+
+func (rolePermission) TableName() string { return "role_permissions" }
+
+// callTag is a row of the call_tags join table.
+type callTag struct {
+	CallID uint
+	TagID  uint
+}
+
+func (callTag) TableName() string { return "call_tags" }
+
+func tagNames(tags []models.Tag) []string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	return names
+}
+
+func orderByName(db *gorm.DB) *gorm.DB {
+	return db.Order("name")
+}
+
+func uniqueStrings(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// deleteByID deletes the row of model with the given ID, returning
+// ErrNotFound if there is none.
+func deleteByID(db *gorm.DB, model interface{}, id uint) error {
+	result := db.Delete(model, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
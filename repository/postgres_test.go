@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/pageza/vet-app/db"
+)
+
+func setupPostgres(t *testing.T) Repositories {
+	db.SetupDB(t)
+	return NewPostgres(db.DB)
+}
+
+func TestPostgresUserRepository(t *testing.T) {
+	testUserRepository(t, setupPostgres(t))
+}
+
+func TestPostgresDeletingUsers(t *testing.T) {
+	testDeletingUsers(t, setupPostgres(t))
+}
+
+func TestPostgresCallRepository(t *testing.T) {
+	testCallRepository(t, setupPostgres(t))
+}
+
+func TestPostgresCallTransitions(t *testing.T) {
+	testCallTransitions(t, setupPostgres(t))
+}
+
+func TestPostgresCallCategoriesAndTags(t *testing.T) {
+	testCallCategoriesAndTags(t, setupPostgres(t))
+}
+
+func TestPostgresCallLocations(t *testing.T) {
+	testCallLocations(t, setupPostgres(t))
+}
+
+func TestPostgresVolunteerRepository(t *testing.T) {
+	testVolunteerRepository(t, setupPostgres(t))
+}
+
+func TestPostgresCategoryRepository(t *testing.T) {
+	testCategoryRepository(t, setupPostgres(t))
+}
+
+func TestPostgresResponseRepository(t *testing.T) {
+	testResponseRepository(t, setupPostgres(t))
+}
+
+func TestPostgresRoleRepository(t *testing.T) {
+	testRoleRepository(t, setupPostgres(t))
+}
+
+func TestPostgresRecoveryCodeRepository(t *testing.T) {
+	testRecoveryCodeRepository(t, setupPostgres(t))
+}
+
+func TestPostgresOrganizationRepository(t *testing.T) {
+	testOrganizationRepository(t, setupPostgres(t))
+}
+
+func TestPostgresAPIKeyRepository(t *testing.T) {
+	testAPIKeyRepository(t, setupPostgres(t))
+}
@@ -0,0 +1,245 @@
+// Package repository defines the storage interfaces used by the HTTP
+// handlers, with a Postgres implementation for production and an in-memory
+// implementation for tests.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pageza/vet-app/geo"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"gorm.io/gorm"
+)
+
+// Errors returned by every implementation. They are the GORM sentinel errors
+// so that apierr maps them the same way regardless of the backing store.
+var (
+	ErrNotFound   = gorm.ErrRecordNotFound
+	ErrDuplicate  = gorm.ErrDuplicatedKey
+	ErrForeignKey = gorm.ErrForeignKeyViolated
+)
+
+// ErrStale is returned when a row changed between being read and being
+// written.
+var ErrStale = errors.New("record was changed by someone else")
+
+// UserFilter narrows the users returned by UserRepository.List. Zero values
+// match everything.
+type UserFilter struct {
+	Email       string
+	IDmeSubject string
+	// Role matches users who were granted the role.
+	Role string
+	// ExcludeDeleting leaves out users who asked for their account to be
+	// deleted.
+	ExcludeDeleting bool
+	// DeletionRequestedBefore matches users who asked for their account to
+	// be deleted before the given time.
+	DeletionRequestedBefore *time.Time
+}
+
+// CallFilter narrows the calls returned by CallRepository.List. Zero values
+// match everything.
+type CallFilter struct {
+	UserID uint
+	// Statuses matches calls in any of the given statuses.
+	Statuses []string
+	// Categories matches calls in any of the categories with the given
+	// slugs.
+	Categories []string
+	// Tags matches calls with any of the given tags.
+	Tags          []string
+	VeteranOnly   *bool
+	Urgent        *bool
+	CreatedBefore *time.Time
+	// Near matches calls whose public location lies in the circle and fills
+	// in their Distance from its center, so they can be sorted by
+	// pagination.SortDistance.
+	Near *geo.Circle
+	// Located matches calls by whether they have a public location.
+	Located *bool
+	// ExcludeDeleting leaves out calls by users who asked for their account
+	// to be deleted.
+	ExcludeDeleting bool
+}
+
+// VolunteerFilter narrows the profiles returned by
+// VolunteerRepository.List. Zero values match everything.
+type VolunteerFilter struct {
+	Paused *bool
+	// Serving matches volunteers whose service area holds the point, along
+	// with those who did not limit their service area.
+	Serving *geo.Point
+	// ExcludeDeleting leaves out volunteers who asked for their account to
+	// be deleted.
+	ExcludeDeleting bool
+}
+
+// ResponseFilter narrows the responses returned by ResponseRepository.List.
+// Zero values match everything.
+type ResponseFilter struct {
+	CallID uint
+	UserID uint
+	// CallVeteranOnly matches responses by whether their call is
+	// veteran-only.
+	CallVeteranOnly *bool
+	Hidden          *bool
+	// ExcludeDeleting leaves out responses by users who asked for their
+	// account to be deleted.
+	ExcludeDeleting bool
+}
+
+// List methods return at most page.Limit+1 items so that callers can build
+// a pagination.Page from the result.
+
+// UserRepository stores users.
+type UserRepository interface {
+	List(ctx context.Context, filter UserFilter, page pagination.Params) ([]models.User, error)
+	Get(ctx context.Context, id uint) (*models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	Update(ctx context.Context, user *models.User) error
+	// Delete removes a user along with their calls and responses.
+	Delete(ctx context.Context, id uint) error
+}
+
+// CallRepository stores calls. Calls are returned with their User, Category
+// and Tags populated, the tags ordered by name.
+type CallRepository interface {
+	List(ctx context.Context, filter CallFilter, page pagination.Params) ([]models.Call, error)
+	Get(ctx context.Context, id uint) (*models.Call, error)
+	// Create stores a call, which is open unless it has another status,
+	// along with its tags. Tags are matched by name and created if they
+	// are new. It returns ErrForeignKey if the category does not exist.
+	Create(ctx context.Context, call *models.Call) error
+	// Update saves a call's details and replaces its tags. Its status and
+	// claimer are only changed by Transition, and whether it is urgent by
+	// MarkUrgent.
+	Update(ctx context.Context, call *models.Call) error
+	// MarkUrgent marks a call urgent, reporting whether it was not urgent
+	// already. It returns ErrNotFound if the call does not exist.
+	MarkUrgent(ctx context.Context, id uint) (bool, error)
+	// Delete removes a call along with its responses.
+	Delete(ctx context.Context, id uint) error
+	// Transition saves call's new Status and ClaimedByID and records change,
+	// as long as the call's status is still change.FromStatus. It returns
+	// ErrNotFound if the call does not exist and ErrStale if its status
+	// changed since it was read.
+	Transition(ctx context.Context, call *models.Call, change *models.CallStatusChange) error
+	// History returns a call's status changes, oldest first.
+	History(ctx context.Context, callID uint) ([]models.CallStatusChange, error)
+}
+
+// ResponseRepository stores responses. Responses are returned with their
+// User and Call populated.
+type ResponseRepository interface {
+	List(ctx context.Context, filter ResponseFilter, page pagination.Params) ([]models.Response, error)
+	Get(ctx context.Context, id uint) (*models.Response, error)
+	Create(ctx context.Context, response *models.Response) error
+	Update(ctx context.Context, response *models.Response) error
+	Delete(ctx context.Context, id uint) error
+}
+
+// CategoryRepository stores call categories.
+type CategoryRepository interface {
+	// List returns every category ordered by name.
+	List(ctx context.Context) ([]models.Category, error)
+	Get(ctx context.Context, slug string) (*models.Category, error)
+	// Create inserts a category, returning ErrDuplicate if the slug is
+	// taken.
+	Create(ctx context.Context, category *models.Category) error
+	Update(ctx context.Context, category *models.Category) error
+	// Delete removes a category, returning ErrForeignKey if calls are
+	// still in it.
+	Delete(ctx context.Context, slug string) error
+}
+
+// RoleRepository stores roles, the permissions they grant and the users
+// they were granted to. Roles are returned with their Permissions populated,
+// both ordered by name.
+type RoleRepository interface {
+	List(ctx context.Context) ([]models.Role, error)
+	Get(ctx context.Context, name string) (*models.Role, error)
+	// Permissions returns every known permission.
+	Permissions(ctx context.Context) ([]models.Permission, error)
+	// SetPermissions replaces the permissions a role grants. It returns
+	// ErrForeignKey if any of them is unknown.
+	SetPermissions(ctx context.Context, role string, permissions []string) error
+	// UserRoles returns the names of the roles granted to a user.
+	UserRoles(ctx context.Context, userID uint) ([]string, error)
+	// Grant gives a user a role. Granting a role the user already has is not
+	// an error.
+	Grant(ctx context.Context, userID uint, role string) error
+	// Revoke takes a role away from a user, returning ErrNotFound if they
+	// did not have it.
+	Revoke(ctx context.Context, userID uint, role string) error
+}
+
+// RecoveryCodeRepository stores the hashes of users' two-factor recovery
+// codes.
+type RecoveryCodeRepository interface {
+	// Replace discards a user's recovery codes and stores hashes instead.
+	// It returns ErrForeignKey if the user does not exist.
+	Replace(ctx context.Context, userID uint, hashes []string) error
+	// Use marks the unused code with the given hash as used at the given
+	// time, returning ErrNotFound if there is none. A code can only be used
+	// once even by concurrent callers.
+	Use(ctx context.Context, userID uint, hash string, at time.Time) error
+	// Remaining counts a user's unused codes.
+	Remaining(ctx context.Context, userID uint) (int, error)
+}
+
+// VolunteerRepository stores volunteer profiles, at most one per user.
+// Profiles are returned with their User populated.
+type VolunteerRepository interface {
+	List(ctx context.Context, filter VolunteerFilter, page pagination.Params) ([]models.VolunteerProfile, error)
+	// Get returns a user's profile, or ErrNotFound if they have none.
+	Get(ctx context.Context, userID uint) (*models.VolunteerProfile, error)
+	// Save creates or replaces a user's profile. It returns ErrForeignKey if
+	// the user does not exist.
+	Save(ctx context.Context, profile *models.VolunteerProfile) error
+	Delete(ctx context.Context, userID uint) error
+}
+
+// OrganizationRepository stores partner organizations.
+type OrganizationRepository interface {
+	// List returns every organization ordered by name.
+	List(ctx context.Context) ([]models.Organization, error)
+	Get(ctx context.Context, id uint) (*models.Organization, error)
+	// Create inserts an organization along with its service account, User.
+	// It returns ErrDuplicate if the name or the user's email is taken.
+	Create(ctx context.Context, org *models.Organization) error
+}
+
+// APIKeyRepository stores API keys. Keys are returned with their
+// Organization populated.
+type APIKeyRepository interface {
+	// List returns the keys of an organization in the order they were
+	// created, including revoked and expired ones.
+	List(ctx context.Context, organizationID uint) ([]models.APIKey, error)
+	Get(ctx context.Context, id uint) (*models.APIKey, error)
+	GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	// Create inserts a key, returning ErrForeignKey if its organization
+	// does not exist.
+	Create(ctx context.Context, key *models.APIKey) error
+	// Revoke marks a key as revoked at the given time. Revoking a revoked
+	// key keeps the original time.
+	Revoke(ctx context.Context, id uint, at time.Time) error
+	// Touch records that a key was used at the given time.
+	Touch(ctx context.Context, id uint, at time.Time) error
+}
+
+// Repositories bundles one implementation of each repository.
+type Repositories struct {
+	Users         UserRepository
+	Calls         CallRepository
+	Responses     ResponseRepository
+	Categories    CategoryRepository
+	Volunteers    VolunteerRepository
+	Roles         RoleRepository
+	RecoveryCodes RecoveryCodeRepository
+	Organizations OrganizationRepository
+	APIKeys       APIKeyRepository
+}
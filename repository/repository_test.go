@@ -0,0 +1,684 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pageza/vet-app/geo"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/pagination"
+	"github.com/stretchr/testify/assert"
+)
+
+// The tests in this file run against every implementation so that the
+// in-memory repositories stay faithful to the Postgres ones.
+
+var ctx = context.Background()
+
+var firstPage = pagination.Params{Limit: pagination.DefaultLimit, Sort: pagination.SortID}
+
+func testUserRepository(t *testing.T, repos Repositories) {
+	user := models.User{Name: "John Doe", Email: "john@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, &user))
+	assert.NotZero(t, user.ID)
+	assert.False(t, user.CreatedAt.IsZero())
+
+	duplicate := models.User{Name: "Jane Doe", Email: "john@example.com"}
+	assert.ErrorIs(t, repos.Users.Create(ctx, &duplicate), ErrDuplicate)
+
+	user.Name = "Johnny Doe"
+	assert.NoError(t, repos.Users.Update(ctx, &user))
+
+	fetched, err := repos.Users.Get(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Johnny Doe", fetched.Name)
+
+	users, err := repos.Users.List(ctx, UserFilter{Email: "john@example.com"}, firstPage)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+
+	subject := "idme-123"
+	user.IDmeSubject = &subject
+	assert.NoError(t, repos.Users.Update(ctx, &user))
+	users, err = repos.Users.List(ctx, UserFilter{IDmeSubject: subject}, firstPage)
+	assert.NoError(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, user.ID, users[0].ID)
+	}
+	other := models.User{Name: "Jane Doe", Email: "jane@example.com", IDmeSubject: &subject}
+	assert.ErrorIs(t, repos.Users.Create(ctx, &other), ErrDuplicate)
+
+	assert.NoError(t, repos.Users.Delete(ctx, user.ID))
+	assert.ErrorIs(t, repos.Users.Delete(ctx, user.ID), ErrNotFound)
+	_, err = repos.Users.Get(ctx, user.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func testDeletingUsers(t *testing.T, repos Repositories) {
+	requested := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	leaving := models.User{Name: "John Doe", Email: "john@example.com", DeletionRequestedAt: &requested}
+	staying := models.User{Name: "Jane Doe", Email: "jane@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, &leaving))
+	assert.NoError(t, repos.Users.Create(ctx, &staying))
+	for _, user := range []models.User{leaving, staying} {
+		call := models.Call{UserID: user.ID, Desc: "Need a ride"}
+		assert.NoError(t, repos.Calls.Create(ctx, &call))
+		assert.NoError(t, repos.Responses.Create(ctx, &models.Response{CallID: call.ID, UserID: user.ID, Msg: "Bump"}))
+	}
+
+	users, err := repos.Users.List(ctx, UserFilter{ExcludeDeleting: true}, firstPage)
+	assert.NoError(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, staying.ID, users[0].ID)
+	}
+	calls, err := repos.Calls.List(ctx, CallFilter{ExcludeDeleting: true}, firstPage)
+	assert.NoError(t, err)
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, staying.ID, calls[0].UserID)
+	}
+	responses, err := repos.Responses.List(ctx, ResponseFilter{ExcludeDeleting: true}, firstPage)
+	assert.NoError(t, err)
+	if assert.Len(t, responses, 1) {
+		assert.Equal(t, staying.ID, responses[0].UserID)
+	}
+
+	before := time.Now().Add(-24 * time.Hour)
+	users, err = repos.Users.List(ctx, UserFilter{DeletionRequestedBefore: &before}, firstPage)
+	assert.NoError(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, leaving.ID, users[0].ID)
+		assert.True(t, users[0].DeletionRequestedAt.Equal(requested))
+	}
+	before = time.Now().Add(-72 * time.Hour)
+	users, err = repos.Users.List(ctx, UserFilter{DeletionRequestedBefore: &before}, firstPage)
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+}
+
+func testCallRepository(t *testing.T, repos Repositories) {
+	user := models.User{Name: "John Doe", Email: "john@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, &user))
+
+	assert.ErrorIs(t, repos.Calls.Create(ctx, &models.Call{UserID: user.ID + 1000, Desc: "Orphan"}), ErrForeignKey)
+
+	for _, desc := range []string{"Need a ride", "Help moving", "Paperwork"} {
+		assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: user.ID, Desc: desc}))
+	}
+
+	page := pagination.Params{Limit: 1, Sort: pagination.SortID, Desc: true}
+	calls, err := repos.Calls.List(ctx, CallFilter{UserID: user.ID}, page)
+	assert.NoError(t, err)
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, "Paperwork", calls[0].Desc)
+		assert.Equal(t, "John Doe", calls[0].User.Name)
+	}
+
+	page.After = &pagination.Cursor{Sort: pagination.SortID, Desc: true, ID: calls[0].ID}
+	calls, err = repos.Calls.List(ctx, CallFilter{UserID: user.ID}, page)
+	assert.NoError(t, err)
+	if assert.Len(t, calls, 2) {
+		assert.Equal(t, "Help moving", calls[0].Desc)
+	}
+
+	call := calls[0]
+	assert.Equal(t, models.CallStatusOpen, call.Status)
+	assert.NoError(t, repos.Calls.Transition(ctx, &models.Call{ID: call.ID, Status: models.CallStatusClosed},
+		&models.CallStatusChange{FromStatus: models.CallStatusOpen, ToStatus: models.CallStatusClosed}))
+
+	calls, err = repos.Calls.List(ctx, CallFilter{Statuses: models.ClosedCallStatuses}, firstPage)
+	assert.NoError(t, err)
+	assert.Len(t, calls, 1)
+	calls, err = repos.Calls.List(ctx, CallFilter{Statuses: []string{models.CallStatusOpen}}, firstPage)
+	assert.NoError(t, err)
+	assert.Len(t, calls, 2)
+
+	// Updating a call leaves its status alone.
+	call.Desc = "Help moving house"
+	assert.NoError(t, repos.Calls.Update(ctx, &call))
+	fetched, err := repos.Calls.Get(ctx, call.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Help moving house", fetched.Desc)
+	assert.Equal(t, models.CallStatusClosed, fetched.Status)
+
+	before := time.Now().Add(time.Hour)
+	calls, err = repos.Calls.List(ctx, CallFilter{CreatedBefore: &before}, firstPage)
+	assert.NoError(t, err)
+	assert.Len(t, calls, 3)
+	before = time.Now().Add(-time.Hour)
+	calls, err = repos.Calls.List(ctx, CallFilter{CreatedBefore: &before}, firstPage)
+	assert.NoError(t, err)
+	assert.Empty(t, calls)
+
+	marked, err := repos.Calls.MarkUrgent(ctx, call.ID)
+	assert.NoError(t, err)
+	assert.True(t, marked)
+	marked, err = repos.Calls.MarkUrgent(ctx, call.ID)
+	assert.NoError(t, err)
+	assert.False(t, marked)
+	_, err = repos.Calls.MarkUrgent(ctx, call.ID+1000)
+	assert.ErrorIs(t, err, ErrNotFound)
+	urgent := true
+	calls, err = repos.Calls.List(ctx, CallFilter{Urgent: &urgent}, firstPage)
+	assert.NoError(t, err)
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, call.ID, calls[0].ID)
+	}
+	// Updating a call leaves it urgent.
+	assert.NoError(t, repos.Calls.Update(ctx, &call))
+	fetched, err = repos.Calls.Get(ctx, call.ID)
+	assert.NoError(t, err)
+	assert.True(t, fetched.Urgent)
+
+	assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: user.ID, Desc: "Vets only", VeteranOnly: true}))
+	veteranOnly := true
+	calls, err = repos.Calls.List(ctx, CallFilter{VeteranOnly: &veteranOnly}, firstPage)
+	assert.NoError(t, err)
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, "Vets only", calls[0].Desc)
+	}
+
+	assert.NoError(t, repos.Calls.Delete(ctx, call.ID))
+	_, err = repos.Calls.Get(ctx, call.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func testCallTransitions(t *testing.T, repos Repositories) {
+	owner := models.User{Name: "John Doe", Email: "john@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, &owner))
+	volunteer := models.User{Name: "Jane Doe", Email: "jane@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, &volunteer))
+	call := models.Call{UserID: owner.ID, Desc: "Need a ride"}
+	assert.NoError(t, repos.Calls.Create(ctx, &call))
+
+	claim := &models.CallStatusChange{UserID: &volunteer.ID, FromStatus: models.CallStatusOpen, ToStatus: models.CallStatusClaimed, Note: "On it"}
+	claimed := models.Call{ID: call.ID, Status: models.CallStatusClaimed, ClaimedByID: &volunteer.ID}
+	assert.NoError(t, repos.Calls.Transition(ctx, &claimed, claim))
+	assert.NotZero(t, claim.ID)
+	assert.Equal(t, call.ID, claim.CallID)
+
+	// A second claim based on the same read loses.
+	assert.ErrorIs(t, repos.Calls.Transition(ctx, &claimed, &models.CallStatusChange{FromStatus: models.CallStatusOpen, ToStatus: models.CallStatusClaimed}), ErrStale)
+	assert.ErrorIs(t, repos.Calls.Transition(ctx, &models.Call{ID: call.ID + 1000, Status: models.CallStatusClosed},
+		&models.CallStatusChange{FromStatus: models.CallStatusOpen, ToStatus: models.CallStatusClosed}), ErrNotFound)
+
+	resolved := models.Call{ID: call.ID, Status: models.CallStatusResolved, ClaimedByID: &volunteer.ID}
+	assert.NoError(t, repos.Calls.Transition(ctx, &resolved, &models.CallStatusChange{FromStatus: models.CallStatusClaimed, ToStatus: models.CallStatusResolved}))
+
+	fetched, err := repos.Calls.Get(ctx, call.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.CallStatusResolved, fetched.Status)
+	if assert.NotNil(t, fetched.ClaimedByID) {
+		assert.Equal(t, volunteer.ID, *fetched.ClaimedByID)
+	}
+
+	history, err := repos.Calls.History(ctx, call.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, models.CallStatusClaimed, history[0].ToStatus)
+		assert.Equal(t, "On it", history[0].Note)
+		assert.Equal(t, volunteer.ID, *history[0].UserID)
+		assert.Equal(t, models.CallStatusResolved, history[1].ToStatus)
+		assert.Nil(t, history[1].UserID)
+	}
+
+	// Deleting the volunteer keeps the history but forgets who they were.
+	assert.NoError(t, repos.Users.Delete(ctx, volunteer.ID))
+	fetched, err = repos.Calls.Get(ctx, call.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, fetched.ClaimedByID)
+	history, err = repos.Calls.History(ctx, call.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, history, 2) {
+		assert.Nil(t, history[0].UserID)
+	}
+
+	assert.NoError(t, repos.Calls.Delete(ctx, call.ID))
+	history, err = repos.Calls.History(ctx, call.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func testCallCategoriesAndTags(t *testing.T, repos Repositories) {
+	user := models.User{Name: "John Doe", Email: "john@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, &user))
+	housing, err := repos.Categories.Get(ctx, "housing")
+	assert.NoError(t, err)
+	food := models.Category{Slug: "food", Name: "Food"}
+	assert.NoError(t, repos.Categories.Create(ctx, &food))
+
+	missing := housing.ID + 1000
+	assert.ErrorIs(t, repos.Calls.Create(ctx, &models.Call{UserID: user.ID, Desc: "Nowhere", CategoryID: &missing}), ErrForeignKey)
+
+	rent := models.Call{UserID: user.ID, Desc: "Behind on rent", CategoryID: &housing.ID,
+		Tags: []models.Tag{{Name: "rent"}, {Name: "eviction"}, {Name: "rent"}}}
+	assert.NoError(t, repos.Calls.Create(ctx, &rent))
+	assert.Equal(t, []string{"eviction", "rent"}, tagNames(rent.Tags))
+	pantry := models.Call{UserID: user.ID, Desc: "Food pantry", CategoryID: &food.ID, Tags: []models.Tag{{Name: "eviction"}}}
+	assert.NoError(t, repos.Calls.Create(ctx, &pantry))
+	assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: user.ID, Desc: "Uncategorized"}))
+
+	fetched, err := repos.Calls.Get(ctx, rent.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, fetched.Category) {
+		assert.Equal(t, "housing", fetched.Category.Slug)
+	}
+	assert.Equal(t, []string{"eviction", "rent"}, tagNames(fetched.Tags))
+
+	calls, err := repos.Calls.List(ctx, CallFilter{Categories: []string{"housing", "food"}}, firstPage)
+	assert.NoError(t, err)
+	assert.Len(t, calls, 2)
+	calls, err = repos.Calls.List(ctx, CallFilter{Categories: []string{"food"}}, firstPage)
+	assert.NoError(t, err)
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, "Food pantry", calls[0].Desc)
+	}
+	calls, err = repos.Calls.List(ctx, CallFilter{Tags: []string{"eviction"}}, firstPage)
+	assert.NoError(t, err)
+	assert.Len(t, calls, 2)
+	calls, err = repos.Calls.List(ctx, CallFilter{Tags: []string{"rent"}, Categories: []string{"food"}}, firstPage)
+	assert.NoError(t, err)
+	assert.Empty(t, calls)
+
+	// Updating a call replaces its tags.
+	rent.Tags = []models.Tag{{Name: "utilities"}}
+	assert.NoError(t, repos.Calls.Update(ctx, &rent))
+	fetched, err = repos.Calls.Get(ctx, rent.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"utilities"}, tagNames(fetched.Tags))
+	calls, err = repos.Calls.List(ctx, CallFilter{Tags: []string{"rent"}}, firstPage)
+	assert.NoError(t, err)
+	assert.Empty(t, calls)
+
+	// Categories in use cannot be deleted.
+	assert.ErrorIs(t, repos.Categories.Delete(ctx, "food"), ErrForeignKey)
+	assert.NoError(t, repos.Calls.Delete(ctx, pantry.ID))
+	assert.NoError(t, repos.Categories.Delete(ctx, "food"))
+	assert.ErrorIs(t, repos.Categories.Delete(ctx, "food"), ErrNotFound)
+}
+
+func testCallLocations(t *testing.T, repos Repositories) {
+	user := models.User{Name: "John Doe", Email: "john@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, &user))
+
+	washington := geo.Point{Lat: 38.8977, Lng: -77.0365}
+	near := func(desc string, p geo.Point) models.Call {
+		call := models.Call{UserID: user.ID, Desc: desc, ZIP: "20500"}
+		call.SetLocation(&geo.Point{Lat: p.Lat + 0.001, Lng: p.Lng}, &p)
+		assert.NoError(t, repos.Calls.Create(ctx, &call))
+		return call
+	}
+	baltimore := near("Ride to Baltimore VA", geo.Point{Lat: 39.2904, Lng: -76.6122})
+	downtown := near("Help moving", washington)
+	arlington := near("Yard work", geo.Point{Lat: 38.8816, Lng: -77.0910})
+	near("Ride in Richmond", geo.Point{Lat: 37.5407, Lng: -77.4360})
+	assert.NoError(t, repos.Calls.Create(ctx, &models.Call{UserID: user.ID, Desc: "Anywhere"}))
+
+	fetched, err := repos.Calls.Get(ctx, downtown.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "20500", fetched.ZIP)
+	assert.Equal(t, &washington, fetched.PublicLocation())
+	if assert.NotNil(t, fetched.Location()) {
+		assert.InDelta(t, washington.Lat+0.001, fetched.Location().Lat, 1e-9)
+	}
+	assert.Nil(t, fetched.Distance)
+
+	// Searches use public locations and sort nearest first.
+	page := pagination.Params{Limit: 2, Sort: pagination.SortDistance}
+	filter := CallFilter{Near: &geo.Circle{Center: washington, Radius: 50}}
+	calls, err := repos.Calls.List(ctx, filter, page)
+	assert.NoError(t, err)
+	if assert.Len(t, calls, 3) {
+		assert.Equal(t, []uint{downtown.ID, arlington.ID, baltimore.ID}, []uint{calls[0].ID, calls[1].ID, calls[2].ID})
+		if assert.NotNil(t, calls[0].Distance) {
+			assert.InDelta(t, 0, *calls[0].Distance, 1e-6)
+		}
+		if assert.NotNil(t, calls[2].Distance) {
+			assert.InDelta(t, geo.Distance(washington, *baltimore.PublicLocation()), *calls[2].Distance, 1e-6)
+		}
+	}
+	page.After = &pagination.Cursor{Sort: pagination.SortDistance, ID: arlington.ID, Distance: *calls[1].Distance}
+	calls, err = repos.Calls.List(ctx, filter, page)
+	assert.NoError(t, err)
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, baltimore.ID, calls[0].ID)
+	}
+
+	filter.Near.Radius = 10
+	calls, err = repos.Calls.List(ctx, filter, firstPage)
+	assert.NoError(t, err)
+	assert.Len(t, calls, 2)
+
+	located := false
+	calls, err = repos.Calls.List(ctx, CallFilter{Located: &located}, firstPage)
+	assert.NoError(t, err)
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, "Anywhere", calls[0].Desc)
+	}
+
+	// Removing a location takes the call out of searches.
+	downtown.SetLocation(nil, nil)
+	assert.NoError(t, repos.Calls.Update(ctx, &downtown))
+	calls, err = repos.Calls.List(ctx, filter, firstPage)
+	assert.NoError(t, err)
+	if assert.Len(t, calls, 1) {
+		assert.Equal(t, arlington.ID, calls[0].ID)
+	}
+}
+
+func testVolunteerRepository(t *testing.T, repos Repositories) {
+	requested := time.Now()
+	local := models.User{Name: "Jane Doe", Email: "jane@example.com"}
+	anywhere := models.User{Name: "Jim Doe", Email: "jim@example.com"}
+	paused := models.User{Name: "Joe Doe", Email: "joe@example.com"}
+	leaving := models.User{Name: "Jill Doe", Email: "jill@example.com", DeletionRequestedAt: &requested}
+	for _, user := range []*models.User{&local, &anywhere, &paused, &leaving} {
+		assert.NoError(t, repos.Users.Create(ctx, user))
+	}
+
+	_, err := repos.Volunteers.Get(ctx, local.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, repos.Volunteers.Save(ctx, &models.VolunteerProfile{UserID: leaving.ID + 1000}), ErrForeignKey)
+
+	profile := models.VolunteerProfile{
+		UserID:       local.ID,
+		Skills:       models.Words{"driving", "housing"},
+		Languages:    models.Words{"spanish"},
+		Availability: models.Availability{{Day: "monday", Start: "09:00", End: "17:00"}},
+		TimeZone:     "America/New_York",
+	}
+	profile.SetServiceArea(&geo.Circle{Center: geo.Point{Lat: 38.8977, Lng: -77.0365}, Radius: 20})
+	assert.NoError(t, repos.Volunteers.Save(ctx, &profile))
+	assert.NotZero(t, profile.ID)
+	for _, p := range []models.VolunteerProfile{
+		{UserID: anywhere.ID, Certifications: models.Words{"cpr"}},
+		{UserID: paused.ID, Paused: true},
+		{UserID: leaving.ID},
+	} {
+		assert.NoError(t, repos.Volunteers.Save(ctx, &p))
+	}
+
+	fetched, err := repos.Volunteers.Get(ctx, local.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Jane Doe", fetched.User.Name)
+	assert.Equal(t, models.Words{"driving", "housing"}, fetched.Skills)
+	assert.Equal(t, models.Availability{{Day: "monday", Start: "09:00", End: "17:00"}}, fetched.Availability)
+	if assert.NotNil(t, fetched.ServiceArea()) {
+		assert.Equal(t, 20.0, fetched.ServiceArea().Radius)
+	}
+
+	// Saving again replaces the profile.
+	replaced := models.VolunteerProfile{UserID: local.ID, Skills: models.Words{"legal"}}
+	assert.NoError(t, repos.Volunteers.Save(ctx, &replaced))
+	assert.Equal(t, profile.ID, replaced.ID)
+	fetched, err = repos.Volunteers.Get(ctx, local.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.Words{"legal"}, fetched.Skills)
+	assert.Nil(t, fetched.ServiceArea())
+	replaced.SetServiceArea(profile.ServiceArea())
+	assert.NoError(t, repos.Volunteers.Save(ctx, &replaced))
+
+	notPaused := false
+	ids := func(filter VolunteerFilter) []uint {
+		profiles, err := repos.Volunteers.List(ctx, filter, firstPage)
+		assert.NoError(t, err)
+		var ids []uint
+		for _, p := range profiles {
+			ids = append(ids, p.UserID)
+		}
+		return ids
+	}
+	assert.Equal(t, []uint{local.ID, anywhere.ID, leaving.ID}, ids(VolunteerFilter{Paused: &notPaused}))
+	assert.Equal(t, []uint{local.ID, anywhere.ID}, ids(VolunteerFilter{Paused: &notPaused, ExcludeDeleting: true,
+		Serving: &geo.Point{Lat: 39.0, Lng: -77.1}}))
+	assert.Equal(t, []uint{anywhere.ID}, ids(VolunteerFilter{Paused: &notPaused, ExcludeDeleting: true,
+		Serving: &geo.Point{Lat: 39.2904, Lng: -76.6122}}))
+
+	assert.NoError(t, repos.Volunteers.Delete(ctx, anywhere.ID))
+	assert.ErrorIs(t, repos.Volunteers.Delete(ctx, anywhere.ID), ErrNotFound)
+	assert.NoError(t, repos.Users.Delete(ctx, local.ID))
+	_, err = repos.Volunteers.Get(ctx, local.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func testCategoryRepository(t *testing.T, repos Repositories) {
+	categories, err := repos.Categories.List(ctx)
+	assert.NoError(t, err)
+	var slugs, names []string
+	for _, category := range categories {
+		slugs = append(slugs, category.Slug)
+		names = append(names, category.Name)
+	}
+	assert.Subset(t, slugs, []string{"benefits", "employment", "housing", "legal", "mental-health", "transportation"})
+	assert.IsNonDecreasing(t, names)
+
+	assert.ErrorIs(t, repos.Categories.Create(ctx, &models.Category{Slug: "housing", Name: "Shelter"}), ErrDuplicate)
+	pets := models.Category{Slug: "pets", Name: "Pets"}
+	assert.NoError(t, repos.Categories.Create(ctx, &pets))
+	assert.NotZero(t, pets.ID)
+
+	pets.Name = "Pets and service animals"
+	pets.Description = "Vet bills and pet sitting"
+	assert.NoError(t, repos.Categories.Update(ctx, &pets))
+	fetched, err := repos.Categories.Get(ctx, "pets")
+	assert.NoError(t, err)
+	assert.Equal(t, "Pets and service animals", fetched.Name)
+	assert.Equal(t, "Vet bills and pet sitting", fetched.Description)
+
+	assert.NoError(t, repos.Categories.Delete(ctx, "pets"))
+	_, err = repos.Categories.Get(ctx, "pets")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func testResponseRepository(t *testing.T, repos Repositories) {
+	veteran := models.User{Name: "John Doe", Email: "john@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, &veteran))
+	volunteer := models.User{Name: "Jane Doe", Email: "jane@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, &volunteer))
+
+	call := models.Call{UserID: veteran.ID, Desc: "Need a ride"}
+	assert.NoError(t, repos.Calls.Create(ctx, &call))
+
+	assert.ErrorIs(t, repos.Responses.Create(ctx, &models.Response{CallID: call.ID + 1000, UserID: volunteer.ID, Msg: "Hi"}), ErrForeignKey)
+
+	response := models.Response{CallID: call.ID, UserID: volunteer.ID, Msg: "On my way"}
+	assert.NoError(t, repos.Responses.Create(ctx, &response))
+
+	fetched, err := repos.Responses.Get(ctx, response.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Jane Doe", fetched.User.Name)
+	assert.Equal(t, "Need a ride", fetched.Call.Desc)
+
+	responses, err := repos.Responses.List(ctx, ResponseFilter{UserID: volunteer.ID}, firstPage)
+	assert.NoError(t, err)
+	assert.Len(t, responses, 1)
+
+	private := models.Call{UserID: veteran.ID, Desc: "Talk", VeteranOnly: true}
+	assert.NoError(t, repos.Calls.Create(ctx, &private))
+	assert.NoError(t, repos.Responses.Create(ctx, &models.Response{CallID: private.ID, UserID: volunteer.ID, Msg: "Here"}))
+	public := false
+	responses, err = repos.Responses.List(ctx, ResponseFilter{UserID: volunteer.ID, CallVeteranOnly: &public}, firstPage)
+	assert.NoError(t, err)
+	if assert.Len(t, responses, 1) {
+		assert.Equal(t, response.ID, responses[0].ID)
+	}
+
+	hiddenAt := time.Now()
+	response.HiddenAt, response.HiddenByID = &hiddenAt, &veteran.ID
+	assert.NoError(t, repos.Responses.Update(ctx, &response))
+	hidden := false
+	responses, err = repos.Responses.List(ctx, ResponseFilter{UserID: volunteer.ID, Hidden: &hidden}, firstPage)
+	assert.NoError(t, err)
+	if assert.Len(t, responses, 1) {
+		assert.NotEqual(t, response.ID, responses[0].ID)
+	}
+
+	// Deleting the call's owner cascades to the call and its responses.
+	assert.NoError(t, repos.Users.Delete(ctx, veteran.ID))
+	_, err = repos.Responses.Get(ctx, response.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func testRoleRepository(t *testing.T, repos Repositories) {
+	user := models.User{Name: "John Doe", Email: "john@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, &user))
+
+	roles, err := repos.Roles.List(ctx)
+	assert.NoError(t, err)
+	var names []string
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	assert.Equal(t, []string{models.RoleAdmin, models.RoleModerator, models.RoleOnDuty, models.RoleVeteran, models.RoleVolunteer}, names)
+
+	permissions, err := repos.Roles.Permissions(ctx)
+	assert.NoError(t, err)
+	admin, err := repos.Roles.Get(ctx, models.RoleAdmin)
+	assert.NoError(t, err)
+	assert.Equal(t, len(permissions), len(admin.Permissions))
+
+	moderator, err := repos.Roles.Get(ctx, models.RoleModerator)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{models.PermissionViewVeteranOnly, models.PermissionHideResponses}, permissionNames(moderator))
+
+	_, err = repos.Roles.Get(ctx, "overlord")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.ErrorIs(t, repos.Roles.SetPermissions(ctx, models.RoleModerator, []string{"world:conquer"}), ErrForeignKey)
+	assert.NoError(t, repos.Roles.SetPermissions(ctx, models.RoleModerator, []string{models.PermissionHideResponses, models.PermissionManageResponses}))
+	moderator, err = repos.Roles.Get(ctx, models.RoleModerator)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{models.PermissionHideResponses, models.PermissionManageResponses}, permissionNames(moderator))
+
+	assert.ErrorIs(t, repos.Roles.Grant(ctx, user.ID, "overlord"), ErrNotFound)
+	assert.ErrorIs(t, repos.Roles.Grant(ctx, user.ID+1000, models.RoleModerator), ErrForeignKey)
+	assert.NoError(t, repos.Roles.Grant(ctx, user.ID, models.RoleModerator))
+	assert.NoError(t, repos.Roles.Grant(ctx, user.ID, models.RoleModerator))
+	assert.NoError(t, repos.Roles.Grant(ctx, user.ID, models.RoleAdmin))
+
+	held, err := repos.Roles.UserRoles(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{models.RoleAdmin, models.RoleModerator}, held)
+
+	users, err := repos.Users.List(ctx, UserFilter{Role: models.RoleModerator}, firstPage)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+
+	assert.NoError(t, repos.Roles.Revoke(ctx, user.ID, models.RoleModerator))
+	assert.ErrorIs(t, repos.Roles.Revoke(ctx, user.ID, models.RoleModerator), ErrNotFound)
+	users, err = repos.Users.List(ctx, UserFilter{Role: models.RoleModerator}, firstPage)
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+
+	assert.NoError(t, repos.Users.Delete(ctx, user.ID))
+	held, err = repos.Roles.UserRoles(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, held)
+}
+
+func testRecoveryCodeRepository(t *testing.T, repos Repositories) {
+	user := models.User{Name: "John Doe", Email: "john@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, &user))
+
+	assert.ErrorIs(t, repos.RecoveryCodes.Replace(ctx, user.ID+1000, []string{"a"}), ErrForeignKey)
+	assert.NoError(t, repos.RecoveryCodes.Replace(ctx, user.ID, []string{"a", "b", "c"}))
+	remaining, err := repos.RecoveryCodes.Remaining(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, remaining)
+
+	assert.NoError(t, repos.RecoveryCodes.Use(ctx, user.ID, "b", time.Now()))
+	assert.ErrorIs(t, repos.RecoveryCodes.Use(ctx, user.ID, "b", time.Now()), ErrNotFound)
+	assert.ErrorIs(t, repos.RecoveryCodes.Use(ctx, user.ID+1000, "a", time.Now()), ErrNotFound)
+	remaining, _ = repos.RecoveryCodes.Remaining(ctx, user.ID)
+	assert.Equal(t, 2, remaining)
+
+	assert.NoError(t, repos.RecoveryCodes.Replace(ctx, user.ID, []string{"d"}))
+	assert.ErrorIs(t, repos.RecoveryCodes.Use(ctx, user.ID, "a", time.Now()), ErrNotFound)
+	remaining, _ = repos.RecoveryCodes.Remaining(ctx, user.ID)
+	assert.Equal(t, 1, remaining)
+
+	assert.NoError(t, repos.Users.Delete(ctx, user.ID))
+	remaining, err = repos.RecoveryCodes.Remaining(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Zero(t, remaining)
+}
+
+func testOrganizationRepository(t *testing.T, repos Repositories) {
+	org := models.Organization{Name: "VFW Post 1", User: models.User{Name: "VFW Post 1", Email: "post1@vfw.example.com"}}
+	assert.NoError(t, repos.Organizations.Create(ctx, &org))
+	assert.NotZero(t, org.ID)
+	assert.NotZero(t, org.UserID)
+	user, err := repos.Users.Get(ctx, org.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, "post1@vfw.example.com", user.Email)
+
+	dup := models.Organization{Name: "VFW Post 1", User: models.User{Name: "Other", Email: "other@vfw.example.com"}}
+	assert.ErrorIs(t, repos.Organizations.Create(ctx, &dup), ErrDuplicate)
+	dup = models.Organization{Name: "VFW Post 2", User: models.User{Name: "Other", Email: "post1@vfw.example.com"}}
+	assert.ErrorIs(t, repos.Organizations.Create(ctx, &dup), ErrDuplicate)
+
+	other := models.Organization{Name: "American Legion", User: models.User{Name: "Legion", Email: "legion@example.com"}}
+	assert.NoError(t, repos.Organizations.Create(ctx, &other))
+	orgs, err := repos.Organizations.List(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, orgs, 2) {
+		assert.Equal(t, "American Legion", orgs[0].Name)
+	}
+
+	_, err = repos.Organizations.Get(ctx, org.ID+1000)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func testAPIKeyRepository(t *testing.T, repos Repositories) {
+	org := models.Organization{Name: "VFW Post 1", User: models.User{Name: "VFW Post 1", Email: "post1@vfw.example.com"}}
+	assert.NoError(t, repos.Organizations.Create(ctx, &org))
+
+	key := models.APIKey{
+		OrganizationID: org.ID,
+		Name:           "Case system",
+		Prefix:         "0123456789abcdef",
+		KeyHash:        "hash",
+		Scopes:         models.Words{models.ScopeCallsRead, models.ScopeResponsesWrite},
+		RateLimit:      60,
+	}
+	assert.NoError(t, repos.APIKeys.Create(ctx, &key))
+	assert.ErrorIs(t, repos.APIKeys.Create(ctx, &models.APIKey{OrganizationID: org.ID + 1000, Prefix: "other", KeyHash: "hash"}), ErrForeignKey)
+
+	found, err := repos.APIKeys.GetByPrefix(ctx, "0123456789abcdef")
+	assert.NoError(t, err)
+	assert.Equal(t, key.ID, found.ID)
+	assert.Equal(t, models.Words{models.ScopeCallsRead, models.ScopeResponsesWrite}, found.Scopes)
+	assert.Equal(t, org.UserID, found.Organization.UserID)
+	_, err = repos.APIKeys.GetByPrefix(ctx, "nope")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	now := time.Now().Truncate(time.Second)
+	assert.NoError(t, repos.APIKeys.Touch(ctx, key.ID, now))
+	assert.NoError(t, repos.APIKeys.Revoke(ctx, key.ID, now))
+	assert.NoError(t, repos.APIKeys.Revoke(ctx, key.ID, now.Add(time.Hour)))
+	assert.ErrorIs(t, repos.APIKeys.Revoke(ctx, key.ID+1000, now), ErrNotFound)
+	found, err = repos.APIKeys.Get(ctx, key.ID)
+	assert.NoError(t, err)
+	assert.True(t, now.Equal(*found.LastUsedAt))
+	assert.True(t, now.Equal(*found.RevokedAt))
+	assert.False(t, found.Active(now))
+
+	keys, err := repos.APIKeys.List(ctx, org.ID)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+
+	// Deleting the service account removes the organization and its keys.
+	assert.NoError(t, repos.Users.Delete(ctx, org.UserID))
+	_, err = repos.Organizations.Get(ctx, org.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = repos.APIKeys.Get(ctx, key.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func permissionNames(role *models.Role) []string {
+	names := []string{}
+	for _, p := range role.Permissions {
+		names = append(names, p.Name)
+	}
+	return names
+}
@@ -0,0 +1,84 @@
+// Package server runs the HTTP server and shuts it down gracefully.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pageza/vet-app/config"
+)
+
+// Server is an http.Server that stops cleanly when its context is cancelled.
+type Server struct {
+	*http.Server
+	drainDelay      time.Duration
+	shutdownTimeout time.Duration
+}
+
+// New returns a server for handler configured from cfg.
+func New(cfg config.ServerConfig, handler http.Handler) *Server {
+	return &Server{
+		Server: &http.Server{
+			Addr:              fmt.Sprintf("0.0.0.0:%d", cfg.Port),
+			Handler:           handler,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+		},
+		drainDelay:      cfg.DrainDelay,
+		shutdownTimeout: cfg.ShutdownTimeout,
+	}
+}
+
+// Run listens on the configured address and serves until ctx is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve accepts connections on ln until ctx is cancelled. It then keeps
+// serving for the drain delay, stops accepting new connections and waits up
+// to the shutdown timeout for in-flight requests to finish. It returns nil
+// after a clean shutdown.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.Server.Serve(ln)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	if s.drainDelay > 0 {
+		log.Printf("Draining for %s before shutdown", s.drainDelay)
+		time.Sleep(s.drainDelay)
+	}
+
+	log.Println("Shutting down HTTP server...")
+	shutdownCtx := context.Background()
+	if s.shutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, s.shutdownTimeout)
+		defer cancel()
+	}
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		s.Close()
+		return fmt.Errorf("shutting down: %w", err)
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
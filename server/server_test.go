@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pageza/vet-app/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func listen(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	return ln
+}
+
+func TestNewAppliesConfig(t *testing.T) {
+	s := New(config.ServerConfig{
+		Port:              9000,
+		ReadTimeout:       time.Second,
+		ReadHeaderTimeout: 2 * time.Second,
+		WriteTimeout:      3 * time.Second,
+		IdleTimeout:       4 * time.Second,
+	}, http.NotFoundHandler())
+
+	assert.Equal(t, "0.0.0.0:9000", s.Addr)
+	assert.Equal(t, time.Second, s.ReadTimeout)
+	assert.Equal(t, 2*time.Second, s.ReadHeaderTimeout)
+	assert.Equal(t, 3*time.Second, s.WriteTimeout)
+	assert.Equal(t, 4*time.Second, s.IdleTimeout)
+}
+
+func TestServeFinishesInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	s := New(config.ServerConfig{ShutdownTimeout: 5 * time.Second}, handler)
+	ln := listen(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ctx, ln) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	got := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			got <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		got <- result{string(body), err}
+	}()
+
+	<-started
+	cancel()
+
+	res := <-got
+	assert.NoError(t, res.err)
+	assert.Equal(t, "done", res.body)
+	assert.NoError(t, <-served)
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	s := New(config.ServerConfig{ShutdownTimeout: 50 * time.Millisecond}, handler)
+	ln := listen(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ctx, ln) }()
+	go http.Get("http://" + ln.Addr().String())
+
+	<-started
+	cancel()
+	assert.ErrorIs(t, <-served, context.DeadlineExceeded)
+}
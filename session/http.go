@@ -0,0 +1,132 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/pageza/vet-app/auth"
+	"github.com/pageza/vet-app/repository"
+)
+
+type sessionKeyType struct{}
+
+// FromContext returns the session loaded by Middleware, or nil.
+func FromContext(ctx context.Context) *Session {
+	sess, _ := ctx.Value(sessionKeyType{}).(*Session)
+	return sess
+}
+
+// Start creates a session for userID and sets its cookie on w. If pending
+// is set the session only becomes usable once the user has entered their
+// second factor.
+func (s *Store) Start(w http.ResponseWriter, r *http.Request, userID uint, pending bool) (*Session, error) {
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	now := s.now()
+	sess := &Session{
+		UserID:     userID,
+		Pending:    pending,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		UserAgent:  r.UserAgent(),
+		IP:         ip,
+	}
+	if err := s.save(r.Context(), sess); err != nil {
+		return nil, err
+	}
+	s.setCookie(w, sess.ID, int(s.cfg.IdleTimeout.Seconds()))
+	return sess, nil
+}
+
+// ConfirmSecondFactor is PassSecondFactor for the request's session,
+// replacing its cookie.
+func (s *Store) ConfirmSecondFactor(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	current := FromContext(r.Context())
+	if current == nil {
+		return nil, ErrNotFound
+	}
+	sess, err := s.PassSecondFactor(r.Context(), current.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.setCookie(w, sess.ID, int(s.cfg.IdleTimeout.Seconds()))
+	return sess, nil
+}
+
+// End revokes the request's session, if any, and clears its cookie.
+func (s *Store) End(w http.ResponseWriter, r *http.Request) error {
+	s.setCookie(w, "", -1)
+	cookie, err := r.Cookie(s.cfg.CookieName)
+	if err != nil {
+		return nil
+	}
+	if err := s.Delete(r.Context(), cookie.Value); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Middleware loads the session named by the request's cookie and stores it
+// and its user in the request context. Requests without a valid session
+// continue anonymously, and the cookie is renewed along with the session.
+// Pending sessions are stored without their user, so they only reach
+// handlers that look for the session itself.
+func (s *Store) Middleware(users repository.UserRepository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie(s.cfg.CookieName)
+			if err != nil || cookie.Value == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			sess, err := s.Get(ctx, cookie.Value)
+			if err != nil {
+				if !errors.Is(err, ErrNotFound) {
+					log.Printf("Failed to load session: %v", err)
+				}
+				s.setCookie(w, "", -1)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			user, err := users.Get(ctx, sess.UserID)
+			if err != nil {
+				if errors.Is(err, repository.ErrNotFound) {
+					s.DeleteUser(ctx, sess.UserID)
+				} else {
+					log.Printf("Failed to load session user %d: %v", sess.UserID, err)
+				}
+				s.setCookie(w, "", -1)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			s.setCookie(w, sess.ID, int(s.cfg.IdleTimeout.Seconds()))
+			ctx = context.WithValue(ctx, sessionKeyType{}, sess)
+			if !sess.Pending {
+				ctx = auth.WithUser(ctx, user)
+			}
+			if sess.SecondFactorAt != nil {
+				ctx = auth.WithSecondFactor(ctx, *sess.SecondFactorAt)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func (s *Store) setCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cfg.CookieName,
+		Value:    value,
+		Path:     "/",
+		Domain:   s.cfg.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   s.cfg.CookieSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,253 @@
+// Package session stores web client sessions in Redis.
+//
+// A session is identified by an opaque random ID that is only ever sent in
+// a cookie. Redis keys are derived from a hash of the ID, so read access to
+// Redis is not enough to hijack a session. Each session is stored under
+// session:{hash} with a TTL of the idle timeout, which is renewed whenever
+// the session is used, and is listed in the user:{id}:sessions set so that
+// every session of a user can be revoked at once.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pageza/vet-app/config"
+)
+
+// ErrNotFound is returned for unknown, expired and revoked sessions.
+var ErrNotFound = errors.New("session not found")
+
+// Session is a logged-in browser. A Pending session belongs to a user with
+// two-factor authentication who has not entered their code yet; it does not
+// authenticate them. SecondFactorAt is when they last entered it.
+type Session struct {
+	// ID is the opaque value sent in the cookie. It is not stored.
+	ID             string     `json:"-"`
+	UserID         uint       `json:"user_id"`
+	Pending        bool       `json:"pending,omitempty"`
+	SecondFactorAt *time.Time `json:"second_factor_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastSeenAt     time.Time  `json:"last_seen_at"`
+	UserAgent      string     `json:"user_agent,omitempty"`
+	IP             string     `json:"ip,omitempty"`
+}
+
+// Store creates, loads and revokes sessions.
+type Store struct {
+	client *redis.Client
+	cfg    config.SessionConfig
+	now    func() time.Time
+}
+
+// NewStore returns a Store that keeps sessions in client.
+func NewStore(client *redis.Client, cfg config.SessionConfig) *Store {
+	return &Store{client: client, cfg: cfg, now: time.Now}
+}
+
+func sessionKey(hash string) string {
+	return "session:" + hash
+}
+
+func userKey(userID uint) string {
+	return fmt.Sprintf("user:%d:sessions", userID)
+}
+
+func hashID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create starts a session for userID.
+func (s *Store) Create(ctx context.Context, userID uint, userAgent, ip string) (*Session, error) {
+	now := s.now()
+	sess := &Session{
+		UserID:     userID,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		UserAgent:  userAgent,
+		IP:         ip,
+	}
+	if err := s.save(ctx, sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// PassSecondFactor replaces the session with the given ID by a new one that
+// is no longer pending and records that the second factor was just entered.
+// The ID changes so that a session ID captured before the user proved
+// their second factor is worthless afterwards.
+func (s *Store) PassSecondFactor(ctx context.Context, id string) (*Session, error) {
+	hash := hashID(id)
+	old, err := s.load(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	sess := *old
+	sess.Pending = false
+	sess.SecondFactorAt = &now
+	sess.LastSeenAt = now
+	if err := s.save(ctx, &sess); err != nil {
+		return nil, err
+	}
+	if err := s.remove(ctx, old.UserID, hash); err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// save stores sess under a new random ID.
+func (s *Store) save(ctx context.Context, sess *Session) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	sess.ID = base64.RawURLEncoding.EncodeToString(b)
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+
+	hash := hashID(sess.ID)
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, sessionKey(hash), data, s.cfg.IdleTimeout)
+		pipe.SAdd(ctx, userKey(sess.UserID), hash)
+		pipe.Expire(ctx, userKey(sess.UserID), s.cfg.MaxLifetime)
+		return nil
+	})
+	return err
+}
+
+// Get loads the session with the given ID and extends its expiry by the
+// idle timeout, up to its maximum lifetime.
+func (s *Store) Get(ctx context.Context, id string) (*Session, error) {
+	hash := hashID(id)
+	sess, err := s.load(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	sess.ID = id
+
+	now := s.now()
+	ttl := s.cfg.IdleTimeout
+	if remaining := sess.CreatedAt.Add(s.cfg.MaxLifetime).Sub(now); remaining < ttl {
+		ttl = remaining
+	}
+	if ttl <= 0 {
+		s.remove(ctx, sess.UserID, hash)
+		return nil, ErrNotFound
+	}
+
+	sess.LastSeenAt = now
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return nil, err
+	}
+	// XX so that a session revoked since it was loaded is not recreated.
+	if err := s.client.SetXX(ctx, sessionKey(hash), data, ttl).Err(); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Delete revokes a single session.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	hash := hashID(id)
+	sess, err := s.load(ctx, hash)
+	if err != nil {
+		return err
+	}
+	return s.remove(ctx, sess.UserID, hash)
+}
+
+// DeleteUser revokes every session of a user and returns how many there
+// were.
+func (s *Store) DeleteUser(ctx context.Context, userID uint) (int, error) {
+	hashes, err := s.client.SMembers(ctx, userKey(userID)).Result()
+	if err != nil {
+		return 0, err
+	}
+	keys := []string{userKey(userID)}
+	for _, hash := range hashes {
+		keys = append(keys, sessionKey(hash))
+	}
+	deleted, err := s.client.Del(ctx, keys...).Result()
+	if err != nil {
+		return 0, err
+	}
+	if len(hashes) > 0 {
+		// One of the deleted keys was the index itself.
+		deleted--
+	}
+	return int(deleted), nil
+}
+
+// List returns the live sessions of a user, dropping expired ones from the
+// index. The returned sessions have no ID.
+func (s *Store) List(ctx context.Context, userID uint) ([]Session, error) {
+	hashes, err := s.client.SMembers(ctx, userKey(userID)).Result()
+	if err != nil || len(hashes) == 0 {
+		return nil, err
+	}
+	keys := make([]string, len(hashes))
+	for i, hash := range hashes {
+		keys[i] = sessionKey(hash)
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []Session
+	var expired []interface{}
+	for i, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			expired = append(expired, hashes[i])
+			continue
+		}
+		var sess Session
+		if err := json.Unmarshal([]byte(data), &sess); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sess)
+	}
+	if len(expired) > 0 {
+		s.client.SRem(ctx, userKey(userID), expired...)
+	}
+	return sessions, nil
+}
+
+func (s *Store) load(ctx context.Context, hash string) (*Session, error) {
+	data, err := s.client.Get(ctx, sessionKey(hash)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sess Session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (s *Store) remove(ctx context.Context, userID uint, hash string) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, sessionKey(hash))
+		pipe.SRem(ctx, userKey(userID), hash)
+		return nil
+	})
+	return err
+}
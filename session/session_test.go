@@ -0,0 +1,219 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/pageza/vet-app/auth"
+	"github.com/pageza/vet-app/config"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+var testConfig = config.SessionConfig{
+	CookieName:   "session",
+	CookieSecure: true,
+	IdleTimeout:  time.Hour,
+	MaxLifetime:  24 * time.Hour,
+}
+
+func newStore(t *testing.T) (*Store, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewStore(client, testConfig), mr
+}
+
+func TestCreateAndGet(t *testing.T) {
+	s, mr := newStore(t)
+
+	sess, err := s.Create(ctx, 7, "test-agent", "10.0.0.1")
+	assert.NoError(t, err)
+	assert.Len(t, sess.ID, 43)
+
+	// Only the hash of the ID is stored.
+	assert.False(t, mr.Exists(sessionKey(sess.ID)))
+	assert.True(t, mr.Exists(sessionKey(hashID(sess.ID))))
+
+	got, err := s.Get(ctx, sess.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint(7), got.UserID)
+		assert.Equal(t, "test-agent", got.UserAgent)
+		assert.Equal(t, sess.ID, got.ID)
+	}
+
+	_, err = s.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestSlidingExpiry(t *testing.T) {
+	s, mr := newStore(t)
+	sess, _ := s.Create(ctx, 7, "", "")
+
+	// Using the session before it goes idle keeps it alive.
+	for i := 0; i < 3; i++ {
+		mr.FastForward(45 * time.Minute)
+		_, err := s.Get(ctx, sess.ID)
+		assert.NoError(t, err)
+	}
+
+	mr.FastForward(61 * time.Minute)
+	_, err := s.Get(ctx, sess.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMaxLifetime(t *testing.T) {
+	s, _ := newStore(t)
+	sess, _ := s.Create(ctx, 7, "", "")
+
+	s.now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+	_, err := s.Get(ctx, sess.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestDelete(t *testing.T) {
+	s, _ := newStore(t)
+	sess, _ := s.Create(ctx, 7, "", "")
+
+	assert.NoError(t, s.Delete(ctx, sess.ID))
+	_, err := s.Get(ctx, sess.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, s.Delete(ctx, sess.ID), ErrNotFound)
+}
+
+func TestDeleteUser(t *testing.T) {
+	s, _ := newStore(t)
+	first, _ := s.Create(ctx, 7, "", "")
+	second, _ := s.Create(ctx, 7, "", "")
+	other, _ := s.Create(ctx, 8, "", "")
+
+	sessions, err := s.List(ctx, 7)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	n, err := s.DeleteUser(ctx, 7)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	for _, id := range []string{first.ID, second.ID} {
+		_, err := s.Get(ctx, id)
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	_, err = s.Get(ctx, other.ID)
+	assert.NoError(t, err)
+}
+
+func TestListPrunesExpired(t *testing.T) {
+	s, mr := newStore(t)
+	s.Create(ctx, 7, "", "")
+	mr.FastForward(2 * time.Hour)
+	live, _ := s.Create(ctx, 7, "", "")
+
+	sessions, err := s.List(ctx, 7)
+	assert.NoError(t, err)
+	if assert.Len(t, sessions, 1) {
+		assert.Equal(t, live.CreatedAt.Unix(), sessions[0].CreatedAt.Unix())
+	}
+	members, _ := mr.SMembers(userKey(7))
+	assert.Len(t, members, 1)
+}
+
+func TestMiddleware(t *testing.T) {
+	s, _ := newStore(t)
+	repos := repository.NewMemory()
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(ctx, &user)
+
+	var seen *models.User
+	h := s.Middleware(repos.Users)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = auth.UserFromContext(r.Context())
+	}))
+
+	// Starting a session sets a secure, HTTP-only cookie.
+	login := httptest.NewRecorder()
+	_, err := s.Start(login, httptest.NewRequest("POST", "/", nil), user.ID, false)
+	assert.NoError(t, err)
+	cookie := login.Result().Cookies()[0]
+	assert.True(t, cookie.Secure)
+	assert.True(t, cookie.HttpOnly)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if assert.NotNil(t, seen) {
+		assert.Equal(t, user.ID, seen.ID)
+	}
+
+	// Revoked sessions are treated as anonymous and the cookie is cleared.
+	s.DeleteUser(ctx, user.ID)
+	seen = nil
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Nil(t, seen)
+	assert.Equal(t, -1, rec.Result().Cookies()[0].MaxAge)
+}
+
+func TestEnd(t *testing.T) {
+	s, _ := newStore(t)
+	login := httptest.NewRecorder()
+	sess, _ := s.Start(login, httptest.NewRequest("POST", "/", nil), 7, false)
+
+	req := httptest.NewRequest("POST", "/auth/logout", nil)
+	req.AddCookie(login.Result().Cookies()[0])
+	assert.NoError(t, s.End(httptest.NewRecorder(), req))
+
+	_, err := s.Get(ctx, sess.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestPendingSession(t *testing.T) {
+	s, _ := newStore(t)
+	repos := repository.NewMemory()
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(ctx, &user)
+
+	var seen *models.User
+	var secondFactorAt time.Time
+	h := s.Middleware(repos.Users)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = auth.UserFromContext(r.Context())
+		secondFactorAt = auth.SecondFactorAt(r.Context())
+		if r.Method == "POST" {
+			_, err := s.ConfirmSecondFactor(w, r)
+			assert.NoError(t, err)
+		}
+	}))
+
+	// A pending session does not authenticate its user.
+	login := httptest.NewRecorder()
+	pending, err := s.Start(login, httptest.NewRequest("POST", "/", nil), user.ID, true)
+	assert.NoError(t, err)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(login.Result().Cookies()[0])
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Nil(t, seen)
+
+	// Confirming the second factor replaces the session with a new ID.
+	req = httptest.NewRequest("POST", "/auth/2fa/verify", nil)
+	req.AddCookie(login.Result().Cookies()[0])
+	confirmed := httptest.NewRecorder()
+	h.ServeHTTP(confirmed, req)
+	_, err = s.Get(ctx, pending.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	cookies := confirmed.Result().Cookies()
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookies[len(cookies)-1])
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if assert.NotNil(t, seen) {
+		assert.Equal(t, user.ID, seen.ID)
+	}
+	assert.False(t, secondFactorAt.IsZero())
+}
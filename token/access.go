@@ -0,0 +1,103 @@
+package token
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// ErrInvalidAccess is returned for access tokens that are malformed,
+// expired or not signed by a known key.
+var ErrInvalidAccess = errors.New("invalid access token")
+
+// accessUse marks tokens as access tokens so that other JWTs signed with
+// the same keys are never accepted in their place.
+const accessUse = "access"
+
+type accessClaims struct {
+	jwt.Claims
+	Use            string           `json:"token_use"`
+	SecondFactorAt *jwt.NumericDate `json:"second_factor_at,omitempty"`
+}
+
+// AccessIssuer signs and verifies access tokens.
+type AccessIssuer struct {
+	keys   *Keyring
+	issuer string
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewAccessIssuer returns an AccessIssuer for tokens valid for ttl.
+func NewAccessIssuer(keys *Keyring, issuer string, ttl time.Duration) *AccessIssuer {
+	return &AccessIssuer{keys: keys, issuer: issuer, ttl: ttl, now: time.Now}
+}
+
+// Issue returns a signed access token for userID and when it expires. If
+// secondFactorAt is set the token records when the user last entered their
+// second factor.
+func (a *AccessIssuer) Issue(userID uint, secondFactorAt time.Time) (string, time.Time, error) {
+	signer, err := a.keys.signer()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := a.now()
+	expiresAt := now.Add(a.ttl)
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	claims := accessClaims{
+		Claims: jwt.Claims{
+			ID:       hex.EncodeToString(id),
+			Issuer:   a.issuer,
+			Subject:  strconv.FormatUint(uint64(userID), 10),
+			IssuedAt: jwt.NewNumericDate(now),
+			Expiry:   jwt.NewNumericDate(expiresAt),
+		},
+		Use: accessUse,
+	}
+	if !secondFactorAt.IsZero() {
+		claims.SecondFactorAt = jwt.NewNumericDate(secondFactorAt)
+	}
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	return token, expiresAt, err
+}
+
+// Verify checks an access token and returns the user it was issued to and
+// when they last entered their second factor, which is zero if the token
+// does not say.
+func (a *AccessIssuer) Verify(raw string) (uint, time.Time, error) {
+	tok, err := jwt.ParseSigned(raw, algorithms)
+	if err != nil || len(tok.Headers) != 1 {
+		return 0, time.Time{}, ErrInvalidAccess
+	}
+	key, ok := a.keys.verificationKey(tok.Headers[0].KeyID)
+	if !ok || jose.SignatureAlgorithm(key.Algorithm) != jose.SignatureAlgorithm(tok.Headers[0].Algorithm) {
+		return 0, time.Time{}, ErrInvalidAccess
+	}
+
+	var claims accessClaims
+	if err := tok.Claims(key.Key, &claims); err != nil {
+		return 0, time.Time{}, ErrInvalidAccess
+	}
+	if err := claims.ValidateWithLeeway(jwt.Expected{Issuer: a.issuer, Time: a.now()}, 0); err != nil {
+		return 0, time.Time{}, ErrInvalidAccess
+	}
+	if claims.Use != accessUse {
+		return 0, time.Time{}, ErrInvalidAccess
+	}
+	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil || userID == 0 {
+		return 0, time.Time{}, ErrInvalidAccess
+	}
+	var secondFactorAt time.Time
+	if claims.SecondFactorAt != nil {
+		secondFactorAt = claims.SecondFactorAt.Time()
+	}
+	return uint(userID), secondFactorAt, nil
+}
@@ -0,0 +1,77 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/auth"
+	"github.com/pageza/vet-app/repository"
+)
+
+var errInvalidBearer = apierr.Unauthorized("invalid or expired access token")
+
+// BearerToken returns the token of an "Authorization: Bearer" header, or
+// "" if there is none.
+func BearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// Middleware authenticates requests carrying a bearer access token and
+// stores the user in the request context. Requests without one pass
+// through untouched; requests with an invalid one are rejected with 401 so
+// that clients know to refresh.
+func (a *AccessIssuer) Middleware(users repository.UserRepository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw := BearerToken(r)
+			if raw == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			userID, secondFactorAt, err := a.Verify(raw)
+			if err != nil {
+				reject(w, r, errInvalidBearer)
+				return
+			}
+			user, err := users.Get(r.Context(), userID)
+			if err != nil {
+				if !errors.Is(err, repository.ErrNotFound) {
+					log.Printf("Failed to load token user %d: %v", userID, err)
+					apierr.Write(w, r, err)
+					return
+				}
+				reject(w, r, errInvalidBearer)
+				return
+			}
+			ctx := auth.WithUser(r.Context(), user)
+			if !secondFactorAt.IsZero() {
+				ctx = auth.WithSecondFactor(ctx, secondFactorAt)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func reject(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	apierr.Write(w, r, err)
+}
+
+// ServeJWKS handles GET /.well-known/jwks.json, publishing the public keys that
+// verify access tokens.
+func (k *Keyring) ServeJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(k.JWKS()); err != nil {
+		log.Printf("Failed to encode JWKS: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+// Keyring holds the keys that sign and verify access tokens. Every key is
+// published in the JWKS, but only the active one signs. To rotate, add a
+// new key and deploy so that clients can fetch it, make it active, and
+// remove the old key once the tokens it signed have expired.
+type Keyring struct {
+	keys   map[string]jose.JSONWebKey
+	active string
+}
+
+// algorithms lists the signature algorithms keys may use.
+var algorithms = []jose.SignatureAlgorithm{jose.ES256, jose.RS256}
+
+// NewKeyring returns a keyring of private keys by key ID. active names the
+// signing key.
+func NewKeyring(keys map[string]crypto.Signer, active string) (*Keyring, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("active key %q not found", active)
+	}
+	k := &Keyring{keys: map[string]jose.JSONWebKey{}, active: active}
+	for id, key := range keys {
+		var alg jose.SignatureAlgorithm
+		switch key := key.(type) {
+		case *ecdsa.PrivateKey:
+			if key.Curve != elliptic.P256() {
+				return nil, fmt.Errorf("key %q: only P-256 EC keys are supported", id)
+			}
+			alg = jose.ES256
+		case *rsa.PrivateKey:
+			alg = jose.RS256
+		default:
+			return nil, fmt.Errorf("key %q: unsupported key type %T", id, key)
+		}
+		k.keys[id] = jose.JSONWebKey{Key: key, KeyID: id, Algorithm: string(alg), Use: "sig"}
+	}
+	return k, nil
+}
+
+// GenerateKeyring returns a keyring with a single new P-256 key. Tokens it
+// signs do not survive a restart and are not accepted by other instances.
+func GenerateKeyring() (*Keyring, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(map[string]crypto.Signer{"generated": key}, "generated")
+}
+
+// LoadKeyring reads every *.pem private key in dir, using the file name
+// without its extension as the key ID. If active is empty, the key whose ID
+// sorts last is made active.
+func LoadKeyring(dir, active string) (*Keyring, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no *.pem keys in %s", dir)
+	}
+	sort.Strings(paths)
+
+	keys := map[string]crypto.Signer{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := parsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys[strings.TrimSuffix(filepath.Base(path), ".pem")] = key
+	}
+	if active == "" {
+		active = strings.TrimSuffix(filepath.Base(paths[len(paths)-1]), ".pem")
+	}
+	return NewKeyring(keys, active)
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type %T", key)
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+// signer returns a signer for the active key.
+func (k *Keyring) signer() (jose.Signer, error) {
+	key := k.keys[k.active]
+	return jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.SignatureAlgorithm(key.Algorithm), Key: key},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+}
+
+// verificationKey returns the public key with the given ID.
+func (k *Keyring) verificationKey(id string) (jose.JSONWebKey, bool) {
+	key, ok := k.keys[id]
+	if !ok {
+		return key, false
+	}
+	return key.Public(), true
+}
+
+// JWKS returns the public keys as a JSON Web Key Set.
+func (k *Keyring) JWKS() jose.JSONWebKeySet {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := jose.JSONWebKeySet{Keys: make([]jose.JSONWebKey, 0, len(ids))}
+	for _, id := range ids {
+		key := k.keys[id]
+		set.Keys = append(set.Keys, key.Public())
+	}
+	return set
+}
@@ -0,0 +1,174 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Errors returned when a refresh token is not accepted.
+var (
+	ErrInvalidRefresh = errors.New("invalid refresh token")
+	// ErrRefreshReused means a retired refresh token was presented and its
+	// family has been revoked.
+	ErrRefreshReused = errors.New("refresh token reused")
+)
+
+// RefreshStore keeps refresh token families in Redis. A family is a hash
+// at refresh:{family} holding the user ID, the Unix time the user last
+// entered their second factor before logging in, if they had, and the hash
+// of the current token, with the hashes of retired tokens in refresh:{family}:used. Each
+// user's families are listed in user:{id}:refresh.
+type RefreshStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRefreshStore returns a RefreshStore whose families expire after ttl
+// without use.
+func NewRefreshStore(client *redis.Client, ttl time.Duration) *RefreshStore {
+	return &RefreshStore{client: client, ttl: ttl}
+}
+
+func familyKey(family string) string {
+	return "refresh:" + family
+}
+
+func usedKey(family string) string {
+	return "refresh:" + family + ":used"
+}
+
+func userFamiliesKey(userID uint) string {
+	return fmt.Sprintf("user:%d:refresh", userID)
+}
+
+// Create starts a new family for userID, who entered their second factor
+// at secondFactorAt unless it is zero, and returns its first token.
+func (s *RefreshStore) Create(ctx context.Context, userID uint, secondFactorAt time.Time) (string, error) {
+	family := randomString(16)
+	token := family + "." + randomString(32)
+
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, familyKey(family), "user_id", userID, "current", hashToken(token))
+		if !secondFactorAt.IsZero() {
+			pipe.HSet(ctx, familyKey(family), "second_factor_at", secondFactorAt.Unix())
+		}
+		pipe.Expire(ctx, familyKey(family), s.ttl)
+		pipe.SAdd(ctx, userFamiliesKey(userID), family)
+		pipe.Expire(ctx, userFamiliesKey(userID), s.ttl)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// rotateScript atomically replaces the current token of a family, so that
+// a token can never be redeemed twice. It returns the user ID and second
+// factor time, or an error status of "invalid" or "reused".
+var rotateScript = redis.NewScript(`
+local current = redis.call('HGET', KEYS[1], 'current')
+if not current then
+	return {err = 'invalid'}
+end
+if current ~= ARGV[1] then
+	if redis.call('SISMEMBER', KEYS[2], ARGV[1]) == 1 then
+		redis.call('DEL', KEYS[1], KEYS[2])
+		return {err = 'reused'}
+	end
+	return {err = 'invalid'}
+end
+redis.call('HSET', KEYS[1], 'current', ARGV[2])
+redis.call('SADD', KEYS[2], ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+return redis.call('HMGET', KEYS[1], 'user_id', 'second_factor_at')
+`)
+
+// Rotate redeems token and returns its user, when they entered their
+// second factor and the family's next token.
+func (s *RefreshStore) Rotate(ctx context.Context, token string) (uint, time.Time, string, error) {
+	family, ok := familyOf(token)
+	if !ok {
+		return 0, time.Time{}, "", ErrInvalidRefresh
+	}
+	next := family + "." + randomString(32)
+
+	res, err := rotateScript.Run(ctx, s.client,
+		[]string{familyKey(family), usedKey(family)},
+		hashToken(token), hashToken(next), s.ttl.Milliseconds(),
+	).Slice()
+	if err != nil {
+		switch err.Error() {
+		case "invalid":
+			return 0, time.Time{}, "", ErrInvalidRefresh
+		case "reused":
+			return 0, time.Time{}, "", ErrRefreshReused
+		}
+		return 0, time.Time{}, "", err
+	}
+	rawUserID, _ := res[0].(string)
+	userID, err := strconv.ParseUint(rawUserID, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, "", err
+	}
+	var secondFactorAt time.Time
+	if raw, ok := res[1].(string); ok {
+		unix, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return 0, time.Time{}, "", err
+		}
+		secondFactorAt = time.Unix(unix, 0)
+	}
+	return uint(userID), secondFactorAt, next, nil
+}
+
+// Revoke deletes the family of token. Unknown tokens are ignored.
+func (s *RefreshStore) Revoke(ctx context.Context, token string) error {
+	family, ok := familyOf(token)
+	if !ok {
+		return nil
+	}
+	return s.client.Del(ctx, familyKey(family), usedKey(family)).Err()
+}
+
+// RevokeUser deletes every family of userID.
+func (s *RefreshStore) RevokeUser(ctx context.Context, userID uint) error {
+	families, err := s.client.SMembers(ctx, userFamiliesKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	keys := []string{userFamiliesKey(userID)}
+	for _, family := range families {
+		keys = append(keys, familyKey(family), usedKey(family))
+	}
+	return s.client.Del(ctx, keys...).Err()
+}
+
+func familyOf(token string) (string, bool) {
+	family, _, ok := strings.Cut(token, ".")
+	return family, ok && family != ""
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
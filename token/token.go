@@ -0,0 +1,90 @@
+// Package token issues the bearer tokens used by the mobile clients.
+//
+// Access tokens are short-lived JWTs signed with a key from a Keyring and
+// verified without any storage lookup. Refresh tokens are opaque and kept
+// in Redis. Every refresh token belongs to a family started at login; using
+// one returns a new pair and retires the old refresh token. Presenting a
+// retired refresh token again means it was stolen or replayed, so the
+// whole family is revoked and both the thief and the user must log in
+// again.
+package token
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pageza/vet-app/config"
+)
+
+// Pair is the token response returned to clients.
+type Pair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Service issues and refreshes token pairs.
+type Service struct {
+	access  *AccessIssuer
+	refresh *RefreshStore
+}
+
+// NewService returns a Service that signs access tokens with keys and
+// stores refresh tokens in client.
+func NewService(keys *Keyring, client *redis.Client, cfg config.TokenConfig) *Service {
+	return &Service{
+		access:  NewAccessIssuer(keys, cfg.Issuer, cfg.AccessTTL),
+		refresh: NewRefreshStore(client, cfg.RefreshTTL),
+	}
+}
+
+// Access returns the issuer of access tokens.
+func (s *Service) Access() *AccessIssuer {
+	return s.access
+}
+
+// Issue starts a new token family for userID. If secondFactorAt is set,
+// the login had a second factor entered then, and every access token of
+// the family says so.
+func (s *Service) Issue(ctx context.Context, userID uint, secondFactorAt time.Time) (*Pair, error) {
+	refresh, err := s.refresh.Create(ctx, userID, secondFactorAt)
+	if err != nil {
+		return nil, err
+	}
+	return s.pair(userID, secondFactorAt, refresh)
+}
+
+// Refresh rotates refreshToken and returns a new pair for its user.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*Pair, error) {
+	userID, secondFactorAt, refresh, err := s.refresh.Rotate(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.pair(userID, secondFactorAt, refresh)
+}
+
+// Revoke revokes the family of refreshToken.
+func (s *Service) Revoke(ctx context.Context, refreshToken string) error {
+	return s.refresh.Revoke(ctx, refreshToken)
+}
+
+// RevokeUser revokes every token family of userID. Access tokens already
+// issued stay valid until they expire.
+func (s *Service) RevokeUser(ctx context.Context, userID uint) error {
+	return s.refresh.RevokeUser(ctx, userID)
+}
+
+func (s *Service) pair(userID uint, secondFactorAt time.Time, refresh string) (*Pair, error) {
+	access, expiresAt, err := s.access.Issue(userID, secondFactorAt)
+	if err != nil {
+		return nil, err
+	}
+	return &Pair{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Until(expiresAt).Round(time.Second).Seconds()),
+		RefreshToken: refresh,
+	}, nil
+}
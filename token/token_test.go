@@ -0,0 +1,263 @@
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-redis/redis/v8"
+	"github.com/pageza/vet-app/auth"
+	"github.com/pageza/vet-app/config"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newService(t *testing.T) (*Service, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	keys, err := GenerateKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewService(keys, client, config.TokenConfig{
+		Issuer:     "vet-app",
+		AccessTTL:  15 * time.Minute,
+		RefreshTTL: time.Hour,
+	}), mr
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir := t.TempDir()
+	for _, id := range []string{"2024-01", "2024-06"} {
+		der, _ := x509.MarshalPKCS8PrivateKey(newKey(t))
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, id+".pem"), data, 0o600))
+	}
+
+	keys, err := LoadKeyring(dir, "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "2024-06", keys.active)
+		assert.Len(t, keys.JWKS().Keys, 2)
+	}
+
+	keys, err = LoadKeyring(dir, "2024-01")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "2024-01", keys.active)
+	}
+
+	_, err = LoadKeyring(dir, "missing")
+	assert.Error(t, err)
+	_, err = LoadKeyring(t.TempDir(), "")
+	assert.Error(t, err)
+}
+
+func TestAccessToken(t *testing.T) {
+	keys, _ := GenerateKeyring()
+	issuer := NewAccessIssuer(keys, "vet-app", 15*time.Minute)
+
+	raw, expiresAt, err := issuer.Issue(42, time.Time{})
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), expiresAt, time.Second)
+
+	userID, secondFactorAt, err := issuer.Verify(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(42), userID)
+	assert.True(t, secondFactorAt.IsZero())
+
+	// Tokens from a login with a second factor say when it was entered.
+	at := time.Now().Add(-time.Minute).Truncate(time.Second)
+	raw2fa, _, err := issuer.Issue(42, at)
+	assert.NoError(t, err)
+	_, secondFactorAt, err = issuer.Verify(raw2fa)
+	assert.NoError(t, err)
+	assert.True(t, at.Equal(secondFactorAt))
+
+	_, _, err = issuer.Verify(raw + "x")
+	assert.ErrorIs(t, err, ErrInvalidAccess)
+
+	// Tokens from another issuer name are rejected.
+	_, _, err = NewAccessIssuer(keys, "other", time.Minute).Verify(raw)
+	assert.ErrorIs(t, err, ErrInvalidAccess)
+
+	// Expired tokens are rejected.
+	issuer.now = func() time.Time { return time.Now().Add(16 * time.Minute) }
+	_, _, err = issuer.Verify(raw)
+	assert.ErrorIs(t, err, ErrInvalidAccess)
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, newKey := newKey(t), newKey(t)
+	before, _ := NewKeyring(map[string]crypto.Signer{"old": oldKey}, "old")
+	during, _ := NewKeyring(map[string]crypto.Signer{"old": oldKey, "new": newKey}, "new")
+	after, _ := NewKeyring(map[string]crypto.Signer{"new": newKey}, "new")
+
+	oldToken, _, _ := NewAccessIssuer(before, "vet-app", time.Minute).Issue(1, time.Time{})
+	newToken, _, _ := NewAccessIssuer(during, "vet-app", time.Minute).Issue(1, time.Time{})
+
+	// While both keys are published, tokens from either verify.
+	_, _, err := NewAccessIssuer(during, "vet-app", time.Minute).Verify(oldToken)
+	assert.NoError(t, err)
+	_, _, err = NewAccessIssuer(after, "vet-app", time.Minute).Verify(newToken)
+	assert.NoError(t, err)
+
+	// Once the old key is removed its tokens no longer verify.
+	_, _, err = NewAccessIssuer(after, "vet-app", time.Minute).Verify(oldToken)
+	assert.ErrorIs(t, err, ErrInvalidAccess)
+}
+
+func TestRefreshRotation(t *testing.T) {
+	s, _ := newService(t)
+
+	first, err := s.Issue(ctx, 7, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer", first.TokenType)
+	assert.Equal(t, 900, first.ExpiresIn)
+
+	second, err := s.Refresh(ctx, first.RefreshToken)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	userID, _, err := s.Access().Verify(second.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(7), userID)
+
+	third, err := s.Refresh(ctx, second.RefreshToken)
+	assert.NoError(t, err)
+
+	// The second factor of the login is kept across refreshes.
+	at := time.Now().Add(-time.Minute).Truncate(time.Second)
+	withSecondFactor, err := s.Issue(ctx, 7, at)
+	assert.NoError(t, err)
+	refreshed, err := s.Refresh(ctx, withSecondFactor.RefreshToken)
+	assert.NoError(t, err)
+	_, secondFactorAt, err := s.Access().Verify(refreshed.AccessToken)
+	assert.NoError(t, err)
+	assert.True(t, at.Equal(secondFactorAt))
+
+	_, err = s.Refresh(ctx, "unknown.token")
+	assert.ErrorIs(t, err, ErrInvalidRefresh)
+
+	// Replaying a retired token revokes the whole family, including the
+	// token that was current.
+	_, err = s.Refresh(ctx, first.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshReused)
+	_, err = s.Refresh(ctx, third.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefresh)
+}
+
+func TestRefreshFamiliesAreIndependent(t *testing.T) {
+	s, _ := newService(t)
+	phone, _ := s.Issue(ctx, 7, time.Time{})
+	tablet, _ := s.Issue(ctx, 7, time.Time{})
+
+	s.Refresh(ctx, phone.RefreshToken)
+	_, err := s.Refresh(ctx, phone.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshReused)
+
+	_, err = s.Refresh(ctx, tablet.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestRefreshExpiry(t *testing.T) {
+	s, mr := newService(t)
+	pair, _ := s.Issue(ctx, 7, time.Time{})
+
+	mr.FastForward(2 * time.Hour)
+	_, err := s.Refresh(ctx, pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefresh)
+}
+
+func TestRevoke(t *testing.T) {
+	s, _ := newService(t)
+	pair, _ := s.Issue(ctx, 7, time.Time{})
+	other, _ := s.Issue(ctx, 7, time.Time{})
+	unrelated, _ := s.Issue(ctx, 8, time.Time{})
+
+	assert.NoError(t, s.Revoke(ctx, pair.RefreshToken))
+	_, err := s.Refresh(ctx, pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefresh)
+	_, err = s.Refresh(ctx, other.RefreshToken)
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.RevokeUser(ctx, 7))
+	_, err = s.Refresh(ctx, other.RefreshToken)
+	assert.Error(t, err)
+	_, err = s.Refresh(ctx, unrelated.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	s, _ := newService(t)
+	repos := repository.NewMemory()
+	user := models.User{Name: "Jane", Email: "jane@example.com"}
+	repos.Users.Create(ctx, &user)
+
+	var seen *models.User
+	h := s.Access().Middleware(repos.Users)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = auth.UserFromContext(r.Context())
+	}))
+	serve := func(authorization string) *httptest.ResponseRecorder {
+		seen = nil
+		req := httptest.NewRequest("GET", "/", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	pair, _ := s.Issue(ctx, user.ID, time.Time{})
+	rec := serve("Bearer " + pair.AccessToken)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	if assert.NotNil(t, seen) {
+		assert.Equal(t, user.ID, seen.ID)
+	}
+
+	rec = serve("")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Nil(t, seen)
+
+	rec = serve("Bearer not-a-token")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "invalid_token")
+	assert.Nil(t, seen)
+}
+
+func TestServeJWKS(t *testing.T) {
+	keys, _ := NewKeyring(map[string]crypto.Signer{"a": newKey(t), "b": newKey(t)}, "b")
+	rec := httptest.NewRecorder()
+	keys.ServeJWKS(rec, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+
+	var set jose.JSONWebKeySet
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &set))
+	if assert.Len(t, set.Keys, 2) {
+		assert.Equal(t, "a", set.Keys[0].KeyID)
+		assert.Equal(t, "ES256", set.Keys[0].Algorithm)
+		assert.True(t, set.Keys[0].IsPublic())
+	}
+}
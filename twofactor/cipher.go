@@ -0,0 +1,79 @@
+package twofactor
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// Cipher encrypts TOTP secrets at rest with AES-256-GCM, so that a copy of
+// the users table is not enough to generate codes.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher returns a Cipher using a 32-byte key.
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// ParseCipher returns a Cipher using the base64-encoded key.
+func ParseCipher(encoded string) (*Cipher, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding encryption key: %w", err)
+	}
+	return NewCipher(key)
+}
+
+// GenerateCipher returns a Cipher with a new random key. Secrets it
+// encrypts cannot be decrypted after a restart or by other instances.
+func GenerateCipher() (*Cipher, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return NewCipher(key)
+}
+
+// Seal encrypts plaintext, returning the base64 encoding of a random nonce
+// followed by the ciphertext.
+func (c *Cipher) Seal(plaintext string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value returned by Seal.
+func (c *Cipher) Open(sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < c.aead.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+	nonce, ciphertext := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
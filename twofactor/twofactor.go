@@ -0,0 +1,304 @@
+// Package twofactor implements TOTP two-factor authentication.
+//
+// Users enroll by adding a secret to an authenticator app and confirming
+// with a code from it, at which point they receive one-time recovery codes
+// for when they lose the app. Secrets are encrypted at rest and recovery
+// codes are stored as hashes. Redis keeps the codes accepted recently, so
+// that a code cannot be replayed within its validity window, and counts
+// failed attempts per user, so that codes cannot be guessed.
+package twofactor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/repository"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// Errors returned by Service.
+var (
+	ErrAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrNotEnrolled     = errors.New("two-factor authentication is not set up")
+	ErrInvalidCode     = errors.New("invalid two-factor code")
+	ErrTooManyAttempts = errors.New("too many failed two-factor attempts")
+)
+
+const (
+	// recoveryCodeCount is how many recovery codes a user gets at a time.
+	recoveryCodeCount = 10
+	// maxFailures failed attempts within failureWindow lock a user out
+	// until the window ends.
+	maxFailures   = 5
+	failureWindow = 15 * time.Minute
+)
+
+// validateOpts are the TOTP parameters every common authenticator app uses.
+// A skew of one period accepts the previous and next codes, allowing for
+// clock drift and slow typing.
+var validateOpts = totp.ValidateOpts{
+	Period:    30,
+	Skew:      1,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// usedCodeTTL covers every period in which an accepted code stays valid.
+const usedCodeTTL = 3 * 30 * time.Second
+
+// recoveryAlphabet leaves out characters that are easily confused.
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// Enrollment is a TOTP secret waiting to be confirmed. URI is the otpauth://
+// URI that authenticator apps read from a QR code.
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// Service enrolls users in two-factor authentication and checks their
+// codes.
+type Service struct {
+	users  repository.UserRepository
+	codes  repository.RecoveryCodeRepository
+	client *redis.Client
+	cipher *Cipher
+	issuer string
+	now    func() time.Time
+}
+
+// NewService returns a Service that stores secrets encrypted with cipher
+// and names itself issuer in authenticator apps.
+func NewService(repos repository.Repositories, client *redis.Client, cipher *Cipher, issuer string) *Service {
+	return &Service{
+		users:  repos.Users,
+		codes:  repos.RecoveryCodes,
+		client: client,
+		cipher: cipher,
+		issuer: issuer,
+		now:    time.Now,
+	}
+}
+
+func failuresKey(userID uint) string {
+	return fmt.Sprintf("2fa:user:%d:failures", userID)
+}
+
+func usedCodeKey(userID uint, code string) string {
+	return fmt.Sprintf("2fa:user:%d:used:%s", userID, code)
+}
+
+// Enroll gives user a new TOTP secret, replacing any unconfirmed one. Two
+// factor authentication is only enabled once the secret is confirmed.
+func (s *Service) Enroll(ctx context.Context, user *models.User) (*Enrollment, error) {
+	if user.TwoFactorEnabled() {
+		return nil, ErrAlreadyEnabled
+	}
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.issuer,
+		AccountName: user.Email,
+		Period:      validateOpts.Period,
+		Digits:      validateOpts.Digits,
+		Algorithm:   validateOpts.Algorithm,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.cipher.Seal(key.Secret())
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPSecret = sealed
+	if err := s.users.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	return &Enrollment{Secret: key.Secret(), URI: key.URL()}, nil
+}
+
+// Confirm enables two-factor authentication for user once they enter a
+// code generated from the secret given by Enroll. It returns their recovery
+// codes, which are not stored in plain text and cannot be shown again.
+func (s *Service) Confirm(ctx context.Context, user *models.User, code string) ([]string, error) {
+	if user.TwoFactorEnabled() {
+		return nil, ErrAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrNotEnrolled
+	}
+	err := s.attempt(ctx, user.ID, func() (bool, error) {
+		return s.checkTOTP(ctx, user, normalize(code))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	user.TOTPEnabledAt = &now
+	if err := s.users.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify checks a TOTP or recovery code entered by user. Recovery codes are
+// used up.
+func (s *Service) Verify(ctx context.Context, user *models.User, code string) error {
+	if !user.TwoFactorEnabled() {
+		return ErrNotEnrolled
+	}
+	code = normalize(code)
+	return s.attempt(ctx, user.ID, func() (bool, error) {
+		if isTOTP(code) {
+			return s.checkTOTP(ctx, user, code)
+		}
+		err := s.codes.Use(ctx, user.ID, hashRecoveryCode(code), s.now())
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+}
+
+// RegenerateRecoveryCodes replaces user's recovery codes after checking
+// code as Verify does.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, user *models.User, code string) ([]string, error) {
+	if err := s.Verify(ctx, user, code); err != nil {
+		return nil, err
+	}
+	return s.replaceRecoveryCodes(ctx, user.ID)
+}
+
+// Disable turns off two-factor authentication for user after checking code
+// as Verify does.
+func (s *Service) Disable(ctx context.Context, user *models.User, code string) error {
+	if err := s.Verify(ctx, user, code); err != nil {
+		return err
+	}
+	if err := s.codes.Replace(ctx, user.ID, nil); err != nil {
+		return err
+	}
+	user.TOTPSecret = ""
+	user.TOTPEnabledAt = nil
+	return s.users.Update(ctx, user)
+}
+
+// RecoveryCodesRemaining counts the recovery codes a user has not used.
+func (s *Service) RecoveryCodesRemaining(ctx context.Context, userID uint) (int, error) {
+	return s.codes.Remaining(ctx, userID)
+}
+
+// attempt runs check unless the user is locked out, counting a failure if
+// it rejects the code and clearing the count if it accepts it.
+func (s *Service) attempt(ctx context.Context, userID uint, check func() (bool, error)) error {
+	key := failuresKey(userID)
+	failures, err := s.client.Get(ctx, key).Int()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	if failures >= maxFailures {
+		return ErrTooManyAttempts
+	}
+
+	ok, err := check()
+	if err != nil {
+		return err
+	}
+	if ok {
+		return s.client.Del(ctx, key).Err()
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, key)
+		pipe.ExpireNX(ctx, key, failureWindow)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return ErrInvalidCode
+}
+
+// checkTOTP validates code against user's secret and records it as used,
+// rejecting codes that were already accepted.
+func (s *Service) checkTOTP(ctx context.Context, user *models.User, code string) (bool, error) {
+	secret, err := s.cipher.Open(user.TOTPSecret)
+	if err != nil {
+		return false, fmt.Errorf("decrypting TOTP secret of user %d: %w", user.ID, err)
+	}
+	valid, err := totp.ValidateCustom(code, secret, s.now(), validateOpts)
+	if err != nil || !valid {
+		return false, nil
+	}
+	return s.client.SetNX(ctx, usedCodeKey(user.ID, code), 1, usedCodeTTL).Result()
+}
+
+// replaceRecoveryCodes gives a user a new set of recovery codes.
+func (s *Service) replaceRecoveryCodes(ctx context.Context, userID uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hashRecoveryCode(normalize(code))
+	}
+	if err := s.codes.Replace(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a random code of the form xxxxx-xxxxx.
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	max := big.NewInt(int64(len(recoveryAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = recoveryAlphabet[n.Int64()]
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+// normalize strips the separators and case differences people introduce
+// when typing codes.
+func normalize(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+}
+
+// isTOTP reports whether a normalized code looks like a TOTP code rather
+// than a recovery code.
+func isTOTP(code string) bool {
+	if len(code) != int(validateOpts.Digits) {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
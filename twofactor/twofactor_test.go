@@ -0,0 +1,167 @@
+package twofactor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/pageza/vet-app/apierr"
+	"github.com/pageza/vet-app/auth"
+	"github.com/pageza/vet-app/models"
+	"github.com/pageza/vet-app/repository"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+var ctx = context.Background()
+
+func setup(t *testing.T) (*Service, repository.Repositories, *models.User) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	cipher, err := GenerateCipher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos := repository.NewMemory()
+	user := &models.User{Name: "Jane Doe", Email: "jane@example.com"}
+	assert.NoError(t, repos.Users.Create(ctx, user))
+	return NewService(repos, client, cipher, "Vet App"), repos, user
+}
+
+// enable enrolls user and returns their secret and recovery codes.
+func enable(t *testing.T, s *Service, user *models.User) (string, []string) {
+	enrollment, err := s.Enroll(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := totp.GenerateCode(enrollment.Secret, s.now())
+	codes, err := s.Confirm(ctx, user, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enrollment.Secret, codes
+}
+
+func TestCipher(t *testing.T) {
+	c, err := GenerateCipher()
+	assert.NoError(t, err)
+	sealed, err := c.Seal("JBSWY3DPEHPK3PXP")
+	assert.NoError(t, err)
+	assert.NotContains(t, sealed, "JBSWY3DPEHPK3PXP")
+	opened, err := c.Open(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", opened)
+
+	other, _ := GenerateCipher()
+	_, err = other.Open(sealed)
+	assert.Error(t, err)
+
+	_, err = ParseCipher("c2hvcnQ=")
+	assert.Error(t, err)
+}
+
+func TestEnrollment(t *testing.T) {
+	s, repos, user := setup(t)
+
+	_, err := s.Confirm(ctx, user, "123456")
+	assert.ErrorIs(t, err, ErrNotEnrolled)
+
+	enrollment, err := s.Enroll(ctx, user)
+	assert.NoError(t, err)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/Vet%20App:jane@example.com")
+	stored, _ := repos.Users.Get(ctx, user.ID)
+	assert.NotEmpty(t, stored.TOTPSecret)
+	assert.NotContains(t, stored.TOTPSecret, enrollment.Secret)
+	assert.False(t, stored.TwoFactorEnabled())
+
+	_, err = s.Confirm(ctx, user, "000000")
+	assert.ErrorIs(t, err, ErrInvalidCode)
+
+	code, _ := totp.GenerateCode(enrollment.Secret, time.Now())
+	codes, err := s.Confirm(ctx, user, code)
+	assert.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+	assert.Regexp(t, `^[a-z0-9]{5}-[a-z0-9]{5}$`, codes[0])
+	stored, _ = repos.Users.Get(ctx, user.ID)
+	assert.True(t, stored.TwoFactorEnabled())
+
+	_, err = s.Enroll(ctx, user)
+	assert.ErrorIs(t, err, ErrAlreadyEnabled)
+}
+
+func TestVerify(t *testing.T) {
+	s, _, user := setup(t)
+	secret, codes := enable(t, s, user)
+
+	// The code used to confirm cannot be used again.
+	code, _ := totp.GenerateCode(secret, time.Now())
+	assert.ErrorIs(t, s.Verify(ctx, user, code), ErrInvalidCode)
+	code, _ = totp.GenerateCode(secret, time.Now().Add(30*time.Second))
+	assert.NoError(t, s.Verify(ctx, user, code))
+
+	// Recovery codes work once, however they are typed.
+	assert.NoError(t, s.Verify(ctx, user, " "+codes[0]+" "))
+	assert.ErrorIs(t, s.Verify(ctx, user, codes[0]), ErrInvalidCode)
+	remaining, err := s.RecoveryCodesRemaining(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, recoveryCodeCount-1, remaining)
+
+	fresh, err := s.RegenerateRecoveryCodes(ctx, user, codes[1])
+	assert.NoError(t, err)
+	assert.ErrorIs(t, s.Verify(ctx, user, codes[2]), ErrInvalidCode)
+	assert.NoError(t, s.Verify(ctx, user, fresh[0]))
+}
+
+func TestVerifyLocksOutAfterFailures(t *testing.T) {
+	s, _, user := setup(t)
+	_, codes := enable(t, s, user)
+
+	for i := 0; i < maxFailures; i++ {
+		assert.ErrorIs(t, s.Verify(ctx, user, "000000"), ErrInvalidCode)
+	}
+	assert.ErrorIs(t, s.Verify(ctx, user, codes[0]), ErrTooManyAttempts)
+}
+
+func TestDisable(t *testing.T) {
+	s, repos, user := setup(t)
+	_, codes := enable(t, s, user)
+
+	assert.ErrorIs(t, s.Disable(ctx, user, "wrong-code"), ErrInvalidCode)
+	assert.NoError(t, s.Disable(ctx, user, codes[0]))
+	stored, _ := repos.Users.Get(ctx, user.ID)
+	assert.False(t, stored.TwoFactorEnabled())
+	assert.Empty(t, stored.TOTPSecret)
+	remaining, _ := s.RecoveryCodesRemaining(ctx, user.ID)
+	assert.Zero(t, remaining)
+	assert.ErrorIs(t, s.Verify(ctx, user, codes[1]), ErrNotEnrolled)
+}
+
+func TestRequireStepUp(t *testing.T) {
+	enabled := time.Now()
+	user := &models.User{ID: 1, TOTPEnabledAt: &enabled}
+	h := RequireStepUp(10 * time.Minute)(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	serve := func(secondFactorAt time.Time) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("DELETE", "/users/2", nil)
+		ctx := auth.WithUser(req.Context(), user)
+		if !secondFactorAt.IsZero() {
+			ctx = auth.WithSecondFactor(ctx, secondFactorAt)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req.WithContext(ctx))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNoContent, serve(time.Now().Add(-time.Minute)).Code)
+	for _, at := range []time.Time{{}, time.Now().Add(-time.Hour)} {
+		rec := serve(at)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Body.String(), apierr.CodeStepUpRequired)
+	}
+}